@@ -0,0 +1,247 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/zk/txpool"
+	"github.com/ledgerwatch/erigon/zkevm/log"
+	"github.com/urfave/cli/v2"
+)
+
+var errDataDirNotSet = errors.New("data directory is not set")
+
+var (
+	name       string
+	effect     string
+	senders    string
+	to         string
+	selectors  string
+	maxValue   string
+	validFrom  string
+	validUntil string
+)
+
+var AddCommand = cli.Command{
+	Action: addRun,
+	Name:   "add-rule",
+	Usage:  "Add an ACL rule on the calls transactions make, replacing any rule with the same name",
+	Flags: []cli.Flag{
+		&utils.DataDirFlag,
+		&cli.StringFlag{
+			Name:        "name",
+			Usage:       "Name of the rule",
+			Required:    true,
+			Destination: &name,
+		},
+		&cli.StringFlag{
+			Name:        "effect",
+			Usage:       "Effect of the rule (allow or deny)",
+			Required:    true,
+			Destination: &effect,
+		},
+		&cli.StringFlag{
+			Name:        "senders",
+			Usage:       "Comma separated senders the rule applies to, all senders if empty",
+			Destination: &senders,
+		},
+		&cli.StringFlag{
+			Name:        "to",
+			Usage:       "Comma separated contract addresses the rule applies to, all destinations if empty",
+			Destination: &to,
+		},
+		&cli.StringFlag{
+			Name:        "selectors",
+			Usage:       "Comma separated 4-byte selectors or function signatures the rule applies to, all calls if empty",
+			Destination: &selectors,
+		},
+		&cli.StringFlag{
+			Name:        "max-value",
+			Usage:       "Value cap in wei, allow rules only allow calls up to it and deny rules only deny calls above it",
+			Destination: &maxValue,
+		},
+		&cli.StringFlag{
+			Name:        "valid-from",
+			Usage:       "Time the rule starts to apply (RFC3339)",
+			Destination: &validFrom,
+		},
+		&cli.StringFlag{
+			Name:        "valid-until",
+			Usage:       "Time the rule stops applying (RFC3339)",
+			Destination: &validUntil,
+		},
+	},
+}
+
+var RemoveCommand = cli.Command{
+	Action: removeRun,
+	Name:   "remove-rule",
+	Usage:  "Remove an ACL rule",
+	Flags: []cli.Flag{
+		&utils.DataDirFlag,
+		&cli.StringFlag{
+			Name:        "name",
+			Usage:       "Name of the rule",
+			Required:    true,
+			Destination: &name,
+		},
+	},
+}
+
+// addRun is the entry point for the add-rule command
+func addRun(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errDataDirNotSet
+	}
+
+	rule, err := buildRule(name, effect, senders, to, selectors, maxValue, validFrom, validUntil)
+	if err != nil {
+		log.Error("Invalid rule", "err", err)
+		return err
+	}
+
+	dataDir := cliCtx.String(utils.DataDirFlag.Name)
+
+	log.Info("Adding ACL rule", "dataDir", dataDir, "name", rule.Name)
+
+	aclDB, err := txpool.OpenACLDB(cliCtx.Context, dataDir)
+	if err != nil {
+		log.Error("Failed to open ACL database", "err", err)
+		return err
+	}
+
+	if err := txpool.AddRule(cliCtx.Context, aclDB, rule); err != nil {
+		log.Error("Failed to add rule", "err", err)
+		return err
+	}
+
+	log.Info("Rule added", "name", rule.Name)
+
+	return nil
+}
+
+// removeRun is the entry point for the remove-rule command
+func removeRun(cliCtx *cli.Context) error {
+	if !cliCtx.IsSet(utils.DataDirFlag.Name) {
+		return errDataDirNotSet
+	}
+
+	dataDir := cliCtx.String(utils.DataDirFlag.Name)
+
+	log.Info("Removing ACL rule", "dataDir", dataDir, "name", name)
+
+	aclDB, err := txpool.OpenACLDB(cliCtx.Context, dataDir)
+	if err != nil {
+		log.Error("Failed to open ACL database", "err", err)
+		return err
+	}
+
+	if err := txpool.RemoveRule(cliCtx.Context, aclDB, name); err != nil {
+		log.Error("Failed to remove rule", "err", err)
+		return err
+	}
+
+	log.Info("Rule removed", "name", name)
+
+	return nil
+}
+
+// buildRule turns the command line flags into a rule
+func buildRule(name, effect, senders, to, selectors, maxValue, validFrom, validUntil string) (txpool.Rule, error) {
+	ruleEffect, err := txpool.ResolveRuleEffect(effect)
+	if err != nil {
+		return txpool.Rule{}, err
+	}
+
+	rule := txpool.Rule{
+		Name:   name,
+		Effect: ruleEffect,
+	}
+	if rule.Senders, err = parseAddresses(senders); err != nil {
+		return txpool.Rule{}, err
+	}
+	if rule.To, err = parseAddresses(to); err != nil {
+		return txpool.Rule{}, err
+	}
+
+	for _, s := range splitList(selectors) {
+		selector, err := txpool.ParseSelector(s)
+		if err != nil {
+			return txpool.Rule{}, err
+		}
+		rule.Selectors = append(rule.Selectors, selector)
+	}
+
+	if maxValue != "" {
+		value, ok := new(big.Int).SetString(maxValue, 10)
+		if !ok {
+			return txpool.Rule{}, fmt.Errorf("invalid max value %q", maxValue)
+		}
+		rule.MaxValue = value
+	}
+
+	if rule.ValidFrom, err = parseTime(validFrom); err != nil {
+		return txpool.Rule{}, err
+	}
+	if rule.ValidUntil, err = parseTime(validUntil); err != nil {
+		return txpool.Rule{}, err
+	}
+
+	return rule, rule.Validate()
+}
+
+func parseAddresses(s string) ([]common.Address, error) {
+	var addrs []common.Address
+	for _, a := range splitList(s) {
+		if !common.IsHexAddress(a) {
+			return nil, fmt.Errorf("invalid address %q", a)
+		}
+		addrs = append(addrs, common.HexToAddress(a))
+	}
+	return addrs, nil
+}
+
+func parseTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	return &t, nil
+}
+
+// splitList splits on the commas that aren't inside a function signature's parentheses
+func splitList(s string) []string {
+	var (
+		result []string
+		depth  int
+		start  int
+	)
+	add := func(item string) {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	add(s[start:])
+	return result
+}
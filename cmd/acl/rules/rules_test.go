@@ -0,0 +1,48 @@
+package rules
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/txpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitList(t *testing.T) {
+	require.Equal(t, []string{"0xa9059cbb", "transfer(address,uint256)", "pause()"}, splitList(" 0xa9059cbb, transfer(address,uint256) ,pause(),"))
+	require.Empty(t, splitList(""))
+}
+
+func TestBuildRule(t *testing.T) {
+	sender1, sender2 := "0x00000000000000000000000000000000000000ad", "0x00000000000000000000000000000000000000be"
+	bridge := "0x00000000000000000000000000000000000b1d6e"
+	rule, err := buildRule("bridge", "allow", sender1+","+sender2, bridge, "pause(),0xa9059cbb", "1000", "2024-01-01T00:00:00Z", "2025-01-01T00:00:00Z")
+	require.NoError(t, err)
+
+	pause, _ := txpool.ParseSelector("pause()")
+	transfer, _ := txpool.ParseSelector("0xa9059cbb")
+	require.Equal(t, "bridge", rule.Name)
+	require.Equal(t, txpool.RuleAllow, rule.Effect)
+	require.Equal(t, []common.Address{common.HexToAddress(sender1), common.HexToAddress(sender2)}, rule.Senders)
+	require.Equal(t, []common.Address{common.HexToAddress(bridge)}, rule.To)
+	require.Equal(t, []txpool.Selector{pause, transfer}, rule.Selectors)
+	require.Equal(t, big.NewInt(1000), rule.MaxValue)
+	require.NotNil(t, rule.ValidFrom)
+	require.NotNil(t, rule.ValidUntil)
+
+	_, err = buildRule("bridge", "maybe", "", "", "", "", "", "")
+	require.Error(t, err)
+
+	// a mistyped address mustn't turn into some other address
+	_, err = buildRule("bridge", "deny", "0xad", "", "", "", "", "")
+	require.ErrorContains(t, err, `invalid address "0xad"`)
+	_, err = buildRule("bridge", "deny", "", bridge+"zz", "", "", "", "")
+	require.Error(t, err)
+
+	_, err = buildRule("bridge", "deny", "", "", "", "lots", "", "")
+	require.Error(t, err)
+
+	_, err = buildRule("bridge", "deny", "", "", "", "", "2025-01-01T00:00:00Z", "2024-01-01T00:00:00Z")
+	require.Error(t, err)
+}
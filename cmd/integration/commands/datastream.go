@@ -21,6 +21,7 @@ import (
 	"github.com/ledgerwatch/erigon/params"
 	"github.com/ledgerwatch/erigon/turbo/debug"
 	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	dstypes "github.com/ledgerwatch/erigon/zk/datastream/types"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/spf13/cobra"
 )
@@ -60,6 +61,74 @@ func init() {
 	rootCmd.AddCommand(datastream)
 }
 
+var datastreamCompact = &cobra.Command{
+	Use: "datastream_compact",
+	Short: `start the datastream over at a batch, archiving the batches before it.
+Examples:
+datastream_compact --datadir=/datadirs/hermez-mainnet --batch=1000 --chain=hermez-bali --archive-dir=/archive/hermez-mainnet # stream from batch 1000
+		`,
+	Example: "go run ./cmd/integration datastream_compact --datadir=... --batch 1000",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common2.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+		db, err := openDB(dbCfg(kv.ChainDB, chaindata), true, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer db.Close()
+
+		if err := compactDatastream(ctx, db, logger); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+	},
+}
+
+func init() {
+	withConfig(datastreamCompact)
+	withChain(datastreamCompact)
+	withDataDir2(datastreamCompact)
+	withDsCompact(datastreamCompact)
+	rootCmd.AddCommand(datastreamCompact)
+}
+
+// compactDatastream starts the stream over at the batch set in the compactBatchNo flag (package global), its first
+// block is checked against the db and the compacted file is opened with the stream library before it is reported done
+func compactDatastream(ctx context.Context, db kv.RwDB, logger log.Logger) error {
+	dsFileName := path.Join(datadirCli, "data-stream")
+	archiveDir := compactArchiveDir
+	if archiveDir == "" {
+		archiveDir = path.Join(datadirCli, "data-stream-archive")
+	}
+
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := server.CompactStream(dsFileName, compactBatchNo, archiveDir, func(block *dstypes.FullL2Block) error {
+		return server.VerifyStreamBlock(tx, block)
+	})
+	if err != nil {
+		return err
+	}
+
+	stream, err := datastreamer.NewServer(0, 0, 1, datastreamer.StreamType(1), dsFileName, 1, 2, 3, nil)
+	if err != nil {
+		return fmt.Errorf("opening the compacted stream: %w", err)
+	}
+	if header := stream.GetHeader(); header.TotalEntries != result.Entries || header.TotalLength != result.Length {
+		return fmt.Errorf("the compacted stream has %d entries in %d bytes, expected %d in %d", header.TotalEntries, header.TotalLength, result.Entries, result.Length)
+	}
+
+	logger.Info("Compacted the datastream", "batch", compactBatchNo, "firstBlock", result.FirstBlock.L2BlockNumber, "stateRoot", result.FirstBlock.StateRoot, "entries", result.Entries, "archived", path.Join(archiveDir, result.Archived.File), "archivedEntries", result.Archived.Entries)
+	return nil
+}
+
 // unwindZk unwinds to the batch number set in the unwindBatchNo flag (package global)
 func unwindDatastream(ctx context.Context, db kv.RwDB, logger log.Logger) error {
 	fmt.Println(datadirCli, unwindDsBlockNo)
@@ -75,6 +144,7 @@ func unwindDatastream(ctx context.Context, db kv.RwDB, logger log.Logger) error
 		2,
 		3,
 		nil,
+		nil,
 	)
 	if err != nil {
 		fmt.Println("unwindDatastream", "error", err)
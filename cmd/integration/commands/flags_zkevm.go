@@ -14,3 +14,41 @@ func withUnwindBatchNo(cmd *cobra.Command) {
 func withDsUnwindBlockNumber(cmd *cobra.Command) {
 	cmd.Flags().Uint64Var(&unwindDsBlockNo, "unwind-block-no", 0, "block number to unwind to (this block number will be the tip)")
 }
+
+var (
+	compactBatchNo    uint64
+	compactArchiveDir string
+)
+
+func withDsCompact(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&compactBatchNo, "batch", 0, "batch number the stream starts at after the compaction")
+	must(cmd.MarkFlagRequired("batch"))
+	cmd.Flags().StringVar(&compactArchiveDir, "archive-dir", "", "directory the batches before it are archived to, data-stream-archive in the datadir when empty")
+}
+
+var (
+	witnessBatchNo     uint64
+	witnessFile        string
+	witnessCompareFile string
+	witnessFull        bool
+	witnessExecutorUrl string
+)
+
+func withWitnessValidation(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&witnessBatchNo, "batch", 0, "batch number the witness is for")
+	must(cmd.MarkFlagRequired("batch"))
+	cmd.Flags().StringVar(&witnessFile, "witness", "", "file holding the witness to validate, hex or binary, generated from the datadir if empty")
+	cmd.Flags().StringVar(&witnessCompareFile, "compare", "", "file holding a witness of the same batch from another node to diff against, a full witness is generated from the datadir if empty")
+	cmd.Flags().BoolVar(&witnessFull, "witness-full", false, "generate a full witness rather than a trimmed one when no witness file is given")
+	cmd.Flags().StringVar(&witnessExecutorUrl, "executor", "", "grpc url of an executor to also verify the batch with the witness against")
+}
+
+var (
+	smtCheckMode   string
+	smtCheckRepair bool
+)
+
+func withSmtCheck(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&smtCheckMode, "mode", "hashes", "what to check: hashes to verify every node hash from the root, plainstate to also compare the leaves with the plain state, orphans to also list the nodes not reachable from the root")
+	cmd.Flags().BoolVar(&smtCheckRepair, "repair", false, "rebuild the sub-trees holding the issues found from the plain state and commit them when the new root matches the header")
+}
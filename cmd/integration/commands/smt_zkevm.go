@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	common2 "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	db2 "github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/turbo/debug"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	stages3 "github.com/ledgerwatch/erigon/zk/stages"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+const (
+	smtCheckHashes     = "hashes"
+	smtCheckPlainState = "plainstate"
+	smtCheckOrphans    = "orphans"
+
+	// how many orphaned nodes are printed, the rest are only counted
+	smtCheckOrphansPrinted = 20
+)
+
+var smtCheck = &cobra.Command{
+	Use: "smt_check",
+	Short: `check the integrity of the SMT and repair it in place.
+Walks the tree from the stored root verifying every node is there and hashes to its key, optionally comparing the leaves
+with the plain state or listing the stored nodes not reachable from the root. With --repair the sub-trees holding the
+issues are rebuilt from the plain state, the rest of the tree is kept, and the change is committed only when the new
+root matches the header root at the IntermediateHashes progress.
+Orphaned nodes are only reported: value nodes are left behind by design and the SMT history reads old nodes.
+Examples:
+smt_check --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --mode=plainstate
+smt_check --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --mode=plainstate --repair
+		`,
+	Example: "go run ./cmd/integration smt_check --config=... --mode=orphans",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common2.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+		db, err := openDB(dbCfg(kv.ChainDB, chaindata), true, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer db.Close()
+
+		if err := checkSmt(ctx, db, logger); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+	},
+}
+
+func init() {
+	withConfig(smtCheck)
+	withChain(smtCheck)
+	withDataDir2(smtCheck)
+	withSmtCheck(smtCheck)
+	rootCmd.AddCommand(smtCheck)
+}
+
+func checkSmt(ctx context.Context, chainDb kv.RwDB, logger log.Logger) error {
+	switch smtCheckMode {
+	case smtCheckHashes, smtCheckPlainState, smtCheckOrphans:
+	default:
+		return fmt.Errorf("unknown mode %q, expected %s, %s or %s", smtCheckMode, smtCheckHashes, smtCheckPlainState, smtCheckOrphans)
+	}
+
+	tx, err := chainDb.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hashesProgress, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return err
+	}
+	executionProgress, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return err
+	}
+	usesPlainState := smtCheckMode == smtCheckPlainState || smtCheckRepair
+	if usesPlainState && hashesProgress != executionProgress {
+		return fmt.Errorf("the tree is at block %d and the plain state at block %d, run the stages until they match first", hashesProgress, executionProgress)
+	}
+
+	eridb := db2.NewEriDb(tx)
+	s := smt.NewSMT(eridb, false)
+	trackVisited := smtCheckMode == smtCheckOrphans
+
+	var check *smt.TreeCheck
+	if smtCheckMode == smtCheckPlainState {
+		check, err = stages3.CheckSmtAgainstPlainState(ctx, "smt_check", tx, s.RoSMT, trackVisited)
+	} else {
+		check, err = s.CheckTree(ctx, "smt_check", trackVisited, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	root := common2.BigToHash(check.Root.ToBigInt())
+	logger.Info("Checked the tree", "block", hashesProgress, "root", root, "branches", check.Branches, "leaves", check.Leaves, "issues", len(check.Issues))
+	if header := rawdb.ReadHeaderByNumber(tx, hashesProgress); header != nil && header.Root != root {
+		logger.Warn("Stored root doesn't match the header", "block", hashesProgress, "root", root, "header", header.Root)
+	}
+	for _, issue := range check.Issues {
+		fmt.Println(issue)
+	}
+
+	if smtCheckMode == smtCheckOrphans {
+		orphans := 0
+		if err := s.ForEachOrphanedNode(check, func(key utils.NodeKey) error {
+			if orphans < smtCheckOrphansPrinted {
+				fmt.Println("orphaned node", utils.ConvertBigIntToHex(key.ToBigInt()))
+			}
+			orphans++
+			return nil
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("orphaned nodes: %d\n", orphans)
+	}
+
+	if !smtCheckRepair || len(check.Issues) == 0 {
+		return nil
+	}
+
+	newRoot, err := stages3.RepairSmt(ctx, "smt_check", tx, eridb, s, check.Issues)
+	if err != nil {
+		return err
+	}
+	header := rawdb.ReadHeaderByNumber(tx, hashesProgress)
+	if header == nil {
+		return fmt.Errorf("header %d not found to verify the repaired root", hashesProgress)
+	}
+	if newRoot != header.Root {
+		return fmt.Errorf("repaired root %s doesn't match the header root %s at block %d, nothing was committed", newRoot, header.Root, hashesProgress)
+	}
+
+	if err := hermez_db.NewHermezDb(tx).WriteSmtDepth(hashesProgress, uint64(s.GetDepth())); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info("Repaired the tree", "block", hashesProgress, "root", newRoot)
+	return nil
+}
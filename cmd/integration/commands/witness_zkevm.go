@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	common2 "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/datadir"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/kvcfg"
+	"github.com/ledgerwatch/erigon/cmd/hack/tool/fromdb"
+	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/turbo/debug"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/ledgerwatch/erigon/zk/witness"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/spf13/cobra"
+)
+
+var witnessValidate = &cobra.Command{
+	Use: "witness_validate",
+	Short: `validate the witness of a batch offline.
+Re-derives the state root from the SMT nodes of the witness and compares it with the root stored for the end of the
+previous batch, then reports the account, storage and code nodes the witness is missing or has on top of a full witness
+of the batch, or of a witness of the same batch taken from another node.
+Examples:
+witness_validate --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --batch=100 # generated trimmed witness against a full one
+witness_validate --datadir=/datadirs/hermez-mainnet --chain=hermez-mainnet --batch=100 --witness=ours.hex --compare=theirs.hex
+		`,
+	Example: "go run ./cmd/integration witness_validate --config=... --batch=100 --executor=localhost:50071",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, _ := common2.RootContext()
+		logger := debug.SetupCobra(cmd, "integration")
+		db, err := openDB(dbCfg(kv.ChainDB, chaindata), true, logger)
+		if err != nil {
+			logger.Error("Opening DB", "error", err)
+			return
+		}
+		defer db.Close()
+
+		if err := validateWitness(ctx, db, logger); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Error(err.Error())
+			}
+			return
+		}
+	},
+}
+
+func init() {
+	withConfig(witnessValidate)
+	withChain(witnessValidate)
+	withDataDir2(witnessValidate)
+	withWitnessValidation(witnessValidate)
+	rootCmd.AddCommand(witnessValidate)
+}
+
+func validateWitness(ctx context.Context, db kv.RwDB, logger log.Logger) error {
+	if witnessBatchNo == 0 {
+		return errors.New("batch 0 has no witness")
+	}
+
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	chainConfig := fromdb.ChainConfig(db)
+	dirs := datadir.New(datadirCli)
+	br, _ := blocksIO(db, logger)
+	engine, _ := initConsensusEngine(ctx, chainConfig, dirs.DataDir, db, br, logger)
+	_, _, agg := allSnapshots(ctx, db, logger)
+
+	zkConfig := &ethconfig.Zk{
+		WitnessMemdbSize:   datasize.ByteSize(utils.WitnessMemdbSize.Value),
+		WitnessUnwindLimit: utils.WitnessUnwindLimit.Value,
+	}
+	generator := witness.NewGenerator(dirs, kvcfg.HistoryV3.FromDB(db), agg, br, chainConfig, zkConfig, engine, nil, zkConfig.WitnessUnwindLimit)
+
+	var data []byte
+	if witnessFile != "" {
+		if data, err = readWitnessFile(witnessFile); err != nil {
+			return err
+		}
+	} else {
+		logger.Info("Generating witness", "batch", witnessBatchNo, "full", witnessFull)
+		if data, err = generator.GetWitnessByBatch(tx, ctx, witnessBatchNo, false, witnessFull); err != nil {
+			return err
+		}
+	}
+	w, err := witness.ParseWitness(data)
+	if err != nil {
+		return fmt.Errorf("parse witness: %w", err)
+	}
+
+	root, err := witness.WitnessRoot(w)
+	if err != nil {
+		return fmt.Errorf("derive witness root: %w", err)
+	}
+	expectedRoot, blockNo, err := witness.PreBatchStateRoot(tx, witnessBatchNo)
+	if err != nil {
+		return err
+	}
+	if root == expectedRoot {
+		logger.Info("Witness root matches", "batch", witnessBatchNo, "block", blockNo, "root", root)
+	} else {
+		logger.Error("Witness root mismatch", "batch", witnessBatchNo, "block", blockNo, "witness", root, "expected", expectedRoot)
+	}
+
+	var reference *trie.Witness
+	if witnessCompareFile != "" {
+		referenceData, err := readWitnessFile(witnessCompareFile)
+		if err != nil {
+			return err
+		}
+		if reference, err = witness.ParseWitness(referenceData); err != nil {
+			return fmt.Errorf("parse witness to compare: %w", err)
+		}
+	} else {
+		logger.Info("Generating full witness to compare", "batch", witnessBatchNo)
+		referenceData, err := generator.GetWitnessByBatch(tx, ctx, witnessBatchNo, false, true)
+		if err != nil {
+			return err
+		}
+		if reference, err = witness.ParseWitness(referenceData); err != nil {
+			return fmt.Errorf("parse full witness: %w", err)
+		}
+	}
+	printWitnessDiff(witness.DiffWitnesses(w, reference))
+
+	if witnessExecutorUrl != "" {
+		return verifyWitnessWithExecutor(tx, chainConfig.ChainID.Uint64(), data)
+	}
+	return nil
+}
+
+// readWitnessFile reads a witness saved as a 0x prefixed hex string, like the executor output and the RPC return it, or
+// as raw bytes
+func readWitnessFile(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("0x")) {
+		return data, nil
+	}
+	decoded, err := hex.DecodeString(string(trimmed[2:]))
+	if err != nil {
+		return nil, fmt.Errorf("decode witness %s: %w", file, err)
+	}
+	return decoded, nil
+}
+
+func printWitnessDiff(diff *witness.Diff) {
+	if diff.Empty() {
+		fmt.Println("witness holds the same account, storage and code nodes as the reference")
+		return
+	}
+	fmt.Printf("missing nodes: %d, extra nodes: %d, mismatched nodes: %d\n", len(diff.Missing), len(diff.Extra), len(diff.Mismatched))
+	for _, node := range diff.Missing {
+		fmt.Println("missing", node)
+	}
+	for _, node := range diff.Extra {
+		fmt.Println("extra", node)
+	}
+	for _, mismatch := range diff.Mismatched {
+		fmt.Printf("mismatched %s, reference 0x%x\n", mismatch.Node, mismatch.Reference)
+	}
+}
+
+// verifyWitnessWithExecutor sends the batch with the witness to the executor the way the verifier stage does
+func verifyWitnessWithExecutor(tx kv.Tx, chainId uint64, data []byte) error {
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	blockNumbers, err := hermezDb.GetL2BlockNosByBatch(witnessBatchNo)
+	if err != nil {
+		return err
+	}
+	if len(blockNumbers) == 0 {
+		return fmt.Errorf("no blocks found for batch %d", witnessBatchNo)
+	}
+	forkId, err := hermezDb.GetForkId(witnessBatchNo)
+	if err != nil {
+		return err
+	}
+
+	blocks := make([]types.Block, 0, len(blockNumbers))
+	txsPerBlock := make(map[uint64][]types.Transaction)
+	for _, blockNumber := range blockNumbers {
+		block, err := rawdb.ReadBlockByNumber(tx, blockNumber)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return fmt.Errorf("block %d not found", blockNumber)
+		}
+		blocks = append(blocks, *block)
+		txsPerBlock[blockNumber] = block.Transactions()
+	}
+	previousHeader := rawdb.ReadHeaderByNumber(tx, blockNumbers[0]-1)
+	if previousHeader == nil {
+		return fmt.Errorf("block %d not found", blockNumbers[0]-1)
+	}
+
+	l1InfoTreeMinTimestamps := make(map[uint64]uint64)
+	entries, err := server.BuildWholeBatchStreamEntriesProto(tx, hermezDb, chainId, witnessBatchNo-1, witnessBatchNo, blocks, txsPerBlock, l1InfoTreeMinTimestamps)
+	if err != nil {
+		return err
+	}
+	streamBytes, err := entries.Marshal()
+	if err != nil {
+		return err
+	}
+
+	lastBlock := blocks[len(blocks)-1]
+	payload := &legacy_executor_verifier.Payload{
+		Witness:                 data,
+		DataStream:              streamBytes,
+		Coinbase:                lastBlock.Coinbase().String(),
+		OldAccInputHash:         common2.Hash{}.Bytes(),
+		TimestampLimit:          lastBlock.Time(),
+		ForcedBlockhashL1:       []byte{0},
+		ContextId:               strconv.FormatUint(witnessBatchNo, 10),
+		L1InfoTreeMinTimestamps: l1InfoTreeMinTimestamps,
+	}
+	request := legacy_executor_verifier.NewVerifierRequest(forkId, witnessBatchNo, blockNumbers, lastBlock.Root(), nil)
+
+	e := legacy_executor_verifier.NewExecutor(witnessExecutorUrl, 10*time.Second, 1, "", 0, 0)
+	defer e.Close()
+	ok, _, executorErr, err := e.Verify(payload, request, previousHeader.Root)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("executor rejected batch %d: %w", witnessBatchNo, executorErr)
+	}
+	fmt.Println("executor accepted the batch with the witness")
+	return nil
+}
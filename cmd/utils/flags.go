@@ -415,11 +415,36 @@ var (
 		Usage: "L2 datastreamer endpoint",
 		Value: "",
 	}
+	L2DataStreamerFallbackUrlsFlag = cli.StringFlag{
+		Name:  "zkevm.l2-datastreamer-fallback-urls",
+		Usage: "Comma separated datastream servers the client fails over to, in order, when the L2 datastreamer endpoint is unreachable. Other RPC nodes re-serving the stream can be listed",
+		Value: "",
+	}
 	L2DataStreamerUseTLSFlag = cli.BoolFlag{
 		Name:  "zkevm.l2-datastreamer-use-tls",
 		Usage: "Use TLS connection to L2 datastreamer endpoint",
 		Value: false,
 	}
+	L2DataStreamerTLSCertFlag = cli.StringFlag{
+		Name:  "zkevm.l2-datastreamer-tls-cert",
+		Usage: "Client certificate presented to L2 datastreamer endpoints requiring mutual TLS, turns TLS on",
+		Value: "",
+	}
+	L2DataStreamerTLSKeyFlag = cli.StringFlag{
+		Name:  "zkevm.l2-datastreamer-tls-key",
+		Usage: "Key of the client certificate presented to the L2 datastreamer endpoints",
+		Value: "",
+	}
+	L2DataStreamerTLSCAFlag = cli.StringFlag{
+		Name:  "zkevm.l2-datastreamer-tls-ca",
+		Usage: "CA the certificate of the L2 datastreamer endpoints is verified against instead of the system roots, turns TLS on",
+		Value: "",
+	}
+	L2DataStreamerTokenFileFlag = cli.StringFlag{
+		Name:  "zkevm.l2-datastreamer-token-file",
+		Usage: "File holding the token sent to L2 datastreamer endpoints requiring token authentication",
+		Value: "",
+	}
 	L2DataStreamerTimeout = cli.StringFlag{
 		Name:  "zkevm.l2-datastreamer-timeout",
 		Usage: "The time to wait for data to arrive from the stream before reporting an error (0s doesn't check)",
@@ -450,6 +475,16 @@ var (
 		Usage: "Ethereum L1 RPC endpoint",
 		Value: "",
 	}
+	L1RpcWeightsFlag = cli.StringFlag{
+		Name:  "zkevm.l1-rpc-weights",
+		Usage: "Comma separated weights for the endpoints in zkevm.l1-rpc-url, in the same order. Endpoints are picked in proportion to their weight, scaled down by their latency, and are ejected with a backoff while failing. Defaults to an equal weight for all",
+		Value: "",
+	}
+	L1WsUrlFlag = cli.StringFlag{
+		Name:  "zkevm.l1-ws-url",
+		Usage: "Ethereum L1 websocket endpoint, when set the L1 syncers follow new L1 logs with eth_subscribe once caught up and fall back to polling on disconnect. Requires zkevm.l1-highest-block-type=latest",
+		Value: "",
+	}
 	L1CacheEnabledFlag = cli.BoolFlag{
 		Name:  "zkevm.l1-cache-enabled",
 		Usage: "Enable the L1 cache",
@@ -460,6 +495,36 @@ var (
 		Usage: "The port used for the L1 cache",
 		Value: 6969,
 	}
+	L1CacheMethodTTLsFlag = cli.StringFlag{
+		Name:  "zkevm.l1-cache-method-ttls",
+		Usage: "Comma separated list of method=duration pairs setting how long the L1 cache keeps responses for a JSON-RPC method, methods not listed never expire",
+		Value: "eth_blockNumber=12s,eth_gasPrice=12s,eth_maxPriorityFeePerGas=12s,eth_feeHistory=12s",
+	}
+	L1CacheTagTTLFlag = cli.DurationFlag{
+		Name:  "zkevm.l1-cache-tag-ttl",
+		Usage: "How long the L1 cache keeps responses to requests using a block tag such as latest or finalized",
+		Value: 12 * time.Second,
+	}
+	L1CacheUnfinalizedTTLFlag = cli.DurationFlag{
+		Name:  "zkevm.l1-cache-unfinalized-ttl",
+		Usage: "How long the L1 cache keeps eth_getLogs and eth_getBlockByNumber responses about blocks above the finalized L1 block",
+		Value: 1 * time.Minute,
+	}
+	L1CacheMaxSizeFlag = DatasizeFlag{
+		Name:  "zkevm.l1-cache-max-size",
+		Usage: "The size the L1 cache is kept under by evicting the least recently used entries in format \"1GB\", 0 for unlimited",
+		Value: datasizeFlagValue(1 * datasize.GB),
+	}
+	L1ArchiveReplayFlag = cli.StringFlag{
+		Name:  "zkevm.l1-archive-replay",
+		Usage: "Path to an L1 archive recorded with zkevm.l1-archive-record or imported from the l1-sequences-downloader, when set the L1 syncers read from the archive instead of the L1 RPC and fail on anything it doesn't hold",
+		Value: "",
+	}
+	L1ArchiveRecordFlag = cli.StringFlag{
+		Name:  "zkevm.l1-archive-record",
+		Usage: "Path to append everything the L1 syncers fetch from the L1 RPC to, for replaying later with zkevm.l1-archive-replay",
+		Value: "",
+	}
 	AddressSequencerFlag = cli.StringFlag{
 		Name:  "zkevm.address-sequencer",
 		Usage: "Sequencer address",
@@ -503,7 +568,7 @@ var (
 	}
 	L1HighestBlockTypeFlag = cli.StringFlag{
 		Name:  "zkevm.l1-highest-block-type",
-		Usage: "The type of the highest block in the L1 chain. latest, safe, or finalized",
+		Usage: "The type of the highest block in the L1 chain. latest, safe, or finalized. With latest or safe the L1 sequences, verifications and info tree updates are unwound and fetched again when the L1 reorgs",
 		Value: "finalized",
 	}
 	L1MaticContractAddressFlag = cli.StringFlag{
@@ -546,6 +611,21 @@ var (
 		Usage: "Regenerate the SMT in memory (requires a lot of RAM for most chains)",
 		Value: false,
 	}
+	SmtRegenerateWorkers = cli.IntFlag{
+		Name:  "zkevm.smt-regenerate-workers",
+		Usage: "Number of goroutines hashing sub-trees in parallel when the SMT is rebuilt, 0 uses all cores and 1 keeps the sequential build",
+		Value: 0,
+	}
+	SmtHistoryBlocksFlag = cli.Uint64Flag{
+		Name:  "zkevm.smt-history-blocks",
+		Usage: "Keep the SMT nodes of this many past blocks so zkevm_getProof can serve them without unwinding, 0 disables the history",
+		Value: 0,
+	}
+	SmtHistoryCheckpointIntervalFlag = cli.Uint64Flag{
+		Name:  "zkevm.smt-history-checkpoint-interval",
+		Usage: "Materialise the SMT at least every this many blocks while syncing, historical proofs between checkpoints unwind from the next one",
+		Value: 100,
+	}
 	SequencerBlockSealTime = cli.StringFlag{
 		Name:  "zkevm.sequencer-block-seal-time",
 		Usage: "Block seal time. Defaults to 6s",
@@ -606,6 +686,16 @@ var (
 		Usage: "The timeout for the executor request",
 		Value: 60 * time.Second,
 	}
+	ExecutorBreakerFailureThreshold = cli.IntFlag{
+		Name:  "zkevm.executor-breaker-failure-threshold",
+		Usage: "How many requests in a row an executor may fail before it stops being sent work for the cooldown",
+		Value: 3,
+	}
+	ExecutorBreakerCooldown = cli.DurationFlag{
+		Name:  "zkevm.executor-breaker-cooldown",
+		Usage: "How long a failing executor is left alone before it is sent a single trial request",
+		Value: 30 * time.Second,
+	}
 	DatastreamNewBlockTimeout = cli.DurationFlag{
 		Name:  "zkevm.datastream-new-block-timeout",
 		Usage: "The timeout for the executor request",
@@ -622,6 +712,16 @@ var (
 		Usage: "The maximum number of blocks the witness generation can unwind",
 		Value: 500_000,
 	}
+	WitnessCacheSize = DatasizeFlag{
+		Name:  "zkevm.witness-cache-size",
+		Usage: "Size of the persistent cache RPC nodes fill with the witnesses of closed batches in the background and sequencers keep the witnesses of pending verifications in, in format \"10GB\". 0 disables the cache",
+		Value: datasizeFlagValue(0),
+	}
+	WitnessCacheInterval = cli.DurationFlag{
+		Name:  "zkevm.witness-cache-interval",
+		Usage: "How often the witness cache checks for newly closed batches",
+		Value: 10 * time.Second,
+	}
 
 	ExecutorMaxConcurrentRequests = cli.IntFlag{
 		Name:  "zkevm.executor-max-concurrent-requests",
@@ -668,6 +768,61 @@ var (
 		Usage: "Define the inactivity check interval timeout when interacting with a data stream server",
 		Value: 5 * time.Minute,
 	}
+	DataStreamInternalPort = cli.UintFlag{
+		Name:  "zkevm.data-stream-internal-port",
+		Usage: "Port the data stream server listens on behind the gateway enforcing the data stream TLS, tokens, allowlist and connection limit. The gateway listens on zkevm.data-stream-port, the data stream server listens on all the interfaces so this port has to be firewalled",
+		Value: 0,
+	}
+	DataStreamTLSCert = cli.StringFlag{
+		Name:  "zkevm.data-stream-tls-cert",
+		Usage: "Certificate the data stream gateway terminates TLS with",
+		Value: "",
+	}
+	DataStreamTLSKey = cli.StringFlag{
+		Name:  "zkevm.data-stream-tls-key",
+		Usage: "Key of the data stream gateway certificate",
+		Value: "",
+	}
+	DataStreamClientCA = cli.StringFlag{
+		Name:  "zkevm.data-stream-client-ca",
+		Usage: "CA the data stream clients must present a certificate signed by (mutual TLS), needs the gateway certificate",
+		Value: "",
+	}
+	DataStreamTokensFile = cli.StringFlag{
+		Name:  "zkevm.data-stream-tokens-file",
+		Usage: "File holding the tokens, one per line, data stream clients must authenticate with one of them",
+		Value: "",
+	}
+	DataStreamAllowlist = cli.StringFlag{
+		Name:  "zkevm.data-stream-allowlist",
+		Usage: "Comma separated IPs or CIDRs the data stream clients must connect from, empty allows all",
+		Value: "",
+	}
+	DataStreamMaxClientConnections = cli.IntFlag{
+		Name:  "zkevm.data-stream-max-client-connections",
+		Usage: "Connections a data stream client IP can have open at once, 0 doesn't limit",
+		Value: 0,
+	}
+	DataStreamCompactKeepBatches = cli.Uint64Flag{
+		Name:  "zkevm.data-stream-compact-keep-batches",
+		Usage: "Compact the data stream once it holds twice this many batches, starting it over with the latest ones and archiving the others. The archive is served by the gateway, so zkevm.data-stream-internal-port has to be set. 0 doesn't compact",
+		Value: 0,
+	}
+	DataStreamCompactInterval = cli.DurationFlag{
+		Name:  "zkevm.data-stream-compact-interval",
+		Usage: "How often a running node archives the batches the data stream compaction on the next start cuts, so the start up only copies the latest batches. 0 leaves it all to the start up",
+		Value: time.Hour,
+	}
+	DataStreamArchiveDir = cli.StringFlag{
+		Name:  "zkevm.data-stream-archive-dir",
+		Usage: "Directory the batches cut from the data stream are archived to, data-stream-archive in the datadir when empty",
+		Value: "",
+	}
+	DataStreamReconcileBatches = cli.Uint64Flag{
+		Name:  "zkevm.data-stream-reconcile-batches",
+		Usage: "Compare this many latest batches of the data stream with the db after each catch up and rewrite the stream from the first entry that differs. 0 doesn't compare",
+		Value: 0,
+	}
 	Limbo = cli.BoolFlag{
 		Name:  "zkevm.limbo",
 		Usage: "Enable limbo processing on batches that failed verification",
@@ -769,6 +924,26 @@ var (
 		Usage: "Set update period of gas price",
 		Value: ethconfig.DefaultGPC.UpdatePeriod,
 	}
+	GasPricerStrategy = cli.StringFlag{
+		Name:  "zkevm.gas-pricer-strategy",
+		Usage: "Strategy of the gas pricer: lastnblocks, l1follower (the L1 gas price times zkevm.gas-price-factor), fixed or eip1559, it can be switched at runtime with admin_setGasPricerStrategy, authorised by acl.rpc-jwtsecret",
+		Value: ethconfig.DefaultGPC.Strategy,
+	}
+	GasPricerFixedPrice = cli.Uint64Flag{
+		Name:  "zkevm.gas-pricer-fixed-price",
+		Usage: "Gas price suggested by the fixed strategy, zkevm.default-gas-price if 0",
+		Value: ethconfig.DefaultGPC.FixedGasPrice,
+	}
+	GasPricerTargetPendingGas = cli.Uint64Flag{
+		Name:  "zkevm.gas-pricer-target-pending-gas",
+		Usage: "Pending gas in the pool the eip1559 strategy raises the price above and lowers it below",
+		Value: ethconfig.DefaultGPC.TargetPendingGas,
+	}
+	GasPricerChangeDenominator = cli.Uint64Flag{
+		Name:  "zkevm.gas-pricer-change-denominator",
+		Usage: "Bounds the change of the eip1559 strategy's price to 1/denominator per update",
+		Value: ethconfig.DefaultGPC.BaseFeeChangeDenominator,
+	}
 	WitnessFullFlag = cli.BoolFlag{
 		Name:  "zkevm.witness-full",
 		Usage: "Enable/Diable witness full",
@@ -801,7 +976,31 @@ var (
 	}
 	DAUrl = cli.StringFlag{
 		Name:  "zkevm.da-url",
-		Usage: "The URL of the data availability service",
+		Usage: "Comma separated list of the URLs of the data availability committee members, they are queried in parallel",
+		Value: "",
+	}
+	DABackend = cli.StringFlag{
+		Name:  "zkevm.da-backend",
+		Usage: "Comma separated, ordered list of data availability backends to fetch validium batch data from: dac, archive, blob. Data found is copied to any archive backend in the list",
+		Value: "dac",
+	}
+	DAArchiveDir = cli.StringFlag{
+		Name:  "zkevm.da-archive-dir",
+		Usage: "The directory used by the archive data availability backend, defaults to <datadir>/da-archive",
+		Value: "",
+	}
+	DABeaconUrl = cli.StringFlag{
+		Name:  "zkevm.da-beacon-url",
+		Usage: "The URL of the L1 beacon node API used by the blob data availability backend",
+		Value: "",
+	}
+	DAVerifySignatures = cli.BoolFlag{
+		Name:  "zkevm.da-verify-signatures",
+		Usage: "Verify the data availability committee signatures sent with validium sequences against the committee registered on the L1, this makes L1 calls to the DataCommittee contract and halts the sync on a sequence with bad signatures. On by default when zkevm.da-url is set and zkevm.da-backend includes dac",
+	}
+	DACommitteeAddress = cli.StringFlag{
+		Name:  "zkevm.da-committee-address",
+		Usage: "The address of the L1 DataCommittee contract, looked up from the rollup contract when not set",
 		Value: "",
 	}
 	VirtualCountersSmtReduction = cli.Float64Flag{
@@ -865,6 +1064,11 @@ var (
 		Usage: "Number of entries to print from the ACL history on node start up",
 		Value: 10,
 	}
+	ACLRPCJWTSecret = cli.StringFlag{
+		Name:  "acl.rpc-jwtsecret",
+		Usage: "Path to the hex encoded 32 byte secret that signs the bearer tokens admin_acl*, admin_retryVerification, admin_dropVerification and admin_setGasPricerStrategy RPC calls need, they are refused if unset",
+		Value: "",
+	}
 	DebugTimers = cli.BoolFlag{
 		Name:  "debug.timers",
 		Usage: "Enable debug timers",
@@ -545,9 +545,16 @@ const (
 	TableAccountValues                = "HermezSmtAccountValues"
 	TableMetadata                     = "HermezSmtMetadata"
 	TableHashKey                      = "HermezSmtHashKey"
+	TableSmtHistory                   = "HermezSmtHistory"
+	TableSmtHistoryIndex              = "HermezSmtHistoryIndex"
+	TableSmtHistoryCheckpoints        = "HermezSmtCheckpoints"
 	TablePoolLimbo                    = "PoolLimbo"
 	BATCH_ENDS                        = "batch_ends"
 	BAD_TX_HASHES                     = "bad_tx_hashes"
+	L1_BATCH_INFO_BLOCK_HASHES        = "hermez_l1BatchInfoBlockHashes"
+	L1_INFO_TREE_BLOCK_HASHES         = "l1_info_tree_block_hashes"
+	L1_INFO_ROOTS_BY_INDEX            = "l1_info_roots_by_index"
+	PENDING_VERIFICATIONS             = "hermez_pendingVerifications"
 	//Diagnostics tables
 	DiagSystemInfo = "DiagSystemInfo"
 	DiagSyncStages = "DiagSyncStages"
@@ -790,9 +797,16 @@ var ChaindataTables = []string{
 	TableAccountValues,
 	TableMetadata,
 	TableHashKey,
+	TableSmtHistory,
+	TableSmtHistoryIndex,
+	TableSmtHistoryCheckpoints,
 	TablePoolLimbo,
 	BATCH_ENDS,
 	BAD_TX_HASHES,
+	L1_BATCH_INFO_BLOCK_HASHES,
+	L1_INFO_TREE_BLOCK_HASHES,
+	L1_INFO_ROOTS_BY_INDEX,
+	PENDING_VERIFICATIONS,
 }
 
 const (
@@ -109,6 +109,7 @@ type TxSlot struct {
 	Commitments []gokzg4844.KZGCommitment
 	Proofs      []gokzg4844.KZGProof
 	To          common.Address
+	Selector    [4]byte // First four bytes of the data, the selector of the function called when DataLen is at least 4
 }
 
 const (
@@ -378,6 +379,9 @@ func (ctx *TxParseContext) parseTransactionBody(payload []byte, pos, p0 int, slo
 
 	// Only note if To field is empty or not
 	slot.Creation = dataLen == 0
+	if !slot.Creation {
+		slot.To = common.BytesToAddress(payload[dataPos : dataPos+dataLen])
+	}
 	p = dataPos + dataLen
 	// Next follows value
 	p, err = rlp.U256(payload, p, &slot.Value)
@@ -390,6 +394,9 @@ func (ctx *TxParseContext) parseTransactionBody(payload []byte, pos, p0 int, slo
 		return 0, fmt.Errorf("%w: data len: %s", ErrParseTxn, err) //nolint
 	}
 	slot.DataLen = dataLen
+	if dataLen >= 4 {
+		copy(slot.Selector[:], payload[dataPos:dataPos+4])
+	}
 
 	// Zero and non-zero bytes are priced differently
 	slot.DataNonZeroLen = 0
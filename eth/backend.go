@@ -99,6 +99,7 @@ import (
 	"github.com/ledgerwatch/erigon/eth/protocols/eth"
 	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/ethclient"
 	"github.com/ledgerwatch/erigon/ethdb/privateapi"
 	"github.com/ledgerwatch/erigon/ethdb/prune"
 	"github.com/ledgerwatch/erigon/node"
@@ -128,8 +129,10 @@ import (
 	stages2 "github.com/ledgerwatch/erigon/turbo/stages"
 	"github.com/ledgerwatch/erigon/turbo/stages/headerdownload"
 	"github.com/ledgerwatch/erigon/zk/contracts"
+	"github.com/ledgerwatch/erigon/zk/da"
 	"github.com/ledgerwatch/erigon/zk/datastream/client"
 	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	dstypes "github.com/ledgerwatch/erigon/zk/datastream/types"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	"github.com/ledgerwatch/erigon/zk/l1_cache"
 	"github.com/ledgerwatch/erigon/zk/l1infotree"
@@ -224,8 +227,10 @@ type Ethereum struct {
 	// zk
 	streamServer    server.StreamServer
 	l1Syncer        *syncer.L1Syncer
+	legacyVerifier  *legacy_executor_verifier.LegacyExecutorVerifier
 	etherManClients []*etherman.Client
 	l1Cache         *l1_cache.L1Cache
+	witnessCache    *witness.Cache
 
 	preStartTasks *PreStartTasks
 
@@ -975,17 +980,47 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 		httpCfg := stack.Config().Http
 		if httpCfg.DataStreamPort > 0 && httpCfg.DataStreamHost != "" {
 			file := stack.Config().Dirs.DataDir + "/data-stream"
+			if backend.config.DataStreamCompactKeepBatches > 0 {
+				if err = compactDataStream(tx, file, backend.config.Zk, stack.Config().Dirs.DataDir); err != nil {
+					log.Warn("[dataStream] Compacting the stream failed, carrying on with it as it is", "err", err)
+				}
+			}
 			logConfig := &log2.Config{
 				Environment: "production",
 				Level:       "warn",
 				Outputs:     nil,
 			}
 
+			// clients starting from a batch cut from the stream get it from the archive, through the gateway
+			archive, err := server.OpenStreamArchive(dataStreamArchiveDir(backend.config.Zk, stack.Config().Dirs.DataDir))
+			if err != nil {
+				return nil, err
+			}
+
 			// todo [zkevm] read the stream version from config and figure out what system id is used for
-			backend.streamServer, err = dataStreamServerFactory.CreateStreamServer(uint16(httpCfg.DataStreamPort), uint8(backend.config.DatastreamVersion), 1, datastreamer.StreamType(1), file, httpCfg.DataStreamWriteTimeout, httpCfg.DataStreamInactivityTimeout, httpCfg.DataStreamInactivityCheckInterval, logConfig)
+			gatewayCfg := &server.GatewayConfig{
+				InternalPort:            uint16(backend.config.DataStreamInternalPort),
+				TLSCertFile:             backend.config.DataStreamTLSCert,
+				TLSKeyFile:              backend.config.DataStreamTLSKey,
+				ClientCAFile:            backend.config.DataStreamClientCA,
+				TokensFile:              backend.config.DataStreamTokensFile,
+				Allowlist:               backend.config.DataStreamAllowlist,
+				MaxConnectionsPerClient: backend.config.DataStreamMaxClientConnections,
+			}
+			if len(archive.Segments) > 0 || backend.config.DataStreamCompactKeepBatches > 0 {
+				if backend.config.DataStreamInternalPort > 0 {
+					gatewayCfg.Archive = archive
+				} else {
+					log.Warn("[dataStream] The stream archive isn't served without a data stream internal port for the gateway", "segments", len(archive.Segments))
+				}
+			}
+			backend.streamServer, err = dataStreamServerFactory.CreateStreamServer(uint16(httpCfg.DataStreamPort), uint8(backend.config.DatastreamVersion), 1, datastreamer.StreamType(1), file, httpCfg.DataStreamWriteTimeout, httpCfg.DataStreamInactivityTimeout, httpCfg.DataStreamInactivityCheckInterval, logConfig, gatewayCfg)
 			if err != nil {
 				return nil, err
 			}
+			if backend.config.DataStreamCompactKeepBatches > 0 && backend.config.DataStreamCompactInterval > 0 {
+				go prepareDataStreamCompactions(backend.sentryCtx, backend.chainDB, file, backend.config.Zk, stack.Config().Dirs.DataDir)
+			}
 
 			// recovery here now, if the stream got into a bad state we want to be able to delete the file and have
 			// the stream re-populated from scratch.  So we check the stream for the latest header and if it is
@@ -1005,7 +1040,13 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 		l1Urls := strings.Split(cfg.L1RpcUrl, ",")
 
 		if cfg.Zk.L1CacheEnabled {
-			l1Cache, err := l1_cache.NewL1Cache(ctx, path.Join(stack.DataDir(), "l1cache"), cfg.Zk.L1CachePort)
+			l1Cache, err := l1_cache.NewL1Cache(ctx, path.Join(stack.DataDir(), "l1cache"), l1_cache.Config{
+				Port:           cfg.Zk.L1CachePort,
+				MethodTTLs:     cfg.Zk.L1CacheMethodTTLs,
+				TagTTL:         cfg.Zk.L1CacheTagTTL,
+				UnfinalizedTTL: cfg.Zk.L1CacheUnfinalizedTTL,
+				MaxSize:        cfg.Zk.L1CacheMaxSize,
+			})
 			if err != nil {
 				return nil, err
 			}
@@ -1067,6 +1108,38 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 			ethermanClients[i] = c.EthClient
 		}
 
+		if cfg.L1ArchiveReplay != "" {
+			archive, err := syncer.LoadL1Archive(cfg.L1ArchiveReplay)
+			if err != nil {
+				return nil, err
+			}
+			log.Info("Replaying the L1 from an archive", "path", cfg.L1ArchiveReplay)
+			ethermanClients = []syncer.IEtherman{syncer.NewArchiveEtherman(archive)}
+		} else if cfg.L1ArchiveRecord != "" {
+			recorder, err := syncer.NewL1Recorder(cfg.L1ArchiveRecord)
+			if err != nil {
+				return nil, err
+			}
+			log.Info("Recording the L1 to an archive", "path", cfg.L1ArchiveRecord)
+			for i, c := range ethermanClients {
+				ethermanClients[i] = recorder.Wrap(c)
+			}
+			go recorder.SaveOnInterval(ctx, time.Minute)
+		}
+
+		// the syncers share the endpoints so that they all see the same health, names come from the configured urls
+		// rather than the cache proxy ones
+		if cfg.L1ArchiveReplay == "" {
+			configuredUrls := strings.Split(cfg.L1RpcUrl, ",")
+			for i, c := range ethermanClients {
+				var weight uint64 = 1
+				if i < len(cfg.L1RpcWeights) {
+					weight = cfg.L1RpcWeights[i]
+				}
+				ethermanClients[i] = syncer.NewEndpoint(syncer.EndpointName(i, configuredUrls[i]), c, weight)
+			}
+		}
+
 		seqVerSyncer := syncer.NewL1Syncer(
 			ctx,
 			ethermanClients,
@@ -1102,6 +1175,17 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 			cfg.L1HighestBlockType,
 		)
 
+		if cfg.L1WsUrl != "" && cfg.L1ArchiveReplay == "" {
+			wsClient, err := ethclient.DialContext(ctx, cfg.L1WsUrl)
+			if err != nil {
+				log.Warn("Failed to connect to the L1 websocket, polling the L1 instead", "err", err)
+			} else {
+				for _, s := range []*syncer.L1Syncer{seqVerSyncer, backend.l1Syncer, l1InfoTreeSyncer} {
+					s.SetLogSubscriber(wsClient)
+				}
+			}
+		}
+
 		l1InfoTreeUpdater := l1infotree.NewUpdater(cfg.Zk, l1InfoTreeSyncer)
 
 		var dataStreamServer server.DataStreamServer
@@ -1130,6 +1214,9 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 					Timeout:               cfg.ExecutorRequestTimeout,
 					MaxConcurrentRequests: cfg.ExecutorMaxConcurrentRequests,
 					OutputLocation:        cfg.ExecutorPayloadOutput,
+
+					BreakerFailureThreshold: cfg.ExecutorBreakerFailureThreshold,
+					BreakerCooldown:         cfg.ExecutorBreakerCooldown,
 				}
 				executors := legacy_executor_verifier.NewExecutors(levCfg)
 				for _, e := range executors {
@@ -1137,13 +1224,24 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 				}
 			}
 
+			// the witnesses of pending verifications are kept in the witness cache so that they survive a restart
+			var witnessCache legacy_executor_verifier.WitnessCache
+			if cfg.WitnessCacheSize > 0 {
+				if backend.witnessCache, err = witness.OpenCache(ctx, config.Dirs.DataDir, cfg.WitnessCacheSize); err != nil {
+					return nil, err
+				}
+				witnessCache = backend.witnessCache
+			}
+
 			verifier := legacy_executor_verifier.NewLegacyExecutorVerifier(
 				*cfg.Zk,
 				legacyExecutors,
 				backend.chainDB,
 				witnessGenerator,
+				witnessCache,
 				dataStreamServer,
 			)
+			backend.legacyVerifier = verifier
 
 			if cfg.Zk.Limbo {
 				limboSubPoolProcessor := txpool.NewLimboSubPoolProcessor(ctx, cfg.Zk, backend.chainConfig, backend.chainDB, backend.txPool2, verifier)
@@ -1166,6 +1264,31 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 				cfg.L1HighestBlockType,
 			)
 
+			daArchiveDir := cfg.DAArchiveDir
+			if daArchiveDir == "" {
+				daArchiveDir = path.Join(stack.DataDir(), "da-archive")
+			}
+			daBackend, err := da.NewBackend(da.Config{
+				Backends:   cfg.DABackend,
+				DAUrls:     strings.Split(cfg.DAUrl, ","),
+				ArchiveDir: daArchiveDir,
+				BeaconUrl:  cfg.DABeaconUrl,
+			}, func(l1BlockNo uint64) (uint64, error) {
+				header, err := l1BlockSyncer.GetHeader(l1BlockNo)
+				if err != nil {
+					return 0, err
+				}
+				return header.Time, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			var daVerifier da.MessageVerifier
+			if cfg.DAVerifySignatures {
+				daVerifier = da.NewCommitteeVerifier(l1BlockSyncer, cfg.AddressZkevm, cfg.DACommitteeAddress)
+			}
+
 			backend.syncStages = stages2.NewSequencerZkStages(
 				backend.sentryCtx,
 				backend.chainDB,
@@ -1185,6 +1308,8 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 				backend.txPool2DB,
 				verifier,
 				l1InfoTreeUpdater,
+				daBackend,
+				daVerifier,
 			)
 
 			backend.syncUnwindOrder = zkStages.ZkSequencerUnwindOrder
@@ -1204,7 +1329,29 @@ func New(ctx context.Context, stack *node.Node, config *ethconfig.Config, logger
 			if err != nil {
 				return nil, err
 			}
-			streamClient := initDataStreamClient(ctx, cfg.Zk, uint16(latestForkId))
+			streamClient, err := initDataStreamClient(ctx, cfg.Zk, uint16(latestForkId))
+			if err != nil {
+				return nil, err
+			}
+
+			if cfg.WitnessCacheSize > 0 {
+				if backend.witnessCache, err = witness.OpenCache(ctx, config.Dirs.DataDir, cfg.WitnessCacheSize); err != nil {
+					return nil, err
+				}
+				witnessGenerator := witness.NewGenerator(
+					config.Dirs,
+					config.HistoryV3,
+					backend.agg,
+					backend.blockReader,
+					backend.chainConfig,
+					backend.config.Zk,
+					backend.engine,
+					backend.config.WitnessContractInclusion,
+					backend.config.WitnessUnwindLimit,
+				)
+				pregenerator := witness.NewPregenerator(backend.chainDB, backend.witnessCache, witnessGenerator, cfg.WitnessFull, cfg.WitnessCacheInterval)
+				go pregenerator.Run(ctx)
+			}
 
 			backend.syncStages = stages2.NewDefaultZkStages(
 				backend.sentryCtx,
@@ -1290,8 +1437,120 @@ func newEtherMan(cfg *ethconfig.Config, l2ChainName, url string) *etherman.Clien
 }
 
 // creates a datastream client with default parameters
-func initDataStreamClient(ctx context.Context, cfg *ethconfig.Zk, latestForkId uint16) *client.StreamClient {
-	return client.NewClient(ctx, cfg.L2DataStreamerUrl, cfg.L2DataStreamerUseTLS, cfg.DatastreamVersion, cfg.L2DataStreamerTimeout, latestForkId)
+func initDataStreamClient(ctx context.Context, cfg *ethconfig.Zk, latestForkId uint16) (*client.StreamClient, error) {
+	return zkStages.NewStreamClient(ctx, cfg, latestForkId)
+}
+
+func dataStreamArchiveDir(cfg *ethconfig.Zk, dataDir string) string {
+	if cfg.DataStreamArchiveDir != "" {
+		return cfg.DataStreamArchiveDir
+	}
+	return filepath.Join(dataDir, "data-stream-archive")
+}
+
+// dataStreamCompactionStart returns the batch to start the stream over at to keep the latest batches, false until the
+// stream holds twice as many
+func dataStreamCompactionStart(tx kv.Tx, file string, keep uint64) (uint64, bool, error) {
+	firstBatch, ok, err := server.StreamFirstBatch(file)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	progress, err := stages.GetStageProgress(tx, stages.DataStream)
+	if err != nil {
+		return 0, false, err
+	}
+	highestBatch, err := hermez_db.NewHermezDbReader(tx).GetBatchNoByL2Block(progress)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if highestBatch+1 < firstBatch+2*keep {
+		return 0, false, nil
+	}
+	return highestBatch + 1 - keep, true, nil
+}
+
+// compactDataStream starts the stream over with the latest batches once it holds twice as many as set to keep, from
+// the batch the running node prepared the compaction at when it did. It runs on start up before the stream server
+// opens the file as the file can't be swapped under it
+func compactDataStream(tx kv.Tx, file string, cfg *ethconfig.Zk, dataDir string) error {
+	fromBatch, ok, err := dataStreamCompactionStart(tx, file, cfg.DataStreamCompactKeepBatches)
+	if err != nil || !ok {
+		return err
+	}
+	archiveDir := dataStreamArchiveDir(cfg, dataDir)
+	archive, err := server.OpenStreamArchive(archiveDir)
+	if err != nil {
+		return err
+	}
+	prepared, err := archive.Prepared()
+	if err != nil {
+		return err
+	}
+	if prepared != nil && prepared.StartBatch <= fromBatch {
+		fromBatch = prepared.StartBatch
+	}
+
+	log.Info("[dataStream] Compacting the stream", "fromBatch", fromBatch, "prepared", prepared != nil, "archive", archiveDir)
+	result, err := server.CompactStream(file, fromBatch, archiveDir, func(block *dstypes.FullL2Block) error {
+		return server.VerifyStreamBlock(tx, block)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("[dataStream] Compacted the stream", "fromBatch", fromBatch, "firstBlock", result.FirstBlock.L2BlockNumber, "entries", result.Entries, "archived", result.Archived.File)
+
+	return nil
+}
+
+// prepareDataStreamCompactions archives the batches the compaction on the next start cuts from the stream while the
+// node runs, so the start up only has the latest batches to copy
+func prepareDataStreamCompactions(ctx context.Context, db kv.RoDB, file string, cfg *ethconfig.Zk, dataDir string) {
+	ticker := time.NewTicker(cfg.DataStreamCompactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := prepareDataStreamCompaction(ctx, db, file, cfg, dataDir); err != nil {
+			log.Warn("[dataStream] Preparing the stream compaction failed", "err", err)
+		}
+	}
+}
+
+// prepareDataStreamCompaction prepares the compaction once the stream holds twice the batches to keep, again once it
+// has grown by as many since the compaction prepared before
+func prepareDataStreamCompaction(ctx context.Context, db kv.RoDB, file string, cfg *ethconfig.Zk, dataDir string) error {
+	var fromBatch uint64
+	var ok bool
+	if err := db.View(ctx, func(tx kv.Tx) (err error) {
+		fromBatch, ok, err = dataStreamCompactionStart(tx, file, cfg.DataStreamCompactKeepBatches)
+		return err
+	}); err != nil || !ok {
+		return err
+	}
+	archiveDir := dataStreamArchiveDir(cfg, dataDir)
+	archive, err := server.OpenStreamArchive(archiveDir)
+	if err != nil {
+		return err
+	}
+	prepared, err := archive.Prepared()
+	if err != nil {
+		return err
+	}
+	if prepared != nil && fromBatch < prepared.StartBatch+cfg.DataStreamCompactKeepBatches {
+		return nil
+	}
+
+	start := time.Now()
+	if prepared, err = server.PrepareCompaction(file, fromBatch, archiveDir); err != nil {
+		return err
+	}
+	log.Info("[dataStream] Prepared the stream compaction for the next start", "fromBatch", fromBatch, "archivedEntries", prepared.Segment.Entries, "took", time.Since(start))
+
+	return nil
 }
 
 func (s *Ethereum) Init(stack *node.Node, config *ethconfig.Config, chainConfig *chain.Config) error {
@@ -1344,7 +1603,7 @@ func (s *Ethereum) Init(stack *node.Node, config *ethconfig.Config, chainConfig
 	if s.streamServer != nil {
 		dataStreamServer = dataStreamServerFactory.CreateDataStreamServer(s.streamServer, config.Zk.L2ChainId)
 	}
-	s.apiList = jsonrpc.APIList(ctx, chainKv, ethRpcClient, txPoolRpcClient, s.txPool2, miningRpcClient, ff, stateCache, blockReader, s.agg, &httpRpcCfg, s.engine, config, s.l1Syncer, s.logger, dataStreamServer)
+	s.apiList = jsonrpc.APIList(ctx, chainKv, ethRpcClient, txPoolRpcClient, s.txPool2, miningRpcClient, ff, stateCache, blockReader, s.agg, &httpRpcCfg, s.engine, config, s.l1Syncer, s.legacyVerifier, s.logger, dataStreamServer, s.witnessCache)
 
 	if config.SilkwormRpcDaemon && httpRpcCfg.Enabled {
 		interface_log_settings := silkworm.RpcInterfaceLogSettings{
@@ -1950,6 +2209,12 @@ func (s *Ethereum) Stop() error {
 	if s.config.Miner.Enabled {
 		<-s.waitForMiningStop
 	}
+	// the gateway in front of the stream server stops taking clients, the stream server itself can't be stopped
+	if gated, ok := s.streamServer.(interface{ Stop() error }); ok {
+		if err := gated.Stop(); err != nil {
+			s.logger.Error("Stopping the data stream gateway", "err", err)
+		}
+	}
 	for _, sentryServer := range s.sentryServers {
 		sentryServer.Close()
 	}
@@ -1959,6 +2224,9 @@ func (s *Ethereum) Stop() error {
 	if s.agg != nil {
 		s.agg.Close()
 	}
+	if s.witnessCache != nil {
+		s.witnessCache.Close()
+	}
 	s.chainDB.Close()
 
 	if s.silkwormRPCDaemonService != nil {
@@ -1,6 +1,7 @@
 package ethconfig
 
 import (
+	"slices"
 	"time"
 
 	"github.com/c2h5oh/datasize"
@@ -18,6 +19,8 @@ type Zk struct {
 	L1SyncStopBatch                        uint64
 	L1ChainId                              uint64
 	L1RpcUrl                               string
+	L1RpcWeights                           []uint64
+	L1WsUrl                                string
 	AddressSequencer                       common.Address
 	AddressAdmin                           common.Address
 	AddressRollup                          common.Address
@@ -34,6 +37,12 @@ type Zk struct {
 	L1FinalizedBlockRequirement            uint64
 	L1CacheEnabled                         bool
 	L1CachePort                            uint
+	L1CacheMethodTTLs                      map[string]time.Duration
+	L1CacheTagTTL                          time.Duration
+	L1CacheUnfinalizedTTL                  time.Duration
+	L1CacheMaxSize                         datasize.ByteSize
+	L1ArchiveReplay                        string
+	L1ArchiveRecord                        string
 	RpcRateLimits                          int
 	RpcGetBatchWitnessConcurrencyLimit     int
 	DatastreamVersion                      int
@@ -49,6 +58,8 @@ type Zk struct {
 	ExecutorUrls                           []string
 	ExecutorStrictMode                     bool
 	ExecutorRequestTimeout                 time.Duration
+	ExecutorBreakerFailureThreshold        int
+	ExecutorBreakerCooldown                time.Duration
 	DatastreamNewBlockTimeout              time.Duration
 	WitnessMemdbSize                       datasize.ByteSize
 	WitnessUnwindLimit                     uint64
@@ -66,6 +77,11 @@ type Zk struct {
 	GasPriceFactor                         float64
 	GasPriceCfg                            *GasPriceConf
 	DAUrl                                  string
+	DABackend                              []string
+	DAArchiveDir                           string
+	DABeaconUrl                            string
+	DAVerifySignatures                     bool
+	DACommitteeAddress                     common.Address
 	DataStreamHost                         string
 	DataStreamPort                         uint
 	DataStreamWriteTimeout                 time.Duration
@@ -79,6 +95,47 @@ type Zk struct {
 	SyncLimit             uint64
 	Gasless               bool
 
+	// SmtHistoryBlocks is how many blocks of SMT history are kept for historical proofs, 0 disables the history
+	SmtHistoryBlocks uint64
+	// SmtHistoryCheckpointInterval bounds the distance between materialised trees while syncing
+	SmtHistoryCheckpointInterval uint64
+
+	// SmtRegenerateWorkers is how many goroutines hash the SMT on a rebuild, 0 uses all cores and 1 the sequential build
+	SmtRegenerateWorkers int
+
+	// WitnessCacheSize bounds the witness cache RPC nodes fill in the background, 0 disables the cache
+	WitnessCacheSize     datasize.ByteSize
+	WitnessCacheInterval time.Duration
+
+	// L2DataStreamerFallbackUrls are the stream servers the client fails over to, in order, when L2DataStreamerUrl is unreachable
+	L2DataStreamerFallbackUrls []string
+
+	// the client credentials for L2 datastreamers gating the access to their stream
+	L2DataStreamerTLSCert   string
+	L2DataStreamerTLSKey    string
+	L2DataStreamerTLSCA     string
+	L2DataStreamerTokenFile string
+
+	// DataStreamInternalPort is where the stream server listens behind the gateway enforcing the access settings below
+	DataStreamInternalPort         uint
+	DataStreamTLSCert              string
+	DataStreamTLSKey               string
+	DataStreamClientCA             string
+	DataStreamTokensFile           string
+	DataStreamAllowlist            []string
+	DataStreamMaxClientConnections int
+
+	// DataStreamCompactKeepBatches starts the stream over with these latest batches on start up once it holds twice as
+	// many, the batches before go to the archive in DataStreamArchiveDir. Every DataStreamCompactInterval the running
+	// node archives the batches the next start cuts
+	DataStreamCompactKeepBatches uint64
+	DataStreamCompactInterval    time.Duration
+	DataStreamArchiveDir         string
+
+	// DataStreamReconcileBatches compares these latest batches of the stream with the db after each catch up, the stream
+	// is rewritten from the first entry that differs
+	DataStreamReconcileBatches uint64
+
 	DebugTimers    bool
 	DebugNoSync    bool
 	DebugLimit     uint64
@@ -95,6 +152,7 @@ type Zk struct {
 	*Merlin
 	InitialBatchCfgFile            string
 	ACLPrintHistory                int
+	ACLRPCJWTSecretPath            string
 	InfoTreeUpdateInterval         time.Duration
 	BadBatches                     []uint64
 	SealBatchImmediatelyOnOverflow bool
@@ -113,6 +171,21 @@ func (c *Zk) HasExecutors() bool {
 	return len(c.ExecutorUrls) > 0 && c.ExecutorUrls[0] != ""
 }
 
+// L2DataStreamerUrls returns the stream servers in order of preference, L2DataStreamerUrl first
+func (c *Zk) L2DataStreamerUrls() []string {
+	return append([]string{c.L2DataStreamerUrl}, c.L2DataStreamerFallbackUrls...)
+}
+
+// DACommitteeConfigured tells if validium data is fetched from data availability committee members
+func (c *Zk) DACommitteeConfigured() bool {
+	return c.DAUrl != "" && slices.Contains(c.DABackend, "dac")
+}
+
+// DataStreamGated tells if the datastream server has access settings to enforce
+func (c *Zk) DataStreamGated() bool {
+	return c.DataStreamTLSCert != "" || c.DataStreamTokensFile != "" || len(c.DataStreamAllowlist) > 0 || c.DataStreamMaxClientConnections > 0
+}
+
 // ShouldImportInitialBatch returns true in case initial batch config file name is non-empty string.
 func (c *Zk) ShouldImportInitialBatch() bool {
 	return c.InitialBatchCfgFile != ""
@@ -65,8 +65,27 @@ type GasPriceConf struct {
 	GlobalPendingDynamicFactor float64
 	PendingGasLimit            uint64
 	UpdatePeriod               time.Duration
+	Strategy                   string
+	FixedGasPrice              uint64
+	L1GasPriceFactor           float64
+	TargetPendingGas           uint64
+	BaseFeeChangeDenominator   uint64
 }
 
+// The strategies the L2 gas pricer can use
+const (
+	// GasPricerLastNBlocks suggests a percentile of the tips paid in the last blocks
+	GasPricerLastNBlocks = "lastnblocks"
+	// GasPricerL1Follower follows the L1 gas price scaled by a factor
+	GasPricerL1Follower = "l1follower"
+	// GasPricerFixed always suggests the same price
+	GasPricerFixed = "fixed"
+	// GasPricerEIP1559 moves the price towards keeping the pool's pending gas at a target, like the EIP-1559 base fee
+	GasPricerEIP1559 = "eip1559"
+)
+
+var GasPricerStrategies = []string{GasPricerLastNBlocks, GasPricerL1Follower, GasPricerFixed, GasPricerEIP1559}
+
 var DefaultGPC = GasPriceConf{
 	Enable:                     false,
 	CheckBlocks:                5,
@@ -77,4 +96,7 @@ var DefaultGPC = GasPriceConf{
 	GlobalPendingDynamicFactor: 1,
 	PendingGasLimit:            22_000_000,
 	UpdatePeriod:               10 * time.Second,
+	Strategy:                   GasPricerLastNBlocks,
+	TargetPendingGas:           11_000_000,
+	BaseFeeChangeDenominator:   8,
 }
@@ -77,7 +77,7 @@ func (s sortGasAndReward) Less(i, j int) bool {
 // processBlock takes a blockFees structure with the blockNumber, the header and optionally
 // the block field filled in, retrieves the block from the backend if not present yet and
 // fills in the rest of the fields.
-func (oracle *Oracle) processBlock(bf *blockFees, percentiles []float64) {
+func (oracle *Oracle) processBlock(ctx context.Context, bf *blockFees, percentiles []float64) {
 	chainconfig := oracle.backend.ChainConfig()
 	if bf.baseFee = bf.header.BaseFee; bf.baseFee == nil {
 		bf.baseFee = new(big.Int)
@@ -111,8 +111,12 @@ func (oracle *Oracle) processBlock(bf *blockFees, percentiles []float64) {
 	if bf.block.BaseFee() != nil {
 		baseFee.SetFromBig(bf.block.BaseFee())
 	}
-	for i, tx := range bf.block.Transactions() {
-		reward := tx.GetEffectiveGasTip(baseFee)
+	tips, err := oracle.gasTips(ctx, bf.block, baseFee)
+	if err != nil {
+		bf.err = err
+		return
+	}
+	for i, reward := range tips {
 		sorter[i] = txGasAndReward{gasUsed: bf.receipts[i].GasUsed, reward: reward.ToBig()}
 	}
 	sort.Sort(sorter)
@@ -268,7 +272,7 @@ func (oracle *Oracle) FeeHistory(ctx context.Context, blocks int, unresolvedLast
 			fees.header = fees.block.Header()
 		}
 		if fees.header != nil {
-			oracle.processBlock(fees, rewardPercentiles)
+			oracle.processBlock(ctx, fees, rewardPercentiles)
 		}
 
 		if fees.err != nil {
@@ -0,0 +1,113 @@
+package gasprice
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+
+	"github.com/ledgerwatch/erigon/core/types"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
+)
+
+// EffectiveGasPriceBackend is implemented by backends that can tell the effective gas price percentage a zkEVM
+// sequencer stored for a transaction, the share of its gas price the transaction was actually charged, and whether one
+// was stored at all
+type EffectiveGasPriceBackend interface {
+	EffectiveGasPricePercentage(ctx context.Context, txHash libcommon.Hash) (uint8, bool, error)
+}
+
+// effectivePercentages returns the effective gas price percentages of the block's transactions, or nil if the chain
+// charges transactions their full gas price
+func (oracle *Oracle) effectivePercentages(ctx context.Context, block *types.Block) ([]uint8, error) {
+	backend, ok := oracle.backend.(EffectiveGasPriceBackend)
+	if !ok {
+		return nil, nil
+	}
+	cc := oracle.backend.ChainConfig()
+	if cc == nil || cc.ChainID == nil || !chain.IsZk(cc.ChainID.Uint64()) || !cc.IsForkID5Dragonfruit(block.NumberU64()) {
+		return nil, nil
+	}
+
+	percentages := make([]uint8, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		percentage, found, err := backend.EffectiveGasPricePercentage(ctx, tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		// a transaction without a stored percentage isn't known to have been charged less than its gas price, reading
+		// it as 0 would count it at 1/256 of the price
+		if !found {
+			percentage = zktypes.EFFECTIVE_GAS_PRICE_PERCENTAGE_MAXIMUM
+		}
+		percentages[i] = percentage
+	}
+	return percentages, nil
+}
+
+// effectiveGasTip is the tip per gas the transaction actually paid once the sequencer applied the effective gas price
+// percentage to its gas price, in the same way core.CalculateEffectiveGas does
+func effectiveGasTip(tx types.Transaction, baseFee *uint256.Int, percentage uint8) *uint256.Int {
+	price := tx.GetEffectiveGasTip(baseFee)
+	if baseFee != nil {
+		price = new(uint256.Int).Add(price, baseFee)
+	}
+	price = new(uint256.Int).Mul(price, uint256.NewInt(uint64(percentage)+1))
+	price.Div(price, zktypes.EFFECTIVE_GAS_PRICE_MAX_VAL)
+
+	if baseFee == nil {
+		return price
+	}
+	if price.Lt(baseFee) {
+		return uint256.NewInt(0)
+	}
+	return price.Sub(price, baseFee)
+}
+
+// gasTips returns the tips the block's transactions paid, accounting for the effective gas price percentages on
+// zkEVM chains
+func (oracle *Oracle) gasTips(ctx context.Context, block *types.Block, baseFee *uint256.Int) ([]*uint256.Int, error) {
+	percentages, err := oracle.effectivePercentages(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	tips := make([]*uint256.Int, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		if percentages == nil {
+			tips[i] = tx.GetEffectiveGasTip(baseFee)
+		} else {
+			tips[i] = effectiveGasTip(tx, baseFee, percentages[i])
+		}
+	}
+	return tips, nil
+}
+
+// getEffectiveBlockPrices is getBlockPrices for blocks whose transactions were charged an effective gas price
+func (oracle *Oracle) getEffectiveBlockPrices(block *types.Block, baseFee *uint256.Int, percentages []uint8, limit int, ignoreUnder *uint256.Int, s *sortingHeap) {
+	type txTip struct {
+		tx  types.Transaction
+		tip *uint256.Int
+	}
+	tips := make([]txTip, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		tips[i] = txTip{tx: tx, tip: effectiveGasTip(tx, baseFee, percentages[i])}
+	}
+	sort.SliceStable(tips, func(i, j int) bool { return tips[i].tip.Lt(tips[j].tip) })
+
+	count := 0
+	for _, t := range tips {
+		if count >= limit {
+			break
+		}
+		if ignoreUnder != nil && t.tip.Lt(ignoreUnder) {
+			continue
+		}
+		if sender, _ := t.tx.GetSender(); sender != block.Coinbase() {
+			heap.Push(s, t.tip)
+			count++
+		}
+	}
+}
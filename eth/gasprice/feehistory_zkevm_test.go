@@ -0,0 +1,111 @@
+package gasprice
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+type effectivePriceBackend struct {
+	chainID     int64
+	percentages map[libcommon.Hash]uint8
+}
+
+func (b *effectivePriceBackend) HeaderByNumber(context.Context, rpc.BlockNumber) (*types.Header, error) {
+	return nil, nil
+}
+func (b *effectivePriceBackend) BlockByNumber(context.Context, rpc.BlockNumber) (*types.Block, error) {
+	return nil, nil
+}
+func (b *effectivePriceBackend) ChainConfig() *chain.Config {
+	return &chain.Config{ChainID: big.NewInt(b.chainID), ForkID5DragonfruitBlock: big.NewInt(0)}
+}
+func (b *effectivePriceBackend) GetReceipts(context.Context, *types.Block) (types.Receipts, error) {
+	return nil, nil
+}
+func (b *effectivePriceBackend) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
+	return nil, nil
+}
+func (b *effectivePriceBackend) EffectiveGasPricePercentage(_ context.Context, txHash libcommon.Hash) (uint8, bool, error) {
+	percentage, found := b.percentages[txHash]
+	return percentage, found, nil
+}
+
+func TestEffectiveGasTip(t *testing.T) {
+	tx := types.NewTransaction(0, libcommon.Address{}, uint256.NewInt(0), 21000, uint256.NewInt(3000), nil)
+
+	require.Equal(t, uint256.NewInt(3000), effectiveGasTip(tx, nil, 255))
+	require.Equal(t, uint256.NewInt(1500), effectiveGasTip(tx, nil, 127))
+	require.Equal(t, uint256.NewInt(2000), effectiveGasTip(tx, uint256.NewInt(1000), 255))
+	require.Equal(t, uint256.NewInt(500), effectiveGasTip(tx, uint256.NewInt(1000), 127))
+	// charged less than the base fee
+	require.Equal(t, uint256.NewInt(0), effectiveGasTip(tx, uint256.NewInt(1000), 31))
+}
+
+func TestEffectiveFeeHistoryRewards(t *testing.T) {
+	// the sequencer charged the first two transactions their full price and the last one an eighth of it
+	prices := []uint64{1000, 2000, 4000}
+	percentages := []uint8{255, 255, 31}
+
+	backend := &effectivePriceBackend{percentages: make(map[libcommon.Hash]uint8)}
+	var (
+		txs      []types.Transaction
+		receipts types.Receipts
+	)
+	for i, price := range prices {
+		tx := types.NewTransaction(uint64(i), libcommon.Address{}, uint256.NewInt(0), 21000, uint256.NewInt(price), nil)
+		backend.percentages[tx.Hash()] = percentages[i]
+		txs = append(txs, tx)
+		receipts = append(receipts, &types.Receipt{GasUsed: 21000})
+	}
+	header := &types.Header{Number: big.NewInt(10), GasLimit: 30_000_000, GasUsed: 63000, Coinbase: libcommon.Address{1}}
+	block := types.NewBlock(header, txs, nil, nil, nil)
+
+	tests := []struct {
+		name    string
+		chainID int64
+		want    []*big.Int
+	}{
+		{name: "zkevm chain", chainID: 1101, want: []*big.Int{big.NewInt(500), big.NewInt(1000), big.NewInt(2000)}},
+		{name: "other chain", chainID: 1, want: []*big.Int{big.NewInt(1000), big.NewInt(2000), big.NewInt(4000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.chainID = tt.chainID
+			oracle := &Oracle{backend: backend}
+
+			fees := &blockFees{blockNumber: 10, header: block.Header(), block: block, receipts: receipts}
+			oracle.processBlock(context.Background(), fees, []float64{0, 50, 100})
+			require.NoError(t, fees.err)
+			require.Equal(t, tt.want, fees.reward)
+		})
+	}
+
+	t.Run("no stored percentage", func(t *testing.T) {
+		backend.chainID = 1101
+		oracle := &Oracle{backend: backend}
+		tx := types.NewTransaction(3, libcommon.Address{}, uint256.NewInt(0), 21000, uint256.NewInt(3000), nil)
+		block := types.NewBlock(header, []types.Transaction{tx}, nil, nil, nil)
+
+		// counted at its full price rather than at 1/256 of it
+		tips, err := oracle.gasTips(context.Background(), block, nil)
+		require.NoError(t, err)
+		require.Equal(t, []*uint256.Int{uint256.NewInt(3000)}, tips)
+	})
+
+	backend.chainID = 1101
+	oracle := &Oracle{backend: backend}
+	var tips sortingHeap
+	blockPercentages, err := oracle.effectivePercentages(context.Background(), block)
+	require.NoError(t, err)
+	oracle.getEffectiveBlockPrices(block, nil, blockPercentages, 2, uint256.NewInt(600), &tips)
+	require.Equal(t, sortingHeap{uint256.NewInt(1000), uint256.NewInt(2000)}, tips)
+}
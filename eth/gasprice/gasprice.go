@@ -241,6 +241,15 @@ func (oracle *Oracle) getBlockPrices(ctx context.Context, blockNum uint64, limit
 			return err
 		}
 	}
+	percentages, err := oracle.effectivePercentages(ctx, block)
+	if err != nil {
+		return err
+	}
+	if percentages != nil {
+		oracle.getEffectiveBlockPrices(block, baseFee, percentages, limit, ignoreUnder, s)
+		return nil
+	}
+
 	txs := newTransactionsByGasPrice(plainTxs, baseFee)
 	heap.Init(&txs)
 
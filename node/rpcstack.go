@@ -344,6 +344,7 @@ func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string, compr
 	handler = newVHostHandler(vhosts, handler)
 	if compression {
 		handler = newGzipHandler(handler)
+		handler = newZstdHandler(handler)
 	}
 	return handler
 }
@@ -0,0 +1,39 @@
+package node
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var zstdPool = sync.Pool{
+	New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	},
+}
+
+// newZstdHandler compresses responses with zstd for clients that accept it, it takes precedence over gzip as it is
+// much cheaper on large responses such as batch witnesses
+func newZstdHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "zstd") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the response is only compressed once
+		r.Header.Del("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "zstd")
+
+		zw := zstdPool.Get().(*zstd.Encoder)
+		defer zstdPool.Put(zw)
+
+		zw.Reset(w)
+		defer zw.Close()
+
+		next.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, Writer: zw}, r)
+	})
+}
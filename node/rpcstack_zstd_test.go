@@ -0,0 +1,47 @@
+package node
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionHandlers(t *testing.T) {
+	body := bytes.Repeat([]byte(`"0x0123456789abcdef"`), 10_000)
+	handler := NewHTTPHandlerStack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}), nil, []string{"*"}, true)
+
+	request := func(acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	plain := request("")
+	require.Empty(t, plain.Header().Get("Content-Encoding"))
+	require.Equal(t, body, plain.Body.Bytes())
+
+	require.Equal(t, "gzip", request("gzip").Header().Get("Content-Encoding"))
+
+	// zstd is preferred and the response is only compressed once
+	compressed := request("gzip, zstd")
+	require.Equal(t, "zstd", compressed.Header().Get("Content-Encoding"))
+	require.Less(t, compressed.Body.Len(), len(body))
+
+	decoder, err := zstd.NewReader(compressed.Body)
+	require.NoError(t, err)
+	defer decoder.Close()
+	decompressed, err := io.ReadAll(decoder)
+	require.NoError(t, err)
+	require.Equal(t, body, decompressed)
+}
@@ -257,6 +257,9 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if origin := r.Header.Get("Origin"); origin != "" {
 		ctx = context.WithValue(ctx, "Origin", origin)
 	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		ctx = context.WithValue(ctx, "Authorization", auth)
+	}
 	if s.debugSingleRequest {
 		if v := r.Header.Get(dbg.HTTPHeader); v == "true" {
 			ctx = dbg.ContextWithDebug(ctx, true)
@@ -302,15 +305,23 @@ func validateRequest(r *http.Request) (int, error) {
 }
 
 func CheckJwtSecret(w http.ResponseWriter, r *http.Request, jwtSecret []byte) bool {
+	if err := ValidateJwtAuthorization(r.Header.Get("Authorization"), jwtSecret); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ValidateJwtAuthorization checks the value of an Authorization header carries a bearer token signed with the secret
+func ValidateJwtAuthorization(auth string, jwtSecret []byte) error {
 	var tokenStr string
 	// Check if JWT signature is correct
-	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+	if strings.HasPrefix(auth, "Bearer ") {
 		tokenStr = strings.TrimPrefix(auth, "Bearer ")
 	}
 
 	if len(tokenStr) == 0 {
-		http.Error(w, "missing token", http.StatusForbidden)
-		return false
+		return errors.New("missing token")
 	}
 
 	keyFunc := func(token *jwt.Token) (interface{}, error) {
@@ -326,20 +337,18 @@ func CheckJwtSecret(w http.ResponseWriter, r *http.Request, jwtSecret []byte) bo
 
 	switch {
 	case err != nil:
-		http.Error(w, err.Error(), http.StatusForbidden)
+		return err
 	case !token.Valid:
-		http.Error(w, "invalid token", http.StatusForbidden)
+		return errors.New("invalid token")
 	case !claims.VerifyExpiresAt(time.Now(), false): // optional
-		http.Error(w, "token is expired", http.StatusForbidden)
+		return errors.New("token is expired")
 	case claims.IssuedAt == nil:
-		http.Error(w, "missing issued-at", http.StatusForbidden)
+		return errors.New("missing issued-at")
 	case time.Since(claims.IssuedAt.Time) > jwtTokenExpiry:
-		http.Error(w, "stale token", http.StatusForbidden)
+		return errors.New("stale token")
 	case time.Until(claims.IssuedAt.Time) > jwtTokenExpiry:
-		http.Error(w, "future token", http.StatusForbidden)
-	default:
-		return true
+		return errors.New("future token")
 	}
 
-	return false
+	return nil
 }
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/dbutils"
+)
+
+// The SMT store is content addressed and nodes are deleted as soon as a change replaces them, so only the latest tree
+// can be read from TableSmt.  With history enabled a deleted node is archived together with the block it was deleted
+// at, and a tree that was materialised for a block (a checkpoint) can be read back as long as the nodes it needs
+// haven't been pruned.
+const TableSmtHistory = "HermezSmtHistory"                // node key -> block the node was deleted at + node value
+const TableSmtHistoryIndex = "HermezSmtHistoryIndex"      // block + node key -> empty, for pruning
+const TableSmtHistoryCheckpoints = "HermezSmtCheckpoints" // block -> root of the tree materialised for the block
+
+var historyStartKey = []byte("historyStart")
+
+var errStopIteration = errors.New("stop iteration")
+
+// NewHistoricalRoEriDb reads the tree with the given root, looking up nodes that have since been deleted in the
+// history tables
+func NewHistoricalRoEriDb(tx kv.Getter, root *big.Int) *EriRoDb {
+	return &EriRoDb{
+		kvTxRo:         tx,
+		historyLookups: true,
+		root:           new(big.Int).Set(root),
+	}
+}
+
+// RecordHistory archives every node deleted from now on as deleted at the given block
+func (m *EriDb) RecordHistory(blockNo uint64) {
+	m.recordHistory = true
+	m.historyBlock = blockNo
+}
+
+// UseHistory makes lookups of nodes missing from the tree fall back to the history tables, which is what unwinding
+// from a checkpoint other than the latest tree needs
+func (m *EriRoDb) UseHistory() {
+	m.historyLookups = true
+}
+
+func (m *EriDb) archive(k []byte) error {
+	data, err := m.kvTxRo.GetOne(TableSmt, k)
+	if err != nil || data == nil {
+		return err
+	}
+
+	v := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(v, m.historyBlock)
+	copy(v[8:], data)
+	if err := m.tx.Put(TableSmtHistory, k, v); err != nil {
+		return err
+	}
+
+	return m.tx.Put(TableSmtHistoryIndex, historyIndexKey(m.historyBlock, k), []byte{})
+}
+
+func (m *EriRoDb) getArchived(k []byte) ([]byte, error) {
+	data, err := m.kvTxRo.GetOne(TableSmtHistory, k)
+	if err != nil || len(data) < 8 {
+		return nil, err
+	}
+	return data[8:], nil
+}
+
+func historyIndexKey(blockNo uint64, k []byte) []byte {
+	key := make([]byte, 8+len(k))
+	binary.BigEndian.PutUint64(key, blockNo)
+	copy(key[8:], k)
+	return key
+}
+
+// GetHistoryStart returns the earliest block proofs can be served for from the history, found is false if history has
+// never been recorded
+func (m *EriRoDb) GetHistoryStart() (uint64, bool, error) {
+	data, err := m.kvTxRo.GetOne(TableStats, historyStartKey)
+	if err != nil || len(data) != 8 {
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint64(data), true, nil
+}
+
+func (m *EriDb) SetHistoryStart(blockNo uint64) error {
+	return m.tx.Put(TableStats, historyStartKey, dbutils.EncodeBlockNumber(blockNo))
+}
+
+// WriteCheckpoint records that the tree for the block was materialised with the given root
+func (m *EriDb) WriteCheckpoint(blockNo uint64, root *big.Int) error {
+	return m.tx.Put(TableSmtHistoryCheckpoints, dbutils.EncodeBlockNumber(blockNo), root.Bytes())
+}
+
+// GetCheckpointFrom returns the first checkpoint at or after the given block
+func (m *EriRoDb) GetCheckpointFrom(blockNo uint64) (uint64, *big.Int, bool, error) {
+	var checkpoint uint64
+	var root *big.Int
+	err := m.kvTxRo.ForEach(TableSmtHistoryCheckpoints, dbutils.EncodeBlockNumber(blockNo), func(k, v []byte) error {
+		checkpoint = binary.BigEndian.Uint64(k)
+		root = new(big.Int).SetBytes(v)
+		return errStopIteration
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return 0, nil, false, err
+	}
+	return checkpoint, root, root != nil, nil
+}
+
+// DeleteCheckpointsFrom drops the checkpoints of unwound blocks
+func (m *EriDb) DeleteCheckpointsFrom(blockNo uint64) error {
+	keys := make([][]byte, 0)
+	err := m.kvTxRo.ForEach(TableSmtHistoryCheckpoints, dbutils.EncodeBlockNumber(blockNo), func(k, _ []byte) error {
+		keys = append(keys, common.Copy(k))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := m.tx.Delete(TableSmtHistoryCheckpoints, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneHistory drops the nodes deleted at or before the given block along with the checkpoints before it, after which
+// proofs can be served from that block on.  It returns the number of nodes dropped
+func (m *EriDb) PruneHistory(before uint64) (int, error) {
+	start, found, err := m.GetHistoryStart()
+	if err != nil {
+		return 0, err
+	}
+	if !found || before <= start {
+		return 0, nil
+	}
+
+	indexKeys := make([][]byte, 0)
+	err = m.kvTxRo.ForEach(TableSmtHistoryIndex, nil, func(k, _ []byte) error {
+		if binary.BigEndian.Uint64(k[:8]) > before {
+			return errStopIteration
+		}
+		indexKeys = append(indexKeys, common.Copy(k))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, indexKey := range indexKeys {
+		k := indexKey[8:]
+		data, err := m.kvTxRo.GetOne(TableSmtHistory, k)
+		if err != nil {
+			return 0, err
+		}
+		// the node may have been re-created and deleted again since, in which case the later entry has to stay
+		if len(data) >= 8 && binary.BigEndian.Uint64(data[:8]) == binary.BigEndian.Uint64(indexKey[:8]) {
+			if err := m.tx.Delete(TableSmtHistory, k); err != nil {
+				return 0, err
+			}
+			pruned++
+		}
+		if err := m.tx.Delete(TableSmtHistoryIndex, indexKey); err != nil {
+			return 0, err
+		}
+	}
+
+	checkpointKeys := make([][]byte, 0)
+	err = m.kvTxRo.ForEach(TableSmtHistoryCheckpoints, nil, func(k, _ []byte) error {
+		if binary.BigEndian.Uint64(k) >= before {
+			return errStopIteration
+		}
+		checkpointKeys = append(checkpointKeys, common.Copy(k))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return 0, err
+	}
+	for _, k := range checkpointKeys {
+		if err := m.tx.Delete(TableSmtHistoryCheckpoints, k); err != nil {
+			return 0, err
+		}
+	}
+
+	return pruned, m.SetHistoryStart(before)
+}
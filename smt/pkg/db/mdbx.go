@@ -31,16 +31,22 @@ const TableAccountValues = "HermezSmtAccountValues"
 const TableMetadata = "HermezSmtMetadata"
 const TableHashKey = "HermezSmtHashKey"
 
-var HermezSmtTables = []string{TableSmt, TableStats, TableAccountValues, TableMetadata, TableHashKey}
+var HermezSmtTables = []string{TableSmt, TableStats, TableAccountValues, TableMetadata, TableHashKey, TableSmtHistory, TableSmtHistoryIndex, TableSmtHistoryCheckpoints}
 
 type EriDb struct {
 	kvTx kv.RwTx
 	tx   SmtDbTx
 	*EriRoDb
+
+	recordHistory bool
+	historyBlock  uint64
 }
 
 type EriRoDb struct {
 	kvTxRo kv.Getter
+
+	historyLookups bool
+	root           *big.Int // set for historical views, overrides the last root
 }
 
 func CreateEriDbBuckets(tx kv.RwTx) error {
@@ -69,6 +75,12 @@ func CreateEriDbBuckets(tx kv.RwTx) error {
 		return err
 	}
 
+	for _, table := range []string{TableSmtHistory, TableSmtHistoryIndex, TableSmtHistoryCheckpoints} {
+		if err = tx.CreateBucket(table); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -123,6 +135,10 @@ func (m *EriDb) RollbackBatch() {
 }
 
 func (m *EriRoDb) GetLastRoot() (*big.Int, error) {
+	if m.root != nil {
+		return new(big.Int).Set(m.root), nil
+	}
+
 	data, err := m.kvTxRo.GetOne(TableStats, []byte("lastRoot"))
 	if err != nil {
 		return big.NewInt(0), err
@@ -166,6 +182,12 @@ func (m *EriRoDb) Get(key utils.NodeKey) (utils.NodeValue12, error) {
 		return utils.NodeValue12{}, err
 	}
 
+	if data == nil && m.historyLookups {
+		if data, err = m.getArchived([]byte(k)); err != nil {
+			return utils.NodeValue12{}, err
+		}
+	}
+
 	if data == nil {
 		return utils.NodeValue12{}, nil
 	}
@@ -176,6 +198,14 @@ func (m *EriRoDb) Get(key utils.NodeKey) (utils.NodeValue12, error) {
 	return val, nil
 }
 
+// ForEachNode calls fn with the key of every node stored in the tree table, including the ones no longer reachable
+// from the root
+func (m *EriRoDb) ForEachNode(fn func(key utils.NodeKey) error) error {
+	return m.kvTxRo.ForEach(TableSmt, nil, func(k, _ []byte) error {
+		return fn(utils.ScalarToRoot(utils.ConvertHexToBigInt(string(k))))
+	})
+}
+
 func (m *EriDb) Insert(key utils.NodeKey, value utils.NodeValue12) error {
 	keyConc := utils.ArrayToScalar(key[:])
 	k := utils.ConvertBigIntToHex(keyConc)
@@ -190,12 +220,22 @@ func (m *EriDb) Insert(key utils.NodeKey, value utils.NodeValue12) error {
 }
 
 func (m *EriDb) Delete(key string) error {
+	if m.recordHistory {
+		if err := m.archive([]byte(key)); err != nil {
+			return err
+		}
+	}
 	return m.tx.Delete(TableSmt, []byte(key))
 }
 
 func (m *EriDb) DeleteByNodeKey(key utils.NodeKey) error {
 	keyConc := utils.ArrayToScalar(key[:])
 	k := utils.ConvertBigIntToHex(keyConc)
+	if m.recordHistory {
+		if err := m.archive([]byte(k)); err != nil {
+			return err
+		}
+	}
 	return m.tx.Delete(TableSmt, []byte(k))
 }
 
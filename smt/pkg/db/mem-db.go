@@ -280,3 +280,19 @@ func (m *MemDb) GetDb() map[string][]string {
 
 	return m.Db
 }
+
+func (m *MemDb) ForEachNode(fn func(key utils.NodeKey) error) error {
+	m.lock.RLock()
+	keys := make([]string, 0, len(m.Db))
+	for k := range m.Db {
+		keys = append(keys, k)
+	}
+	m.lock.RUnlock()
+
+	for _, k := range keys {
+		if err := fn(utils.ScalarToRoot(utils.ConvertHexToBigInt(k))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
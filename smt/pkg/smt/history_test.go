@@ -0,0 +1,114 @@
+package smt_test
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/holiman/uint256"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func leafValues(t *testing.T, ro *smt.RoSMT) []uint64 {
+	t.Helper()
+
+	root, err := ro.DbRo.GetLastRoot()
+	require.NoError(t, err)
+
+	values := make([]uint64, 0)
+	err = ro.Traverse(context.Background(), root, func(prefix []byte, k utils.NodeKey, v utils.NodeValue12) (bool, error) {
+		if !v.IsFinalNode() {
+			return true, nil
+		}
+		value, err := ro.DbRo.Get(*v.Get4to8())
+		if err != nil {
+			return false, err
+		}
+		values = append(values, value[0].Uint64())
+		return false, nil
+	})
+	require.NoError(t, err)
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+func TestSMTHistory(t *testing.T) {
+	ctx := context.Background()
+	dbi, err := mdbx.NewTemporaryMdbx(ctx, t.TempDir())
+	require.NoError(t, err)
+	defer dbi.Close()
+	tx, err := dbi.BeginRw(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, db.CreateEriDbBuckets(tx))
+
+	eridb := db.NewEriDb(tx)
+	s := smt.NewSMT(eridb, false)
+
+	a := libcommon.HexToAddress("0xaa")
+	b := libcommon.HexToAddress("0xbb")
+	setBalances := func(blockNo uint64, balances map[libcommon.Address]uint64) *big.Int {
+		accChanges := make(map[libcommon.Address]*accounts.Account)
+		for addr, balance := range balances {
+			acc := accounts.NewAccount()
+			acc.Balance = *uint256.NewInt(balance)
+			accChanges[addr] = &acc
+		}
+		eridb.RecordHistory(blockNo)
+		_, _, err := s.SetStorage(ctx, "test", accChanges, map[libcommon.Address]string{}, map[libcommon.Address]map[string]string{})
+		require.NoError(t, err)
+		root := s.LastRoot()
+		require.NoError(t, eridb.WriteCheckpoint(blockNo, root))
+		return root
+	}
+
+	require.NoError(t, eridb.SetHistoryStart(1))
+	root1 := setBalances(1, map[libcommon.Address]uint64{a: 100, b: 5})
+	root2 := setBalances(2, map[libcommon.Address]uint64{a: 200})
+	root3 := setBalances(3, map[libcommon.Address]uint64{a: 300})
+
+	// the current tree is untouched by the history
+	require.Equal(t, []uint64{5, 300}, leafValues(t, smt.NewRoSMT(db.NewRoEriDb(tx))))
+
+	// older trees are read back through the archived nodes
+	require.Equal(t, []uint64{5, 100}, leafValues(t, smt.NewRoSMT(db.NewHistoricalRoEriDb(tx, root1))))
+	require.Equal(t, []uint64{5, 200}, leafValues(t, smt.NewRoSMT(db.NewHistoricalRoEriDb(tx, root2))))
+	require.Equal(t, []uint64{5, 300}, leafValues(t, smt.NewRoSMT(db.NewHistoricalRoEriDb(tx, root3))))
+
+	checkpoint, root, found, err := eridb.GetCheckpointFrom(2)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(2), checkpoint)
+	require.Equal(t, root2, root)
+
+	// pruning drops the trees before the cut off but keeps the rest
+	pruned, err := eridb.PruneHistory(2)
+	require.NoError(t, err)
+	require.Greater(t, pruned, 0)
+
+	start, found, err := eridb.GetHistoryStart()
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(2), start)
+
+	checkpoint, _, found, err = eridb.GetCheckpointFrom(0)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(2), checkpoint)
+
+	require.Equal(t, []uint64{5, 200}, leafValues(t, smt.NewRoSMT(db.NewHistoricalRoEriDb(tx, root2))))
+
+	// unwound checkpoints are dropped
+	require.NoError(t, eridb.DeleteCheckpointsFrom(3))
+	_, _, found, err = eridb.GetCheckpointFrom(3)
+	require.NoError(t, err)
+	require.False(t, found)
+}
@@ -0,0 +1,485 @@
+package smt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/log/v3"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//	CheckTree walks the tree from the stored root and checks every node it reaches is in the db and hashes to its
+//	key, reporting what it finds as issues at the path of the node. RebuildSubtrees then repairs the tree in place
+//	by building the sub-trees under the reported paths again from their leaves, keeping the rest of the tree as it
+//	is stored and re-hashing only the branches above the rebuilt sub-trees.
+//
+//	Nodes the walk doesn't reach are only reported, never deleted: the batch insert leaves the value nodes it
+//	replaces behind, and the SMT history reads old nodes from the same table.
+//////////////////////////////////////////////////////////////////////////////
+
+// IssueKind tells what is wrong with a node of the tree
+type IssueKind string
+
+const (
+	IssueMissingNode      IssueKind = "missing node"
+	IssueHashMismatch     IssueKind = "hash mismatch"
+	IssueMissingHashKey   IssueKind = "missing hash key"
+	IssueMissingKeySource IssueKind = "missing key source"
+	IssueWrongValue       IssueKind = "wrong value"
+	IssueExtraLeaf        IssueKind = "extra leaf"
+	IssueMissingLeaf      IssueKind = "missing leaf"
+)
+
+// NodeIssue is a problem with the node reached from the root by Path, 0 going left and 1 going right
+type NodeIssue struct {
+	Kind IssueKind
+	Path []int
+	Hash utils.NodeKey
+	// Key is the full key of the leaf for the issues found at a leaf
+	Key    utils.NodeKey
+	Detail string
+}
+
+func (i NodeIssue) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s at path %s", i.Kind, FormatPath(i.Path))
+	if !i.Hash.IsZero() {
+		fmt.Fprintf(&sb, " node %s", utils.ConvertBigIntToHex(i.Hash.ToBigInt()))
+	}
+	if !i.Key.IsZero() {
+		fmt.Fprintf(&sb, " key %s", utils.ConvertBigIntToHex(i.Key.ToBigInt()))
+	}
+	if i.Detail != "" {
+		fmt.Fprintf(&sb, ": %s", i.Detail)
+	}
+	return sb.String()
+}
+
+// FormatPath prints the path of a node as its bits from the root
+func FormatPath(path []int) string {
+	if len(path) == 0 {
+		return "root"
+	}
+	return pathString(path)
+}
+
+// TreeLeaf is a leaf reached by CheckTree whose nodes hash correctly
+type TreeLeaf struct {
+	Path []int
+	Hash utils.NodeKey
+	Key  utils.NodeKey
+	// KeySource is nil when the key source of the leaf is missing
+	KeySource []byte
+	Value     *big.Int
+}
+
+type TreeCheck struct {
+	Root     utils.NodeKey
+	Branches int
+	Leaves   int
+	Issues   []NodeIssue
+
+	// the keys of the nodes reached, kept only when asked for as they take a lot of memory for a full tree
+	visited map[utils.NodeKey]struct{}
+}
+
+// NodeIterator is implemented by the dbs that can list the nodes they store
+type NodeIterator interface {
+	ForEachNode(fn func(key utils.NodeKey) error) error
+}
+
+// CheckTree walks the whole tree from the stored root checking its nodes. onLeaf, when set, is called with every leaf
+// whose nodes are sound. trackVisited keeps the keys of the nodes reached for ForEachOrphanedNode.
+func (s *RoSMT) CheckTree(ctx context.Context, logPrefix string, trackVisited bool, onLeaf func(leaf *TreeLeaf) error) (*TreeCheck, error) {
+	root, err := s.getLastRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	check := &TreeCheck{Root: root}
+	if trackVisited {
+		check.visited = make(map[utils.NodeKey]struct{})
+	}
+
+	startTime := time.Now()
+	if err := s.checkNode(ctx, check, root, make([]int, 0, 256), onLeaf); err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("[%s] Finished checking the tree in %v", logPrefix, time.Since(startTime)), "branches", check.Branches, "leaves", check.Leaves, "issues", len(check.Issues))
+
+	return check, nil
+}
+
+func (s *RoSMT) checkNode(ctx context.Context, check *TreeCheck, hash utils.NodeKey, path []int, onLeaf func(leaf *TreeLeaf) error) error {
+	if hash.IsZero() {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	v, ok, err := s.getCheckedNode(check, hash, path)
+	if err != nil || !ok {
+		return err
+	}
+
+	if !v.IsFinalNode() {
+		check.Branches++
+		if err := s.checkNode(ctx, check, *v.Get0to4(), append(path, 0), onLeaf); err != nil {
+			return err
+		}
+		return s.checkNode(ctx, check, *v.Get4to8(), append(path, 1), onLeaf)
+	}
+
+	check.Leaves++
+	key := *utils.JoinKey(path, *v.Get0to4())
+	valueHash := *v.Get4to8()
+	value, ok, err := s.getCheckedNode(check, valueHash, path)
+	if err != nil || !ok {
+		return err
+	}
+
+	if hashKey, err := s.DbRo.GetHashKey(hash); err != nil || hashKey != key {
+		check.Issues = append(check.Issues, NodeIssue{Kind: IssueMissingHashKey, Path: slices.Clone(path), Hash: hash, Key: key})
+	}
+	keySource, err := s.DbRo.GetKeySource(key)
+	if err != nil {
+		keySource = nil
+		check.Issues = append(check.Issues, NodeIssue{Kind: IssueMissingKeySource, Path: slices.Clone(path), Hash: hash, Key: key})
+	}
+
+	if onLeaf == nil {
+		return nil
+	}
+	return onLeaf(&TreeLeaf{
+		Path:      slices.Clone(path),
+		Hash:      hash,
+		Key:       key,
+		KeySource: keySource,
+		Value:     utils.ArrayBigToScalar(utils.BigIntArrayFromNodeValue8(value.GetNodeValue8())),
+	})
+}
+
+// getCheckedNode reads a node and checks it hashes to its key, reporting an issue and returning false otherwise
+func (s *RoSMT) getCheckedNode(check *TreeCheck, hash utils.NodeKey, path []int) (utils.NodeValue12, bool, error) {
+	v, err := s.DbRo.Get(hash)
+	if err != nil {
+		return utils.NodeValue12{}, false, err
+	}
+	if v[0] == nil {
+		check.Issues = append(check.Issues, NodeIssue{Kind: IssueMissingNode, Path: slices.Clone(path), Hash: hash})
+		return v, false, nil
+	}
+
+	var capacity [4]uint64
+	for i := range capacity {
+		if v[8+i] != nil {
+			capacity[i] = v[8+i].Uint64()
+		}
+	}
+	if actual := utils.Hash(v.StripCapacity(), capacity); actual != hash {
+		check.Issues = append(check.Issues, NodeIssue{
+			Kind:   IssueHashMismatch,
+			Path:   slices.Clone(path),
+			Hash:   hash,
+			Detail: fmt.Sprintf("content hashes to %s", utils.ConvertBigIntToHex(utils.ArrayToScalar(actual[:]))),
+		})
+		return v, false, nil
+	}
+
+	if check.visited != nil {
+		check.visited[hash] = struct{}{}
+	}
+	return v, true, nil
+}
+
+// ForEachOrphanedNode calls fn with every node of the db the check didn't reach from the root. The check has to keep
+// the visited nodes.
+func (s *RoSMT) ForEachOrphanedNode(check *TreeCheck, fn func(key utils.NodeKey) error) error {
+	if check.visited == nil {
+		return errors.New("the tree check didn't keep the visited nodes")
+	}
+	iterator, ok := s.DbRo.(NodeIterator)
+	if !ok {
+		return errors.New("db cannot list its nodes")
+	}
+	return iterator.ForEachNode(func(key utils.NodeKey) error {
+		if _, ok := check.visited[key]; ok {
+			return nil
+		}
+		return fn(key)
+	})
+}
+
+// FindLeaf follows the path of the key down from the root. It returns the path of the node the search ends at, which
+// is where the leaf of the key is or would be, and the value of the leaf, nil when the key isn't in the tree.
+func (s *RoSMT) FindLeaf(k utils.NodeKey) ([]int, *big.Int, error) {
+	hash, err := s.getLastRoot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var path []int
+	for level := 0; !hash.IsZero(); level++ {
+		v, err := s.DbRo.Get(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v[0] == nil {
+			return path, nil, nil
+		}
+
+		if v.IsFinalNode() {
+			if *utils.JoinKey(path, *v.Get0to4()) != k {
+				return path, nil, nil
+			}
+			value, err := s.DbRo.Get(*v.Get4to8())
+			if err != nil {
+				return nil, nil, err
+			}
+			if value[0] == nil {
+				return path, nil, nil
+			}
+			return path, utils.ArrayBigToScalar(utils.BigIntArrayFromNodeValue8(value.GetNodeValue8())), nil
+		}
+
+		bit := keyBit(k, level)
+		path = append(path, bit)
+		if bit == 0 {
+			hash = *v.Get0to4()
+		} else {
+			hash = *v.Get4to8()
+		}
+	}
+
+	return path, nil, nil
+}
+
+// Subtrees holds the sub-trees RebuildSubtrees replaces, each rooted at the node its path reaches from the root, along
+// with the leaves they are built from
+type Subtrees struct {
+	roots     map[string]*subtreeLeaves
+	ancestors map[string]struct{}
+	maxDepth  int
+}
+
+type subtreeLeaves struct {
+	keys   []utils.NodeKey
+	values []utils.NodeValue8
+}
+
+// NewSubtrees returns the sub-trees rooted at the paths, dropping the paths that are within another sub-tree
+func NewSubtrees(paths [][]int) *Subtrees {
+	t := &Subtrees{
+		roots:     make(map[string]*subtreeLeaves),
+		ancestors: make(map[string]struct{}),
+	}
+
+	sorted := slices.Clone(paths)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) < len(sorted[j]) })
+	for _, path := range sorted {
+		covered := false
+		for i := 0; i <= len(path) && !covered; i++ {
+			_, covered = t.roots[pathString(path[:i])]
+		}
+		if covered {
+			continue
+		}
+
+		t.roots[pathString(path)] = &subtreeLeaves{}
+		for i := 0; i < len(path); i++ {
+			t.ancestors[pathString(path[:i])] = struct{}{}
+		}
+		t.maxDepth = max(t.maxDepth, len(path))
+	}
+
+	return t
+}
+
+// Len returns the number of sub-trees
+func (t *Subtrees) Len() int {
+	return len(t.roots)
+}
+
+// Contains tells whether the key lies within one of the sub-trees
+func (t *Subtrees) Contains(k utils.NodeKey) bool {
+	return t.find(k) != nil
+}
+
+// Add adds a leaf to the sub-tree its key lies within, returning false when it isn't within any of them
+func (t *Subtrees) Add(k utils.NodeKey, v utils.NodeValue8) bool {
+	leaves := t.find(k)
+	if leaves == nil {
+		return false
+	}
+	leaves.keys = append(leaves.keys, k)
+	leaves.values = append(leaves.values, v)
+	return true
+}
+
+func (t *Subtrees) find(k utils.NodeKey) *subtreeLeaves {
+	prefix := make([]byte, 0, t.maxDepth)
+	for level := 0; level <= t.maxDepth; level++ {
+		if leaves, ok := t.roots[string(prefix)]; ok {
+			return leaves
+		}
+		prefix = append(prefix, '0'+byte(keyBit(k, level)))
+	}
+	return nil
+}
+
+// RebuildSubtrees builds the sub-trees again from their leaves and hashes the branches above them up to a new root,
+// reading everything else from the stored tree. As with GenerateFromKVBulk the key sources of the leaves are left to
+// the caller.
+func (s *SMT) RebuildSubtrees(ctx context.Context, logPrefix string, t *Subtrees) ([4]uint64, error) {
+	s.clearUpMutex.Lock()
+	defer s.clearUpMutex.Unlock()
+
+	root, err := s.getLastRoot()
+	if err != nil {
+		return [4]uint64{}, err
+	}
+
+	startTime := time.Now()
+	b := &bulkBuilder{result: utils.NewCalcAndPrepareJobResult(s.Db)}
+	node, err := s.rebuildNode(ctx, b, t, root, make([]int, 0, 256))
+	if err != nil {
+		return [4]uint64{}, err
+	}
+	finalRoot := b.childHash(node, 0)
+	if err := b.result.Save(); err != nil {
+		return [4]uint64{}, err
+	}
+
+	s.updateDepth(b.depth)
+	if err := s.setLastRoot(finalRoot); err != nil {
+		return [4]uint64{}, err
+	}
+
+	log.Info(fmt.Sprintf("[%s] Rebuilt sub-trees in %v", logPrefix, time.Since(startTime)), "subtrees", t.Len(), "root", utils.ConvertBigIntToHex(utils.ArrayToScalar(finalRoot[:])))
+
+	return finalRoot, nil
+}
+
+func (s *SMT) rebuildNode(ctx context.Context, b *bulkBuilder, t *Subtrees, hash utils.NodeKey, path []int) (*bulkSubtree, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	p := pathString(path)
+	if leaves, ok := t.roots[p]; ok {
+		return b.buildSubtree(leaves, len(path))
+	}
+	if _, ok := t.ancestors[p]; !ok {
+		return s.storedSubtree(hash, path)
+	}
+
+	var left, right utils.NodeKey
+	if !hash.IsZero() {
+		v, err := s.Db.Get(hash)
+		if err != nil {
+			return nil, err
+		}
+		if v[0] == nil || v.IsFinalNode() {
+			return nil, fmt.Errorf("no branch at path %s above the sub-trees to rebuild", FormatPath(path))
+		}
+		left, right = *v.Get0to4(), *v.Get4to8()
+	}
+
+	leftNode, err := s.rebuildNode(ctx, b, t, left, append(path, 0))
+	if err != nil {
+		return nil, err
+	}
+	rightNode, err := s.rebuildNode(ctx, b, t, right, append(path, 1))
+	if err != nil {
+		return nil, err
+	}
+	return b.combine(leftNode, rightNode, len(path)), nil
+}
+
+// storedSubtree reads the node at the path as the sub-tree it roots, which is kept as it is
+func (s *SMT) storedSubtree(hash utils.NodeKey, path []int) (*bulkSubtree, error) {
+	if hash.IsZero() {
+		return &bulkSubtree{}, nil
+	}
+
+	v, err := s.Db.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	if v[0] == nil {
+		return nil, fmt.Errorf("node %s at path %s is missing outside the sub-trees to rebuild", utils.ConvertBigIntToHex(hash.ToBigInt()), FormatPath(path))
+	}
+	if !v.IsFinalNode() {
+		// the count only tells apart empty sub-trees, single leaves and the rest
+		return &bulkSubtree{count: 2, hash: hash}, nil
+	}
+
+	value, err := s.Db.Get(*v.Get4to8())
+	if err != nil {
+		return nil, err
+	}
+	if value[0] == nil {
+		return nil, fmt.Errorf("value of leaf %s at path %s is missing outside the sub-trees to rebuild", utils.ConvertBigIntToHex(hash.ToBigInt()), FormatPath(path))
+	}
+	return &bulkSubtree{count: 1, key: *utils.JoinKey(path, *v.Get0to4()), value: *value.GetNodeValue8()}, nil
+}
+
+// buildSubtree builds the sub-tree at the given level from its leaves
+func (b *bulkBuilder) buildSubtree(leaves *subtreeLeaves, level int) (*bulkSubtree, error) {
+	sort.Sort(leaves)
+	switch len(leaves.keys) {
+	case 0:
+		return &bulkSubtree{}, nil
+	case 1:
+		return &bulkSubtree{count: 1, key: leaves.keys[0], value: leaves.values[0]}, nil
+	}
+
+	sub := &bulkBuilder{keys: leaves.keys, values: leaves.values, result: b.result}
+	hash, err := sub.hashNode(0, len(leaves.keys), level)
+	if err != nil {
+		return nil, err
+	}
+	b.depth = max(b.depth, sub.depth)
+	return &bulkSubtree{count: len(leaves.keys), hash: hash}, nil
+}
+
+// sort.Interface sorting the leaves bitwise by key, keeping the values along
+
+func (l *subtreeLeaves) Len() int {
+	return len(l.keys)
+}
+
+func (l *subtreeLeaves) Less(i, j int) bool {
+	for level := 0; level < 256; level++ {
+		if a, b := keyBit(l.keys[i], level), keyBit(l.keys[j], level); a != b {
+			return a < b
+		}
+	}
+	return false
+}
+
+func (l *subtreeLeaves) Swap(i, j int) {
+	l.keys[i], l.keys[j] = l.keys[j], l.keys[i]
+	l.values[i], l.values[j] = l.values[j], l.values[i]
+}
+
+func pathString(path []int) string {
+	b := make([]byte, len(path))
+	for i, bit := range path {
+		b[i] = '0' + byte(bit)
+	}
+	return string(b)
+}
@@ -0,0 +1,172 @@
+package smt_test
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"gotest.tools/v3/assert"
+)
+
+func prepareCheckSmt(t *testing.T, values map[utils.NodeKey]utils.NodeValue8) *smt.SMT {
+	keys := make([]utils.NodeKey, 0, len(values))
+	s := smt.NewSMT(nil, false)
+	for k, v := range values {
+		keys = append(keys, k)
+		assert.NilError(t, s.Db.InsertAccountValue(k, v))
+		assert.NilError(t, s.Db.InsertKeySource(k, []byte{utils.KEY_BALANCE}))
+	}
+	_, err := s.GenerateFromKVBulk(context.Background(), "", keys)
+	assert.NilError(t, err)
+	return s
+}
+
+func randomCheckValues(n int) map[utils.NodeKey]utils.NodeValue8 {
+	values := make(map[utils.NodeKey]utils.NodeValue8)
+	for len(values) < n {
+		v := big.NewInt(rand.Int63() + 1)
+		values[utils.ScalarToNodeKey(v)] = utils.ScalarToNodeValue8(v)
+	}
+	return values
+}
+
+func checkTreeLeaves(t *testing.T, s *smt.SMT) (*smt.TreeCheck, []*smt.TreeLeaf) {
+	var leaves []*smt.TreeLeaf
+	check, err := s.CheckTree(context.Background(), "", true, func(leaf *smt.TreeLeaf) error {
+		leaves = append(leaves, leaf)
+		return nil
+	})
+	assert.NilError(t, err)
+	return check, leaves
+}
+
+// rebuildAt rebuilds the sub-trees at the paths from the given values
+func rebuildAt(t *testing.T, s *smt.SMT, paths [][]int, values map[utils.NodeKey]utils.NodeValue8) [4]uint64 {
+	subtrees := smt.NewSubtrees(paths)
+	for k, v := range values {
+		subtrees.Add(k, v)
+		assert.NilError(t, s.Db.InsertKeySource(k, []byte{utils.KEY_BALANCE}))
+	}
+	root, err := s.RebuildSubtrees(context.Background(), "", subtrees)
+	assert.NilError(t, err)
+	return root
+}
+
+func TestCheckTree(t *testing.T) {
+	values := randomCheckValues(1000)
+	s := prepareCheckSmt(t, values)
+
+	check, leaves := checkTreeLeaves(t, s)
+	assert.Equal(t, 0, len(check.Issues))
+	assert.Equal(t, len(values), check.Leaves)
+	assert.Assert(t, check.Branches >= len(values)-1)
+	for _, leaf := range leaves {
+		v := values[leaf.Key]
+		assert.Equal(t, 0, leaf.Value.Cmp(utils.ArrayBigToScalar(utils.BigIntArrayFromNodeValue8(&v))))
+
+		path, value, err := s.FindLeaf(leaf.Key)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, leaf.Path, path)
+		assert.Equal(t, 0, value.Cmp(leaf.Value))
+	}
+
+	orphans := 0
+	assert.NilError(t, s.ForEachOrphanedNode(check, func(utils.NodeKey) error {
+		orphans++
+		return nil
+	}))
+	assert.Equal(t, 0, orphans)
+}
+
+func TestRebuildSubtrees(t *testing.T) {
+	values := randomCheckValues(1000)
+	expected := prepareCheckSmt(t, values)
+	expectedRoot := expected.LastRoot()
+
+	t.Run("corrupted nodes", func(t *testing.T) {
+		s := prepareCheckSmt(t, values)
+		_, leaves := checkTreeLeaves(t, s)
+
+		// break the branch above a leaf and drop another leaf
+		branchPath := leaves[10].Path[:len(leaves[10].Path)-1]
+		var branch utils.NodeKey
+		assert.NilError(t, s.Traverse(context.Background(), s.LastRoot(), func(prefix []byte, k utils.NodeKey, v utils.NodeValue12) (bool, error) {
+			if len(prefix) == len(branchPath) {
+				for i := range prefix {
+					if int(prefix[i]) != branchPath[i] {
+						return false, nil
+					}
+				}
+				branch = k
+				return false, nil
+			}
+			return true, nil
+		}))
+		corrupted, err := s.Db.Get(branch)
+		assert.NilError(t, err)
+		corrupted[0] = new(big.Int).Add(corrupted[0], big.NewInt(1))
+		assert.NilError(t, s.Db.Insert(branch, corrupted))
+		assert.NilError(t, s.Db.DeleteByNodeKey(leaves[500].Hash))
+
+		check, _ := checkTreeLeaves(t, s)
+		assert.Equal(t, 2, len(check.Issues))
+		assert.Equal(t, smt.IssueHashMismatch, check.Issues[0].Kind)
+		assert.DeepEqual(t, branchPath, check.Issues[0].Path)
+		assert.Equal(t, smt.IssueMissingNode, check.Issues[1].Kind)
+		assert.DeepEqual(t, leaves[500].Path, check.Issues[1].Path)
+
+		root := rebuildAt(t, s, [][]int{check.Issues[0].Path, check.Issues[1].Path}, values)
+		assert.Equal(t, 0, expectedRoot.Cmp(utils.ArrayToScalar(root[:])))
+
+		check, _ = checkTreeLeaves(t, s)
+		assert.Equal(t, 0, len(check.Issues))
+		assert.Equal(t, len(values), check.Leaves)
+	})
+
+	t.Run("changed leaves", func(t *testing.T) {
+		s := prepareCheckSmt(t, values)
+		_, leaves := checkTreeLeaves(t, s)
+
+		changed := make(map[utils.NodeKey]utils.NodeValue8)
+		for k, v := range values {
+			changed[k] = v
+		}
+		// a new value, a removed leaf and a new leaf
+		changed[leaves[1].Key] = utils.ScalarToNodeValue8(big.NewInt(42))
+		delete(changed, leaves[2].Key)
+		added := randomCheckValues(1)
+		var paths [][]int
+		for k, v := range added {
+			changed[k] = v
+			path, value, err := s.FindLeaf(k)
+			assert.NilError(t, err)
+			assert.Assert(t, value == nil)
+			paths = append(paths, path)
+		}
+		paths = append(paths, leaves[1].Path, leaves[2].Path)
+
+		root := rebuildAt(t, s, paths, changed)
+		assert.Equal(t, 0, prepareCheckSmt(t, changed).LastRoot().Cmp(utils.ArrayToScalar(root[:])))
+
+		check, _ := checkTreeLeaves(t, s)
+		assert.Equal(t, 0, len(check.Issues))
+		assert.Equal(t, len(changed), check.Leaves)
+
+		// the replaced nodes are left behind
+		orphans := 0
+		assert.NilError(t, s.ForEachOrphanedNode(check, func(utils.NodeKey) error {
+			orphans++
+			return nil
+		}))
+		assert.Assert(t, orphans > 0)
+	})
+
+	t.Run("whole tree", func(t *testing.T) {
+		s := prepareCheckSmt(t, values)
+		root := rebuildAt(t, s, [][]int{{}, {0, 1}}, values)
+		assert.Equal(t, 0, expectedRoot.Cmp(utils.ArrayToScalar(root[:])))
+	})
+}
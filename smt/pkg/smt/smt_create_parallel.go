@@ -0,0 +1,284 @@
+package smt
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/zk"
+	"github.com/ledgerwatch/log/v3"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+//	GenerateFromKVBulkParallel builds the same tree as GenerateFromKVBulk but spreads the hashing across cores.
+//
+//	Once the keys are sorted bitwise, the keys sharing their first n path bits are contiguous and form a
+//	sub-tree of their own. Every such partition is read from the db, then built and hashed on a worker
+//	goroutine, while the db reads and writes stay on the calling goroutine. When all partitions are done the
+//	levels above them are hashed from the partition roots in key order, so the result doesn't depend on the
+//	order the workers finish in.
+//
+//	A partition holding a single key has no root of its own, its leaf floats up to the first level where it
+//	has a non empty sibling, so those are kept as key and value and only hashed as part of the merge.
+//////////////////////////////////////////////////////////////////////////////
+
+const (
+	// maxKeysPerPartition bounds how many values a partition holds in memory while it is hashed
+	maxKeysPerPartition = 1 << 15
+	maxPartitionBits    = 16
+)
+
+type bulkSubtree struct {
+	count int
+	// key and value of the leaf of a partition holding a single key
+	key   utils.NodeKey
+	value utils.NodeValue8
+	// hash of the root of a partition holding more keys
+	hash   [4]uint64
+	depth  int
+	result *utils.CalcAndPrepareJobResult
+	err    error
+}
+
+// bulkBuilder hashes the nodes of a sorted range of keys, collecting what is to be saved in its result
+type bulkBuilder struct {
+	keys   []utils.NodeKey
+	values []utils.NodeValue8
+	result *utils.CalcAndPrepareJobResult
+	depth  int
+}
+
+func (s *SMT) GenerateFromKVBulkParallel(ctx context.Context, logPrefix string, nodeKeys []utils.NodeKey, workers int) ([4]uint64, error) {
+	s.clearUpMutex.Lock()
+	defer s.clearUpMutex.Unlock()
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	log.Info(fmt.Sprintf("[%s] Building tree in parallel started", logPrefix), "values", len(nodeKeys), "workers", workers)
+
+	sortStartTime := time.Now()
+	utils.SortNodeKeysBitwiseAsc(nodeKeys)
+	log.Info(fmt.Sprintf("[%s] Keys sorted in %v", logPrefix, time.Since(sortStartTime)))
+
+	buildStartTime := time.Now()
+	partitionBits := bulkPartitionBits(len(nodeKeys), workers)
+	bounds := bulkPartitionBounds(nodeKeys, partitionBits)
+	parts := make([]*bulkSubtree, 1<<partitionBits)
+
+	progressChan, stopProgressPrinter := zk.ProgressPrinterWithoutValues(fmt.Sprintf("[%s] SMT regenerate progress", logPrefix), uint64(len(nodeKeys)))
+	defer stopProgressPrinter()
+
+	// the channel holds a result for every running worker so none of them blocks when we return early
+	results := make(chan *bulkSubtree, workers)
+	inFlight := 0
+	done := uint64(0)
+	saveNext := func() error {
+		part := <-results
+		inFlight--
+		if part.err != nil {
+			return part.err
+		}
+		if err := part.result.Save(); err != nil {
+			return err
+		}
+		part.result = nil
+		done += uint64(part.count)
+		progressChan <- done
+		return nil
+	}
+
+	for p := range parts {
+		for inFlight >= workers {
+			if err := saveNext(); err != nil {
+				return [4]uint64{}, err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return [4]uint64{}, fmt.Errorf("[%s] Context done", logPrefix)
+		default:
+		}
+
+		keys := nodeKeys[bounds[p]:bounds[p+1]]
+		values := make([]utils.NodeValue8, len(keys))
+		for i, k := range keys {
+			v, err := s.Db.GetAccountValue(k)
+			if err != nil {
+				return [4]uint64{}, err
+			}
+			values[i] = v
+		}
+
+		part := &bulkSubtree{count: len(keys)}
+		parts[p] = part
+		if part.count == 1 {
+			part.key, part.value = keys[0], values[0]
+		}
+		if part.count < 2 {
+			continue
+		}
+
+		inFlight++
+		go func() {
+			b := &bulkBuilder{keys: keys, values: values, result: utils.NewCalcAndPrepareJobResult(s.Db)}
+			part.hash, part.err = b.hashNode(0, len(keys), partitionBits)
+			part.depth, part.result = b.depth, b.result
+			results <- part
+		}()
+	}
+	for inFlight > 0 {
+		if err := saveNext(); err != nil {
+			return [4]uint64{}, err
+		}
+	}
+
+	// special case where no values were inserted
+	if len(nodeKeys) == 0 {
+		return [4]uint64{}, nil
+	}
+
+	top := &bulkBuilder{result: utils.NewCalcAndPrepareJobResult(s.Db)}
+	root := top.merge(parts, 0, partitionBits)
+	finalRoot := top.childHash(root, 0)
+	if err := top.result.Save(); err != nil {
+		return [4]uint64{}, err
+	}
+
+	depth := top.depth
+	for _, part := range parts {
+		depth = max(depth, part.depth)
+	}
+	s.updateDepth(depth)
+
+	if err := s.setLastRoot(finalRoot); err != nil {
+		return [4]uint64{}, err
+	}
+
+	log.Info(fmt.Sprintf("[%s] Finished the parallel tree build in %v", logPrefix, time.Since(buildStartTime)), "partitions", len(parts))
+
+	return finalRoot, nil
+}
+
+// bulkPartitionBits picks how many leading key bits the partitions are split on: enough partitions to keep all the
+// workers busy and few enough keys in each to bound the memory a running worker holds
+func bulkPartitionBits(keysCount, workers int) int {
+	partitionBits := bits.Len(uint(workers * 4))
+	for partitionBits < maxPartitionBits && keysCount>>partitionBits > maxKeysPerPartition {
+		partitionBits++
+	}
+	return min(partitionBits, maxPartitionBits)
+}
+
+// bulkPartitionBounds returns where the partitions start in the bitwise sorted keys, partition p spanning
+// keys[bounds[p]:bounds[p+1]]
+func bulkPartitionBounds(nodeKeys []utils.NodeKey, partitionBits int) []int {
+	bounds := make([]int, 1<<partitionBits+1)
+	for p := range bounds {
+		bounds[p] = sort.Search(len(nodeKeys), func(i int) bool {
+			return keyPrefix(nodeKeys[i], partitionBits) >= p
+		})
+	}
+	return bounds
+}
+
+// keyBit returns the bit of the key's path at the given level
+func keyBit(k utils.NodeKey, level int) int {
+	return int(k[level%4]>>(level/4)) & 1
+}
+
+func keyPrefix(k utils.NodeKey, prefixBits int) int {
+	prefix := 0
+	for level := 0; level < prefixBits; level++ {
+		prefix = prefix<<1 | keyBit(k, level)
+	}
+	return prefix
+}
+
+// hashNode hashes the node at the given level holding keys[lo:hi], which share the bits of their path above it
+func (b *bulkBuilder) hashNode(lo, hi, level int) ([4]uint64, error) {
+	switch hi - lo {
+	case 0:
+		return [4]uint64{}, nil
+	case 1:
+		return b.hashLeaf(b.keys[lo], &b.values[lo], level), nil
+	}
+	if level >= 256 {
+		return [4]uint64{}, fmt.Errorf("duplicate key %v", b.keys[lo])
+	}
+
+	split := lo + sort.Search(hi-lo, func(i int) bool { return keyBit(b.keys[lo+i], level) == 1 })
+	leftHash, err := b.hashNode(lo, split, level+1)
+	if err != nil {
+		return [4]uint64{}, err
+	}
+	rightHash, err := b.hashNode(split, hi, level+1)
+	if err != nil {
+		return [4]uint64{}, err
+	}
+	return b.hashBranch(leftHash, rightHash), nil
+}
+
+func (b *bulkBuilder) hashLeaf(k utils.NodeKey, v *utils.NodeValue8, level int) [4]uint64 {
+	rKey := utils.RemoveKeyBits(k, level)
+	valueHash, valueHashValue, leafHash, leafHashValue := createNewLeafNoSave(&rKey, v)
+	b.result.KvMap[*valueHash] = *valueHashValue
+	b.result.KvMap[*leafHash] = *leafHashValue
+	b.result.LeafsKvMap[*leafHash] = k
+	b.depth = max(b.depth, level)
+	return *leafHash
+}
+
+func (b *bulkBuilder) hashBranch(leftHash, rightHash [4]uint64) [4]uint64 {
+	var totalHash utils.NodeValue8
+	totalHash.SetHalfValue(leftHash, 0)  // no point to check for error because we used hardcoded 0 which ensures that no error will be returned
+	totalHash.SetHalfValue(rightHash, 1) // no point to check for error because we used hardcoded 1 which ensures that no error will be returned
+	hash, value := utils.HashKeyAndValueByPointers(totalHash.ToUintArrayByPointer(), &utils.BranchCapacity)
+	b.result.KvMap[*hash] = *value
+	return *hash
+}
+
+// merge hashes the levels above the partitions, returning the node at the given level over parts
+func (b *bulkBuilder) merge(parts []*bulkSubtree, level, partitionBits int) *bulkSubtree {
+	if level == partitionBits {
+		return parts[0]
+	}
+
+	half := len(parts) / 2
+	left := b.merge(parts[:half], level+1, partitionBits)
+	right := b.merge(parts[half:], level+1, partitionBits)
+	return b.combine(left, right, level)
+}
+
+// combine returns the node at the given level over the left and right sub-trees below it
+func (b *bulkBuilder) combine(left, right *bulkSubtree, level int) *bulkSubtree {
+	// only an empty sub-tree or a single leaf floats up, anything more keeps its branch even without a sibling
+	switch {
+	case left.count+right.count < 2 && right.count == 0:
+		return left
+	case left.count+right.count < 2 && left.count == 0:
+		return right
+	}
+
+	// both children are hashed at the level below, where a single leaf ends up once it has a sibling
+	return &bulkSubtree{
+		count: left.count + right.count,
+		hash:  b.hashBranch(b.childHash(left, level+1), b.childHash(right, level+1)),
+	}
+}
+
+func (b *bulkBuilder) childHash(node *bulkSubtree, level int) [4]uint64 {
+	switch node.count {
+	case 0:
+		return [4]uint64{}
+	case 1:
+		return b.hashLeaf(node.key, &node.value, level)
+	default:
+		return node.hash
+	}
+}
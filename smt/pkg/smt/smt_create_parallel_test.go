@@ -0,0 +1,144 @@
+package smt_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"gotest.tools/v3/assert"
+)
+
+// prepareBulkData returns the keys and values of the smt_batch_compare_test data as the interhashes stage collects them
+func prepareBulkData(t testing.TB) ([]utils.NodeKey, []utils.NodeValue8) {
+	batchInsertDataHolders, _ := prepareData()
+
+	accChanges := make(map[libcommon.Address]*accounts.Account)
+	codeChanges := make(map[libcommon.Address]string)
+	storageChanges := make(map[libcommon.Address]map[string]string)
+	for _, batchInsertDataHolder := range batchInsertDataHolders {
+		accChanges[batchInsertDataHolder.AddressAccount] = &batchInsertDataHolder.acc
+		codeChanges[batchInsertDataHolder.AddressContract] = batchInsertDataHolder.Bytecode
+		storageChanges[batchInsertDataHolder.AddressContract] = batchInsertDataHolder.Storage
+	}
+
+	keyPointers, valuePointers, err := smt.NewSMT(nil, true).SetStorage(context.Background(), "", accChanges, codeChanges, storageChanges)
+	assert.NilError(t, err)
+
+	var keys []utils.NodeKey
+	var values []utils.NodeValue8
+	for i, key := range keyPointers {
+		if !valuePointers[i].IsZero() {
+			keys = append(keys, *key)
+			values = append(values, *valuePointers[i])
+		}
+	}
+	return keys, values
+}
+
+func prepareBulkSmt(keys []utils.NodeKey, values []utils.NodeValue8) (*smt.SMT, []utils.NodeKey) {
+	s := smt.NewSMT(nil, false)
+	for i, k := range keys {
+		s.Db.InsertAccountValue(k, values[i])
+	}
+	// the builders sort the keys in place
+	return s, append([]utils.NodeKey{}, keys...)
+}
+
+func TestGenerateFromKVBulkParallel(t *testing.T) {
+	ctx := context.Background()
+	fixtureKeys, fixtureValues := prepareBulkData(t)
+
+	var randomKeys []utils.NodeKey
+	var randomValues []utils.NodeValue8
+	seen := make(map[utils.NodeKey]struct{})
+	for i := 1; i <= 5000; i++ {
+		v := big.NewInt(rand.Int63())
+		k := utils.ScalarToNodeKey(v)
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		randomKeys = append(randomKeys, k)
+		randomValues = append(randomValues, utils.ScalarToNodeValue8(v))
+	}
+
+	// keys sharing the first 16 bits of their path all fall into the same partition, leaving the others empty
+	var clusteredKeys []utils.NodeKey
+	var clusteredValues []utils.NodeValue8
+	for i, k := range randomKeys[:500] {
+		clusteredKeys = append(clusteredKeys, utils.NodeKey{k[0] &^ 0xf, k[1] &^ 0xf, k[2] &^ 0xf, k[3] &^ 0xf})
+		clusteredValues = append(clusteredValues, randomValues[i])
+	}
+
+	scenarios := []struct {
+		name   string
+		keys   []utils.NodeKey
+		values []utils.NodeValue8
+	}{
+		{"empty", nil, nil},
+		{"single", randomKeys[:1], randomValues[:1]},
+		{"two", randomKeys[:2], randomValues[:2]},
+		{"random", randomKeys, randomValues},
+		{"clustered", clusteredKeys, clusteredValues},
+		{"fixtures", fixtureKeys, fixtureValues},
+	}
+
+	for _, scenario := range scenarios {
+		sequential, keys := prepareBulkSmt(scenario.keys, scenario.values)
+		expectedRoot, err := sequential.GenerateFromKVBulk(ctx, "", keys)
+		assert.NilError(t, err)
+
+		for _, workers := range []int{1, 4, 0} {
+			t.Run(fmt.Sprintf("%s/workers=%d", scenario.name, workers), func(t *testing.T) {
+				parallel, keys := prepareBulkSmt(scenario.keys, scenario.values)
+				root, err := parallel.GenerateFromKVBulkParallel(ctx, "", keys, workers)
+				assert.NilError(t, err)
+				assert.Equal(t, expectedRoot, root)
+
+				// both builders save exactly the same nodes
+				assert.DeepEqual(t, sequential.Db.(*db.MemDb).Db, parallel.Db.(*db.MemDb).Db)
+				assert.DeepEqual(t, sequential.Db.(*db.MemDb).DbHashKey, parallel.Db.(*db.MemDb).DbHashKey)
+				if len(scenario.keys) > 1 {
+					assert.Equal(t, sequential.GetDepth(), parallel.GetDepth())
+					assertSmtDbStructure(t, parallel, false)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkGenerateFromKVBulk(b *testing.B) {
+	keys, values := prepareBulkData(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		s, keys := prepareBulkSmt(keys, values)
+		b.StartTimer()
+		if _, err := s.GenerateFromKVBulk(context.Background(), "", keys); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateFromKVBulkParallel(b *testing.B) {
+	keys, values := prepareBulkData(b)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				s, keys := prepareBulkSmt(keys, values)
+				b.StartTimer()
+				if _, err := s.GenerateFromKVBulkParallel(context.Background(), "", keys, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -177,15 +177,28 @@ var DefaultFlags = []cli.Flag{
 	&utils.L2ChainIdFlag,
 	&utils.L2RpcUrlFlag,
 	&utils.L2DataStreamerUrlFlag,
+	&utils.L2DataStreamerFallbackUrlsFlag,
 	&utils.L2DataStreamerUseTLSFlag,
+	&utils.L2DataStreamerTLSCertFlag,
+	&utils.L2DataStreamerTLSKeyFlag,
+	&utils.L2DataStreamerTLSCAFlag,
+	&utils.L2DataStreamerTokenFileFlag,
 	&utils.L2DataStreamerTimeout,
 	&utils.L2ShortCircuitToVerifiedBatchFlag,
 	&utils.L1SyncStartBlock,
 	&utils.L1SyncStopBatch,
 	&utils.L1ChainIdFlag,
 	&utils.L1RpcUrlFlag,
+	&utils.L1RpcWeightsFlag,
+	&utils.L1WsUrlFlag,
 	&utils.L1CacheEnabledFlag,
 	&utils.L1CachePortFlag,
+	&utils.L1CacheMethodTTLsFlag,
+	&utils.L1CacheTagTTLFlag,
+	&utils.L1CacheUnfinalizedTTLFlag,
+	&utils.L1CacheMaxSizeFlag,
+	&utils.L1ArchiveReplayFlag,
+	&utils.L1ArchiveRecordFlag,
 	&utils.AddressSequencerFlag,
 	&utils.AddressAdminFlag,
 	&utils.AddressRollupFlag,
@@ -206,6 +219,9 @@ var DefaultFlags = []cli.Flag{
 	&utils.RebuildTreeAfterFlag,
 	&utils.IncrementTreeAlways,
 	&utils.SmtRegenerateInMemory,
+	&utils.SmtRegenerateWorkers,
+	&utils.SmtHistoryBlocksFlag,
+	&utils.SmtHistoryCheckpointIntervalFlag,
 	&utils.SequencerBlockSealTime,
 	&utils.SequencerBatchSealTime,
 	&utils.SequencerBatchVerificationTimeout,
@@ -218,9 +234,13 @@ var DefaultFlags = []cli.Flag{
 	&utils.ExecutorUrls,
 	&utils.ExecutorStrictMode,
 	&utils.ExecutorRequestTimeout,
+	&utils.ExecutorBreakerFailureThreshold,
+	&utils.ExecutorBreakerCooldown,
 	&utils.DatastreamNewBlockTimeout,
 	&utils.WitnessMemdbSize,
 	&utils.WitnessUnwindLimit,
+	&utils.WitnessCacheSize,
+	&utils.WitnessCacheInterval,
 	&utils.ExecutorMaxConcurrentRequests,
 	&utils.Limbo,
 	&utils.AllowFreeTransactions,
@@ -242,11 +262,26 @@ var DefaultFlags = []cli.Flag{
 	&utils.GlobalPendingDynamicFactor,
 	&utils.PendingGasLimit,
 	&utils.UpdatePeriod,
+	&utils.GasPricerStrategy,
+	&utils.GasPricerFixedPrice,
+	&utils.GasPricerTargetPendingGas,
+	&utils.GasPricerChangeDenominator,
 	&utils.DataStreamHost,
 	&utils.DataStreamPort,
 	&utils.DataStreamWriteTimeout,
 	&utils.DataStreamInactivityTimeout,
 	&utils.DataStreamInactivityCheckInterval,
+	&utils.DataStreamInternalPort,
+	&utils.DataStreamTLSCert,
+	&utils.DataStreamTLSKey,
+	&utils.DataStreamClientCA,
+	&utils.DataStreamTokensFile,
+	&utils.DataStreamAllowlist,
+	&utils.DataStreamMaxClientConnections,
+	&utils.DataStreamCompactKeepBatches,
+	&utils.DataStreamCompactInterval,
+	&utils.DataStreamArchiveDir,
+	&utils.DataStreamReconcileBatches,
 	&utils.WitnessFullFlag,
 	&utils.SyncLimit,
 	&utils.ExecutorPayloadOutput,
@@ -296,11 +331,17 @@ var DefaultFlags = []cli.Flag{
 	&utils.TxPoolRejectSmartContractDeployments,
 	&utils.DisableVirtualCounters,
 	&utils.DAUrl,
+	&utils.DABackend,
+	&utils.DAArchiveDir,
+	&utils.DABeaconUrl,
+	&utils.DAVerifySignatures,
+	&utils.DACommitteeAddress,
 	&utils.VirtualCountersSmtReduction,
 	&utils.BadBatches,
 	&utils.InitialBatchCfgFile,
 
 	&utils.ACLPrintHistory,
+	&utils.ACLRPCJWTSecret,
 	&utils.InfoTreeUpdateInterval,
 	&utils.SealBatchImmediatelyOnOverflow,
 	&utils.VerifyZkProofForkid,
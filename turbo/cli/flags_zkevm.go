@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"math"
+	"slices"
 
 	"strings"
 
@@ -138,6 +139,36 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		badBatches = append(badBatches, val)
 	}
 
+	l1CacheMethodTTLs := make(map[string]time.Duration)
+	for _, s := range strings.Split(ctx.String(utils.L1CacheMethodTTLsFlag.Name), ",") {
+		if s == "" {
+			continue
+		}
+		method, ttl, found := strings.Cut(strings.TrimSpace(s), "=")
+		if !found {
+			panic(fmt.Sprintf("could not parse l1 cache method ttl %s, expected method=duration", s))
+		}
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			panic(fmt.Sprintf("could not parse l1 cache method ttl %s: %v", s, err))
+		}
+		l1CacheMethodTTLs[method] = duration
+	}
+
+	var l1RpcWeights []uint64
+	if weights := ctx.String(utils.L1RpcWeightsFlag.Name); weights != "" {
+		for _, s := range strings.Split(weights, ",") {
+			weight, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+			if err != nil || weight == 0 {
+				panic(fmt.Sprintf("could not parse l1 rpc weight %s, expected a whole number of at least 1", s))
+			}
+			l1RpcWeights = append(l1RpcWeights, weight)
+		}
+		if urls := strings.Split(ctx.String(utils.L1RpcUrlFlag.Name), ","); len(urls) != len(l1RpcWeights) {
+			panic(fmt.Sprintf("%s has %d weights for %d l1 rpc urls", utils.L1RpcWeightsFlag.Name, len(l1RpcWeights), len(urls)))
+		}
+	}
+
 	var witnessInclusion []libcommon.Address
 	for _, s := range strings.Split(ctx.String(utils.WitnessContractInclusion.Name), ",") {
 		if s == "" {
@@ -155,6 +186,13 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 	if globalPendingDynamicFactor < 0 || globalPendingDynamicFactor > 1 {
 		panic("Effective global pending dynamic factor must be in interval [0; 1]")
 	}
+	gasPricerStrategy := ctx.String(utils.GasPricerStrategy.Name)
+	if !slices.Contains(ethconfig.GasPricerStrategies, gasPricerStrategy) {
+		panic(fmt.Sprintf("Gas pricer strategy must be one of %v", ethconfig.GasPricerStrategies))
+	}
+	if ctx.Uint64(utils.GasPricerChangeDenominator.Name) == 0 {
+		panic("Gas pricer change denominator must be positive")
+	}
 	gpConf := &ethconfig.GasPriceConf{
 		Enable:                     ctx.Bool(utils.EnableGasPricer.Name),
 		DefaultGasPrice:            ctx.Uint64(utils.DefaultGasPrice.Name),
@@ -168,6 +206,11 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		GlobalPendingDynamicFactor: globalPendingDynamicFactor,
 		PendingGasLimit:            ctx.Uint64(utils.PendingGasLimit.Name),
 		UpdatePeriod:               ctx.Duration(utils.UpdatePeriod.Name),
+		Strategy:                   gasPricerStrategy,
+		FixedGasPrice:              ctx.Uint64(utils.GasPricerFixedPrice.Name),
+		L1GasPriceFactor:           ctx.Float64(utils.GasPriceFactor.Name),
+		TargetPendingGas:           ctx.Uint64(utils.GasPricerTargetPendingGas.Name),
+		BaseFeeChangeDenominator:   ctx.Uint64(utils.GasPricerChangeDenominator.Name),
 	}
 
 	cfg.Zk = &ethconfig.Zk{
@@ -181,8 +224,16 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		L1SyncStopBatch:                        ctx.Uint64(utils.L1SyncStopBatch.Name),
 		L1ChainId:                              ctx.Uint64(utils.L1ChainIdFlag.Name),
 		L1RpcUrl:                               ctx.String(utils.L1RpcUrlFlag.Name),
+		L1RpcWeights:                           l1RpcWeights,
+		L1WsUrl:                                ctx.String(utils.L1WsUrlFlag.Name),
 		L1CacheEnabled:                         ctx.Bool(utils.L1CacheEnabledFlag.Name),
 		L1CachePort:                            ctx.Uint(utils.L1CachePortFlag.Name),
+		L1CacheMethodTTLs:                      l1CacheMethodTTLs,
+		L1CacheTagTTL:                          ctx.Duration(utils.L1CacheTagTTLFlag.Name),
+		L1CacheUnfinalizedTTL:                  ctx.Duration(utils.L1CacheUnfinalizedTTLFlag.Name),
+		L1CacheMaxSize:                         *utils.DatasizeFlagValue(ctx, utils.L1CacheMaxSizeFlag.Name),
+		L1ArchiveReplay:                        ctx.String(utils.L1ArchiveReplayFlag.Name),
+		L1ArchiveRecord:                        ctx.String(utils.L1ArchiveRecordFlag.Name),
 		AddressSequencer:                       libcommon.HexToAddress(ctx.String(utils.AddressSequencerFlag.Name)),
 		AddressAdmin:                           libcommon.HexToAddress(ctx.String(utils.AddressAdminFlag.Name)),
 		AddressRollup:                          libcommon.HexToAddress(ctx.String(utils.AddressRollupFlag.Name)),
@@ -202,6 +253,27 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		RebuildTreeAfter:                       ctx.Uint64(utils.RebuildTreeAfterFlag.Name),
 		IncrementTreeAlways:                    ctx.Bool(utils.IncrementTreeAlways.Name),
 		SmtRegenerateInMemory:                  ctx.Bool(utils.SmtRegenerateInMemory.Name),
+		SmtHistoryBlocks:                       ctx.Uint64(utils.SmtHistoryBlocksFlag.Name),
+		SmtHistoryCheckpointInterval:           ctx.Uint64(utils.SmtHistoryCheckpointIntervalFlag.Name),
+		SmtRegenerateWorkers:                   ctx.Int(utils.SmtRegenerateWorkers.Name),
+		WitnessCacheSize:                       *utils.DatasizeFlagValue(ctx, utils.WitnessCacheSize.Name),
+		WitnessCacheInterval:                   ctx.Duration(utils.WitnessCacheInterval.Name),
+		L2DataStreamerFallbackUrls:             splitList(ctx.String(utils.L2DataStreamerFallbackUrlsFlag.Name)),
+		L2DataStreamerTLSCert:                  ctx.String(utils.L2DataStreamerTLSCertFlag.Name),
+		L2DataStreamerTLSKey:                   ctx.String(utils.L2DataStreamerTLSKeyFlag.Name),
+		L2DataStreamerTLSCA:                    ctx.String(utils.L2DataStreamerTLSCAFlag.Name),
+		L2DataStreamerTokenFile:                ctx.String(utils.L2DataStreamerTokenFileFlag.Name),
+		DataStreamInternalPort:                 ctx.Uint(utils.DataStreamInternalPort.Name),
+		DataStreamTLSCert:                      ctx.String(utils.DataStreamTLSCert.Name),
+		DataStreamTLSKey:                       ctx.String(utils.DataStreamTLSKey.Name),
+		DataStreamClientCA:                     ctx.String(utils.DataStreamClientCA.Name),
+		DataStreamTokensFile:                   ctx.String(utils.DataStreamTokensFile.Name),
+		DataStreamAllowlist:                    splitList(ctx.String(utils.DataStreamAllowlist.Name)),
+		DataStreamMaxClientConnections:         ctx.Int(utils.DataStreamMaxClientConnections.Name),
+		DataStreamCompactKeepBatches:           ctx.Uint64(utils.DataStreamCompactKeepBatches.Name),
+		DataStreamCompactInterval:              ctx.Duration(utils.DataStreamCompactInterval.Name),
+		DataStreamArchiveDir:                   ctx.String(utils.DataStreamArchiveDir.Name),
+		DataStreamReconcileBatches:             ctx.Uint64(utils.DataStreamReconcileBatches.Name),
 		SequencerBlockSealTime:                 sequencerBlockSealTime,
 		SequencerBatchSealTime:                 sequencerBatchSealTime,
 		SequencerBatchVerificationTimeout:      sequencerBatchVerificationTimeout,
@@ -214,6 +286,8 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		ExecutorUrls:                           strings.Split(strings.ReplaceAll(ctx.String(utils.ExecutorUrls.Name), " ", ""), ","),
 		ExecutorStrictMode:                     ctx.Bool(utils.ExecutorStrictMode.Name),
 		ExecutorRequestTimeout:                 ctx.Duration(utils.ExecutorRequestTimeout.Name),
+		ExecutorBreakerFailureThreshold:        ctx.Int(utils.ExecutorBreakerFailureThreshold.Name),
+		ExecutorBreakerCooldown:                ctx.Duration(utils.ExecutorBreakerCooldown.Name),
 		DatastreamNewBlockTimeout:              ctx.Duration(utils.DatastreamNewBlockTimeout.Name),
 		WitnessMemdbSize:                       *witnessMemSize,
 		WitnessUnwindLimit:                     witnessUnwindLimit,
@@ -242,6 +316,11 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		DisableVirtualCounters:                 ctx.Bool(utils.DisableVirtualCounters.Name),
 		ExecutorPayloadOutput:                  ctx.String(utils.ExecutorPayloadOutput.Name),
 		DAUrl:                                  ctx.String(utils.DAUrl.Name),
+		DABackend:                              strings.Split(strings.ReplaceAll(ctx.String(utils.DABackend.Name), " ", ""), ","),
+		DAArchiveDir:                           ctx.String(utils.DAArchiveDir.Name),
+		DABeaconUrl:                            ctx.String(utils.DABeaconUrl.Name),
+		DAVerifySignatures:                     ctx.Bool(utils.DAVerifySignatures.Name),
+		DACommitteeAddress:                     libcommon.HexToAddress(ctx.String(utils.DACommitteeAddress.Name)),
 		DataStreamHost:                         ctx.String(utils.DataStreamHost.Name),
 		DataStreamPort:                         ctx.Uint(utils.DataStreamPort.Name),
 		DataStreamWriteTimeout:                 ctx.Duration(utils.DataStreamWriteTimeout.Name),
@@ -251,6 +330,7 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		BadBatches:                             badBatches,
 		InitialBatchCfgFile:                    ctx.String(utils.InitialBatchCfgFile.Name),
 		ACLPrintHistory:                        ctx.Int(utils.ACLPrintHistory.Name),
+		ACLRPCJWTSecretPath:                    ctx.String(utils.ACLRPCJWTSecret.Name),
 		InfoTreeUpdateInterval:                 ctx.Duration(utils.InfoTreeUpdateInterval.Name),
 		SealBatchImmediatelyOnOverflow:         ctx.Bool(utils.SealBatchImmediatelyOnOverflow.Name),
 		MockWitnessGeneration:                  ctx.Bool(utils.MockWitnessGeneration.Name),
@@ -258,12 +338,55 @@ func ApplyFlagsForZkConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		BadTxAllowance:                         ctx.Uint64(utils.BadTxAllowance.Name),
 	}
 
+	if cfg.SmtRegenerateWorkers < 0 {
+		panic(fmt.Sprintf("%s must not be negative", utils.SmtRegenerateWorkers.Name))
+	}
+
+	if cfg.WitnessCacheSize > 0 && cfg.WitnessCacheInterval <= 0 {
+		panic(fmt.Sprintf("%s must be positive when the witness cache is enabled", utils.WitnessCacheInterval.Name))
+	}
+
+	if (cfg.L2DataStreamerTLSCert == "") != (cfg.L2DataStreamerTLSKey == "") {
+		panic(fmt.Sprintf("%s and %s must be set together", utils.L2DataStreamerTLSCertFlag.Name, utils.L2DataStreamerTLSKeyFlag.Name))
+	}
+	if (cfg.DataStreamTLSCert == "") != (cfg.DataStreamTLSKey == "") {
+		panic(fmt.Sprintf("%s and %s must be set together", utils.DataStreamTLSCert.Name, utils.DataStreamTLSKey.Name))
+	}
+	if cfg.DataStreamClientCA != "" && cfg.DataStreamTLSCert == "" {
+		panic(fmt.Sprintf("%s needs %s", utils.DataStreamClientCA.Name, utils.DataStreamTLSCert.Name))
+	}
+	if cfg.DataStreamMaxClientConnections < 0 {
+		panic(fmt.Sprintf("%s must not be negative", utils.DataStreamMaxClientConnections.Name))
+	}
+	if cfg.DataStreamGated() && (cfg.DataStreamInternalPort == 0 || cfg.DataStreamInternalPort == cfg.DataStreamPort) {
+		panic(fmt.Sprintf("%s must be set to a port other than %s to gate the data stream", utils.DataStreamInternalPort.Name, utils.DataStreamPort.Name))
+	}
+	// the gateway serves the archive of the compacted stream
+	if cfg.DataStreamCompactKeepBatches > 0 && (cfg.DataStreamInternalPort == 0 || cfg.DataStreamInternalPort == cfg.DataStreamPort) {
+		panic(fmt.Sprintf("%s must be set to a port other than %s to compact the data stream", utils.DataStreamInternalPort.Name, utils.DataStreamPort.Name))
+	}
+
+	// data taken from committee members is only trusted once the quorum of their signatures is checked
+	if !ctx.IsSet(utils.DAVerifySignatures.Name) {
+		cfg.DAVerifySignatures = cfg.DACommitteeConfigured()
+	}
+
 	utils2.EnableTimer(cfg.DebugTimers)
 
 	checkFlag(utils.L2ChainIdFlag.Name, cfg.L2ChainId)
 	if !sequencer.IsSequencer() {
 		checkFlag(utils.L2RpcUrlFlag.Name, cfg.Zk.L2RpcUrl)
 		checkFlag(utils.L2DataStreamerUrlFlag.Name, cfg.L2DataStreamerUrl)
+
+		// a node relaying the stream must not sync from its own stream
+		if cfg.DataStreamHost != "" && cfg.DataStreamPort > 0 {
+			relayAddr := fmt.Sprintf("%s:%d", cfg.DataStreamHost, cfg.DataStreamPort)
+			for _, url := range cfg.L2DataStreamerUrls() {
+				if url == relayAddr {
+					panic(fmt.Sprintf("%s can't point to the node's own datastream %s", utils.L2DataStreamerUrlFlag.Name, relayAddr))
+				}
+			}
+		}
 	} else {
 		checkFlag(utils.ExecutorUrls.Name, cfg.ExecutorUrls)
 		checkFlag(utils.ExecutorStrictMode.Name, cfg.ExecutorStrictMode)
@@ -323,3 +446,14 @@ func parseVerifyZkProofConfigs(ctx *cli.Context) []*ethconfig.VerifyZkProofConfi
 	}
 	return confs
 }
+
+// splitList splits a comma separated flag value, dropping the empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -5,10 +5,16 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/p2p"
 
+	"github.com/ledgerwatch/erigon/rpc"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/ledgerwatch/erigon/zk/txpool"
 )
 
 // AdminAPI the interface for the admin_* RPC commands.
@@ -22,17 +28,71 @@ type AdminAPI interface {
 
 	// AddPeer requests connecting to a remote node.
 	AddPeer(ctx context.Context, url string) (bool, error)
+
+	// L1Endpoints returns the health of each L1 RPC endpoint used by the L1 syncer.
+	L1Endpoints(ctx context.Context) ([]syncer.EndpointHealth, error)
+
+	// Executors returns the circuit breaker state and request history of each executor the sequencer verifies with.
+	Executors(ctx context.Context) ([]legacy_executor_verifier.ExecutorHealth, error)
+
+	// PendingVerifications lists the sequencer's verification requests that haven't reached the datastream yet.
+	PendingVerifications(ctx context.Context) ([]legacy_executor_verifier.PendingVerification, error)
+
+	// RetryVerification resets the timeout and retries of the verification ending at the given block and reruns it if it failed.
+	// It needs a bearer token signed with the ACL secret.
+	RetryVerification(ctx context.Context, lastBlock rpc.BlockNumber) (bool, error)
+
+	// DropVerification gives up on the verification ending at the given block, unwinding the sequencer to the block before it.
+	// It needs a bearer token signed with the ACL secret.
+	DropVerification(ctx context.Context, lastBlock rpc.BlockNumber) (bool, error)
+
+	// GasPricerStrategy returns the strategy the gas pricer currently uses.
+	GasPricerStrategy(ctx context.Context) (*GasPricerStrategyInfo, error)
+
+	// SetGasPricerStrategy switches the strategy of the gas pricer. It needs a bearer token signed with the ACL secret.
+	SetGasPricerStrategy(ctx context.Context, strategy string) (bool, error)
+
+	// AclMode returns the mode of the txpool access list.
+	AclMode(ctx context.Context) (txpool.ACLMode, error)
+
+	// AclSetMode switches the mode of the txpool access list.
+	AclSetMode(ctx context.Context, mode string) (bool, error)
+
+	// AclAddPolicy adds a policy to an account in the allowlist or blocklist.
+	AclAddPolicy(ctx context.Context, aclType string, addr common.Address, policy string) (bool, error)
+
+	// AclRemovePolicy removes a policy from an account in the allowlist or blocklist.
+	AclRemovePolicy(ctx context.Context, aclType string, addr common.Address, policy string) (bool, error)
+
+	// AclRules lists the access list rules.
+	AclRules(ctx context.Context) ([]txpool.Rule, error)
+
+	// AclAddRule adds a rule to the access list, replacing any rule with the same name.
+	AclAddRule(ctx context.Context, rule txpool.Rule) (bool, error)
+
+	// AclRemoveRule removes a rule from the access list.
+	AclRemoveRule(ctx context.Context, name string) (bool, error)
+
+	// AclPolicyTransactions returns the latest changes made to the access list.
+	AclPolicyTransactions(ctx context.Context, count int) ([]txpool.PolicyTransaction, error)
 }
 
 // AdminAPIImpl data structure to store things needed for admin_* commands.
 type AdminAPIImpl struct {
 	ethBackend rpchelper.ApiBackend
+	l1Syncer   *syncer.L1Syncer
+	verifier   *legacy_executor_verifier.LegacyExecutorVerifier
+	gasPricer  *SwitchableGasPricer
+	aclDB      kv.RwDB
+	aclSecret  []byte
 }
 
 // NewAdminAPI returns AdminAPIImpl instance.
-func NewAdminAPI(eth rpchelper.ApiBackend) *AdminAPIImpl {
+func NewAdminAPI(eth rpchelper.ApiBackend, l1Syncer *syncer.L1Syncer, verifier *legacy_executor_verifier.LegacyExecutorVerifier) *AdminAPIImpl {
 	return &AdminAPIImpl{
 		ethBackend: eth,
+		l1Syncer:   l1Syncer,
+		verifier:   verifier,
 	}
 }
 
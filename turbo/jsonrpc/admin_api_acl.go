@@ -0,0 +1,175 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/zk/txpool"
+)
+
+var (
+	errNoACL         = errors.New("the access list is only available on a node running the txpool")
+	errACLRPCOff     = errors.New("access list management over RPC is disabled, set acl.rpc-jwtsecret to enable it")
+	errACLNotAllowed = errors.New("access list management requires a valid bearer token")
+)
+
+// maxACLPolicyTransactions caps how much of the access list history a single call returns
+const maxACLPolicyTransactions = 1000
+
+// SetACL lets the admin API manage the txpool's access list, authorising every call against the JWT secret. Without a
+// txpool the secret still authorises the calls changing the sequencer
+func (api *AdminAPIImpl) SetACL(aclDB kv.RwDB, secret []byte) {
+	api.aclDB = aclDB
+	api.aclSecret = secret
+}
+
+// ReadACLSecret reads the hex encoded 32 byte secret bearer tokens for admin_acl* and the other mutating admin calls
+// are signed with
+func ReadACLSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret := common.FromHex(strings.TrimSpace(string(data)))
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("invalid ACL RPC secret length %d, expected 32 bytes", len(secret))
+	}
+	return secret, nil
+}
+
+// authorizeACL checks the request carries a token signed with the ACL secret
+func (api *AdminAPIImpl) authorizeACL(ctx context.Context) error {
+	if api.aclDB == nil {
+		return errNoACL
+	}
+	return api.authorizeJWT(ctx, errACLRPCOff, errACLNotAllowed)
+}
+
+// authorizeJWT checks the request carries a token signed with the ACL secret, which the admin calls changing the
+// sequencer need as well.  The token comes from the HTTP Authorization header so the methods can't be used over
+// websockets
+func (api *AdminAPIImpl) authorizeJWT(ctx context.Context, errOff, errNotAllowed error) error {
+	if len(api.aclSecret) == 0 {
+		return errOff
+	}
+	auth, _ := ctx.Value("Authorization").(string)
+	if err := rpc.ValidateJwtAuthorization(auth, api.aclSecret); err != nil {
+		log.Warn("Refused admin RPC call", "remote", ctx.Value("remote"), "err", err)
+		return fmt.Errorf("%w: %s", errNotAllowed, err)
+	}
+	return nil
+}
+
+// logACLChange leaves a trace of who changed the access list next to the policy transaction history
+func logACLChange(ctx context.Context, msg string, args ...interface{}) {
+	log.Info(msg, append([]interface{}{"remote", ctx.Value("remote")}, args...)...)
+}
+
+func (api *AdminAPIImpl) AclMode(ctx context.Context) (txpool.ACLMode, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return "", err
+	}
+	mode, err := txpool.GetMode(ctx, api.aclDB)
+	if err != nil {
+		return "", err
+	}
+	if mode == "" {
+		return txpool.DisabledMode, nil
+	}
+	return mode, nil
+}
+
+func (api *AdminAPIImpl) AclSetMode(ctx context.Context, mode string) (bool, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return false, err
+	}
+	if err := txpool.SetMode(ctx, api.aclDB, mode); err != nil {
+		return false, err
+	}
+	logACLChange(ctx, "Access list mode changed over RPC", "mode", mode)
+	return true, nil
+}
+
+func (api *AdminAPIImpl) AclAddPolicy(ctx context.Context, aclType string, addr common.Address, policy string) (bool, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return false, err
+	}
+	p, err := txpool.ResolvePolicy(policy)
+	if err != nil {
+		return false, err
+	}
+	if err = txpool.AddPolicy(ctx, api.aclDB, aclType, addr, p); err != nil {
+		return false, err
+	}
+	logACLChange(ctx, "Access list policy added over RPC", "type", aclType, "address", addr, "policy", policy)
+	return true, nil
+}
+
+func (api *AdminAPIImpl) AclRemovePolicy(ctx context.Context, aclType string, addr common.Address, policy string) (bool, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return false, err
+	}
+	p, err := txpool.ResolvePolicy(policy)
+	if err != nil {
+		return false, err
+	}
+	if err = txpool.RemovePolicy(ctx, api.aclDB, aclType, addr, p); err != nil {
+		return false, err
+	}
+	logACLChange(ctx, "Access list policy removed over RPC", "type", aclType, "address", addr, "policy", policy)
+	return true, nil
+}
+
+func (api *AdminAPIImpl) AclRules(ctx context.Context) ([]txpool.Rule, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return nil, err
+	}
+	return txpool.ListRules(ctx, api.aclDB)
+}
+
+func (api *AdminAPIImpl) AclAddRule(ctx context.Context, rule txpool.Rule) (bool, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return false, err
+	}
+	if err := txpool.AddRule(ctx, api.aclDB, rule); err != nil {
+		return false, err
+	}
+	logACLChange(ctx, "Access list rule added over RPC", "name", rule.Name, "effect", rule.Effect)
+	return true, nil
+}
+
+func (api *AdminAPIImpl) AclRemoveRule(ctx context.Context, name string) (bool, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return false, err
+	}
+	if err := txpool.RemoveRule(ctx, api.aclDB, name); err != nil {
+		return false, err
+	}
+	logACLChange(ctx, "Access list rule removed over RPC", "name", name)
+	return true, nil
+}
+
+func (api *AdminAPIImpl) AclPolicyTransactions(ctx context.Context, count int) ([]txpool.PolicyTransaction, error) {
+	if err := api.authorizeACL(ctx); err != nil {
+		return nil, err
+	}
+	if count < 0 || count > maxACLPolicyTransactions {
+		return nil, fmt.Errorf("count must be between 0 and %d", maxACLPolicyTransactions)
+	}
+	pts, err := txpool.LastPolicyTransactions(ctx, api.aclDB, count)
+	if err != nil {
+		return nil, err
+	}
+	if pts == nil {
+		pts = []txpool.PolicyTransaction{}
+	}
+	return pts, nil
+}
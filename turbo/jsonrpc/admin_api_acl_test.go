@@ -0,0 +1,88 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/zk/txpool"
+)
+
+func TestAdminACL(t *testing.T) {
+	ctx := context.Background()
+	aclDB, err := txpool.OpenACLDB(ctx, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(aclDB.Close)
+
+	secret := common.FromHex("0x3a7e0c1cbe5f3f1a0cd0f8ea5b1b0b5b6e0ce53d7c1b5b1fa30e0e9b2d1c6f10")
+	token := func(secret []byte, issued time.Time) context.Context {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(issued)}).SignedString(secret)
+		require.NoError(t, err)
+		return context.WithValue(ctx, "Authorization", "Bearer "+signed)
+	}
+
+	api := NewAdminAPI(nil, nil, nil)
+	_, err = api.AclMode(ctx)
+	require.ErrorIs(t, err, errNoACL)
+
+	api.SetACL(aclDB, nil)
+	_, err = api.AclMode(token(secret, time.Now()))
+	require.ErrorIs(t, err, errACLRPCOff)
+
+	api.SetACL(aclDB, secret)
+	for name, ctx := range map[string]context.Context{
+		"no token":     ctx,
+		"wrong secret": token(common.FromHex("0x01"), time.Now()),
+		"stale token":  token(secret, time.Now().Add(-time.Hour)),
+	} {
+		_, err = api.AclSetMode(ctx, txpool.BlocklistMode)
+		require.ErrorIs(t, err, errACLNotAllowed, name)
+	}
+
+	authorized := token(secret, time.Now())
+	mode, err := api.AclMode(authorized)
+	require.NoError(t, err)
+	require.Equal(t, txpool.ACLMode(txpool.DisabledMode), mode)
+
+	addr := common.HexToAddress("0x0921598333Cf3cE5FE2031C056C79aec59EE10b6")
+	_, err = api.AclSetMode(authorized, txpool.BlocklistMode)
+	require.NoError(t, err)
+	_, err = api.AclAddPolicy(authorized, "blocklist", addr, "sendTx")
+	require.NoError(t, err)
+	_, err = api.AclAddPolicy(authorized, "blocklist", addr, "fly")
+	require.Error(t, err)
+
+	mode, err = api.AclMode(authorized)
+	require.NoError(t, err)
+	require.Equal(t, txpool.ACLMode(txpool.BlocklistMode), mode)
+
+	has, err := txpool.DoesAccountHavePolicy(ctx, aclDB, addr, txpool.SendTx)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	_, err = api.AclRemovePolicy(authorized, "blocklist", addr, "sendTx")
+	require.NoError(t, err)
+
+	// every change is part of the policy transaction history
+	pts, err := api.AclPolicyTransactions(authorized, 10)
+	require.NoError(t, err)
+	require.Len(t, pts, 3)
+
+	encoded, err := json.Marshal(pts)
+	require.NoError(t, err)
+	var decoded []map[string]interface{}
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	operations := make(map[interface{}]bool)
+	for _, pt := range decoded {
+		operations[pt["operation"]] = true
+	}
+	require.Equal(t, map[interface{}]bool{"mode change": true, "add": true, "remove": true}, operations)
+
+	_, err = api.AclPolicyTransactions(authorized, maxACLPolicyTransactions+1)
+	require.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+)
+
+var (
+	errNoVerifier  = errors.New("verifications are only available on a sequencer")
+	errNoGasPricer = errors.New("the gas pricer is only available on a sequencer with zkevm.enable-gas-pricer set")
+
+	errAdminRPCOff     = errors.New("changing the sequencer over RPC is disabled, set acl.rpc-jwtsecret to enable it")
+	errAdminNotAllowed = errors.New("changing the sequencer over RPC requires a valid bearer token")
+)
+
+// GasPricerStrategyInfo describes the strategy of the gas pricer
+type GasPricerStrategyInfo struct {
+	Strategy   string       `json:"strategy"`
+	Strategies []string     `json:"strategies"`
+	GasPrice   *hexutil.Big `json:"gasPrice"`
+}
+
+// SetGasPricer lets the admin API switch the strategy of the gas pricer, which is nil if the node doesn't run one
+func (api *AdminAPIImpl) SetGasPricer(gasPricer *SwitchableGasPricer) {
+	api.gasPricer = gasPricer
+}
+
+func (api *AdminAPIImpl) L1Endpoints(ctx context.Context) ([]syncer.EndpointHealth, error) {
+	if api.l1Syncer == nil {
+		return nil, errors.New("the L1 syncer is not available on this node")
+	}
+	return api.l1Syncer.GetEndpointsHealth(), nil
+}
+
+func (api *AdminAPIImpl) Executors(ctx context.Context) ([]legacy_executor_verifier.ExecutorHealth, error) {
+	if api.verifier == nil {
+		return nil, errNoVerifier
+	}
+	return api.verifier.GetExecutorsHealth(), nil
+}
+
+func (api *AdminAPIImpl) PendingVerifications(ctx context.Context) ([]legacy_executor_verifier.PendingVerification, error) {
+	if api.verifier == nil {
+		return nil, errNoVerifier
+	}
+	return api.verifier.GetPendingVerifications(), nil
+}
+
+func (api *AdminAPIImpl) RetryVerification(ctx context.Context, lastBlock rpc.BlockNumber) (bool, error) {
+	if api.verifier == nil {
+		return false, errNoVerifier
+	}
+	if err := api.authorizeJWT(ctx, errAdminRPCOff, errAdminNotAllowed); err != nil {
+		return false, err
+	}
+	if lastBlock < 0 {
+		return false, errors.New("a block number is required")
+	}
+	if err := api.verifier.RetryVerification(uint64(lastBlock)); err != nil {
+		return false, err
+	}
+	log.Info("Retrying verification over RPC", "remote", ctx.Value("remote"), "lastBlock", uint64(lastBlock))
+	return true, nil
+}
+
+func (api *AdminAPIImpl) DropVerification(ctx context.Context, lastBlock rpc.BlockNumber) (bool, error) {
+	if api.verifier == nil {
+		return false, errNoVerifier
+	}
+	if err := api.authorizeJWT(ctx, errAdminRPCOff, errAdminNotAllowed); err != nil {
+		return false, err
+	}
+	if lastBlock < 0 {
+		return false, errors.New("a block number is required")
+	}
+	if err := api.verifier.DropVerification(uint64(lastBlock)); err != nil {
+		return false, err
+	}
+	log.Info("Dropped verification over RPC", "remote", ctx.Value("remote"), "lastBlock", uint64(lastBlock))
+	return true, nil
+}
+
+func (api *AdminAPIImpl) GasPricerStrategy(ctx context.Context) (*GasPricerStrategyInfo, error) {
+	if api.gasPricer == nil {
+		return nil, errNoGasPricer
+	}
+	return &GasPricerStrategyInfo{
+		Strategy:   api.gasPricer.Strategy(),
+		Strategies: api.gasPricer.Strategies(),
+		GasPrice:   (*hexutil.Big)(api.gasPricer.GetGasPrice()),
+	}, nil
+}
+
+func (api *AdminAPIImpl) SetGasPricerStrategy(ctx context.Context, strategy string) (bool, error) {
+	if api.gasPricer == nil {
+		return false, errNoGasPricer
+	}
+	if err := api.authorizeJWT(ctx, errAdminRPCOff, errAdminNotAllowed); err != nil {
+		return false, err
+	}
+	if err := api.gasPricer.SetStrategy(strategy); err != nil {
+		return false, err
+	}
+	log.Info("Switched the gas pricer strategy over RPC", "remote", ctx.Value("remote"), "strategy", strategy)
+	return true, nil
+}
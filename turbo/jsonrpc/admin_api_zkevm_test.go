@@ -0,0 +1,89 @@
+package jsonrpc
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+)
+
+var testAdminSecret = common.FromHex("0x3a7e0c1cbe5f3f1a0cd0f8ea5b1b0b5b6e0ce53d7c1b5b1fa30e0e9b2d1c6f10")
+
+// authorizedContext carries a bearer token signed with the secret the way the HTTP handler passes it on
+func authorizedContext(t *testing.T, ctx context.Context, secret []byte) context.Context {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now())}).SignedString(secret)
+	require.NoError(t, err)
+	return context.WithValue(ctx, "Authorization", "Bearer "+signed)
+}
+
+func TestAdminVerificationsAuthorization(t *testing.T) {
+	ctx := context.Background()
+	secret := testAdminSecret
+	authorized := authorizedContext(t, ctx, secret)
+
+	api := NewAdminAPI(nil, nil, legacy_executor_verifier.NewLegacyExecutorVerifier(ethconfig.Zk{}, nil, nil, nil, nil, nil))
+	_, err := api.RetryVerification(authorized, 1)
+	require.ErrorIs(t, err, errAdminRPCOff)
+
+	// the secret of the access list authorises the calls without a txpool
+	api.SetACL(nil, secret)
+	_, err = api.DropVerification(ctx, 1)
+	require.ErrorIs(t, err, errAdminNotAllowed)
+
+	// past the authorization the verifier has no verification ending at the block
+	_, err = api.RetryVerification(authorized, 1)
+	require.ErrorIs(t, err, legacy_executor_verifier.ErrVerificationNotFound)
+	_, err = api.DropVerification(authorized, 1)
+	require.ErrorIs(t, err, legacy_executor_verifier.ErrVerificationNotFound)
+
+	// listing them and the executors stays open
+	_, err = api.PendingVerifications(ctx)
+	require.NoError(t, err)
+	executors, err := api.Executors(ctx)
+	require.NoError(t, err)
+	require.Empty(t, executors)
+
+	_, err = NewAdminAPI(nil, nil, nil).Executors(ctx)
+	require.ErrorIs(t, err, errNoVerifier)
+}
+
+func TestAdminSetGasPricerStrategyAuthorization(t *testing.T) {
+	ctx := context.Background()
+	cfg := testGasPriceConf()
+	pricer, err := NewSwitchableGasPricer(ethconfig.GasPricerFixed, map[string]L2GasPricer{
+		ethconfig.GasPricerFixed:      newFixedGasPricer(cfg),
+		ethconfig.GasPricerL1Follower: newL1FollowerGasPricer(cfg, func() (*big.Int, error) { return big.NewInt(1), nil }),
+	})
+	require.NoError(t, err)
+	api := NewAdminAPI(nil, nil, nil)
+	api.SetGasPricer(pricer)
+
+	_, err = api.SetGasPricerStrategy(authorizedContext(t, ctx, testAdminSecret), ethconfig.GasPricerL1Follower)
+	require.ErrorIs(t, err, errAdminRPCOff)
+
+	api.SetACL(nil, testAdminSecret)
+	for name, ctx := range map[string]context.Context{
+		"no token":     ctx,
+		"wrong secret": authorizedContext(t, ctx, common.FromHex("0x01")),
+	} {
+		_, err = api.SetGasPricerStrategy(ctx, ethconfig.GasPricerL1Follower)
+		require.ErrorIs(t, err, errAdminNotAllowed, name)
+	}
+	require.Equal(t, ethconfig.GasPricerFixed, pricer.Strategy())
+
+	_, err = api.SetGasPricerStrategy(authorizedContext(t, ctx, testAdminSecret), ethconfig.GasPricerL1Follower)
+	require.NoError(t, err)
+	require.Equal(t, ethconfig.GasPricerL1Follower, pricer.Strategy())
+
+	// reading the strategy stays open
+	info, err := api.GasPricerStrategy(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ethconfig.GasPricerL1Follower, info.Strategy)
+}
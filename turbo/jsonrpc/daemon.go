@@ -20,16 +20,19 @@ import (
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 	"github.com/ledgerwatch/erigon/turbo/services"
 	"github.com/ledgerwatch/erigon/zk/datastream/server"
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
 	"github.com/ledgerwatch/erigon/zk/sequencer"
 	"github.com/ledgerwatch/erigon/zk/syncer"
 	txpool2 "github.com/ledgerwatch/erigon/zk/txpool"
+	"github.com/ledgerwatch/erigon/zk/witness"
 )
 
 // APIList describes the list of available RPC apis
 func APIList(ctx context.Context, db kv.RoDB, eth rpchelper.ApiBackend, txPool txpool.TxpoolClient, rawPool *txpool2.TxPool, mining txpool.MiningClient,
 	filters *rpchelper.Filters, stateCache kvcache.Cache,
 	blockReader services.FullBlockReader, agg *libstate.Aggregator, cfg *httpcfg.HttpCfg, engine consensus.EngineReader,
-	ethCfg *ethconfig.Config, l1Syncer *syncer.L1Syncer, logger log.Logger, dataStreamServer server.DataStreamServer,
+	ethCfg *ethconfig.Config, l1Syncer *syncer.L1Syncer, legacyVerifier *legacy_executor_verifier.LegacyExecutorVerifier,
+	logger log.Logger, dataStreamServer server.DataStreamServer, witnessCache *witness.Cache,
 ) (list []rpc.API) {
 	// non-sequencer nodes should forward on requests to the sequencer
 	rpcUrl := ""
@@ -41,8 +44,10 @@ func APIList(ctx context.Context, db kv.RoDB, eth rpchelper.ApiBackend, txPool t
 	base.SetL2RpcUrl(ethCfg.Zk.L2RpcUrl)
 	base.SetGasless(ethCfg.AllowFreeTransactions)
 	ethImpl := NewEthAPI(base, db, eth, txPool, mining, cfg.Gascap, cfg.Feecap, cfg.ReturnDataLimit, ethCfg, cfg.AllowUnprotectedTxs, cfg.MaxGetProofRewindBlockCount, cfg.WebsocketSubscribeLogsChannelSize, logger, cfg.LogsMaxRange)
+	var gasPricer *SwitchableGasPricer
 	if sequencer.IsSequencer() && ethCfg.GasPriceCfg.Enable {
-		ethImpl.SetL2GasPricer(NewL2GasPricer(ctx, ethCfg.GasPriceCfg, ethImpl.BaseAPI, txPool, db))
+		gasPricer = NewL2GasPricer(ctx, ethCfg.GasPriceCfg, ethImpl.BaseAPI, txPool, db, ethImpl.l1GasPrice)
+		ethImpl.SetL2GasPricer(gasPricer)
 	}
 	erigonImpl := NewErigonAPI(base, db, eth)
 	txpoolImpl := NewTxPoolAPI(base, db, txPool, rawPool, rpcUrl)
@@ -51,7 +56,20 @@ func APIList(ctx context.Context, db kv.RoDB, eth rpchelper.ApiBackend, txPool t
 	traceImpl := NewTraceAPI(base, db, cfg)
 	web3Impl := NewWeb3APIImpl(eth)
 	dbImpl := NewDBAPIImpl() /* deprecated */
-	adminImpl := NewAdminAPI(eth)
+	adminImpl := NewAdminAPI(eth, l1Syncer, legacyVerifier)
+	adminImpl.SetGasPricer(gasPricer)
+	var aclSecret []byte
+	if ethCfg.Zk.ACLRPCJWTSecretPath != "" {
+		var err error
+		if aclSecret, err = ReadACLSecret(ethCfg.Zk.ACLRPCJWTSecretPath); err != nil {
+			logger.Error("Access list management and changing the sequencer over RPC are disabled", "err", err)
+		}
+	}
+	var aclDB kv.RwDB
+	if rawPool != nil {
+		aclDB = rawPool.ACLDB()
+	}
+	adminImpl.SetACL(aclDB, aclSecret)
 	parityImpl := NewParityAPIImpl(base, db)
 
 	var borImpl *BorImpl
@@ -74,6 +92,7 @@ func APIList(ctx context.Context, db kv.RoDB, eth rpchelper.ApiBackend, txPool t
 	gqlImpl := NewGraphQLAPI(base, db)
 	overlayImpl := NewOverlayAPI(base, db, cfg.Gascap, cfg.OverlayGetLogsTimeout, cfg.OverlayReplayBlockTimeout, otsImpl)
 	zkEvmImpl := NewZkEvmAPI(ethImpl, db, cfg.ReturnDataLimit, ethCfg, l1Syncer, rpcUrl, dataStreamServer)
+	zkEvmImpl.SetWitnessCache(witnessCache)
 	merlinAPIImpl := NewMerlinAPI(ethImpl, zkEvmImpl, ethCfg.Merlin, db, l1Syncer)
 
 	if cfg.GraphQLEnabled {
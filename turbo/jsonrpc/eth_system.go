@@ -140,6 +140,13 @@ func (api *APIImpl) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, err
 	if err != nil {
 		return nil, err
 	}
+	cc, err := api.chainConfig(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if chain.IsZk(cc.ChainID.Uint64()) {
+		return api.maxPriorityFeePerGasZk(ctx, tx, tipcap)
+	}
 	return (*hexutil.Big)(tipcap), err
 }
 
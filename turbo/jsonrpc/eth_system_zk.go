@@ -9,9 +9,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon/cmd/utils"
+	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/ethclient"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	"github.com/ledgerwatch/erigon/zkevm/encoding"
 	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
 	"github.com/ledgerwatch/log/v3"
@@ -145,3 +149,37 @@ func (api *APIImpl) l1GasPrice() (*big.Int, error) {
 
 	return price, nil
 }
+
+// maxPriorityFeePerGasZk suggests the tip that makes a dynamic fee transaction bid the price eth_gasPrice suggests, which
+// is what the zk gas pricer (or the L1 gas price and GasPriceFactor) asks for.  It never goes below the default gas
+// price when transactions with a lower price are rejected, since a dynamic fee transaction's price is its tip.  The
+// oracle's suggestion, taken from the tips transactions actually paid, is used if the gas price can't be determined
+func (api *APIImpl) maxPriorityFeePerGasZk(ctx context.Context, tx kv.Tx, oracleTip *big.Int) (*hexutil.Big, error) {
+	tip := new(big.Int).Set(oracleTip)
+
+	gasPrice, err := api.GasPrice(ctx)
+	if err != nil {
+		log.Debug("Failed to get the gas price, suggesting a tip from recent blocks", "err", err)
+	} else {
+		tip = new(big.Int).Set(gasPrice.ToInt())
+		if head := rawdb.ReadCurrentHeader(tx); head != nil && head.BaseFee != nil {
+			tip.Sub(tip, head.BaseFee)
+		}
+		if tip.Sign() < 0 {
+			tip.SetUint64(0)
+		}
+	}
+
+	if api.RejectLowGasPriceTransactions {
+		if minTip := new(big.Int).SetUint64(api.DefaultGasPrice); tip.Cmp(minTip) < 0 {
+			tip = minTip
+		}
+	}
+	return (*hexutil.Big)(tip), nil
+}
+
+// EffectiveGasPricePercentage lets the gas price oracle account for the share of their gas price transactions were
+// actually charged
+func (b *GasPriceOracleBackend) EffectiveGasPricePercentage(ctx context.Context, txHash common.Hash) (uint8, bool, error) {
+	return hermez_db.NewHermezDbReader(b.tx).CheckEffectiveGasPricePercentage(txHash)
+}
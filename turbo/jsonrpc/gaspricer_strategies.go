@@ -0,0 +1,235 @@
+package jsonrpc
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// SwitchableGasPricer hands out the price of one of several strategies, which can be switched while the node runs
+type SwitchableGasPricer struct {
+	strategies map[string]L2GasPricer
+
+	lock    sync.RWMutex
+	current string
+}
+
+// NewSwitchableGasPricer starts with the given strategy
+func NewSwitchableGasPricer(strategy string, strategies map[string]L2GasPricer) (*SwitchableGasPricer, error) {
+	if _, ok := strategies[strategy]; !ok {
+		return nil, fmt.Errorf("unknown gas pricer strategy %q", strategy)
+	}
+	return &SwitchableGasPricer{
+		strategies: strategies,
+		current:    strategy,
+	}, nil
+}
+
+func (s *SwitchableGasPricer) pricer() L2GasPricer {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.strategies[s.current]
+}
+
+// GetGasPrice get gas price of the current strategy
+func (s *SwitchableGasPricer) GetGasPrice() *big.Int {
+	return s.pricer().GetGasPrice()
+}
+
+// UpdateGasPriceAvg updates the price of the current strategy, the others are left alone until they are switched to
+func (s *SwitchableGasPricer) UpdateGasPriceAvg() {
+	s.pricer().UpdateGasPriceAvg()
+}
+
+// Strategy returns the name of the current strategy
+func (s *SwitchableGasPricer) Strategy() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.current
+}
+
+// Strategies returns the names of the strategies that can be switched to
+func (s *SwitchableGasPricer) Strategies() []string {
+	names := make([]string, 0, len(s.strategies))
+	for name := range s.strategies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// SetStrategy switches to the named strategy.  Strategies that adjust their price step by step carry on from the
+// price of the previous one, and the new strategy is updated straight away so it doesn't hand out a stale price
+func (s *SwitchableGasPricer) SetStrategy(strategy string) error {
+	next, ok := s.strategies[strategy]
+	if !ok {
+		return fmt.Errorf("unknown gas pricer strategy %q, expected one of %v", strategy, s.Strategies())
+	}
+
+	s.lock.Lock()
+	previous := s.current
+	if strategy != previous {
+		if seeded, ok := next.(interface{ seed(price *big.Int) }); ok {
+			seeded.seed(s.strategies[previous].GetGasPrice())
+		}
+		s.current = strategy
+	}
+	s.lock.Unlock()
+
+	next.UpdateGasPriceAvg()
+	log.Info("Switched gas pricer strategy", "from", previous, "to", strategy, "price", next.GetGasPrice())
+	return nil
+}
+
+// clampGasPrice keeps the price between the default (minimum) and maximum gas price, a zero maximum being no maximum
+func clampGasPrice(cfg *ethconfig.GasPriceConf, price *big.Int) *big.Int {
+	if min := new(big.Int).SetUint64(cfg.DefaultGasPrice); price.Cmp(min) < 0 {
+		return min
+	}
+	if cfg.MaxGasPrice > 0 {
+		if max := new(big.Int).SetUint64(cfg.MaxGasPrice); price.Cmp(max) > 0 {
+			return max
+		}
+	}
+	return price
+}
+
+// fixedGasPrice always suggests the same price
+type fixedGasPrice struct {
+	price *big.Int
+}
+
+func newFixedGasPricer(cfg *ethconfig.GasPriceConf) *fixedGasPrice {
+	price := cfg.FixedGasPrice
+	if price == 0 {
+		price = cfg.DefaultGasPrice
+	}
+	return &fixedGasPrice{price: new(big.Int).SetUint64(price)}
+}
+
+func (g *fixedGasPrice) GetGasPrice() *big.Int {
+	return new(big.Int).Set(g.price)
+}
+
+func (g *fixedGasPrice) UpdateGasPriceAvg() {}
+
+// l1FollowerGasPrice follows the L1 gas price scaled by a factor, keeping the last price while L1 can't be reached
+type l1FollowerGasPrice struct {
+	cfg        *ethconfig.GasPriceConf
+	l1GasPrice func() (*big.Int, error)
+
+	lock      sync.RWMutex
+	lastPrice *big.Int
+}
+
+func newL1FollowerGasPricer(cfg *ethconfig.GasPriceConf, l1GasPrice func() (*big.Int, error)) *l1FollowerGasPrice {
+	return &l1FollowerGasPrice{
+		cfg:        cfg,
+		l1GasPrice: l1GasPrice,
+		lastPrice:  new(big.Int).SetUint64(cfg.DefaultGasPrice),
+	}
+}
+
+func (g *l1FollowerGasPrice) UpdateGasPriceAvg() {
+	l1Price, err := g.l1GasPrice()
+	if err != nil {
+		log.Warn("Failed to get the L1 gas price, keeping the last gas price", "err", err)
+		return
+	}
+
+	scaled, _ := new(big.Float).Mul(new(big.Float).SetInt(l1Price), big.NewFloat(g.cfg.L1GasPriceFactor)).Int(nil)
+	price := clampGasPrice(g.cfg, scaled)
+
+	g.lock.Lock()
+	g.lastPrice = price
+	g.lock.Unlock()
+
+	log.Debug("Setting gas prices", "l1 gas price", l1Price, "factor", g.cfg.L1GasPriceFactor, "l2 gas price", price)
+}
+
+func (g *l1FollowerGasPrice) GetGasPrice() *big.Int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.lastPrice
+}
+
+// eip1559GasPrice moves the price the way EIP-1559 moves the base fee, with the gas pending in the pool standing in
+// for the gas used by the parent block: above the target the price goes up, below it goes down, by at most
+// 1/BaseFeeChangeDenominator per update
+type eip1559GasPrice struct {
+	cfg        *ethconfig.GasPriceConf
+	pendingGas func() (uint64, error)
+
+	lock      sync.RWMutex
+	lastPrice *big.Int
+}
+
+func newEIP1559GasPricer(cfg *ethconfig.GasPriceConf, pendingGas func() (uint64, error)) *eip1559GasPrice {
+	return &eip1559GasPrice{
+		cfg:        cfg,
+		pendingGas: pendingGas,
+		lastPrice:  new(big.Int).SetUint64(cfg.DefaultGasPrice),
+	}
+}
+
+func (g *eip1559GasPrice) seed(price *big.Int) {
+	if price == nil {
+		return
+	}
+	g.lock.Lock()
+	g.lastPrice = clampGasPrice(g.cfg, new(big.Int).Set(price))
+	g.lock.Unlock()
+}
+
+func (g *eip1559GasPrice) UpdateGasPriceAvg() {
+	pending, err := g.pendingGas()
+	if err != nil {
+		log.Warn("Failed to get the pool's pending gas, keeping the last gas price", "err", err)
+		return
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.lastPrice = nextEIP1559GasPrice(g.cfg, g.lastPrice, pending)
+	log.Debug("Setting gas prices", "pending gas", pending, "target", g.cfg.TargetPendingGas, "l2 gas price", g.lastPrice)
+}
+
+func (g *eip1559GasPrice) GetGasPrice() *big.Int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.lastPrice
+}
+
+// nextEIP1559GasPrice is calcBaseFee with the pending gas as the gas used and the target pending gas as the gas target
+func nextEIP1559GasPrice(cfg *ethconfig.GasPriceConf, price *big.Int, pending uint64) *big.Int {
+	target := cfg.TargetPendingGas
+	if target == 0 || pending == target {
+		return clampGasPrice(cfg, price)
+	}
+
+	var delta uint64
+	if pending > target {
+		delta = pending - target
+	} else {
+		delta = target - pending
+	}
+	change := new(big.Int).Mul(price, new(big.Int).SetUint64(delta))
+	change.Div(change, new(big.Int).SetUint64(target))
+	change.Div(change, new(big.Int).SetUint64(cfg.BaseFeeChangeDenominator))
+
+	next := new(big.Int)
+	if pending > target {
+		// always move up by at least one wei so a price can't stay stuck at a low value
+		if change.Sign() == 0 {
+			change.SetUint64(1)
+		}
+		next.Add(price, change)
+	} else {
+		next.Sub(price, change)
+	}
+	return clampGasPrice(cfg, next)
+}
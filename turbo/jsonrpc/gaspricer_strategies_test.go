@@ -0,0 +1,139 @@
+package jsonrpc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+)
+
+func testGasPriceConf() *ethconfig.GasPriceConf {
+	cfg := ethconfig.DefaultGPC
+	cfg.DefaultGasPrice = 10_000_000
+	cfg.MaxGasPrice = 1_000_000_000
+	cfg.L1GasPriceFactor = 0.04
+	cfg.TargetPendingGas = 10_000_000
+	return &cfg
+}
+
+func TestPercentileGasPrice(t *testing.T) {
+	// tips sampled from three consecutive blocks, the second one empty
+	blocks := [][]int64{
+		{12_000_000, 15_000_000, 30_000_000},
+		{},
+		{11_000_000, 20_000_000, 25_000_000},
+	}
+	var tips []*big.Int
+	for _, block := range blocks {
+		for _, tip := range block {
+			tips = append(tips, big.NewInt(tip))
+		}
+	}
+
+	fallback := big.NewInt(10_000_000)
+	require.Equal(t, big.NewInt(20_000_000), percentileGasPrice(tips, 70, fallback))
+	require.Equal(t, big.NewInt(11_000_000), percentileGasPrice(tips, 0, fallback))
+	require.Equal(t, big.NewInt(30_000_000), percentileGasPrice(tips, 100, fallback))
+	require.Equal(t, fallback, percentileGasPrice(nil, 70, fallback))
+}
+
+func TestFixedGasPricer(t *testing.T) {
+	cfg := testGasPriceConf()
+	require.Equal(t, big.NewInt(10_000_000), newFixedGasPricer(cfg).GetGasPrice())
+
+	cfg.FixedGasPrice = 50_000_000
+	pricer := newFixedGasPricer(cfg)
+	pricer.UpdateGasPriceAvg()
+	require.Equal(t, big.NewInt(50_000_000), pricer.GetGasPrice())
+}
+
+func TestL1FollowerGasPricer(t *testing.T) {
+	cfg := testGasPriceConf()
+
+	// L1 gas prices recorded on consecutive updates, with L1 unreachable on one of them
+	recorded := []struct {
+		l1Price int64
+		err     error
+		want    int64
+	}{
+		{l1Price: 1_000_000_000, want: 40_000_000},
+		{l1Price: 2_500_000_000, want: 100_000_000},
+		{err: errors.New("connection refused"), want: 100_000_000},
+		{l1Price: 100_000_000, want: 10_000_000},       // below the default price
+		{l1Price: 50_000_000_000, want: 1_000_000_000}, // above the max price
+	}
+
+	i := 0
+	pricer := newL1FollowerGasPricer(cfg, func() (*big.Int, error) {
+		r := recorded[i]
+		return big.NewInt(r.l1Price), r.err
+	})
+	require.Equal(t, big.NewInt(10_000_000), pricer.GetGasPrice())
+
+	for ; i < len(recorded); i++ {
+		pricer.UpdateGasPriceAvg()
+		require.Equal(t, big.NewInt(recorded[i].want), pricer.GetGasPrice(), "update %d", i)
+	}
+}
+
+func TestEIP1559GasPricer(t *testing.T) {
+	cfg := testGasPriceConf()
+
+	// pending gas in the pool recorded on consecutive updates
+	recorded := []struct {
+		pending uint64
+		want    int64
+	}{
+		{pending: 20_000_000, want: 11_250_000}, // twice the target, +12.5%
+		{pending: 20_000_000, want: 12_656_250},
+		{pending: 15_000_000, want: 13_447_265},
+		{pending: 10_000_000, want: 13_447_265}, // at the target
+		{pending: 5_000_000, want: 12_606_811},
+		{pending: 0, want: 11_030_960}, // empty pool, -12.5%
+		{pending: 0, want: 10_000_000}, // down to the default price
+		{pending: 0, want: 10_000_000},
+	}
+
+	i := 0
+	pricer := newEIP1559GasPricer(cfg, func() (uint64, error) {
+		return recorded[i].pending, nil
+	})
+
+	for ; i < len(recorded); i++ {
+		pricer.UpdateGasPriceAvg()
+		require.Equal(t, big.NewInt(recorded[i].want), pricer.GetGasPrice(), "update %d", i)
+	}
+
+	cfg.MaxGasPrice = 11_000_000
+	require.Equal(t, big.NewInt(11_000_000), nextEIP1559GasPrice(cfg, big.NewInt(10_900_000), 80_000_000))
+}
+
+func TestSwitchableGasPricer(t *testing.T) {
+	cfg := testGasPriceConf()
+	cfg.FixedGasPrice = 40_000_000
+
+	_, err := NewSwitchableGasPricer("auction", nil)
+	require.Error(t, err)
+
+	pricer, err := NewSwitchableGasPricer(ethconfig.GasPricerFixed, map[string]L2GasPricer{
+		ethconfig.GasPricerFixed: newFixedGasPricer(cfg),
+		ethconfig.GasPricerEIP1559: newEIP1559GasPricer(cfg, func() (uint64, error) {
+			return cfg.TargetPendingGas * 2, nil
+		}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, ethconfig.GasPricerFixed, pricer.Strategy())
+	require.Equal(t, []string{ethconfig.GasPricerEIP1559, ethconfig.GasPricerFixed}, pricer.Strategies())
+	require.Equal(t, big.NewInt(40_000_000), pricer.GetGasPrice())
+
+	require.Error(t, pricer.SetStrategy("auction"))
+	require.Equal(t, ethconfig.GasPricerFixed, pricer.Strategy())
+
+	// the eip1559 strategy carries on from the fixed price and is updated straight away
+	require.NoError(t, pricer.SetStrategy(ethconfig.GasPricerEIP1559))
+	require.Equal(t, ethconfig.GasPricerEIP1559, pricer.Strategy())
+	require.Equal(t, big.NewInt(45_000_000), pricer.GetGasPrice())
+}
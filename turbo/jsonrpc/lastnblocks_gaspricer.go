@@ -29,9 +29,22 @@ type L2GasPricer interface {
 	UpdateGasPriceAvg()
 }
 
-// NewL2GasPricer new l2 gas pricer
-func NewL2GasPricer(ctx context.Context, cfg *ethconfig.GasPriceConf, base *BaseAPI, txPool txpool.TxpoolClient, db kv.RoDB) L2GasPricer {
-	pricer := newLastNL2BlocksGasPriceSuggester(ctx, cfg, base, txPool, db)
+// NewL2GasPricer new l2 gas pricer, using the configured strategy until it is switched
+func NewL2GasPricer(ctx context.Context, cfg *ethconfig.GasPriceConf, base *BaseAPI, txPool txpool.TxpoolClient, db kv.RoDB, l1GasPrice func() (*big.Int, error)) *SwitchableGasPricer {
+	pendingGas := func() (uint64, error) {
+		return pendingPoolGas(ctx, txPool)
+	}
+	strategies := map[string]L2GasPricer{
+		ethconfig.GasPricerLastNBlocks: newLastNL2BlocksGasPriceSuggester(ctx, cfg, base, txPool, db),
+		ethconfig.GasPricerL1Follower:  newL1FollowerGasPricer(cfg, l1GasPrice),
+		ethconfig.GasPricerFixed:       newFixedGasPricer(cfg),
+		ethconfig.GasPricerEIP1559:     newEIP1559GasPricer(cfg, pendingGas),
+	}
+	pricer, err := NewSwitchableGasPricer(cfg.Strategy, strategies)
+	if err != nil {
+		log.Warn("Falling back to the default gas pricer strategy", "err", err)
+		pricer, _ = NewSwitchableGasPricer(ethconfig.GasPricerLastNBlocks, strategies)
+	}
 	go func() {
 		up := cfg.UpdatePeriod
 		updateTimer := time.NewTimer(up)
@@ -129,11 +142,7 @@ func (g *LastNL2BlocksGasPrice) UpdateGasPriceAvg() {
 		results = append(results, res.values...)
 	}
 
-	price := lastPrice
-	if len(results) > 0 {
-		slices.SortFunc(results, func(a, b *big.Int) int { return a.Cmp(b) })
-		price = results[(len(results)-1)*g.cfg.Percentile/100]
-	}
+	price := percentileGasPrice(results, g.cfg.Percentile, lastPrice)
 	log.Debug("Gasprice historical data spot check results", "len(results):", len(results), "percentile:",
 		g.cfg.Percentile, "checkBlocks:", g.cfg.CheckBlocks, "price:", price.Uint64())
 
@@ -165,6 +174,15 @@ func (g *LastNL2BlocksGasPrice) UpdateGasPriceAvg() {
 	log.Debug("Setting gas prices", "block: ", g.lastL2BlockNumber, "l2 gas price:", g.lastPrice)
 }
 
+// percentileGasPrice picks the percentile of the sampled tips, or the fallback if there are none
+func percentileGasPrice(tips []*big.Int, percentile int, fallback *big.Int) *big.Int {
+	if len(tips) == 0 {
+		return fallback
+	}
+	slices.SortFunc(tips, func(a, b *big.Int) int { return a.Cmp(b) })
+	return tips[(len(tips)-1)*percentile/100]
+}
+
 // GetGasPrice get gas price
 func (g *LastNL2BlocksGasPrice) GetGasPrice() *big.Int {
 	g.cacheLock.Lock()
@@ -184,10 +202,25 @@ func (g *LastNL2BlocksGasPrice) IsTxPoolIdle(ctx context.Context) (bool, error)
 		return false, nil
 	}
 
-	reply, err := g.txPool.Pending(ctx, &emptypb.Empty{})
+	totalPendingGas, err := pendingPoolGas(ctx, g.txPool)
 	if err != nil {
 		return false, err
 	}
+
+	isIdle := uint64(sReply.PendingCount) < thresholdCount && totalPendingGas < g.cfg.PendingGasLimit
+	log.Debug("IsTxPoolIdle", "is", isIdle,
+		"pendingCount:", sReply.PendingCount, "thresholdCount", thresholdCount,
+		"totalPendingGas", totalPendingGas, "pendingGasLimit", g.cfg.PendingGasLimit)
+
+	return isIdle, nil
+}
+
+// pendingPoolGas sums the gas limits of the pool's pending transactions
+func pendingPoolGas(ctx context.Context, txPool txpool.TxpoolClient) (uint64, error) {
+	reply, err := txPool.Pending(ctx, &emptypb.Empty{})
+	if err != nil {
+		return 0, err
+	}
 	totalPendingGas := uint64(0)
 	for _, rtx := range reply.Txs {
 		txn, err := types.DecodeWrappedTransaction(rtx.RlpTx)
@@ -196,13 +229,7 @@ func (g *LastNL2BlocksGasPrice) IsTxPoolIdle(ctx context.Context) (bool, error)
 		}
 		totalPendingGas += txn.GetGas()
 	}
-
-	isIdle := uint64(sReply.PendingCount) < thresholdCount && totalPendingGas < g.cfg.PendingGasLimit
-	log.Debug("IsTxPoolIdle", "is", isIdle,
-		"pendingCount:", sReply.PendingCount, "thresholdCount", thresholdCount,
-		"totalPendingGas", totalPendingGas, "pendingGasLimit", g.cfg.PendingGasLimit)
-
-	return isIdle, nil
+	return totalPendingGas, nil
 }
 
 // BlockNumber get current blocknum
@@ -19,6 +19,7 @@ import (
 	"math"
 
 	"github.com/holiman/uint256"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/ledgerwatch/erigon-lib/common/hexutil"
 	"github.com/ledgerwatch/erigon-lib/kv/membatchwithdb"
 	"github.com/ledgerwatch/erigon/core"
@@ -46,7 +47,6 @@ import (
 	"github.com/ledgerwatch/erigon/zk/utils"
 	zkUtils "github.com/ledgerwatch/erigon/zk/utils"
 	"github.com/ledgerwatch/erigon/zk/witness"
-	"github.com/ledgerwatch/erigon/zkevm/hex"
 	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
 )
 
@@ -66,9 +66,9 @@ type ZkEvmAPI interface {
 	GetFullBlockByHash(ctx context.Context, hash common.Hash, fullTx bool) (types.Block, error)
 	// GetBroadcastURI(ctx context.Context) (string, error)
 	GetWitness(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, mode *WitnessMode, debug *bool) (hexutility.Bytes, error)
-	GetBlockRangeWitness(ctx context.Context, startBlockNrOrHash rpc.BlockNumberOrHash, endBlockNrOrHash rpc.BlockNumberOrHash, mode *WitnessMode, debug *bool) (hexutility.Bytes, error)
-	GetBatchWitness(ctx context.Context, batchNumber uint64, mode *WitnessMode) (interface{}, error)
-	GetProverInput(ctx context.Context, batchNumber uint64, mode *WitnessMode, debug *bool) (*legacy_executor_verifier.RpcPayload, error)
+	GetBlockRangeWitness(ctx context.Context, startBlockNrOrHash rpc.BlockNumberOrHash, endBlockNrOrHash rpc.BlockNumberOrHash, mode *WitnessMode, debug *bool, stream *jsoniter.Stream) error
+	GetBatchWitness(ctx context.Context, batchNumber uint64, mode *WitnessMode, stream *jsoniter.Stream) error
+	GetProverInput(ctx context.Context, batchNumber uint64, mode *WitnessMode, debug *bool, stream *jsoniter.Stream) error
 	GetLatestGlobalExitRoot(ctx context.Context) (common.Hash, error)
 	GetExitRootsByGER(ctx context.Context, globalExitRoot common.Hash) (*ZkExitRoots, error)
 	GetL2BlockInfoTree(ctx context.Context, blockNum rpc.BlockNumberOrHash) (json.RawMessage, error)
@@ -98,6 +98,7 @@ type ZkEvmAPIImpl struct {
 	l2SequencerUrl   string
 	semaphores       map[string]chan struct{}
 	datastreamServer server.DataStreamServer
+	witnessCache     *witness.Cache
 }
 
 func (api *ZkEvmAPIImpl) initializeSemaphores(functionLimits map[string]int) {
@@ -138,6 +139,11 @@ func NewZkEvmAPI(
 	return a
 }
 
+// SetWitnessCache lets getBatchWitness serve the witnesses the node pre-generates in the node's witness mode
+func (api *ZkEvmAPIImpl) SetWitnessCache(cache *witness.Cache) {
+	api.witnessCache = cache
+}
+
 // ConsolidatedBlockNumber returns the latest consolidated block number
 // Once a batch is verified, it is connected to the blockchain, and the block number of the most recent block in that batch
 // becomes the "consolidated block number.”
@@ -970,10 +976,10 @@ func (api *ZkEvmAPIImpl) GetWitness(ctx context.Context, blockNrOrHash rpc.Block
 	return api.getBlockRangeWitness(ctx, api.db, blockNrOrHash, blockNrOrHash, dbg, checkedMode)
 }
 
-func (api *ZkEvmAPIImpl) GetBlockRangeWitness(ctx context.Context, startBlockNrOrHash rpc.BlockNumberOrHash, endBlockNrOrHash rpc.BlockNumberOrHash, mode *WitnessMode, debug *bool) (hexutility.Bytes, error) {
+func (api *ZkEvmAPIImpl) GetBlockRangeWitness(ctx context.Context, startBlockNrOrHash rpc.BlockNumberOrHash, endBlockNrOrHash rpc.BlockNumberOrHash, mode *WitnessMode, debug *bool, stream *jsoniter.Stream) error {
 	checkedMode := WitnessModeNone
 	if mode != nil && *mode != WitnessModeFull && *mode != WitnessModeTrimmed {
-		return nil, errors.New("invalid mode, must be full or trimmed")
+		return errors.New("invalid mode, must be full or trimmed")
 	} else if mode != nil {
 		checkedMode = *mode
 	}
@@ -982,7 +988,11 @@ func (api *ZkEvmAPIImpl) GetBlockRangeWitness(ctx context.Context, startBlockNrO
 	if debug != nil {
 		dbg = *debug
 	}
-	return api.getBlockRangeWitness(ctx, api.db, startBlockNrOrHash, endBlockNrOrHash, dbg, checkedMode)
+	witness, err := api.getBlockRangeWitness(ctx, api.db, startBlockNrOrHash, endBlockNrOrHash, dbg, checkedMode)
+	if err != nil {
+		return err
+	}
+	return writeWitness(stream, witness)
 }
 
 func (api *ZkEvmAPIImpl) getBatchWitness(ctx context.Context, tx kv.Tx, batchNum uint64, debug bool, mode WitnessMode) (hexutility.Bytes, error) {
@@ -1083,28 +1093,46 @@ const (
 	WitnessModeTrimmedRegen WitnessMode = "trimmed_regen" // forces regenerate no matter the node mode
 )
 
-func (api *ZkEvmAPIImpl) GetBatchWitness(ctx context.Context, batchNumber uint64, mode *WitnessMode) (interface{}, error) {
+// GetBatchWitness streams the witness of the batch, the witnesses the node keeps in its own witness mode are served
+// without generating them again
+func (api *ZkEvmAPIImpl) GetBatchWitness(ctx context.Context, batchNumber uint64, mode *WitnessMode, stream *jsoniter.Stream) error {
+	witness, forwarded, err := api.batchWitness(ctx, batchNumber, mode)
+	if err != nil {
+		return err
+	}
+	if forwarded != nil {
+		if _, err = stream.Write(forwarded); err != nil {
+			return err
+		}
+		return stream.Flush()
+	}
+	return writeWitness(stream, witness)
+}
+
+// batchWitness returns the witness of the batch, or the response of the sequencer for invalid batches
+func (api *ZkEvmAPIImpl) batchWitness(ctx context.Context, batchNumber uint64, mode *WitnessMode) ([]byte, json.RawMessage, error) {
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer tx.Rollback()
 
 	hermezDb := hermez_db.NewHermezDbReader(tx)
 	badBatch, err := hermezDb.GetInvalidBatch(batchNumber)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if badBatch && !sequencer.IsSequencer() {
 		// we won't have the details in our db if the batch is marked as invalid so we need to check this
 		// here
-		return api.sendGetBatchWitness(api.l2SequencerUrl, batchNumber, mode)
+		forwarded, err := api.sendGetBatchWitness(api.l2SequencerUrl, batchNumber, mode)
+		return nil, forwarded, err
 	}
 
 	checkedMode := WitnessModeNone
 	if mode != nil && *mode != WitnessModeFull && *mode != WitnessModeTrimmed {
-		return nil, errors.New("invalid mode, must be full or trimmed")
+		return nil, nil, errors.New("invalid mode, must be full or trimmed")
 	} else if mode != nil {
 		checkedMode = *mode
 	}
@@ -1120,24 +1148,46 @@ func (api *ZkEvmAPIImpl) GetBatchWitness(ctx context.Context, batchNumber uint64
 		hermezDb := hermez_db.NewHermezDbReader(tx)
 		witnessCached, err := hermezDb.GetWitness(batchNumber)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if witnessCached != nil {
-			return witnessCached, nil
+			return witnessCached, nil, nil
+		}
+
+		if api.witnessCache != nil {
+			witnessCached, err = api.witnessCache.Get(ctx, tx, batchNumber)
+			if err != nil {
+				return nil, nil, err
+			}
+			if witnessCached != nil {
+				return witnessCached, nil, nil
+			}
+		}
+	}
+
+	generated, err := api.getBatchWitness(ctx, tx, batchNumber, false, checkedMode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// witnesses generated on demand in the node's mode are cached too, the cache evicts them like any other
+	if api.witnessCache != nil && (isWitnessModeNone || rpcModeMatchesNodeMode) {
+		if err = api.witnessCache.Put(ctx, tx, batchNumber, generated); err != nil {
+			log.Warn("Failed to cache the batch witness", "batch", batchNumber, "err", err)
 		}
 	}
 
-	return api.getBatchWitness(ctx, tx, batchNumber, false, checkedMode)
+	return generated, nil, nil
 }
 
-func (api *ZkEvmAPIImpl) GetProverInput(ctx context.Context, batchNumber uint64, mode *WitnessMode, debug *bool) (*legacy_executor_verifier.RpcPayload, error) {
+func (api *ZkEvmAPIImpl) GetProverInput(ctx context.Context, batchNumber uint64, mode *WitnessMode, debug *bool, stream *jsoniter.Stream) error {
 	if !sequencer.IsSequencer() {
-		return nil, errors.New("method only supported from a sequencer node")
+		return errors.New("method only supported from a sequencer node")
 	}
 
 	checkedMode := WitnessModeNone
 	if mode != nil && *mode != WitnessModeFull && *mode != WitnessModeTrimmed {
-		return nil, errors.New("invalid mode, must be full or trimmed")
+		return errors.New("invalid mode, must be full or trimmed")
 	} else if mode != nil {
 		checkedMode = *mode
 	}
@@ -1149,7 +1199,7 @@ func (api *ZkEvmAPIImpl) GetProverInput(ctx context.Context, batchNumber uint64,
 
 	tx, err := api.db.BeginRo(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer tx.Rollback()
 
@@ -1157,12 +1207,12 @@ func (api *ZkEvmAPIImpl) GetProverInput(ctx context.Context, batchNumber uint64,
 
 	blockNumbers, err := hDb.GetL2BlockNosByBatch(batchNumber)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	lastBlock, err := rawdb.ReadBlockByNumber(tx, blockNumbers[len(blockNumbers)-1])
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	start := rpc.BlockNumberOrHashWithNumber(rpc.BlockNumber(blockNumbers[0]))
@@ -1170,14 +1220,14 @@ func (api *ZkEvmAPIImpl) GetProverInput(ctx context.Context, batchNumber uint64,
 
 	rangeWitness, err := api.getBlockRangeWitness(ctx, api.db, start, end, useDebug, checkedMode)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	var oldAccInputHash common.Hash
 	if batchNumber > 0 {
 		oaih, err := api.getAccInputHash(ctx, hDb, batchNumber-1)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		oldAccInputHash = *oaih
 	} else {
@@ -1186,13 +1236,12 @@ func (api *ZkEvmAPIImpl) GetProverInput(ctx context.Context, batchNumber uint64,
 
 	timestampLimit := lastBlock.Time()
 
-	return &legacy_executor_verifier.RpcPayload{
-		Witness:           hex.EncodeToHex(rangeWitness),
+	return writeProverInput(stream, &legacy_executor_verifier.RpcPayload{
 		Coinbase:          api.config.AddressSequencer.String(),
 		OldAccInputHash:   oldAccInputHash.String(),
 		TimestampLimit:    timestampLimit,
 		ForcedBlockhashL1: "",
-	}, nil
+	}, rangeWitness)
 }
 
 func (api *ZkEvmAPIImpl) GetLatestGlobalExitRoot(ctx context.Context) (common.Hash, error) {
@@ -1670,7 +1719,14 @@ func (zkapi *ZkEvmAPIImpl) GetProof(ctx context.Context, address common.Address,
 		return nil, err
 	}
 
+	var smtRoDb smt.RoDB
 	if blockNr < latestBlock {
+		if smtRoDb, err = historicalSmt(ctx, batch, blockNr, uint64(api.MaxGetProofRewindBlockCount)); err != nil {
+			return nil, err
+		}
+	}
+
+	if blockNr < latestBlock && smtRoDb == nil {
 		if latestBlock-blockNr > uint64(api.MaxGetProofRewindBlockCount) {
 			return nil, fmt.Errorf("requested block is too old, block must be within %d blocks of the head block number (currently %d)", api.MaxGetProofRewindBlockCount, latestBlock)
 		}
@@ -1742,7 +1798,10 @@ func (zkapi *ZkEvmAPIImpl) GetProof(ctx context.Context, address common.Address,
 		return nil, err
 	}
 
-	smtTrie := smt.NewRoSMT(smtDb.NewRoEriDb(tx))
+	if smtRoDb == nil {
+		smtRoDb = smtDb.NewRoEriDb(tx)
+	}
+	smtTrie := smt.NewRoSMT(smtRoDb)
 
 	proofs, err := smt.BuildProofs(smtTrie, rl, ctx)
 	if err != nil {
@@ -1824,6 +1883,37 @@ func (zkapi *ZkEvmAPIImpl) GetProof(ctx context.Context, address common.Address,
 	return accProof, nil
 }
 
+// historicalSmt opens the SMT as it was at the block from the SMT history, or returns nil if the history doesn't go
+// back that far.  A block without a checkpoint of its own is unwound in memory from the next checkpoint after it
+func historicalSmt(ctx context.Context, batch kv.RwTx, blockNr, maxRewind uint64) (smt.RoDB, error) {
+	eridb := smtDb.NewEriDb(batch)
+	start, found, err := eridb.GetHistoryStart()
+	if err != nil || !found || blockNr < start {
+		return nil, err
+	}
+
+	checkpoint, root, found, err := eridb.GetCheckpointFrom(blockNr)
+	if err != nil || !found {
+		return nil, err
+	}
+	if checkpoint == blockNr {
+		return smtDb.NewHistoricalRoEriDb(batch, root), nil
+	}
+
+	if checkpoint-blockNr > maxRewind {
+		return nil, fmt.Errorf("requested block is too far from an SMT checkpoint, block must be within %d blocks of the next checkpoint (currently %d)", maxRewind, checkpoint)
+	}
+	if err = eridb.SetLastRoot(root); err != nil {
+		return nil, err
+	}
+	unwound, err := zkStages.UnwindZkSMTFromCheckpoint(ctx, "getProof", checkpoint, blockNr, batch)
+	if err != nil {
+		return nil, fmt.Errorf("unwind SMT from checkpoint %d: %w", checkpoint, err)
+	}
+
+	return smtDb.NewHistoricalRoEriDb(batch, unwound.Big()), nil
+}
+
 // ForkId returns the network's current fork ID
 func (api *ZkEvmAPIImpl) GetForkId(ctx context.Context) (hexutil.Uint64, error) {
 	tx, err := api.db.BeginRo(ctx)
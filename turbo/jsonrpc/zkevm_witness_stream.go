@@ -0,0 +1,58 @@
+package jsonrpc
+
+import (
+	"encoding/hex"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+)
+
+// witnessChunkSize is how much of a witness is hex encoded and written to the client at a time
+const witnessChunkSize = 1 << 20
+
+// writeWitness writes the witness as a hex string a chunk at a time, so neither the hex encoding nor the JSON response
+// is held in memory in one piece and the client can start reading the witness while the rest is written
+func writeWitness(stream *jsoniter.Stream, witness []byte) error {
+	buf := make([]byte, hex.EncodedLen(min(len(witness), witnessChunkSize)))
+
+	stream.WriteRaw(`"0x`)
+	for len(witness) > 0 {
+		n := min(len(witness), witnessChunkSize)
+		hex.Encode(buf, witness[:n])
+		if _, err := stream.Write(buf[:hex.EncodedLen(n)]); err != nil {
+			return err
+		}
+		if err := stream.Flush(); err != nil {
+			return err
+		}
+		witness = witness[n:]
+	}
+	stream.WriteRaw(`"`)
+
+	return stream.Flush()
+}
+
+// writeProverInput writes the prover input with its witness streamed, the payload's own witness is ignored
+func writeProverInput(stream *jsoniter.Stream, payload *legacy_executor_verifier.RpcPayload, witness []byte) error {
+	stream.WriteObjectStart()
+	stream.WriteObjectField("witness")
+	if err := writeWitness(stream, witness); err != nil {
+		return err
+	}
+	stream.WriteMore()
+	stream.WriteObjectField("coinbase")
+	stream.WriteString(payload.Coinbase)
+	stream.WriteMore()
+	stream.WriteObjectField("oldAccInputHash")
+	stream.WriteString(payload.OldAccInputHash)
+	stream.WriteMore()
+	stream.WriteObjectField("timestampLimit")
+	stream.WriteUint64(payload.TimestampLimit)
+	stream.WriteMore()
+	stream.WriteObjectField("forcedBlockhashL1")
+	stream.WriteString(payload.ForcedBlockhashL1)
+	stream.WriteObjectEnd()
+
+	return stream.Flush()
+}
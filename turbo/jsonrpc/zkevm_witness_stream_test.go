@@ -0,0 +1,45 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/ledgerwatch/erigon-lib/common/hexutility"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+)
+
+func TestWriteWitness(t *testing.T) {
+	for _, size := range []int{0, 1, witnessChunkSize, 2*witnessChunkSize + 7} {
+		witness := bytes.Repeat([]byte{0xab, 0x01}, size/2+size%2)[:size]
+
+		var out bytes.Buffer
+		stream := jsoniter.NewStream(jsoniter.ConfigDefault, &out, 4096)
+		require.NoError(t, writeWitness(stream, witness))
+
+		expected, err := json.Marshal(hexutility.Bytes(witness))
+		require.NoError(t, err)
+		require.Equal(t, string(expected), out.String(), "size %d", size)
+	}
+}
+
+func TestWriteProverInput(t *testing.T) {
+	witness := bytes.Repeat([]byte{0x12}, witnessChunkSize+1)
+	payload := &legacy_executor_verifier.RpcPayload{
+		Coinbase:        "0x5b06837a43bdc3dd9f114558daf4b26ed49842ed",
+		OldAccInputHash: "0x0000000000000000000000000000000000000000000000000000000000000001",
+		TimestampLimit:  1_700_000_000,
+	}
+
+	var out bytes.Buffer
+	stream := jsoniter.NewStream(jsoniter.ConfigDefault, &out, 4096)
+	require.NoError(t, writeProverInput(stream, payload, witness))
+
+	var decoded legacy_executor_verifier.RpcPayload
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	payload.Witness = hexutility.Encode(witness)
+	require.Equal(t, *payload, decoded)
+}
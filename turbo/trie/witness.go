@@ -122,6 +122,8 @@ func NewWitnessFromReader(input io.Reader, trace bool) (*Witness, error) {
 			op = &OperatorEmptyRoot{}
 		case OpExtension:
 			op = &OperatorExtension{}
+		case OpSMTLeaf:
+			op = &OperatorSMTLeafValue{}
 		case OpNewTrie:
 			/* end of the current trie, end the function */
 		default:
@@ -0,0 +1,61 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/crypto"
+)
+
+// ArchiveBackend serves off chain data from a local directory holding one file per data hash.  It is
+// typically paired with the DAC backend so a copy of everything fetched is kept for when the DAC is offline
+type ArchiveBackend struct {
+	dir string
+}
+
+func NewArchiveBackend(dir string) (*ArchiveBackend, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("data availability archive directory is required for the archive backend")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ArchiveBackend{dir: dir}, nil
+}
+
+func (a *ArchiveBackend) GetOffChainData(_ context.Context, _ uint64, hash common.Hash) ([]byte, error) {
+	data, err := os.ReadFile(a.path(hash))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w in archive: %s", ErrDataNotFound, hash)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (a *ArchiveBackend) StoreOffChainData(hash common.Hash, data []byte) error {
+	if actual := crypto.Keccak256Hash(data); actual != hash {
+		return fmt.Errorf("refusing to archive off chain data for hash %s, data hashes to %s", hash, actual)
+	}
+
+	target := a.path(hash)
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+
+	// write to a temp file first so a crash never leaves a partial file behind under the real name
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+func (a *ArchiveBackend) path(hash common.Hash) string {
+	return filepath.Join(a.dir, hash.Hex())
+}
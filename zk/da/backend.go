@@ -0,0 +1,112 @@
+package da
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	BackendDAC     = "dac"
+	BackendArchive = "archive"
+	BackendBlob    = "blob"
+)
+
+var ErrDataNotFound = errors.New("off chain data not found")
+
+// DataAvailabilityBackend is a source of off chain batch data for validium chains.  The L1 block number
+// is the block the sequence was included in on the L1, backends that don't need it are free to ignore it
+type DataAvailabilityBackend interface {
+	GetOffChainData(ctx context.Context, l1BlockNo uint64, hash common.Hash) ([]byte, error)
+}
+
+// DataArchiver is implemented by backends that can keep a copy of data fetched from another backend
+type DataArchiver interface {
+	StoreOffChainData(hash common.Hash, data []byte) error
+}
+
+type Config struct {
+	// Backends is the ordered list of backends to try, the first one to return data wins
+	Backends   []string
+	DAUrls     []string
+	ArchiveDir string
+	BeaconUrl  string
+}
+
+// NewBackend builds the data availability backend described by the config.  When more than one backend is
+// configured they are tried in order and any data found is copied into the archive backends further up the list
+func NewBackend(cfg Config, headerTimeFn HeaderTimeFn) (DataAvailabilityBackend, error) {
+	backends := make([]DataAvailabilityBackend, 0, len(cfg.Backends))
+	for _, name := range cfg.Backends {
+		switch strings.TrimSpace(name) {
+		case BackendDAC:
+			backends = append(backends, NewDACBackend(cfg.DAUrls...))
+		case BackendArchive:
+			archive, err := NewArchiveBackend(cfg.ArchiveDir)
+			if err != nil {
+				return nil, err
+			}
+			backends = append(backends, archive)
+		case BackendBlob:
+			if headerTimeFn == nil {
+				return nil, fmt.Errorf("the blob data availability backend requires access to L1 headers")
+			}
+			backends = append(backends, NewBlobBackend(cfg.BeaconUrl, headerTimeFn))
+		case "":
+			continue
+		default:
+			return nil, fmt.Errorf("unknown data availability backend: %s", name)
+		}
+	}
+
+	switch len(backends) {
+	case 0:
+		return nil, fmt.Errorf("no data availability backend configured")
+	case 1:
+		return backends[0], nil
+	default:
+		return NewFallbackBackend(backends...), nil
+	}
+}
+
+// FallbackBackend tries each of its backends in order until one of them returns the data
+type FallbackBackend struct {
+	backends []DataAvailabilityBackend
+}
+
+func NewFallbackBackend(backends ...DataAvailabilityBackend) *FallbackBackend {
+	return &FallbackBackend{backends: backends}
+}
+
+func (f *FallbackBackend) GetOffChainData(ctx context.Context, l1BlockNo uint64, hash common.Hash) ([]byte, error) {
+	var errs []error
+	for idx, b := range f.backends {
+		data, err := b.GetOffChainData(ctx, l1BlockNo, hash)
+		if err != nil {
+			log.Debug("Failed to get off chain data from backend", "backend", idx, "hash", hash, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		// keep a copy in any other archive so the next lookup doesn't depend on the backend
+		// that served it still being available
+		for other, backend := range f.backends {
+			if other == idx {
+				continue
+			}
+			if archiver, ok := backend.(DataArchiver); ok {
+				if err := archiver.StoreOffChainData(hash, data); err != nil {
+					log.Warn("Failed to archive off chain data", "hash", hash, "err", err)
+				}
+			}
+		}
+
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("unable to get off chain data for hash %s from any backend: %w", hash, errors.Join(errs...))
+}
@@ -0,0 +1,183 @@
+package da
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+type failingBackend struct{}
+
+func (failingBackend) GetOffChainData(context.Context, uint64, common.Hash) ([]byte, error) {
+	return nil, fmt.Errorf("dac offline")
+}
+
+type staticBackend struct {
+	data []byte
+}
+
+func (s staticBackend) GetOffChainData(context.Context, uint64, common.Hash) ([]byte, error) {
+	return s.data, nil
+}
+
+func TestFallbackBackend_ArchivesFetchedData(t *testing.T) {
+	data := []byte("offchaindata")
+	hash := crypto.Keccak256Hash(data)
+
+	archive, err := NewArchiveBackend(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = archive.GetOffChainData(context.Background(), 0, hash)
+	require.ErrorIs(t, err, ErrDataNotFound)
+
+	// the dac serves the data and the archive keeps a copy of it
+	got, err := NewFallbackBackend(archive, staticBackend{data: data}).GetOffChainData(context.Background(), 0, hash)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// with the dac offline the archived copy is used instead
+	got, err = NewFallbackBackend(failingBackend{}, archive).GetOffChainData(context.Background(), 0, hash)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func TestFallbackBackend_AllFail(t *testing.T) {
+	_, err := NewFallbackBackend(failingBackend{}, failingBackend{}).GetOffChainData(context.Background(), 0, common.Hash{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "dac offline")
+}
+
+func TestArchiveBackend_RejectsMismatchedData(t *testing.T) {
+	archive, err := NewArchiveBackend(t.TempDir())
+	require.NoError(t, err)
+
+	require.Error(t, archive.StoreOffChainData(common.HexToHash("0x01"), []byte("offchaindata")))
+}
+
+func TestNewBackend(t *testing.T) {
+	_, err := NewBackend(Config{Backends: []string{"unknown"}}, nil)
+	require.Error(t, err)
+
+	_, err = NewBackend(Config{Backends: []string{BackendBlob}}, nil)
+	require.Error(t, err)
+
+	backend, err := NewBackend(Config{Backends: []string{BackendDAC}, DAUrls: []string{"http://localhost"}}, nil)
+	require.NoError(t, err)
+	require.IsType(t, &DACBackend{}, backend)
+
+	backend, err = NewBackend(Config{Backends: []string{BackendDAC, BackendArchive}, ArchiveDir: t.TempDir()}, nil)
+	require.NoError(t, err)
+	require.IsType(t, &FallbackBackend{}, backend)
+}
+
+func TestBlobBackend_GetOffChainData(t *testing.T) {
+	data := []byte("offchaindata")
+	hash := crypto.Keccak256Hash(data)
+
+	blob, err := EncodeBlob(data)
+	require.NoError(t, err)
+	otherBlob, err := EncodeBlob([]byte("someone else's data"))
+	require.NoError(t, err)
+
+	const genesisTime = 1000
+	const l1BlockTime = genesisTime + 12*5
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/eth/v1/beacon/genesis":
+			_, err := fmt.Fprintf(w, `{"data":{"genesis_time":"%d"}}`, genesisTime)
+			require.NoError(t, err)
+		case "/eth/v1/beacon/blob_sidecars/5":
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": []map[string]interface{}{
+					{"index": "0", "blob": hexutil.Bytes(otherBlob)},
+					{"index": "1", "blob": hexutil.Bytes(blob)},
+				},
+			}))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	backend := NewBlobBackend(svr.URL, func(uint64) (uint64, error) {
+		return l1BlockTime, nil
+	})
+
+	got, err := backend.GetOffChainData(context.Background(), 100, hash)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	_, err = backend.GetOffChainData(context.Background(), 100, common.HexToHash("0x01"))
+	require.ErrorIs(t, err, ErrDataNotFound)
+}
+
+func TestDACBackend_IgnoresBadMembers(t *testing.T) {
+	data := []byte("offchaindata")
+	hash := crypto.Keccak256Hash(data)
+
+	newMember := func(result string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := fmt.Fprint(w, result)
+			require.NoError(t, err)
+		}))
+	}
+
+	malicious := newMember(fmt.Sprintf(`{"result":"%s"}`, hexutil.Encode([]byte("baddata"))))
+	defer malicious.Close()
+	broken := newMember(`{"error":{"code":123,"message":"test error"}}`)
+	defer broken.Close()
+	honest := newMember(fmt.Sprintf(`{"result":"%s"}`, hexutil.Encode(data)))
+	defer honest.Close()
+
+	got, err := NewDACBackend(malicious.URL, broken.URL, honest.URL).GetOffChainData(context.Background(), 0, hash)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	_, err = NewDACBackend(malicious.URL, broken.URL).GetOffChainData(context.Background(), 0, hash)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "data hash mismatch")
+}
+
+func TestDACBackend_CancelsSlowMembers(t *testing.T) {
+	data := []byte("offchaindata")
+	hash := crypto.Keccak256Hash(data)
+
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices the client going away once the request has been read
+		_, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	honest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := fmt.Fprintf(w, `{"result":"%s"}`, hexutil.Encode(data))
+		require.NoError(t, err)
+	}))
+	defer honest.Close()
+
+	got, err := NewDACBackend(slow.URL, honest.URL).GetOffChainData(context.Background(), 0, hash)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request to the slow member wasn't cancelled")
+	}
+}
@@ -0,0 +1,194 @@
+package da
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon/crypto"
+)
+
+const (
+	blobFieldElements      = 4096
+	blobFieldElementSize   = 32
+	blobSize               = blobFieldElements * blobFieldElementSize
+	blobUsableElementBytes = blobFieldElementSize - 1
+	blobLengthPrefixSize   = 4
+	defaultSecondsPerSlot  = 12
+)
+
+// HeaderTimeFn returns the timestamp of the given L1 block
+type HeaderTimeFn func(l1BlockNo uint64) (uint64, error)
+
+// BlobBackend finds off chain data in the EIP-4844 blob sidecars of the L1 block the sequence was included in,
+// as served by a beacon node.  Blobs are expected to carry the data in the low 31 bytes of each field element
+// prefixed with its big endian uint32 length, a blob matches when its payload hashes to the requested hash
+type BlobBackend struct {
+	beaconUrl      string
+	headerTimeFn   HeaderTimeFn
+	secondsPerSlot uint64
+	client         *http.Client
+
+	genesisLock sync.Mutex
+	genesisTime uint64
+}
+
+func NewBlobBackend(beaconUrl string, headerTimeFn HeaderTimeFn) *BlobBackend {
+	return &BlobBackend{
+		beaconUrl:      strings.TrimSuffix(beaconUrl, "/"),
+		headerTimeFn:   headerTimeFn,
+		secondsPerSlot: defaultSecondsPerSlot,
+		client:         http.DefaultClient,
+	}
+}
+
+type beaconGenesisResponse struct {
+	Data struct {
+		GenesisTime string `json:"genesis_time"`
+	} `json:"data"`
+}
+
+type beaconBlobSidecarsResponse struct {
+	Data []struct {
+		Index string        `json:"index"`
+		Blob  hexutil.Bytes `json:"blob"`
+	} `json:"data"`
+}
+
+func (b *BlobBackend) GetOffChainData(ctx context.Context, l1BlockNo uint64, hash common.Hash) ([]byte, error) {
+	if b.beaconUrl == "" {
+		return nil, fmt.Errorf("beacon url is required for the blob backend")
+	}
+
+	slot, err := b.slotForBlock(ctx, l1BlockNo)
+	if err != nil {
+		return nil, err
+	}
+
+	var sidecars beaconBlobSidecarsResponse
+	if err := b.get(ctx, fmt.Sprintf("/eth/v1/beacon/blob_sidecars/%d", slot), &sidecars); err != nil {
+		return nil, err
+	}
+
+	for _, sidecar := range sidecars.Data {
+		data, err := DecodeBlob(sidecar.Blob)
+		if err != nil {
+			// not every blob in the block belongs to us so a blob we can't decode isn't an error
+			continue
+		}
+		if crypto.Keccak256Hash(data) == hash {
+			return data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w in blob sidecars of L1 block %d (slot %d): %s", ErrDataNotFound, l1BlockNo, slot, hash)
+}
+
+func (b *BlobBackend) slotForBlock(ctx context.Context, l1BlockNo uint64) (uint64, error) {
+	genesis, err := b.getGenesisTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	blockTime, err := b.headerTimeFn(l1BlockNo)
+	if err != nil {
+		return 0, err
+	}
+	if blockTime < genesis {
+		return 0, fmt.Errorf("L1 block %d is older than the beacon chain genesis", l1BlockNo)
+	}
+
+	return (blockTime - genesis) / b.secondsPerSlot, nil
+}
+
+func (b *BlobBackend) getGenesisTime(ctx context.Context) (uint64, error) {
+	b.genesisLock.Lock()
+	defer b.genesisLock.Unlock()
+
+	if b.genesisTime != 0 {
+		return b.genesisTime, nil
+	}
+
+	var genesis beaconGenesisResponse
+	if err := b.get(ctx, "/eth/v1/beacon/genesis", &genesis); err != nil {
+		return 0, err
+	}
+	genesisTime, err := strconv.ParseUint(genesis.Data.GenesisTime, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid beacon genesis time %q: %w", genesis.Data.GenesisTime, err)
+	}
+	b.genesisTime = genesisTime
+
+	return genesisTime, nil
+}
+
+func (b *BlobBackend) get(ctx context.Context, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.beaconUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid status code from beacon node, expected: %d, found: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// DecodeBlob extracts the length prefixed payload from the usable bytes of a blob
+func DecodeBlob(blob []byte) ([]byte, error) {
+	if len(blob) != blobSize {
+		return nil, fmt.Errorf("invalid blob size %d", len(blob))
+	}
+
+	payload := make([]byte, 0, blobFieldElements*blobUsableElementBytes)
+	for i := 0; i < blobFieldElements; i++ {
+		element := blob[i*blobFieldElementSize : (i+1)*blobFieldElementSize]
+		if element[0] != 0 {
+			return nil, fmt.Errorf("invalid field element %d in blob", i)
+		}
+		payload = append(payload, element[1:]...)
+	}
+
+	length := binary.BigEndian.Uint32(payload[:blobLengthPrefixSize])
+	if uint64(length) > uint64(len(payload)-blobLengthPrefixSize) {
+		return nil, fmt.Errorf("blob payload length %d exceeds blob capacity", length)
+	}
+
+	return payload[blobLengthPrefixSize : blobLengthPrefixSize+length], nil
+}
+
+// EncodeBlob packs data into a blob in the format expected by DecodeBlob
+func EncodeBlob(data []byte) ([]byte, error) {
+	payload := make([]byte, blobLengthPrefixSize+len(data))
+	if len(payload) > blobFieldElements*blobUsableElementBytes {
+		return nil, fmt.Errorf("data of size %d does not fit in a blob", len(data))
+	}
+	binary.BigEndian.PutUint32(payload, uint32(len(data)))
+	copy(payload[blobLengthPrefixSize:], data)
+
+	blob := make([]byte, blobSize)
+	for i := 0; i*blobUsableElementBytes < len(payload); i++ {
+		end := (i + 1) * blobUsableElementBytes
+		if end > len(payload) {
+			end = len(payload)
+		}
+		copy(blob[i*blobFieldElementSize+1:], payload[i*blobUsableElementBytes:end])
+	}
+
+	return blob, nil
+}
@@ -2,6 +2,7 @@ package da
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,7 +10,9 @@ import (
 
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/common/hexutil"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/client"
+	"github.com/ledgerwatch/log/v3"
 )
 
 const maxAttempts = 10
@@ -19,10 +22,14 @@ func GetOffChainData(ctx context.Context, url string, hash common.Hash) ([]byte,
 	attemp := 0
 
 	for attemp < maxAttempts {
-		response, err := client.JSONRPCCall(url, "sync_getOffChainData", hash)
+		response, err := client.JSONRPCCallWithContext(ctx, url, "sync_getOffChainData", hash)
 
 		if httpErr, ok := err.(*client.HTTPError); ok && httpErr.StatusCode == http.StatusTooManyRequests {
-			time.Sleep(retryDelay)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retryDelay):
+			}
 			attemp += 1
 			continue
 		}
@@ -40,3 +47,61 @@ func GetOffChainData(ctx context.Context, url string, hash common.Hash) ([]byte,
 
 	return nil, fmt.Errorf("max attempts of data fetching reached, attempts: %v, DA url: %s", maxAttempts, url)
 }
+
+// DACBackend fetches off chain data from the members of the data availability committee over JSON-RPC.  All
+// members are queried in parallel and the first response whose keccak hash matches the requested hash is used, so
+// a single stale or malicious member can only slow us down rather than feed us bad data.  The requests still out
+// are cancelled as soon as one member answers
+type DACBackend struct {
+	urls []string
+}
+
+func NewDACBackend(urls ...string) *DACBackend {
+	filtered := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if url = strings.TrimSpace(url); url != "" {
+			filtered = append(filtered, url)
+		}
+	}
+	return &DACBackend{urls: filtered}
+}
+
+type memberResult struct {
+	url  string
+	data []byte
+	err  error
+}
+
+func (d *DACBackend) GetOffChainData(ctx context.Context, _ uint64, hash common.Hash) ([]byte, error) {
+	if len(d.urls) == 0 {
+		return nil, fmt.Errorf("data availability url is required for the dac backend")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan memberResult, len(d.urls))
+	for _, url := range d.urls {
+		go func(url string) {
+			data, err := GetOffChainData(ctx, url, hash)
+			results <- memberResult{url: url, data: data, err: err}
+		}(url)
+	}
+
+	var errs []error
+	for range d.urls {
+		res := <-results
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.url, res.err))
+			continue
+		}
+		if actual := crypto.Keccak256Hash(res.data); actual != hash {
+			log.Warn("DAC member returned data not matching the requested hash", "url", res.url, "hash", hash, "actual", actual)
+			errs = append(errs, fmt.Errorf("%s: data hash mismatch, expected %s got %s", res.url, hash, actual))
+			continue
+		}
+		return res.data, nil
+	}
+
+	return nil, fmt.Errorf("no DAC member returned valid data for hash %s: %w", hash, errors.Join(errs...))
+}
@@ -0,0 +1,212 @@
+package da
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	signatureSize = 65
+	addressSize   = 20
+)
+
+var (
+	dataAvailabilityProtocolSignature   = crypto.Keccak256([]byte("dataAvailabilityProtocol()"))[:4]
+	requiredAmountOfSignaturesSignature = crypto.Keccak256([]byte("requiredAmountOfSignatures()"))[:4]
+	getAmountOfMembersSignature         = crypto.Keccak256([]byte("getAmountOfMembers()"))[:4]
+	membersSignature                    = crypto.Keccak256([]byte("members(uint256)"))[:4]
+)
+
+// MessageVerifier checks the data availability message sent to the L1 alongside a validium sequence
+type MessageVerifier interface {
+	VerifyMessage(ctx context.Context, l1BlockNo uint64, signedHash common.Hash, message []byte) error
+}
+
+// ContractCaller makes read only calls against L1 contracts, a nil block number means the latest block
+type ContractCaller interface {
+	CallContractAtBlock(ctx context.Context, addr *common.Address, data []byte, blockNumber *big.Int) ([]byte, error)
+}
+
+// Committee is the set of data availability committee members registered in the L1 DataCommittee contract
+type Committee struct {
+	RequiredSignatures uint64
+	Members            []common.Address
+}
+
+// Hash matches the committeeHash stored by the DataCommittee contract
+func (c *Committee) Hash() common.Hash {
+	return crypto.Keccak256Hash(c.packedMembers())
+}
+
+func (c *Committee) packedMembers() []byte {
+	packed := make([]byte, 0, len(c.Members)*addressSize)
+	for _, member := range c.Members {
+		packed = append(packed, member.Bytes()...)
+	}
+	return packed
+}
+
+// VerifyMessage checks a data availability message against the committee in the same way the DataCommittee
+// contract does: the message is the required amount of signatures over the signed hash followed by the addresses
+// of all committee members, and the signers must be committee members appearing in the same order as the addresses
+func (c *Committee) VerifyMessage(signedHash common.Hash, message []byte) error {
+	splitByte := signatureSize * int(c.RequiredSignatures)
+	if len(message) < splitByte || (len(message)-splitByte)%addressSize != 0 {
+		return fmt.Errorf("unexpected data availability message length %d", len(message))
+	}
+
+	addrs := message[splitByte:]
+	if !bytes.Equal(addrs, c.packedMembers()) {
+		return fmt.Errorf("data availability message members do not match the committee")
+	}
+
+	lastAddrIndexUsed := 0
+	for i := 0; i < int(c.RequiredSignatures); i++ {
+		signer, err := recoverSigner(signedHash, message[i*signatureSize:(i+1)*signatureSize])
+		if err != nil {
+			return fmt.Errorf("invalid signature %d in data availability message: %w", i, err)
+		}
+
+		found := false
+		for j := lastAddrIndexUsed; j < len(c.Members); j++ {
+			if c.Members[j] == signer {
+				lastAddrIndexUsed = j + 1
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("signer %s of the data availability message is not part of the committee", signer)
+		}
+	}
+
+	return nil
+}
+
+func recoverSigner(hash common.Hash, signature []byte) (common.Address, error) {
+	sig := make([]byte, signatureSize)
+	copy(sig, signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// CommitteeVerifier verifies data availability messages against the committee registered on the L1.  The latest
+// committee is cached and the committee at the sequence's L1 block is only fetched if the cached one doesn't match
+type CommitteeVerifier struct {
+	caller           ContractCaller
+	rollupAddress    common.Address
+	committeeAddress common.Address
+
+	lock      sync.Mutex
+	committee *Committee
+}
+
+// NewCommitteeVerifier creates a verifier for the given DataCommittee contract, when the committee address is
+// empty it is looked up from the rollup contract's data availability protocol on first use
+func NewCommitteeVerifier(caller ContractCaller, rollupAddress, committeeAddress common.Address) *CommitteeVerifier {
+	return &CommitteeVerifier{
+		caller:           caller,
+		rollupAddress:    rollupAddress,
+		committeeAddress: committeeAddress,
+	}
+}
+
+func (v *CommitteeVerifier) VerifyMessage(ctx context.Context, l1BlockNo uint64, signedHash common.Hash, message []byte) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.committee == nil {
+		committee, err := v.getCommittee(ctx, nil)
+		if err != nil {
+			return err
+		}
+		v.committee = committee
+	}
+
+	committee := v.committee
+	if len(message) < signatureSize*int(committee.RequiredSignatures) ||
+		!bytes.Equal(message[signatureSize*int(committee.RequiredSignatures):], committee.packedMembers()) {
+		// the committee could have been changed on the L1 since this sequence was sent so check against
+		// the committee as it was when the sequence was included
+		log.Debug("Data availability message does not match the latest committee, checking at the sequence block", "l1Block", l1BlockNo)
+		atBlock, err := v.getCommittee(ctx, new(big.Int).SetUint64(l1BlockNo))
+		if err != nil {
+			return err
+		}
+		committee = atBlock
+	}
+
+	return committee.VerifyMessage(signedHash, message)
+}
+
+func (v *CommitteeVerifier) getCommittee(ctx context.Context, blockNumber *big.Int) (*Committee, error) {
+	if v.committeeAddress == (common.Address{}) {
+		resp, err := v.caller.CallContractAtBlock(ctx, &v.rollupAddress, dataAvailabilityProtocolSignature, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the data availability protocol address: %w", err)
+		}
+		if len(resp) < 32 {
+			return nil, fmt.Errorf("response too short to contain the data availability protocol address")
+		}
+		v.committeeAddress = common.BytesToAddress(resp[12:32])
+	}
+
+	required, err := v.callUint64(ctx, requiredAmountOfSignaturesSignature, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the required amount of signatures: %w", err)
+	}
+	amount, err := v.callUint64(ctx, getAmountOfMembersSignature, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the amount of committee members: %w", err)
+	}
+
+	committee := &Committee{
+		RequiredSignatures: required,
+		Members:            make([]common.Address, 0, amount),
+	}
+	for i := uint64(0); i < amount; i++ {
+		data := make([]byte, 4+32)
+		copy(data, membersSignature)
+		new(big.Int).SetUint64(i).FillBytes(data[4:])
+
+		// members returns (string url, address addr) so the address is the second word of the response
+		resp, err := v.caller.CallContractAtBlock(ctx, &v.committeeAddress, data, blockNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get committee member %d: %w", i, err)
+		}
+		if len(resp) < 64 {
+			return nil, fmt.Errorf("response too short to contain committee member %d", i)
+		}
+		committee.Members = append(committee.Members, common.BytesToAddress(resp[44:64]))
+	}
+
+	return committee, nil
+}
+
+func (v *CommitteeVerifier) callUint64(ctx context.Context, data []byte, blockNumber *big.Int) (uint64, error) {
+	resp, err := v.caller.CallContractAtBlock(ctx, &v.committeeAddress, data, blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) < 32 {
+		return 0, fmt.Errorf("response too short to contain a uint256")
+	}
+	value := new(big.Int).SetBytes(resp[:32])
+	if !value.IsUint64() {
+		return 0, fmt.Errorf("value %s overflows uint64", value)
+	}
+	return value.Uint64(), nil
+}
@@ -0,0 +1,132 @@
+package da
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	common2 "github.com/ledgerwatch/erigon/common"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func signMessage(t *testing.T, hash common.Hash, signers []*ecdsa.PrivateKey, members []common.Address) []byte {
+	var message []byte
+	for _, key := range signers {
+		sig, err := crypto.Sign(hash.Bytes(), key)
+		require.NoError(t, err)
+		// solidity signatures carry v as 27/28
+		sig[64] += 27
+		message = append(message, sig...)
+	}
+	for _, member := range members {
+		message = append(message, member.Bytes()...)
+	}
+	return message
+}
+
+func newCommittee(t *testing.T, size int, required uint64) ([]*ecdsa.PrivateKey, *Committee) {
+	keys := make([]*ecdsa.PrivateKey, size)
+	committee := &Committee{RequiredSignatures: required}
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		keys[i] = key
+		committee.Members = append(committee.Members, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	return keys, committee
+}
+
+func TestCommittee_VerifyMessage(t *testing.T) {
+	keys, committee := newCommittee(t, 3, 2)
+	hash := crypto.Keccak256Hash([]byte("accumulated"))
+
+	outsider, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		message []byte
+		err     string
+	}{
+		{
+			name:    "quorum of members in order",
+			message: signMessage(t, hash, []*ecdsa.PrivateKey{keys[0], keys[2]}, committee.Members),
+		},
+		{
+			name:    "members out of order",
+			message: signMessage(t, hash, []*ecdsa.PrivateKey{keys[2], keys[0]}, committee.Members),
+			err:     "not part of the committee",
+		},
+		{
+			name:    "signature from outside the committee",
+			message: signMessage(t, hash, []*ecdsa.PrivateKey{keys[0], outsider}, committee.Members),
+			err:     "not part of the committee",
+		},
+		{
+			name:    "not enough signatures",
+			message: signMessage(t, hash, []*ecdsa.PrivateKey{keys[0]}, committee.Members),
+			err:     "unexpected data availability message length",
+		},
+		{
+			name:    "different committee members",
+			message: signMessage(t, hash, []*ecdsa.PrivateKey{keys[0], keys[1]}, committee.Members[:2]),
+			err:     "do not match the committee",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := committee.VerifyMessage(hash, tt.message)
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+type committeeContract struct {
+	committee *Committee
+	calls     int
+}
+
+func (c *committeeContract) CallContractAtBlock(_ context.Context, _ *common.Address, data []byte, _ *big.Int) ([]byte, error) {
+	c.calls++
+	word := func(v uint64) []byte {
+		return common2.LeftPadBytes(new(big.Int).SetUint64(v).Bytes(), 32)
+	}
+	switch string(data[:4]) {
+	case string(requiredAmountOfSignaturesSignature):
+		return word(c.committee.RequiredSignatures), nil
+	case string(getAmountOfMembersSignature):
+		return word(uint64(len(c.committee.Members))), nil
+	case string(membersSignature):
+		idx := new(big.Int).SetBytes(data[4:]).Uint64()
+		resp := append(word(64), common2.LeftPadBytes(c.committee.Members[idx].Bytes(), 32)...)
+		return append(resp, word(0)...), nil
+	}
+	return nil, nil
+}
+
+func TestCommitteeVerifier_VerifyMessage(t *testing.T) {
+	keys, committee := newCommittee(t, 2, 1)
+	hash := crypto.Keccak256Hash([]byte("accumulated"))
+	contract := &committeeContract{committee: committee}
+
+	verifier := NewCommitteeVerifier(contract, common.Address{}, common.HexToAddress("0x01"))
+	message := signMessage(t, hash, []*ecdsa.PrivateKey{keys[1]}, committee.Members)
+
+	require.NoError(t, verifier.VerifyMessage(context.Background(), 1, hash, message))
+	calls := contract.calls
+
+	// the committee is cached after the first verification
+	require.NoError(t, verifier.VerifyMessage(context.Background(), 2, hash, message))
+	require.Equal(t, calls, contract.calls)
+
+	require.Error(t, verifier.VerifyMessage(context.Background(), 3, common.HexToHash("0x02"), message))
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Auth is what the client presents to a datastream server gating the access to its stream
+type Auth struct {
+	CertFile  string // client certificate for mutual TLS
+	KeyFile   string
+	CAFile    string // verifies the server certificate instead of the system roots
+	TokenFile string // file holding the token sent to the servers
+}
+
+// SetAuth loads the credentials presented to the servers, a certificate or a CA turns TLS on
+func (c *StreamClient) SetAuth(auth Auth) error {
+	if (auth.CertFile == "") != (auth.KeyFile == "") {
+		return errors.New("the client certificate and its key must be set together")
+	}
+
+	if auth.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(auth.CertFile, auth.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading the client certificate: %w", err)
+		}
+		c.tlsConfig.Certificates = []tls.Certificate{cert}
+		c.useTLS = true
+	}
+
+	if auth.CAFile != "" {
+		pool, err := loadCertPool(auth.CAFile)
+		if err != nil {
+			return err
+		}
+		c.tlsConfig.RootCAs = pool
+		c.useTLS = true
+	}
+
+	if auth.TokenFile != "" {
+		data, err := os.ReadFile(auth.TokenFile)
+		if err != nil {
+			return fmt.Errorf("reading the token: %w", err)
+		}
+		c.token = strings.TrimSpace(string(data))
+	}
+	return nil
+}
+
+// authenticate sends the token on a new connection, the server answers with a result
+func (c *StreamClient) authenticate() error {
+	if err := c.sendAuthCmd(c.token); err != nil {
+		return fmt.Errorf("sendAuthCmd: %w", err)
+	}
+
+	if _, err := c.readPacketAndDecodeResultEntry(); err != nil {
+		return fmt.Errorf("readPacketAndDecodeResultEntry: %w", err)
+	}
+
+	return nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading the CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
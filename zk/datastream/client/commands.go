@@ -9,6 +9,9 @@ const (
 	CmdStartBookmark // CmdStartBookmark for the start from bookmark TCP client command
 	CmdEntry         // CmdEntry for the get entry TCP client command
 	CmdBookmark      // CmdBookmark for the get bookmark TCP client command
+
+	// CmdAuth sends the token to the gateway in front of the stream server, the stream server never sees it
+	CmdAuth Command = 0x80
 )
 
 // sendHeaderCmd sends the header command to the server.
@@ -76,3 +79,18 @@ func (c *StreamClient) sendCommand(cmd Command) error {
 	// Send stream type
 	return c.writeToConn(uint64(c.streamType))
 }
+
+// sendAuthCmd sends the auth command with the token to the server.
+func (c *StreamClient) sendAuthCmd(token string) error {
+	if err := c.sendCommand(CmdAuth); err != nil {
+		return err
+	}
+
+	// Send token length
+	if err := c.writeToConn(uint32(len(token))); err != nil {
+		return err
+	}
+
+	// Send the token
+	return c.writeToConn([]byte(token))
+}
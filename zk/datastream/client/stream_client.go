@@ -13,6 +13,7 @@ import (
 
 	"sync"
 
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
 	"github.com/ledgerwatch/erigon/zk/datastream/types"
 	"github.com/ledgerwatch/log/v3"
@@ -42,7 +43,8 @@ var (
 
 type StreamClient struct {
 	ctx          context.Context
-	server       string // Server address to connect IP:port
+	server       string   // Server address to connect IP:port
+	servers      []string // Servers to fail over to in order of preference, the first being the primary
 	version      int
 	streamType   StreamType
 	conn         net.Conn
@@ -71,8 +73,12 @@ type StreamClient struct {
 	lastError error
 	started   bool
 
+	// the last block read from the stream, a server has to hold the same block to be failed over to
+	lastRead atomic.Pointer[streamPosition]
+
 	useTLS    bool
 	tlsConfig *tls.Config
+	token     string // sent to servers gating the access to the stream
 }
 
 const (
@@ -90,10 +96,17 @@ const (
 // Creates a new client fo datastream
 // server must be in format "url:port"
 func NewClient(ctx context.Context, server string, useTLS bool, version int, checkTimeout time.Duration, latestDownloadedForkId uint16) *StreamClient {
+	return NewMultiSourceClient(ctx, []string{server}, useTLS, version, checkTimeout, latestDownloadedForkId)
+}
+
+// NewMultiSourceClient creates a datastream client connecting to the first reachable of the servers, in order of
+// preference, and failing over to the others when the connection to the stream is lost
+func NewMultiSourceClient(ctx context.Context, servers []string, useTLS bool, version int, checkTimeout time.Duration, latestDownloadedForkId uint16) *StreamClient {
 	c := &StreamClient{
 		ctx:          ctx,
 		checkTimeout: checkTimeout,
-		server:       server,
+		server:       servers[0],
+		servers:      servers,
 		version:      version,
 		streamType:   StSequencer,
 		entryChan:    make(chan interface{}, 100000),
@@ -104,16 +117,16 @@ func NewClient(ctx context.Context, server string, useTLS bool, version int, che
 		allowStops:   true,
 	}
 
-	// Extract hostname from server address (removing port if present)
-	host, _, err := net.SplitHostPort(c.server)
-	if err != nil {
-		host = c.server // If no port was specified, use the full server string
-	}
-	c.tlsConfig.ServerName = host
-
 	return c
 }
 
+// streamPosition is the last block the client read. Servers number their entries differently, a compacted one
+// restarting at 0, so the position is kept by block and looked up through its bookmark
+type streamPosition struct {
+	blockNumber uint64
+	blockHash   common.Hash
+}
+
 func (c *StreamClient) IsVersion3() bool {
 	return c.version >= versionAddedBlockEnd
 }
@@ -297,17 +310,49 @@ func (c *StreamClient) GetProgressAtomic() *atomic.Uint64 {
 	return &c.progress
 }
 
-// Opens a TCP connection to the server
+// Opens a TCP connection to the first reachable server
 func (c *StreamClient) Start() error {
+	var err error
+	for _, server := range c.servers {
+		if err = c.connect(server); err == nil {
+			return nil
+		}
+		if len(c.servers) > 1 {
+			log.Warn("[Datastream client] Server unreachable", "server", server, "err", err)
+		}
+	}
+
+	return err
+}
+
+// connect opens a TCP connection to the server
+func (c *StreamClient) connect(server string) error {
 	var err error
 	if c.useTLS {
-		c.conn, err = tls.Dial("tcp", c.server, c.tlsConfig)
+		tlsConfig := c.tlsConfig.Clone()
+		// Extract hostname from server address (removing port if present)
+		host, _, splitErr := net.SplitHostPort(server)
+		if splitErr != nil {
+			host = server // If no port was specified, use the full server string
+		}
+		tlsConfig.ServerName = host
+		c.conn, err = tls.Dial("tcp", server, tlsConfig)
 	} else {
-		c.conn, err = net.Dial("tcp", c.server)
+		c.conn, err = net.Dial("tcp", server)
 	}
 	if err != nil {
-		return fmt.Errorf("connecting to server %s: %w", c.server, err)
+		return fmt.Errorf("connecting to server %s: %w", server, err)
+	}
+	if c.token != "" {
+		if err = c.authenticate(); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return fmt.Errorf("authenticating to server %s: %w", server, err)
+		}
 	}
+	c.server = server
+	// a new connection doesn't stream until asked to
+	c.setStreaming(false)
 
 	return nil
 }
@@ -566,6 +611,9 @@ LOOP:
 		select {
 		case c.entryChan <- parsedProto:
 			readNewProto = true
+			if block, ok := parsedProto.(*types.FullL2Block); ok {
+				c.lastRead.Store(&streamPosition{blockNumber: block.L2BlockNumber, blockHash: block.L2Blockhash})
+			}
 		default:
 			time.Sleep(10 * time.Microsecond)
 		}
@@ -617,6 +665,9 @@ func (c *StreamClient) HandleStart() error {
 	return nil
 }
 
+// tryReConnect reconnects to the servers in order of preference. Before the client switches to another server than the
+// one it was reading from, the server is checked to hold the stream read so far, the progress and the bookmark the
+// reading starts from being kept.
 func (c *StreamClient) tryReConnect() (err error) {
 	if c.conn != nil {
 		if err := c.conn.Close(); err != nil {
@@ -625,13 +676,55 @@ func (c *StreamClient) tryReConnect() (err error) {
 		}
 		c.conn = nil
 	}
-	if err = c.Start(); err != nil {
-		log.Warn(fmt.Sprintf("start DS connection: %v", err))
+
+	previous := c.server
+	for _, server := range c.servers {
+		if err = c.connect(server); err != nil {
+			log.Warn(fmt.Sprintf("start DS connection: %v", err))
+			continue
+		}
+		if server == previous {
+			return nil
+		}
+
+		if err = c.checkServer(); err == nil {
+			log.Info("[Datastream client] Failed over to another server", "from", previous, "to", server, "progress", c.progress.Load())
+			return nil
+		}
+		log.Warn("[Datastream client] Server doesn't match the stream read so far", "server", server, "err", err)
+		if closeErr := c.conn.Close(); closeErr != nil {
+			log.Warn(fmt.Sprintf("close DS connection: %v", closeErr))
+		}
+		c.conn = nil
 	}
 
+	c.server = previous
 	return err
 }
 
+// checkServer checks the connected server holds the last read block, found by its bookmark as the entry numbers of
+// the servers don't have to match, with the same hash. A server behind the client doesn't have the block bookmarked.
+func (c *StreamClient) checkServer() error {
+	if _, err := c.GetHeader(); err != nil {
+		return fmt.Errorf("GetHeader: %w", err)
+	}
+
+	lastRead := c.lastRead.Load()
+	if lastRead == nil {
+		return nil
+	}
+
+	block, err := c.getL2BlockByNumber(lastRead.blockNumber)
+	if err != nil {
+		return fmt.Errorf("server doesn't hold block %d: %w", lastRead.blockNumber, err)
+	}
+	if block.L2Blockhash != lastRead.blockHash {
+		return fmt.Errorf("block %d has hash %s but %s was read", lastRead.blockNumber, block.L2Blockhash, lastRead.blockHash)
+	}
+
+	return nil
+}
+
 func (c *StreamClient) StopReadingToChannel() {
 	c.stopReadingToChannel.Store(true)
 }
@@ -880,6 +973,8 @@ func (c *StreamClient) readResultEntry(packet []byte) (re *types.ResultEntry, er
 			return re, fmt.Errorf("%w: %s", types.ErrBadFromBookmark, re.ErrorStr)
 		case types.CmdErrInvalidCommand:
 			return re, fmt.Errorf("%w: %s", types.ErrInvalidCommand, re.ErrorStr)
+		case types.CmdErrUnauthorized:
+			return re, fmt.Errorf("%w: %s", types.ErrUnauthorized, re.ErrorStr)
 		default:
 			return re, fmt.Errorf("unknown error code: %d str: %s", re.ErrorNum, re.ErrorStr)
 		}
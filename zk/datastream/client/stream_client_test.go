@@ -590,3 +590,137 @@ func createL2BlockAndTransactions(t *testing.T, blockNum uint64, txnCount int) (
 
 	return l2Block, txns
 }
+
+// serveTestStream answers the header, start bookmark and stop commands of the clients connecting to the listener, the
+// stream holding totalEntries entries and the block, the only one bookmarked
+func serveTestStream(t *testing.T, listener net.Listener, totalEntries uint64, block *datastream.L2Block) {
+	t.Helper()
+	l2BlockRaw, err := (&types.L2BlockProto{L2Block: block}).Marshal()
+	require.NoError(t, err)
+	l2BlockEndRaw, err := (&types.L2BlockEndProto{Number: block.GetNumber()}).Marshal()
+	require.NoError(t, err)
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		for {
+			commandRaw, err := readBuffer(conn, 16)
+			if err != nil {
+				return
+			}
+
+			switch Command(binary.BigEndian.Uint64(commandRaw)) {
+			case CmdHeader:
+				conn.Write(createResultEntry(t).Encode())
+				he := &types.HeaderEntry{
+					PacketType:   uint8(CmdHeader),
+					HeadLength:   types.HeaderSize,
+					Version:      3,
+					SystemId:     1,
+					StreamType:   types.StreamType(StSequencer),
+					TotalEntries: totalEntries,
+				}
+				conn.Write(he.Encode())
+			case CmdStartBookmark:
+				lengthRaw, err := readBuffer(conn, 4)
+				if err != nil {
+					return
+				}
+				bookmarkRaw, err := readBuffer(conn, binary.BigEndian.Uint32(lengthRaw))
+				if err != nil {
+					return
+				}
+				bookmark, err := types.UnmarshalBookmark(bookmarkRaw)
+				if err != nil || bookmark.BookmarkType() != datastream.BookmarkType_BOOKMARK_TYPE_L2_BLOCK || bookmark.Value != block.GetNumber() {
+					errStr := []byte("bookmark not found")
+					conn.Write((&types.ResultEntry{
+						PacketType: PtResult,
+						ErrorNum:   types.CmdErrBadFromBookmark,
+						Length:     types.ResultEntryMinSize + uint32(len(errStr)),
+						ErrorStr:   errStr,
+					}).Encode())
+					continue
+				}
+				conn.Write(createResultEntry(t).Encode())
+				conn.Write(createFileEntry(t, types.EntryTypeL2Block, 1, l2BlockRaw).Encode())
+				conn.Write(createFileEntry(t, types.EntryTypeL2BlockEnd, 2, l2BlockEndRaw).Encode())
+			default:
+				conn.Write(createResultEntry(t).Encode())
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+}
+
+func newTestStreamServer(t *testing.T, totalEntries uint64, block *datastream.L2Block) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	serveTestStream(t, listener, totalEntries, block)
+	return listener.Addr().String()
+}
+
+func TestStreamClientFailover(t *testing.T) {
+	block, _ := createL2BlockAndTransactions(t, 5, 0)
+	forkedBlock, _ := createL2BlockAndTransactions(t, 5, 0)
+	forkedBlock.Hash = common.HexToHash("0xdead").Bytes()
+
+	unreachable, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	primary := unreachable.Addr().String()
+	unreachable.Close()
+
+	previousBlock, _ := createL2BlockAndTransactions(t, 4, 0)
+	behind := newTestStreamServer(t, 20, previousBlock)
+	forked := newTestStreamServer(t, 20, forkedBlock)
+	good := newTestStreamServer(t, 20, block)
+	// a compacted server numbers its entries from 0 again, holding fewer entries than were read from the others
+	compacted := newTestStreamServer(t, 3, block)
+
+	lastRead := &streamPosition{blockNumber: 5, blockHash: common.BytesToHash(block.Hash)}
+
+	t.Run("fails over to the first matching server", func(t *testing.T) {
+		c := NewMultiSourceClient(context.Background(), []string{primary, behind, forked, good}, false, 3, time.Second, 0)
+		c.lastRead.Store(lastRead)
+		c.progress.Store(5)
+
+		require.NoError(t, c.tryReConnect())
+		require.Equal(t, good, c.server)
+		require.Equal(t, uint64(5), c.progress.Load())
+		require.NoError(t, c.conn.Close())
+	})
+
+	t.Run("fails over to a compacted server", func(t *testing.T) {
+		c := NewMultiSourceClient(context.Background(), []string{primary, behind, compacted}, false, 3, time.Second, 0)
+		c.lastRead.Store(lastRead)
+
+		require.NoError(t, c.tryReConnect())
+		require.Equal(t, compacted, c.server)
+		require.NoError(t, c.conn.Close())
+	})
+
+	t.Run("keeps the server when none matches", func(t *testing.T) {
+		c := NewMultiSourceClient(context.Background(), []string{primary, behind, forked}, false, 3, time.Second, 0)
+		c.lastRead.Store(lastRead)
+
+		require.Error(t, c.tryReConnect())
+		require.Equal(t, primary, c.server)
+	})
+
+	t.Run("starts on the first reachable server", func(t *testing.T) {
+		c := NewMultiSourceClient(context.Background(), []string{primary, behind, good}, false, 3, time.Second, 0)
+
+		require.NoError(t, c.Start())
+		require.Equal(t, behind, c.server)
+		require.NoError(t, c.conn.Close())
+	})
+}
@@ -45,6 +45,45 @@ func (m *MockDataStreamServer) EXPECT() *MockDataStreamServerMockRecorder {
 	return m.recorder
 }
 
+// CompareWithDb mocks base method.
+func (m *MockDataStreamServer) CompareWithDb(arg0 kv.Tx, arg1 *hermez_db.HermezDbReader, arg2, arg3 uint64, arg4 bool) (*server.ReconcileReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareWithDb", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*server.ReconcileReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareWithDb indicates an expected call of CompareWithDb.
+func (mr *MockDataStreamServerMockRecorder) CompareWithDb(arg0, arg1, arg2, arg3, arg4 any) *MockDataStreamServerCompareWithDbCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareWithDb", reflect.TypeOf((*MockDataStreamServer)(nil).CompareWithDb), arg0, arg1, arg2, arg3, arg4)
+	return &MockDataStreamServerCompareWithDbCall{Call: call}
+}
+
+// MockDataStreamServerCompareWithDbCall wrap *gomock.Call
+type MockDataStreamServerCompareWithDbCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDataStreamServerCompareWithDbCall) Return(arg0 *server.ReconcileReport, arg1 error) *MockDataStreamServerCompareWithDbCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDataStreamServerCompareWithDbCall) Do(f func(kv.Tx, *hermez_db.HermezDbReader, uint64, uint64, bool) (*server.ReconcileReport, error)) *MockDataStreamServerCompareWithDbCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDataStreamServerCompareWithDbCall) DoAndReturn(f func(kv.Tx, *hermez_db.HermezDbReader, uint64, uint64, bool) (*server.ReconcileReport, error)) *MockDataStreamServerCompareWithDbCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // GetChainId mocks base method.
 func (m *MockDataStreamServer) GetChainId() uint64 {
 	m.ctrl.T.Helper()
@@ -355,6 +394,82 @@ func (c *MockDataStreamServerReadBatchesCall) DoAndReturn(f func(uint64, uint64)
 	return c
 }
 
+// RewriteDivergentTail mocks base method.
+func (m *MockDataStreamServer) RewriteDivergentTail(arg0 context.Context, arg1 string, arg2 kv.Tx, arg3 server.DbReader, arg4 *server.ReconcileReport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RewriteDivergentTail", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RewriteDivergentTail indicates an expected call of RewriteDivergentTail.
+func (mr *MockDataStreamServerMockRecorder) RewriteDivergentTail(arg0, arg1, arg2, arg3, arg4 any) *MockDataStreamServerRewriteDivergentTailCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RewriteDivergentTail", reflect.TypeOf((*MockDataStreamServer)(nil).RewriteDivergentTail), arg0, arg1, arg2, arg3, arg4)
+	return &MockDataStreamServerRewriteDivergentTailCall{Call: call}
+}
+
+// MockDataStreamServerRewriteDivergentTailCall wrap *gomock.Call
+type MockDataStreamServerRewriteDivergentTailCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDataStreamServerRewriteDivergentTailCall) Return(arg0 error) *MockDataStreamServerRewriteDivergentTailCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDataStreamServerRewriteDivergentTailCall) Do(f func(context.Context, string, kv.Tx, server.DbReader, *server.ReconcileReport) error) *MockDataStreamServerRewriteDivergentTailCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDataStreamServerRewriteDivergentTailCall) DoAndReturn(f func(context.Context, string, kv.Tx, server.DbReader, *server.ReconcileReport) error) *MockDataStreamServerRewriteDivergentTailCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// UnwindAfterBlock mocks base method.
+func (m *MockDataStreamServer) UnwindAfterBlock(arg0, arg1 uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnwindAfterBlock", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnwindAfterBlock indicates an expected call of UnwindAfterBlock.
+func (mr *MockDataStreamServerMockRecorder) UnwindAfterBlock(arg0, arg1 any) *MockDataStreamServerUnwindAfterBlockCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnwindAfterBlock", reflect.TypeOf((*MockDataStreamServer)(nil).UnwindAfterBlock), arg0, arg1)
+	return &MockDataStreamServerUnwindAfterBlockCall{Call: call}
+}
+
+// MockDataStreamServerUnwindAfterBlockCall wrap *gomock.Call
+type MockDataStreamServerUnwindAfterBlockCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDataStreamServerUnwindAfterBlockCall) Return(arg0 error) *MockDataStreamServerUnwindAfterBlockCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDataStreamServerUnwindAfterBlockCall) Do(f func(uint64, uint64) error) *MockDataStreamServerUnwindAfterBlockCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDataStreamServerUnwindAfterBlockCall) DoAndReturn(f func(uint64, uint64) error) *MockDataStreamServerUnwindAfterBlockCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // UnwindIfNecessary mocks base method.
 func (m *MockDataStreamServer) UnwindIfNecessary(arg0 string, arg1 server.DbReader, arg2, arg3, arg4 uint64) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,484 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+)
+
+const (
+	streamArchiveIndex   = "index.json"
+	preparedSegmentIndex = "prepared.json"
+	preparedSegmentFile  = "prepared.zst"
+)
+
+var ErrNotArchived = errors.New("bookmark not in the stream archive")
+
+// ArchiveSegment is a zstd compressed file holding the encoded entries of a range of batches cut from the stream,
+// numbered on from the segment before it so the archive reads as one stream
+type ArchiveSegment struct {
+	File      string `json:"file"`
+	FromBatch uint64 `json:"fromBatch"`
+	ToBatch   uint64 `json:"toBatch"`
+	FromBlock uint64 `json:"fromBlock"`
+	ToBlock   uint64 `json:"toBlock"`
+	FromEntry uint64 `json:"fromEntry"`
+	Entries   uint64 `json:"entries"`
+}
+
+func (s *ArchiveSegment) holds(bookmark *types.BookmarkProto) bool {
+	switch bookmark.BookmarkType() {
+	case datastream.BookmarkType_BOOKMARK_TYPE_BATCH:
+		return bookmark.Value >= s.FromBatch && bookmark.Value <= s.ToBatch
+	case datastream.BookmarkType_BOOKMARK_TYPE_L2_BLOCK:
+		return bookmark.Value >= s.FromBlock && bookmark.Value <= s.ToBlock
+	}
+	return false
+}
+
+// PreparedCompaction is a segment archived from the stream while the stream server has it open, it only goes to the
+// archive once the stream is compacted at its batch
+type PreparedCompaction struct {
+	Segment    ArchiveSegment `json:"segment"`
+	StartBatch uint64         `json:"startBatch"`
+	StartEntry uint64         `json:"startEntry"`
+	Digest     string         `json:"digest"` // sha256 of the archived entries as read from the stream
+}
+
+// StreamArchive holds the parts of the stream cut by the compaction, clients fetch them by bookmark like from the stream
+type StreamArchive struct {
+	dir      string
+	Segments []ArchiveSegment `json:"segments"`
+}
+
+// OpenStreamArchive opens the archive in the directory, an empty archive when it has no index yet
+func OpenStreamArchive(dir string) (*StreamArchive, error) {
+	archive := &StreamArchive{dir: dir}
+
+	content, err := os.ReadFile(filepath.Join(dir, streamArchiveIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return archive, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, archive); err != nil {
+		return nil, fmt.Errorf("reading the stream archive index: %w", err)
+	}
+
+	return archive, nil
+}
+
+func (a *StreamArchive) nextEntry() uint64 {
+	if len(a.Segments) == 0 {
+		return 0
+	}
+	last := a.Segments[len(a.Segments)-1]
+	return last.FromEntry + last.Entries
+}
+
+// archiveWriter compresses the entries of a new segment as they come
+type archiveWriter struct {
+	archive *StreamArchive
+	file    *os.File
+	buffer  *bufio.Writer
+	encoder *zstd.Encoder
+	segment ArchiveSegment
+	base    uint64
+	batches bool
+	blocks  bool
+}
+
+func (a *StreamArchive) newSegment() (*archiveWriter, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(a.dir, "segment-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	buffer := bufio.NewWriterSize(file, 1<<20)
+	encoder, err := zstd.NewWriter(buffer)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &archiveWriter{
+		archive: a,
+		file:    file,
+		buffer:  buffer,
+		encoder: encoder,
+		base:    a.nextEntry(),
+	}, nil
+}
+
+func (w *archiveWriter) append(entry *types.FileEntry) error {
+	if entry.IsBookmark() {
+		bookmark, err := types.UnmarshalBookmark(entry.Data)
+		if err != nil {
+			return err
+		}
+		switch bookmark.BookmarkType() {
+		case datastream.BookmarkType_BOOKMARK_TYPE_BATCH:
+			if !w.batches {
+				w.segment.FromBatch, w.batches = bookmark.Value, true
+			}
+			w.segment.ToBatch = bookmark.Value
+		case datastream.BookmarkType_BOOKMARK_TYPE_L2_BLOCK:
+			if !w.blocks {
+				w.segment.FromBlock, w.blocks = bookmark.Value, true
+			}
+			w.segment.ToBlock = bookmark.Value
+		}
+	}
+
+	archived := *entry
+	archived.EntryNum = w.base + w.segment.Entries
+	if _, err := w.encoder.Write(archived.Encode()); err != nil {
+		return err
+	}
+	w.segment.Entries++
+
+	return nil
+}
+
+// finish closes the segment file, it is removed on failure
+func (w *archiveWriter) finish() error {
+	err := w.encoder.Close()
+	if err == nil {
+		err = w.buffer.Flush()
+	}
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !w.batches {
+		err = errors.New("nothing to archive before the batch")
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	w.segment.FromEntry = w.base
+	w.segment.File = fmt.Sprintf("batches-%012d-%012d.zst", w.segment.FromBatch, w.segment.ToBatch)
+	return nil
+}
+
+// commit closes the segment and adds it to the index
+func (w *archiveWriter) commit() (*ArchiveSegment, error) {
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	return w.archive.add(w.segment, w.file.Name())
+}
+
+// prepare closes the segment and keeps it aside of the index until the stream is compacted at the batch, replacing
+// the compaction prepared before
+func (w *archiveWriter) prepare(startBatch, startEntry uint64, digest []byte) (*PreparedCompaction, error) {
+	if err := w.finish(); err != nil {
+		return nil, err
+	}
+	a := w.archive
+	if err := a.discardPrepared(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(w.file.Name(), filepath.Join(a.dir, preparedSegmentFile)); err != nil {
+		return nil, err
+	}
+	prepared := &PreparedCompaction{
+		Segment:    w.segment,
+		StartBatch: startBatch,
+		StartEntry: startEntry,
+		Digest:     hex.EncodeToString(digest),
+	}
+	content, err := json.MarshalIndent(prepared, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return prepared, writeFileAtomic(filepath.Join(a.dir, preparedSegmentIndex), content)
+}
+
+// add moves the segment file into the archive and adds it to the index, segments from the same batch on are replaced
+// as they can only be left from a compaction that didn't get to swap the stream file, the entry numbers skip the ones
+// they had
+func (a *StreamArchive) add(segment ArchiveSegment, fileName string) (*ArchiveSegment, error) {
+	for i, archived := range a.Segments {
+		if archived.FromBatch >= segment.FromBatch {
+			a.Segments = a.Segments[:i]
+			break
+		}
+	}
+	if err := os.Rename(fileName, filepath.Join(a.dir, segment.File)); err != nil {
+		return nil, err
+	}
+	a.Segments = append(a.Segments, segment)
+
+	return &a.Segments[len(a.Segments)-1], a.writeIndex()
+}
+
+// Prepared returns the compaction prepared while the stream was open, nil without one
+func (a *StreamArchive) Prepared() (*PreparedCompaction, error) {
+	content, err := os.ReadFile(filepath.Join(a.dir, preparedSegmentIndex))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prepared := &PreparedCompaction{}
+	if err = json.Unmarshal(content, prepared); err != nil {
+		return nil, fmt.Errorf("reading the prepared compaction: %w", err)
+	}
+	return prepared, nil
+}
+
+// commitPrepared adds the segment of the prepared compaction to the index
+func (a *StreamArchive) commitPrepared(prepared *PreparedCompaction) (*ArchiveSegment, error) {
+	segment, err := a.add(prepared.Segment, filepath.Join(a.dir, preparedSegmentFile))
+	if err != nil {
+		return nil, err
+	}
+	return segment, os.Remove(filepath.Join(a.dir, preparedSegmentIndex))
+}
+
+// discardPrepared removes the prepared compaction, the stream no longer starts the way it was prepared for
+func (a *StreamArchive) discardPrepared() error {
+	if err := os.Remove(filepath.Join(a.dir, preparedSegmentIndex)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(filepath.Join(a.dir, preparedSegmentFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (w *archiveWriter) abort() {
+	w.encoder.Close()
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+func (a *StreamArchive) writeIndex() error {
+	content, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(a.dir, streamArchiveIndex), content)
+}
+
+func writeFileAtomic(fileName string, content []byte) error {
+	tmp := fileName + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fileName)
+}
+
+// findSegment returns the index of the segment holding the bookmark
+func (a *StreamArchive) findSegment(bookmark []byte) (int, *types.BookmarkProto, error) {
+	decoded, err := types.UnmarshalBookmark(bookmark)
+	if err != nil {
+		return 0, nil, err
+	}
+	i := sort.Search(len(a.Segments), func(i int) bool {
+		if decoded.BookmarkType() == datastream.BookmarkType_BOOKMARK_TYPE_BATCH {
+			return a.Segments[i].ToBatch >= decoded.Value
+		}
+		return a.Segments[i].ToBlock >= decoded.Value
+	})
+	if i == len(a.Segments) || !a.Segments[i].holds(decoded) {
+		return 0, nil, ErrNotArchived
+	}
+	return i, decoded, nil
+}
+
+// Iterator returns an iterator over the archived entries from the bookmark on, up to the end of the archive
+func (a *StreamArchive) Iterator(bookmark []byte) (*ArchiveIterator, error) {
+	segment, _, err := a.findSegment(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	it := &ArchiveIterator{archive: a, segment: segment}
+	for {
+		entry, err := it.NextFileEntry()
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		if entry == nil {
+			it.Close()
+			return nil, ErrNotArchived
+		}
+		if entry.IsBookmark() && string(entry.Data) == string(bookmark) {
+			it.pending = entry
+			return it, nil
+		}
+	}
+}
+
+// HasBookmark tells if the bookmark is in the archive
+func (a *StreamArchive) HasBookmark(bookmark []byte) bool {
+	_, _, err := a.findSegment(bookmark)
+	return err == nil
+}
+
+// StreamFrom sends the archived entries from the bookmark on to the stream clients. The entries are numbered back from
+// the first one of the stream, wrapping around, so clients don't take them for entries of the stream
+func (a *StreamArchive) StreamFrom(bookmark []byte, send func(entry *types.FileEntry) error) error {
+	it, err := a.Iterator(bookmark)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	total := a.nextEntry()
+	for {
+		entry, err := it.NextFileEntry()
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		entry.PacketType = datastreamer.PtData
+		entry.EntryNum -= total
+		if err = send(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// GetDataBetweenBookmarks returns the data of the entries from the first bookmark to the second one, leaving the
+// bookmarks out, as the stream server does
+func (a *StreamArchive) GetDataBetweenBookmarks(bookmarkFrom, bookmarkTo []byte) ([]byte, error) {
+	if _, _, err := a.findSegment(bookmarkTo); err != nil {
+		return nil, err
+	}
+	it, err := a.Iterator(bookmarkFrom)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var data []byte
+	for {
+		entry, err := it.NextFileEntry()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, ErrNotArchived
+		}
+		if !entry.IsBookmark() {
+			data = append(data, entry.Data...)
+			continue
+		}
+		if string(entry.Data) == string(bookmarkTo) {
+			return data, nil
+		}
+	}
+}
+
+// ReadBatches returns the blocks of the archived batches from start to end
+func (a *StreamArchive) ReadBatches(start, end uint64) ([][]*types.FullL2Block, error) {
+	bookmark, err := types.NewBookmarkProto(start, datastream.BookmarkType_BOOKMARK_TYPE_BATCH).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	it, err := a.Iterator(bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	return ReadBatches(it, start, end)
+}
+
+// ArchiveIterator reads the archived entries in order across the segments
+type ArchiveIterator struct {
+	archive *StreamArchive
+	segment int
+	file    *os.File
+	decoder *zstd.Decoder
+	pending *types.FileEntry
+}
+
+func (it *ArchiveIterator) GetEntryNumberLimit() uint64 {
+	return it.archive.nextEntry()
+}
+
+func (it *ArchiveIterator) NextFileEntry() (*types.FileEntry, error) {
+	if it.pending != nil {
+		entry := it.pending
+		it.pending = nil
+		return entry, nil
+	}
+
+	for {
+		if it.decoder == nil {
+			if it.segment >= len(it.archive.Segments) {
+				return nil, nil
+			}
+			file, err := os.Open(filepath.Join(it.archive.dir, it.archive.Segments[it.segment].File))
+			if err != nil {
+				return nil, err
+			}
+			decoder, err := zstd.NewReader(bufio.NewReader(file))
+			if err != nil {
+				file.Close()
+				return nil, err
+			}
+			it.file, it.decoder = file, decoder
+		}
+
+		fixed := make([]byte, types.FileEntryMinSize)
+		_, err := io.ReadFull(it.decoder, fixed)
+		if errors.Is(err, io.EOF) {
+			it.closeSegment()
+			it.segment++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(fixed[1:5])
+		if length < types.FileEntryMinSize {
+			return nil, fmt.Errorf("invalid entry length %d in %s", length, it.archive.Segments[it.segment].File)
+		}
+		encoded := make([]byte, length)
+		copy(encoded, fixed)
+		if _, err = io.ReadFull(it.decoder, encoded[len(fixed):]); err != nil {
+			return nil, err
+		}
+		return types.DecodeFileEntry(encoded)
+	}
+}
+
+func (it *ArchiveIterator) closeSegment() {
+	if it.decoder != nil {
+		it.decoder.Close()
+		it.file.Close()
+		it.decoder, it.file = nil, nil
+	}
+}
+
+func (it *ArchiveIterator) Close() {
+	it.closeSegment()
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+var ErrNothingToCompact = errors.New("the stream already starts at the batch")
+
+// CompactResult describes a compacted stream
+type CompactResult struct {
+	Entries    uint64             // entries left in the stream
+	Length     uint64             // bytes used in the stream file
+	Archived   *ArchiveSegment    // the segment holding the entries cut from the stream
+	FirstBlock *types.FullL2Block // the first block of the stream
+}
+
+// CompactStream starts the stream over at the bookmark of the batch. The entries from the bookmark on are copied to a
+// new stream file, numbered from 0 with their bookmarks pointing to the new numbers, the entries before it are archived
+// to a new segment in the archive directory, or taken from the compaction prepared at the batch when they didn't change
+// since. The new file only replaces the stream once its header and bookmarks are read back and verifyBlock accepts its
+// first block. The stream must not be open, clients resuming from an entry number have to resume from a bookmark
+// instead.
+func CompactStream(fileName string, batchNumber uint64, archiveDir string, verifyBlock func(block *types.FullL2Block) error) (*CompactResult, error) {
+	binName, dbName := streamFileNames(fileName)
+	newBinName, newDbName := binName+".compact", dbName+".compact"
+
+	startBookmark, err := types.NewBookmarkProto(batchNumber, datastream.BookmarkType_BOOKMARK_TYPE_BATCH).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	startEntry, err := getStreamBookmark(dbName, startBookmark)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, fmt.Errorf("batch %d is not in the stream", batchNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if startEntry == 0 {
+		return nil, ErrNothingToCompact
+	}
+
+	reader, err := openStreamFile(binName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if startEntry >= reader.header.TotalEntries {
+		return nil, fmt.Errorf("the bookmark of batch %d points to entry %d past the end of the stream", batchNumber, startEntry)
+	}
+
+	archive, err := OpenStreamArchive(archiveDir)
+	if err != nil {
+		return nil, err
+	}
+	prepared, err := archive.Prepared()
+	if err != nil {
+		return nil, err
+	}
+	if prepared != nil && (prepared.StartBatch != batchNumber || prepared.StartEntry != startEntry || prepared.Segment.FromEntry != archive.nextEntry()) {
+		log.Info("[datastream] Discarding the compaction prepared for another start", "batch", prepared.StartBatch, "entry", prepared.StartEntry)
+		if err = archive.discardPrepared(); err != nil {
+			return nil, err
+		}
+		prepared = nil
+	}
+
+	// the entries before the bookmark are only read over when they are archived already
+	var segment *archiveWriter
+	digest := sha256.New()
+	archived := func(entry *types.FileEntry) error {
+		_, err := digest.Write(entry.Encode())
+		return err
+	}
+	if prepared == nil {
+		if segment, err = archive.newSegment(); err != nil {
+			return nil, err
+		}
+		archived = segment.append
+	}
+
+	result, err := copyCompactedStream(reader, startEntry, startBookmark, archived, newBinName, newDbName)
+	if err == nil && prepared != nil && hex.EncodeToString(digest.Sum(nil)) != prepared.Digest {
+		archive.discardPrepared()
+		err = errors.New("the stream changed before the batch since the compaction was prepared")
+	}
+	if err == nil {
+		err = verifyCompactedStream(newBinName, newDbName, reader.header, result)
+	}
+	if err == nil && verifyBlock != nil {
+		err = verifyBlock(result.FirstBlock)
+	}
+	switch {
+	case err != nil && segment != nil:
+		segment.abort()
+	case err == nil && segment != nil:
+		result.Archived, err = segment.commit()
+	case err == nil:
+		result.Archived, err = archive.commitPrepared(prepared)
+	}
+	if err != nil {
+		os.Remove(newBinName)
+		os.RemoveAll(newDbName)
+		return nil, err
+	}
+
+	// swap the bookmarks first, the stream server checks a bookmark points to its entry before trusting it
+	oldDbName := dbName + ".old"
+	if err = os.Rename(dbName, oldDbName); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(newDbName, dbName); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(newBinName, binName); err != nil {
+		return nil, err
+	}
+	if err = os.RemoveAll(oldDbName); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PrepareCompaction archives the entries before the bookmark of the batch while the stream server has the stream open
+// and keeps the segment aside, so compacting the stream at the batch on the next start only copies the entries from
+// the bookmark on. The stream is read up to the entries it held when opened, its bookmarks db is locked by the server
+// so the bookmark is looked for in the stream.
+func PrepareCompaction(fileName string, batchNumber uint64, archiveDir string) (*PreparedCompaction, error) {
+	binName, _ := streamFileNames(fileName)
+	startBookmark, err := types.NewBookmarkProto(batchNumber, datastream.BookmarkType_BOOKMARK_TYPE_BATCH).Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := openStreamFile(binName)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	archive, err := OpenStreamArchive(archiveDir)
+	if err != nil {
+		return nil, err
+	}
+	segment, err := archive.newSegment()
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.New()
+	for {
+		entry, err := reader.next()
+		if err == nil && entry == nil {
+			err = fmt.Errorf("batch %d is not in the stream", batchNumber)
+		}
+		if err != nil {
+			segment.abort()
+			return nil, err
+		}
+
+		if entry.IsBookmark() && string(entry.Data) == string(startBookmark) {
+			if entry.EntryNum == 0 {
+				segment.abort()
+				return nil, ErrNothingToCompact
+			}
+			return segment.prepare(batchNumber, entry.EntryNum, digest.Sum(nil))
+		}
+		if _, err = digest.Write(entry.Encode()); err == nil {
+			err = segment.append(entry)
+		}
+		if err != nil {
+			segment.abort()
+			return nil, err
+		}
+	}
+}
+
+func getStreamBookmark(dbName string, bookmark []byte) (uint64, error) {
+	db, err := leveldb.OpenFile(dbName, nil)
+	if err != nil {
+		return 0, fmt.Errorf("opening the stream bookmarks: %w", err)
+	}
+	defer db.Close()
+
+	entry, err := db.Get(bookmark, nil)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(entry), nil
+}
+
+// copyCompactedStream copies the entries from the start entry on to the new stream and passes the ones before it to
+// archived
+func copyCompactedStream(reader *streamFileReader, startEntry uint64, startBookmark []byte, archived func(entry *types.FileEntry) error, binName, dbName string) (*CompactResult, error) {
+	if err := os.RemoveAll(dbName); err != nil {
+		return nil, err
+	}
+	db, err := leveldb.OpenFile(dbName, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	writer, err := createStreamFile(binName, reader.header.Version, reader.header.SystemID, reader.header.StreamType)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CompactResult{}
+	for {
+		entry, err := reader.next()
+		if err != nil {
+			writer.close()
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+
+		if entry.EntryNum < startEntry {
+			if err = archived(entry); err != nil {
+				writer.close()
+				return nil, err
+			}
+			continue
+		}
+		if entry.EntryNum == startEntry && (!entry.IsBookmark() || string(entry.Data) != string(startBookmark)) {
+			writer.close()
+			return nil, fmt.Errorf("the bookmark of the batch points to entry %d which isn't the bookmark", startEntry)
+		}
+
+		entryNum, err := writer.append(entry.EntryType, entry.Data)
+		if err != nil {
+			writer.close()
+			return nil, err
+		}
+		if entry.IsBookmark() {
+			if err = db.Put(entry.Data, binary.BigEndian.AppendUint64(nil, entryNum), nil); err != nil {
+				writer.close()
+				return nil, err
+			}
+		}
+		if result.FirstBlock == nil && entry.EntryType == types.EntryTypeL2Block {
+			if result.FirstBlock, err = types.UnmarshalL2Block(entry.Data); err != nil {
+				writer.close()
+				return nil, err
+			}
+		}
+	}
+
+	if err = writer.close(); err != nil {
+		return nil, err
+	}
+	result.Entries, result.Length = writer.header.TotalEntries, writer.header.TotalLength
+	if result.FirstBlock == nil {
+		return nil, errors.New("no block in the stream from the batch on")
+	}
+
+	return result, nil
+}
+
+// verifyCompactedStream reads the new stream back, its header must carry the one of the old stream with the entries
+// copied and every bookmark must point to its entry
+func verifyCompactedStream(binName, dbName string, oldHeader *streamHeader, result *CompactResult) error {
+	reader, err := openStreamFile(binName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	header := reader.header
+	if header.Version != oldHeader.Version || header.SystemID != oldHeader.SystemID || header.StreamType != oldHeader.StreamType {
+		return fmt.Errorf("the compacted stream header %+v doesn't match the stream one %+v", header, oldHeader)
+	}
+	if header.TotalEntries != result.Entries || header.TotalLength != result.Length {
+		return fmt.Errorf("the compacted stream header has %d entries in %d bytes, %d entries in %d bytes were written", header.TotalEntries, header.TotalLength, result.Entries, result.Length)
+	}
+
+	db, err := leveldb.OpenFile(dbName, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for {
+		entry, err := reader.next()
+		if err != nil {
+			return fmt.Errorf("reading the compacted stream back: %w", err)
+		}
+		if entry == nil {
+			return nil
+		}
+		if !entry.IsBookmark() {
+			continue
+		}
+		value, err := db.Get(entry.Data, nil)
+		if err != nil {
+			return fmt.Errorf("bookmark of entry %d: %w", entry.EntryNum, err)
+		}
+		if binary.BigEndian.Uint64(value) != entry.EntryNum {
+			return fmt.Errorf("bookmark of entry %d points to entry %d", entry.EntryNum, binary.BigEndian.Uint64(value))
+		}
+	}
+}
+
+// StreamFirstBatch returns the first batch in the stream, false if it has none
+func StreamFirstBatch(fileName string) (uint64, bool, error) {
+	binName, _ := streamFileNames(fileName)
+	reader, err := openStreamFile(binName)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer reader.Close()
+
+	for {
+		entry, err := reader.next()
+		if err != nil || entry == nil {
+			return 0, false, err
+		}
+		if !entry.IsBookmark() {
+			continue
+		}
+		bookmark, err := types.UnmarshalBookmark(entry.Data)
+		if err != nil {
+			return 0, false, err
+		}
+		if bookmark.BookmarkType() == datastream.BookmarkType_BOOKMARK_TYPE_BATCH {
+			return bookmark.Value, true, nil
+		}
+	}
+}
+
+// VerifyStreamBlock checks the block in the stream is the canonical one, with the state root and batch of the db
+func VerifyStreamBlock(tx kv.Tx, block *types.FullL2Block) error {
+	hash, err := rawdb.ReadCanonicalHash(tx, block.L2BlockNumber)
+	if err != nil {
+		return err
+	}
+	if hash != block.L2Blockhash {
+		return fmt.Errorf("block %d is %s in the stream, %s in the db", block.L2BlockNumber, block.L2Blockhash, hash)
+	}
+	header := rawdb.ReadHeader(tx, hash, block.L2BlockNumber)
+	if header == nil {
+		return fmt.Errorf("no header for block %d in the db", block.L2BlockNumber)
+	}
+	if header.Root != block.StateRoot {
+		return fmt.Errorf("block %d has state root %s in the stream, %s in the db", block.L2BlockNumber, block.StateRoot, header.Root)
+	}
+	batchNumber, err := hermez_db.NewHermezDbReader(tx).GetBatchNoByL2Block(block.L2BlockNumber)
+	if err != nil {
+		return err
+	}
+	if batchNumber != block.BatchNumber {
+		return fmt.Errorf("block %d is in batch %d in the stream, %d in the db", block.L2BlockNumber, block.BatchNumber, batchNumber)
+	}
+
+	log.Debug("[datastream] Verified the block against the db", "block", block.L2BlockNumber, "batch", batchNumber, "root", header.Root)
+	return nil
+}
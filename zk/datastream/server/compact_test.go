@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/datastream/client"
+	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testBatches        = 6
+	testBlocksPerBatch = 2
+)
+
+// writeTestStream writes batches of blocks with a large transaction each so the entries spill over the data pages, and
+// returns the entries written
+func writeTestStream(t *testing.T, fileName string) []*types.FileEntry {
+	binName, dbName := streamFileNames(fileName)
+	writer, err := createStreamFile(binName, 2, 1, datastreamer.StreamType(1))
+	require.NoError(t, err)
+	db, err := leveldb.OpenFile(dbName, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var entries []*types.FileEntry
+	add := func(entryType types.EntryType, message proto.Message) {
+		data, err := proto.Marshal(message)
+		require.NoError(t, err)
+		entryNum, err := writer.append(entryType, data)
+		require.NoError(t, err)
+		if entryType == types.BookmarkEntryType {
+			require.NoError(t, db.Put(data, binary.BigEndian.AppendUint64(nil, entryNum), nil))
+		}
+		entries = append(entries, &types.FileEntry{EntryType: entryType, EntryNum: entryNum, Data: data})
+	}
+
+	block := uint64(1)
+	for batch := uint64(1); batch <= testBatches; batch++ {
+		add(types.BookmarkEntryType, &datastream.BookMark{Type: datastream.BookmarkType_BOOKMARK_TYPE_BATCH, Value: batch})
+		add(types.EntryTypeBatchStart, &datastream.BatchStart{Number: batch, ForkId: 9})
+		for i := 0; i < testBlocksPerBatch; i++ {
+			add(types.BookmarkEntryType, &datastream.BookMark{Type: datastream.BookmarkType_BOOKMARK_TYPE_L2_BLOCK, Value: block})
+			add(types.EntryTypeL2Block, &datastream.L2Block{Number: block, BatchNumber: batch, StateRoot: libcommon.BigToHash(libcommon.Big1).Bytes()})
+			add(types.EntryTypeL2Tx, &datastream.Transaction{L2BlockNumber: block, Encoded: make([]byte, 300_000)})
+			add(types.EntryTypeL2BlockEnd, &datastream.L2BlockEnd{Number: block})
+			block++
+		}
+		add(types.EntryTypeBatchEnd, &datastream.BatchEnd{Number: batch})
+	}
+	require.NoError(t, writer.close())
+
+	return entries
+}
+
+func batchBookmark(t *testing.T, batch uint64) []byte {
+	bookmark, err := types.NewBookmarkProto(batch, datastream.BookmarkType_BOOKMARK_TYPE_BATCH).Marshal()
+	require.NoError(t, err)
+	return bookmark
+}
+
+func TestCompactStream(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "data-stream")
+	archiveDir := filepath.Join(dir, "archive")
+	entries := writeTestStream(t, fileName)
+	entriesPerBatch := len(entries) / testBatches
+
+	// a block failing the verification leaves the stream as it was
+	_, err := CompactStream(fileName, 3, archiveDir, func(*types.FullL2Block) error { return errors.New("bad block") })
+	require.Error(t, err)
+	first, ok, err := StreamFirstBatch(fileName)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), first)
+
+	var verified []uint64
+	verify := func(block *types.FullL2Block) error {
+		verified = append(verified, block.L2BlockNumber)
+		return nil
+	}
+	result, err := CompactStream(fileName, 3, archiveDir, verify)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4*entriesPerBatch), result.Entries)
+	require.Equal(t, ArchiveSegment{File: result.Archived.File, FromBatch: 1, ToBatch: 2, FromBlock: 1, ToBlock: 4, FromEntry: 0, Entries: uint64(2 * entriesPerBatch)}, *result.Archived)
+
+	result, err = CompactStream(fileName, 5, archiveDir, verify)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2*entriesPerBatch), result.Entries)
+	require.Equal(t, uint64(2*entriesPerBatch), result.Archived.FromEntry)
+	require.Equal(t, []uint64{5, 9}, verified)
+
+	_, err = CompactStream(fileName, 5, archiveDir, verify)
+	require.ErrorIs(t, err, ErrNothingToCompact)
+
+	// the archive reads as the stream did across its segments
+	archive, err := OpenStreamArchive(archiveDir)
+	require.NoError(t, err)
+	require.Len(t, archive.Segments, 2)
+
+	batches, err := archive.ReadBatches(1, 4)
+	require.NoError(t, err)
+	require.Len(t, batches, 4)
+	for i, blocks := range batches {
+		require.Len(t, blocks, testBlocksPerBatch)
+		require.Equal(t, uint64(i+1), blocks[0].BatchNumber)
+		require.Len(t, blocks[0].L2Txs, 1)
+	}
+
+	var expected []byte
+	for _, entry := range entries[entriesPerBatch : 3*entriesPerBatch] {
+		if !entry.IsBookmark() {
+			expected = append(expected, entry.Data...)
+		}
+	}
+	data, err := archive.GetDataBetweenBookmarks(batchBookmark(t, 2), batchBookmark(t, 4))
+	require.NoError(t, err)
+	require.Equal(t, expected, data)
+
+	_, err = archive.GetDataBetweenBookmarks(batchBookmark(t, 4), batchBookmark(t, 5))
+	require.ErrorIs(t, err, ErrNotArchived)
+
+	// the library opens the compacted stream with its entries and bookmarks renumbered
+	stream, err := datastreamer.NewServer(freePort(t), 2, 1, datastreamer.StreamType(1), fileName, time.Second, time.Second, time.Second, nil)
+	require.NoError(t, err)
+	require.Equal(t, result.Entries, stream.GetHeader().TotalEntries)
+	for i, entry := range entries[4*entriesPerBatch:] {
+		read, err := stream.GetEntry(uint64(i))
+		require.NoError(t, err)
+		require.Equal(t, entry.Data, read.Data)
+	}
+	entryNum, err := stream.GetBookmark(batchBookmark(t, 6))
+	require.NoError(t, err)
+	require.Equal(t, uint64(entriesPerBatch), entryNum)
+
+	batches, err = NewZkEVMDataStreamServerFactory().CreateDataStreamServer(stream, 1).ReadBatches(5, 6)
+	require.NoError(t, err)
+	require.Equal(t, uint64(12), batches[1][1].L2BlockNumber)
+
+	// and carries on writing to it
+	require.NoError(t, stream.Start())
+	require.NoError(t, stream.StartAtomicOp())
+	entryNum, err = stream.AddStreamBookmark(batchBookmark(t, 7))
+	require.NoError(t, err)
+	require.Equal(t, result.Entries, entryNum)
+	require.NoError(t, stream.CommitAtomicOp())
+	read, err := stream.GetEntry(entryNum)
+	require.NoError(t, err)
+	require.Equal(t, batchBookmark(t, 7), read.Data)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, file := range files {
+		require.Contains(t, []string{"archive", "data-stream.bin", "data-stream.db"}, file.Name())
+	}
+}
+
+func TestPrepareCompaction(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "data-stream")
+	archiveDir := filepath.Join(dir, "archive")
+	entries := writeTestStream(t, fileName)
+	entriesPerBatch := uint64(len(entries) / testBatches)
+
+	_, err := PrepareCompaction(fileName, 1, archiveDir)
+	require.ErrorIs(t, err, ErrNothingToCompact)
+	_, err = PrepareCompaction(fileName, testBatches+1, archiveDir)
+	require.Error(t, err)
+
+	// the prepared segment stays out of the archive until the stream is compacted at its batch
+	prepared, err := PrepareCompaction(fileName, 3, archiveDir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), prepared.StartBatch)
+	require.Equal(t, 2*entriesPerBatch, prepared.StartEntry)
+	archive, err := OpenStreamArchive(archiveDir)
+	require.NoError(t, err)
+	require.Empty(t, archive.Segments)
+
+	result, err := CompactStream(fileName, 3, archiveDir, nil)
+	require.NoError(t, err)
+	require.Equal(t, prepared.Segment, *result.Archived)
+	archive, err = OpenStreamArchive(archiveDir)
+	require.NoError(t, err)
+	require.Equal(t, []ArchiveSegment{prepared.Segment}, archive.Segments)
+	prepared, err = archive.Prepared()
+	require.NoError(t, err)
+	require.Nil(t, prepared)
+
+	// the stream changing before the batch since the compaction was prepared fails the compaction
+	prepared, err = PrepareCompaction(fileName, 5, archiveDir)
+	require.NoError(t, err)
+	require.Equal(t, 2*entriesPerBatch, prepared.Segment.FromEntry)
+	prepared.Digest = "00"
+	content, err := json.Marshal(prepared)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(archiveDir, preparedSegmentIndex), content, 0644))
+	_, err = CompactStream(fileName, 5, archiveDir, nil)
+	require.Error(t, err)
+	first, _, err := StreamFirstBatch(fileName)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), first)
+
+	// and a compaction prepared at another batch is discarded
+	_, err = PrepareCompaction(fileName, 5, archiveDir)
+	require.NoError(t, err)
+	result, err = CompactStream(fileName, 4, archiveDir, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), result.Archived.FromBatch)
+	require.Equal(t, uint64(3), result.Archived.ToBatch)
+	_, err = os.Stat(filepath.Join(archiveDir, preparedSegmentFile))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	archive, err = OpenStreamArchive(archiveDir)
+	require.NoError(t, err)
+	batches, err := archive.ReadBatches(1, 3)
+	require.NoError(t, err)
+	require.Len(t, batches, 3)
+}
+
+func TestCompactedStreamServesArchive(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "data-stream")
+	archiveDir := filepath.Join(dir, "archive")
+	writeTestStream(t, fileName)
+	_, err := CompactStream(fileName, 4, archiveDir, nil)
+	require.NoError(t, err)
+
+	archive, err := OpenStreamArchive(archiveDir)
+	require.NoError(t, err)
+	// the gateway serves the archive in front of the stream server
+	port := freePort(t)
+	stream, err := NewZkEVMDataStreamServerFactory().CreateStreamServer(port, 2, 1, datastreamer.StreamType(1), fileName, time.Second, time.Minute, time.Minute, nil, &GatewayConfig{InternalPort: freePort(t), Archive: archive})
+	require.NoError(t, err)
+	require.NoError(t, stream.Start())
+	defer stream.(*gatedStreamServer).Stop()
+
+	// a client resuming from an archived block gets the blocks from the archive, then the ones of the stream
+	readBlocks := func(progress uint64) []uint64 {
+		c := client.NewClient(context.Background(), net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))), false, 2, time.Second, 0)
+		require.NoError(t, c.Start())
+		defer c.Stop()
+		c.GetProgressAtomic().Store(progress)
+
+		// the client ends the read with a nil entry once it reaches the last entry of the stream
+		errs := make(chan error, 1)
+		go func() { errs <- c.ReadAllEntriesToChannel() }()
+		var blocks []uint64
+		for {
+			select {
+			case entry := <-*c.GetEntryChan():
+				if entry == nil {
+					return blocks
+				}
+				if block, ok := entry.(*types.FullL2Block); ok {
+					blocks = append(blocks, block.L2BlockNumber)
+				}
+			case err := <-errs:
+				require.NoError(t, err)
+				errs = nil
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "the stream didn't end", "blocks read %v", blocks)
+			}
+		}
+	}
+	require.Equal(t, []uint64{3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, readBlocks(2))
+	require.Equal(t, []uint64{8, 9, 10, 11, 12}, readBlocks(7))
+
+	// the archive only holds the batches cut from the stream
+	require.True(t, archive.HasBookmark(batchBookmark(t, 1)))
+	require.False(t, archive.HasBookmark(batchBookmark(t, 4)))
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 	zktypes "github.com/ledgerwatch/erigon/zk/types"
 	"github.com/ledgerwatch/erigon/zk/utils"
 	"github.com/ledgerwatch/log/v3"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
 type DbReader interface {
@@ -68,8 +71,25 @@ func NewZkEVMDataStreamServerFactory() *ZkEVMDataStreamServerFactory {
 	return &ZkEVMDataStreamServerFactory{}
 }
 
-func (f *ZkEVMDataStreamServerFactory) CreateStreamServer(port uint16, version uint8, systemID uint64, streamType datastreamer.StreamType, fileName string, writeTimeout time.Duration, inactivityTimeout time.Duration, inactivityCheckInterval time.Duration, cfg *dslog.Config) (StreamServer, error) {
-	return datastreamer.NewServer(port, version, systemID, streamType, fileName, writeTimeout, inactivityTimeout, inactivityCheckInterval, cfg)
+// CreateStreamServer creates the stream server listening on the port, or behind a gateway listening on it when the
+// gateway config has anything to enforce
+func (f *ZkEVMDataStreamServerFactory) CreateStreamServer(port uint16, version uint8, systemID uint64, streamType datastreamer.StreamType, fileName string, writeTimeout time.Duration, inactivityTimeout time.Duration, inactivityCheckInterval time.Duration, cfg *dslog.Config, gatewayCfg *GatewayConfig) (StreamServer, error) {
+	if !gatewayCfg.Enabled() {
+		return datastreamer.NewServer(port, version, systemID, streamType, fileName, writeTimeout, inactivityTimeout, inactivityCheckInterval, cfg)
+	}
+
+	gateway, err := newGateway(port, gatewayCfg)
+	if err != nil {
+		return nil, err
+	}
+	streamServer, err := datastreamer.NewServer(gatewayCfg.InternalPort, version, systemID, streamType, fileName, writeTimeout, inactivityTimeout, inactivityCheckInterval, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// the stream server listens on all the interfaces, the internal port has to be firewalled so only the gateway
+	// reaches it
+	log.Warn("[datastream gateway] The stream server behind the gateway listens on all the interfaces, firewall its port", "internalPort", gatewayCfg.InternalPort)
+	return &gatedStreamServer{StreamServer: streamServer, gateway: gateway}, nil
 }
 
 func (f *ZkEVMDataStreamServerFactory) CreateDataStreamServer(streamServer StreamServer, chainId uint64) DataStreamServer {
@@ -609,6 +629,69 @@ func (srv *ZkEVMDataStreamServer) UnwindToBatchStart(batchNumber uint64) error {
 	return srv.streamServer.TruncateFile(entryNum)
 }
 
+// removes everything written after the given block of the given batch
+// the batch end of the batch is kept if it is there, the start of the next batch and the blocks after are removed
+// only the stream is read so it works also when the db doesn't hold the blocks written after this one
+func (srv *ZkEVMDataStreamServer) UnwindAfterBlock(blockNumber, batchNumber uint64) error {
+	entryNum, found, err := srv.findBookmark(blockNumber+1, datastream.BookmarkType_BOOKMARK_TYPE_L2_BLOCK)
+	if err != nil {
+		return err
+	}
+
+	batchEntryNum, batchFound, err := srv.findBookmark(batchNumber+1, datastream.BookmarkType_BOOKMARK_TYPE_BATCH)
+	if err != nil {
+		return err
+	}
+	if batchFound && (!found || batchEntryNum < entryNum) {
+		entryNum, found = batchEntryNum, true
+	}
+
+	if !found {
+		return nil
+	}
+
+	if err = srv.streamServer.TruncateFile(entryNum); err != nil {
+		return err
+	}
+
+	// the cached values could be past the new end of the stream, they are read again from it when needed
+	srv.highestBlockWritten = nil
+	srv.highestBatchWritten = nil
+	srv.highestClosedBatchWritten = nil
+
+	return nil
+}
+
+// finds the entry of a bookmark
+// truncating the stream leaves the bookmarks in place, so one pointing past the end or to another entry is not found
+func (srv *ZkEVMDataStreamServer) findBookmark(value uint64, bookmarkType datastream.BookmarkType) (uint64, bool, error) {
+	marshalled, err := types.NewBookmarkProto(value, bookmarkType).Marshal()
+	if err != nil {
+		return 0, false, err
+	}
+
+	entryNum, err := srv.streamServer.GetBookmark(marshalled)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if entryNum >= srv.streamServer.GetHeader().TotalEntries {
+		return 0, false, nil
+	}
+	entry, err := srv.streamServer.GetEntry(entryNum)
+	if err != nil {
+		return 0, false, err
+	}
+	if entry.Type != datastreamer.EtBookmark || !bytes.Equal(entry.Data, marshalled) {
+		return 0, false, nil
+	}
+
+	return entryNum, true, nil
+}
+
 func (srv *ZkEVMDataStreamServer) getLastEntryOfType(entryType datastreamer.EntryType) (datastreamer.FileEntry, bool, error) {
 	header := srv.streamServer.GetHeader()
 	emtryEntry := datastreamer.FileEntry{}
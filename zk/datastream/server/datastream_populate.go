@@ -143,7 +143,11 @@ func (srv *ZkEVMDataStreamServer) WriteBlocksToStreamConsecutively(
 	}
 
 	entries := make([]DataStreamEntryProto, 0, insertEntryCount)
-	var forkId uint64
+	// the first block can carry on the batch of the block before it, so the fork id isn't queried in the loop for it
+	forkId, err := reader.GetForkId(batchNum)
+	if err != nil {
+		return err
+	}
 
 	batchesProgress, err := stages.GetStageProgress(tx, stages.Batches)
 	if err != nil {
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/holiman/uint256"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	eritypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// the first block written can carry on the batch of the block before it, its transactions have to be written with the
+// fork id of that batch all the same
+func TestWriteBlocksToStreamConsecutivelyForkId(t *testing.T) {
+	tx := memdb.BeginRw(t, memdb.NewTestDB(t))
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+	hDB := hermez_db.NewHermezDb(tx)
+
+	var parent *eritypes.Block
+	for blockNum := uint64(0); blockNum <= 2; blockNum++ {
+		header := &eritypes.Header{Number: new(big.Int).SetUint64(blockNum), Time: blockNum, Difficulty: big.NewInt(1)}
+		var txs []eritypes.Transaction
+		if parent != nil {
+			header.ParentHash = parent.Hash()
+			txs = append(txs, eritypes.NewTransaction(blockNum, libcommon.Address{1}, uint256.NewInt(0), 21000, uint256.NewInt(1), nil))
+			require.NoError(t, hDB.WriteIntermediateTxStateRoot(blockNum, txs[0].Hash(), libcommon.HexToHash("0x1")))
+		}
+		block := eritypes.NewBlock(header, txs, nil, nil, nil)
+		require.NoError(t, rawdb.WriteBlock(tx, block))
+		require.NoError(t, rawdb.WriteCanonicalHash(tx, block.Hash(), blockNum))
+		parent = block
+	}
+	require.NoError(t, hDB.WriteBlockBatch(0, 0))
+	require.NoError(t, hDB.WriteBlockBatch(1, 1))
+	require.NoError(t, hDB.WriteBlockBatch(2, 1))
+	// past etrog the transactions don't carry their intermediate state root
+	require.NoError(t, hDB.WriteForkId(1, 9))
+
+	stream, err := datastreamer.NewServer(freePort(t), 2, 1, datastreamer.StreamType(1), filepath.Join(t.TempDir(), "data-stream"), time.Second, time.Minute, time.Minute, nil)
+	require.NoError(t, err)
+	require.NoError(t, stream.Start())
+	srv := NewZkEVMDataStreamServerFactory().CreateDataStreamServer(stream, 1)
+
+	require.NoError(t, srv.WriteBlocksToStreamConsecutively(context.Background(), "test", tx, hermez_db.NewHermezDbReader(tx), 2, 2))
+
+	var written []*datastream.Transaction
+	for entryNum := uint64(0); entryNum < stream.GetHeader().TotalEntries; entryNum++ {
+		entry, err := stream.GetEntry(entryNum)
+		require.NoError(t, err)
+		if types.EntryType(entry.Type) != types.EntryTypeL2Tx {
+			continue
+		}
+		transaction := &datastream.Transaction{}
+		require.NoError(t, proto.Unmarshal(entry.Data, transaction))
+		written = append(written, transaction)
+	}
+	require.Len(t, written, 1)
+	require.Equal(t, uint64(2), written[0].L2BlockNumber)
+	require.Equal(t, libcommon.Hash{}.Bytes(), written[0].ImStateRoot)
+}
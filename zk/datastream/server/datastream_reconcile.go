@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/zk/datastream/proto/github.com/0xPolygonHermez/zkevm-node/state/datastream"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/utils"
+)
+
+// the kinds of divergences between the stream and the db
+const (
+	DivergenceEntry         = "entry"           // a block entry differs from the one built from the db
+	DivergenceGerUpdate     = "ger_update"      // a GER update differs from the one built from the db
+	DivergenceBatchEnd      = "batch_end"       // a batch end differs from the one built from the db
+	DivergenceBatchEnds     = "batch_ends"      // a batch closed in the stream isn't closed in the BATCH_ENDS table
+	DivergenceLatestUsedGer = "latest_used_ger" // the GER of a block isn't the one the LATEST_USED_GER table has for it
+)
+
+// Divergence is an entry of the stream not matching the db
+type Divergence struct {
+	Kind   string
+	Block  uint64 // the block the entry is written with
+	Batch  uint64
+	Entry  uint64
+	Detail string
+}
+
+// ReconcileReport holds what comparing the stream to the db found
+type ReconcileReport struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Entries   uint64 // entries found matching
+
+	// the first entry not matching, the stream is rewritten from RewriteFromEntry where the entries of
+	// RewriteFromBlock start, the end of the batch before it included
+	Divergence       *Divergence
+	RewriteFromEntry uint64
+	RewriteFromBlock uint64
+
+	// the BATCH_ENDS and LATEST_USED_GER tables disagreeing with the stream, the stream isn't built from them so
+	// rewriting it doesn't change them
+	TableMismatches []Divergence
+}
+
+// CompareWithDb compares the stream from the first block of the batch up to the block entry by entry with the entries
+// built from the db as the stream is written, then checks the batch ends and the GERs of the blocks against the
+// BATCH_ENDS and LATEST_USED_GER tables. Nothing is compared when the stream doesn't hold the block before the batch.
+func (srv *ZkEVMDataStreamServer) CompareWithDb(tx kv.Tx, reader *hermez_db.HermezDbReader, fromBatch, toBlock uint64, checkBatchEnds bool) (*ReconcileReport, error) {
+	fromBlock, startEntry, found, err := srv.findComparisonStart(reader, fromBatch, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconcileReport{FromBlock: fromBlock, ToBlock: toBlock}
+	if !found {
+		return report, nil
+	}
+
+	lastBlock, err := rawdb.ReadBlockByNumber(tx, fromBlock-1)
+	if err != nil {
+		return nil, err
+	}
+	lastBatch, err := reader.GetBatchNoByL2Block(fromBlock - 1)
+	if err != nil && !errors.Is(err, hermez_db.ErrorNotStored) {
+		return nil, err
+	}
+
+	it := newDataStreamServerIterator(srv.streamServer, startEntry)
+	diverged := func(d *Divergence, blockEntry, blockNum, batchNum uint64) *ReconcileReport {
+		d.Block, d.Batch = blockNum, batchNum
+		report.Divergence, report.RewriteFromEntry, report.RewriteFromBlock = d, blockEntry, blockNum
+		return report
+	}
+
+	// the batch of the block before the last one, the end of the last batch carries the GER updates since then
+	var prevBatch, blockEntry uint64
+	for blockNum := fromBlock; blockNum <= toBlock; blockNum++ {
+		block, err := rawdb.ReadBlockByNumber(tx, blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			return nil, fmt.Errorf("block %d not found", blockNum)
+		}
+		batchNum, err := reader.GetBatchNoByL2Block(blockNum)
+		if err != nil && !errors.Is(err, hermez_db.ErrorNotStored) {
+			return nil, err
+		}
+		forkId, err := reader.GetForkId(batchNum)
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := createBlockWithBatchCheckStreamEntriesProto(reader, tx, block, lastBlock, batchNum, lastBatch, srv.chainId, forkId, false, false)
+		if err != nil {
+			return nil, err
+		}
+		blockEntry = it.curEntryNum
+		for _, expected := range entries.Entries() {
+			d, err := compareStreamEntry(it, expected)
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				return diverged(d, blockEntry, blockNum, batchNum), nil
+			}
+			report.Entries++
+		}
+
+		if batchNum != lastBatch {
+			if checkBatchEnds && blockNum > 1 {
+				isEnd, err := reader.GetBatchEnd(blockNum - 1)
+				if err != nil {
+					return nil, err
+				}
+				if !isEnd {
+					report.TableMismatches = append(report.TableMismatches, Divergence{Kind: DivergenceBatchEnds, Block: blockNum - 1, Batch: lastBatch, Detail: "the stream closes the batch at the block"})
+				}
+			}
+		}
+
+		usedGer, found, err := reader.GetBlockLatestUsedGer(blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			ger, err := reader.GetBlockGlobalExitRoot(blockNum)
+			if err != nil {
+				return nil, err
+			}
+			if ger != usedGer {
+				report.TableMismatches = append(report.TableMismatches, Divergence{Kind: DivergenceLatestUsedGer, Block: blockNum, Batch: batchNum, Detail: fmt.Sprintf("the block has GER %s, the table %s", ger, usedGer)})
+			}
+		}
+
+		prevBatch, lastBlock, lastBatch = lastBatch, block, batchNum
+	}
+
+	// after the last block the stream can only close its batch, the block is rewritten for anything else
+	if it.curEntryNum > it.header {
+		return report, nil
+	}
+	gers, err := reader.GetBatchGlobalExitRootsProto(prevBatch, lastBatch)
+	if err != nil {
+		return nil, err
+	}
+	localExitRoot, err := utils.GetBatchLocalExitRootFromSCStorageForLatestBlock(lastBatch, reader, tx)
+	if err != nil {
+		return nil, err
+	}
+	root := lastBlock.Root()
+	endEntries, err := addBatchEndEntriesProto(lastBatch, &root, gers, &localExitRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, expected := range endEntries {
+		d, err := compareStreamEntry(it, expected)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			return diverged(d, blockEntry, toBlock, lastBatch), nil
+		}
+		report.Entries++
+	}
+	if it.curEntryNum <= it.header {
+		d := &Divergence{Kind: DivergenceEntry, Entry: it.curEntryNum, Detail: fmt.Sprintf("the stream has %d entries after the end of the batch", it.header+1-it.curEntryNum)}
+		return diverged(d, blockEntry, toBlock, lastBatch), nil
+	}
+	if checkBatchEnds {
+		isEnd, err := reader.GetBatchEnd(toBlock)
+		if err != nil {
+			return nil, err
+		}
+		if !isEnd {
+			report.TableMismatches = append(report.TableMismatches, Divergence{Kind: DivergenceBatchEnds, Block: toBlock, Batch: lastBatch, Detail: "the stream closes the batch at the block"})
+		}
+	}
+
+	return report, nil
+}
+
+// findComparisonStart returns the first block of the batch, or of the first batch after it with blocks, whose block
+// before is in the stream, and the entry after the end of that block where the entries of the block start
+func (srv *ZkEVMDataStreamServer) findComparisonStart(reader *hermez_db.HermezDbReader, fromBatch, toBlock uint64) (uint64, uint64, bool, error) {
+	if srv.streamServer.GetHeader().TotalEntries == 0 {
+		return 0, 0, false, nil
+	}
+	toBatch, err := reader.GetBatchNoByL2Block(toBlock)
+	if err != nil && !errors.Is(err, hermez_db.ErrorNotStored) {
+		return 0, 0, false, err
+	}
+
+	for batchNum := fromBatch; batchNum <= toBatch; batchNum++ {
+		blocks, err := reader.GetL2BlockNosByBatch(batchNum)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		fromBlock := blocks[0]
+		for _, blockNum := range blocks {
+			fromBlock = min(fromBlock, blockNum)
+		}
+		if fromBlock == 0 {
+			continue
+		}
+		if fromBlock > toBlock {
+			break
+		}
+
+		entryNum, found, err := srv.findBookmark(fromBlock-1, datastream.BookmarkType_BOOKMARK_TYPE_L2_BLOCK)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if !found {
+			continue
+		}
+		it := newDataStreamServerIterator(srv.streamServer, entryNum)
+		for {
+			entry, err := it.NextFileEntry()
+			if err != nil {
+				return 0, 0, false, err
+			}
+			if entry == nil {
+				break
+			}
+			if entry.IsL2BlockEnd() {
+				return fromBlock, it.curEntryNum, true, nil
+			}
+		}
+	}
+
+	return 0, 0, false, nil
+}
+
+func compareStreamEntry(it *dataStreamServerIterator, expected DataStreamEntryProto) (*Divergence, error) {
+	data, err := expected.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	kind := DivergenceEntry
+	switch expected.Type() {
+	case types.EntryTypeGerUpdate:
+		kind = DivergenceGerUpdate
+	case types.EntryTypeBatchEnd:
+		kind = DivergenceBatchEnd
+	}
+
+	entryNum := it.curEntryNum
+	entry, err := it.NextFileEntry()
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return &Divergence{Kind: kind, Entry: entryNum, Detail: fmt.Sprintf("the stream ends before an entry of type %d", expected.Type())}, nil
+	}
+	if entry.EntryType != expected.Type() {
+		return &Divergence{Kind: kind, Entry: entryNum, Detail: fmt.Sprintf("the stream has an entry of type %d instead of %d", entry.EntryType, expected.Type())}, nil
+	}
+	if !bytes.Equal(entry.Data, data) {
+		return &Divergence{Kind: kind, Entry: entryNum, Detail: fmt.Sprintf("the entry of type %d differs", entry.EntryType)}, nil
+	}
+
+	return nil, nil
+}
+
+// RewriteDivergentTail removes the stream from the entry the report rewrites from and writes the blocks from the
+// report block to its last block again from the db
+func (srv *ZkEVMDataStreamServer) RewriteDivergentTail(ctx context.Context, logPrefix string, tx kv.Tx, reader DbReader, report *ReconcileReport) error {
+	if report.Divergence == nil {
+		return nil
+	}
+
+	// the stream can end before the block's entries
+	if report.RewriteFromEntry < srv.streamServer.GetHeader().TotalEntries {
+		if err := srv.streamServer.TruncateFile(report.RewriteFromEntry); err != nil {
+			return err
+		}
+	}
+	srv.highestBlockWritten = nil
+	srv.highestBatchWritten = nil
+	srv.highestClosedBatchWritten = nil
+
+	return srv.WriteBlocksToStreamConsecutively(ctx, logPrefix, tx, reader, report.RewriteFromBlock, report.ToBlock)
+}
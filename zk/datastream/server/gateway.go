@@ -0,0 +1,347 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon/zk/datastream/client"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	gatewayHandshakeTimeout = 10 * time.Second
+	gatewayMaxTokenLength   = 1024
+)
+
+// GatewayConfig puts a gateway in front of the stream server that terminates TLS, authenticates the clients and limits
+// their connections before passing them to the stream server
+type GatewayConfig struct {
+	// the stream server listens on this port behind the gateway, on all the interfaces so it has to be firewalled
+	InternalPort uint16
+
+	TLSCertFile  string
+	TLSKeyFile   string
+	ClientCAFile string // clients must present a certificate signed by it, it needs TLS
+
+	TokensFile              string   // clients must send one of the tokens of the file, one per line
+	Allowlist               []string // IPs or CIDRs the clients must connect from, empty allows all
+	MaxConnectionsPerClient int      // connections at once from an IP, 0 doesn't limit
+
+	// clients starting from a bookmark cut from the stream get the archived entries from it on, then the stream
+	Archive *StreamArchive
+}
+
+// Enabled tells if the gateway has anything to enforce or serve
+func (c *GatewayConfig) Enabled() bool {
+	return c != nil && (c.TLSCertFile != "" || c.TokensFile != "" || len(c.Allowlist) > 0 || c.MaxConnectionsPerClient > 0 || c.Archive != nil)
+}
+
+// gatedStreamServer starts the stream server behind the gateway
+type gatedStreamServer struct {
+	StreamServer
+	gateway *gateway
+}
+
+func (s *gatedStreamServer) Start() error {
+	if err := s.StreamServer.Start(); err != nil {
+		return err
+	}
+	return s.gateway.start()
+}
+
+// Stop closes the gateway, the stream server behind it has no way to stop and goes with the process
+func (s *gatedStreamServer) Stop() error {
+	return s.gateway.stop()
+}
+
+type gateway struct {
+	port      uint16
+	target    string
+	tlsConfig *tls.Config
+	tokens    [][]byte
+	allowlist []*net.IPNet
+	maxConns  int
+	archive   *StreamArchive
+
+	mtx   sync.Mutex
+	ln    net.Listener
+	conns map[string]int
+}
+
+func newGateway(port uint16, cfg *GatewayConfig) (*gateway, error) {
+	if cfg.InternalPort == 0 || cfg.InternalPort == port {
+		return nil, fmt.Errorf("the stream server behind the gateway needs its own port, got %d", cfg.InternalPort)
+	}
+
+	g := &gateway{
+		port:     port,
+		target:   net.JoinHostPort("127.0.0.1", strconv.Itoa(int(cfg.InternalPort))),
+		maxConns: cfg.MaxConnectionsPerClient,
+		archive:  cfg.Archive,
+		conns:    make(map[string]int),
+	}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading the server certificate: %w", err)
+		}
+		g.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	if cfg.ClientCAFile != "" {
+		if g.tlsConfig == nil {
+			return nil, errors.New("verifying the client certificates needs the server certificate")
+		}
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.ClientCAFile)
+		}
+		g.tlsConfig.ClientCAs = pool
+		g.tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if cfg.TokensFile != "" {
+		data, err := os.ReadFile(cfg.TokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading the tokens: %w", err)
+		}
+		for _, token := range strings.Split(string(data), "\n") {
+			if token = strings.TrimSpace(token); token != "" {
+				g.tokens = append(g.tokens, []byte(token))
+			}
+		}
+		if len(g.tokens) == 0 {
+			return nil, fmt.Errorf("no token found in %s", cfg.TokensFile)
+		}
+	}
+
+	for _, entry := range cfg.Allowlist {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowlist entry %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			g.allowlist = append(g.allowlist, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+		}
+		g.allowlist = append(g.allowlist, ipNet)
+	}
+
+	return g, nil
+}
+
+func (g *gateway) start() error {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(int(g.port)))
+	if err != nil {
+		return err
+	}
+	if g.tlsConfig != nil {
+		ln = tls.NewListener(ln, g.tlsConfig)
+	}
+
+	g.mtx.Lock()
+	g.ln = ln
+	g.mtx.Unlock()
+
+	log.Info("[datastream gateway] Listening", "port", g.port, "tls", g.tlsConfig != nil, "mtls", g.tlsConfig != nil && g.tlsConfig.ClientCAs != nil, "tokens", len(g.tokens), "allowlist", len(g.allowlist), "maxConnectionsPerClient", g.maxConns, "archive", g.archive != nil)
+	go g.serve(ln)
+
+	return nil
+}
+
+func (g *gateway) stop() error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.ln == nil {
+		return nil
+	}
+	err := g.ln.Close()
+	g.ln = nil
+	return err
+}
+
+func (g *gateway) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Warn("[datastream gateway] Accepting a connection", "err", err)
+			continue
+		}
+		go g.handle(conn)
+	}
+}
+
+func (g *gateway) handle(conn net.Conn) {
+	defer conn.Close()
+
+	clientID := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(clientID)
+	if err != nil {
+		host = clientID
+	}
+
+	if !g.allowed(host) {
+		log.Warn("[datastream gateway] Client not in the allowlist", "client", clientID)
+		return
+	}
+	if !g.acquire(host) {
+		log.Warn("[datastream gateway] Client reached its connection limit", "client", clientID, "limit", g.maxConns)
+		return
+	}
+	defer g.release(host)
+
+	if err = conn.SetDeadline(time.Now().Add(gatewayHandshakeTimeout)); err != nil {
+		return
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err = tlsConn.Handshake(); err != nil {
+			log.Warn("[datastream gateway] TLS handshake failed", "client", clientID, "err", err)
+			return
+		}
+	}
+	if len(g.tokens) > 0 {
+		if err = g.authenticate(conn); err != nil {
+			log.Warn("[datastream gateway] Authentication failed", "client", clientID, "err", err)
+			return
+		}
+	}
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	upstream, err := net.Dial("tcp", g.target)
+	if err != nil {
+		log.Error("[datastream gateway] Connecting to the stream server", "err", err)
+		return
+	}
+	defer upstream.Close()
+
+	log.Debug("[datastream gateway] Client connected", "client", clientID)
+	if g.archive == nil {
+		proxy(conn, upstream)
+		return
+	}
+	if err = newArchiveSession(g.archive, clientID, conn, upstream).run(); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		log.Debug("[datastream gateway] Client disconnected", "client", clientID, "err", err)
+	}
+}
+
+func (g *gateway) allowed(host string) bool {
+	if len(g.allowlist) == 0 {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range g.allowlist {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *gateway) acquire(host string) bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.maxConns > 0 && g.conns[host] >= g.maxConns {
+		return false
+	}
+	g.conns[host]++
+	return true
+}
+
+func (g *gateway) release(host string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.conns[host]--; g.conns[host] <= 0 {
+		delete(g.conns, host)
+	}
+}
+
+// authenticate reads the auth command the client sends first and answers it with a result
+func (g *gateway) authenticate(conn net.Conn) error {
+	header := make([]byte, 8+8+4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if command := client.Command(binary.BigEndian.Uint64(header[:8])); command != client.CmdAuth {
+		writeGatewayResult(conn, types.CmdErrUnauthorized, "authentication required")
+		return fmt.Errorf("expected the auth command, got %d", command)
+	}
+	length := binary.BigEndian.Uint32(header[16:])
+	if length > gatewayMaxTokenLength {
+		writeGatewayResult(conn, types.CmdErrUnauthorized, "invalid token")
+		return fmt.Errorf("token of %d bytes", length)
+	}
+	token := make([]byte, length)
+	if _, err := io.ReadFull(conn, token); err != nil {
+		return err
+	}
+
+	valid := 0
+	for _, t := range g.tokens {
+		valid |= subtle.ConstantTimeCompare(t, token)
+	}
+	if valid == 0 {
+		writeGatewayResult(conn, types.CmdErrUnauthorized, "invalid token")
+		return errors.New("invalid token")
+	}
+
+	return writeGatewayResult(conn, types.CmdErrOK, "")
+}
+
+func writeGatewayResult(conn net.Conn, errorNum uint32, errorStr string) error {
+	result := types.ResultEntry{
+		PacketType: client.PtResult,
+		Length:     types.ResultEntryMinSize + uint32(len(errorStr)),
+		ErrorNum:   errorNum,
+		ErrorStr:   []byte(errorStr),
+	}
+	_, err := conn.Write(result.Encode())
+	return err
+}
+
+// proxy copies the data both ways until one of the sides closes its connection
+func proxy(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go pipe(a, b)
+	go pipe(b, a)
+	<-done
+}
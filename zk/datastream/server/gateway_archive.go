@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/ledgerwatch/erigon/zk/datastream/client"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// the datastreamer library doesn't take longer bookmarks
+const gatewayMaxBookmarkLength = 16
+
+// archiveSession relays the commands of a client to the stream server and answers the ones starting from a bookmark
+// the stream server doesn't have but the archive does itself: the archived entries from the bookmark on, then the
+// stream from its first entry. The stream server only sends packets in answer to commands while the client isn't
+// streaming, so they are relayed command by command then and copied as they come while it is.
+type archiveSession struct {
+	archive    *StreamArchive
+	clientID   string
+	client     net.Conn
+	commands   *bufio.Reader
+	upstream   net.Conn
+	packets    *bufio.Reader
+	streamType uint64
+}
+
+func newArchiveSession(archive *StreamArchive, clientID string, conn, upstream net.Conn) *archiveSession {
+	return &archiveSession{
+		archive:  archive,
+		clientID: clientID,
+		client:   conn,
+		commands: bufio.NewReader(conn),
+		upstream: upstream,
+		packets:  bufio.NewReader(upstream),
+	}
+}
+
+// gatewayCommand is a command of a client as sent, with its parameters
+type gatewayCommand struct {
+	command  client.Command
+	raw      []byte
+	bookmark []byte
+}
+
+func (s *archiveSession) run() error {
+	for {
+		cmd, err := s.readCommand()
+		if err != nil {
+			return err
+		}
+
+		streaming := false
+		switch cmd.command {
+		case client.CmdStartBookmark:
+			streaming, err = s.startBookmark(cmd)
+		case client.CmdStart:
+			streaming, err = s.relay(cmd, 0)
+		case client.CmdHeader, client.CmdEntry, client.CmdBookmark:
+			_, err = s.relay(cmd, 1)
+		default:
+			_, err = s.relay(cmd, 0)
+		}
+		if err != nil {
+			return err
+		}
+		if streaming {
+			if err = s.stream(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *archiveSession) readCommand() (*gatewayCommand, error) {
+	raw := make([]byte, 16)
+	if _, err := io.ReadFull(s.commands, raw); err != nil {
+		return nil, err
+	}
+	cmd := &gatewayCommand{command: client.Command(binary.BigEndian.Uint64(raw[:8]))}
+	s.streamType = binary.BigEndian.Uint64(raw[8:])
+
+	switch cmd.command {
+	case client.CmdStart, client.CmdEntry:
+		param := make([]byte, 8)
+		if _, err := io.ReadFull(s.commands, param); err != nil {
+			return nil, err
+		}
+		raw = append(raw, param...)
+	case client.CmdStartBookmark, client.CmdBookmark:
+		length := make([]byte, 4)
+		if _, err := io.ReadFull(s.commands, length); err != nil {
+			return nil, err
+		}
+		if binary.BigEndian.Uint32(length) > gatewayMaxBookmarkLength {
+			return nil, fmt.Errorf("bookmark of %d bytes", binary.BigEndian.Uint32(length))
+		}
+		cmd.bookmark = make([]byte, binary.BigEndian.Uint32(length))
+		if _, err := io.ReadFull(s.commands, cmd.bookmark); err != nil {
+			return nil, err
+		}
+		raw = append(append(raw, length...), cmd.bookmark...)
+	}
+	cmd.raw = raw
+
+	return cmd, nil
+}
+
+// relay sends the command to the stream server and relays its result and the packets following a successful one
+func (s *archiveSession) relay(cmd *gatewayCommand, following int) (bool, error) {
+	if _, err := s.upstream.Write(cmd.raw); err != nil {
+		return false, err
+	}
+	result, err := s.readPacket()
+	if err != nil {
+		return false, err
+	}
+	if _, err = s.client.Write(result); err != nil {
+		return false, err
+	}
+	ok := resultOk(result)
+	for i := 0; ok && i < following; i++ {
+		packet, err := s.readPacket()
+		if err != nil {
+			return false, err
+		}
+		if _, err = s.client.Write(packet); err != nil {
+			return false, err
+		}
+	}
+	return ok, nil
+}
+
+// startBookmark starts the client from the bookmark, from the archive when only the archive has it
+func (s *archiveSession) startBookmark(cmd *gatewayCommand) (bool, error) {
+	found, err := s.upstreamHasBookmark(cmd.bookmark)
+	if err != nil {
+		return false, err
+	}
+	if found || !s.archive.HasBookmark(cmd.bookmark) {
+		return s.relay(cmd, 0)
+	}
+
+	if err = writeGatewayResult(s.client, types.CmdErrOK, "OK"); err != nil {
+		return false, err
+	}
+	log.Debug("[datastream gateway] Streaming from the archive", "client", s.clientID, "bookmark", cmd.bookmark)
+	if err = s.archive.StreamFrom(cmd.bookmark, func(entry *types.FileEntry) error {
+		_, err := s.client.Write(entry.Encode())
+		return err
+	}); err != nil {
+		return false, fmt.Errorf("streaming from the archive: %w", err)
+	}
+
+	start := binary.BigEndian.AppendUint64(nil, uint64(client.CmdStart))
+	start = binary.BigEndian.AppendUint64(start, s.streamType)
+	start = binary.BigEndian.AppendUint64(start, 0)
+	if _, err = s.upstream.Write(start); err != nil {
+		return false, err
+	}
+	result, err := s.readPacket()
+	if err != nil {
+		return false, err
+	}
+	if !resultOk(result) {
+		return false, errors.New("the stream server didn't start the stream after the archive")
+	}
+	return true, nil
+}
+
+func (s *archiveSession) upstreamHasBookmark(bookmark []byte) (bool, error) {
+	cmd := binary.BigEndian.AppendUint64(nil, uint64(client.CmdBookmark))
+	cmd = binary.BigEndian.AppendUint64(cmd, s.streamType)
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(len(bookmark)))
+	if _, err := s.upstream.Write(append(cmd, bookmark...)); err != nil {
+		return false, err
+	}
+	result, err := s.readPacket()
+	if err != nil || !resultOk(result) {
+		return false, err
+	}
+	// the entry the bookmark points to, of the not found type when the stream doesn't have it
+	entry, err := s.readPacket()
+	if err != nil {
+		return false, err
+	}
+	if len(entry) < 9 {
+		return false, fmt.Errorf("bookmark entry of %d bytes", len(entry))
+	}
+	return types.EntryType(binary.BigEndian.Uint32(entry[5:9])) != types.EntryTypeNotFound, nil
+}
+
+// stream copies the packets of the stream server to the client until the client stops the stream. The results of
+// the commands sent meanwhile are matched to them in order, only the one of a stop ends the stream.
+func (s *archiveSession) stream() error {
+	pending := make(chan client.Command, 16)
+	stopped := make(chan bool, 16)
+	copyErr := make(chan error, 1)
+	go func() {
+		for {
+			packet, err := s.readPacket()
+			if err == nil {
+				_, err = s.client.Write(packet)
+			}
+			if err != nil {
+				copyErr <- err
+				// unblock the client side waiting on a stop
+				s.client.Close()
+				return
+			}
+			if packet[0] != client.PtResult {
+				continue
+			}
+			select {
+			case cmd := <-pending:
+				if cmd != client.CmdStop {
+					continue
+				}
+				ok := resultOk(packet)
+				stopped <- ok
+				if ok {
+					copyErr <- nil
+					return
+				}
+			default:
+			}
+		}
+	}()
+
+	for {
+		cmd, err := s.readCommand()
+		if err != nil {
+			s.upstream.Close()
+			<-copyErr
+			return err
+		}
+		pending <- cmd.command
+		if _, err = s.upstream.Write(cmd.raw); err != nil {
+			return err
+		}
+		if cmd.command != client.CmdStop {
+			continue
+		}
+		select {
+		case ok := <-stopped:
+			if ok {
+				return <-copyErr
+			}
+		case err := <-copyErr:
+			return err
+		}
+	}
+}
+
+// readPacket reads a packet of the stream server, all of them start with their type and total length
+func (s *archiveSession) readPacket() ([]byte, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(s.packets, head); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(head[1:])
+	if length < uint32(len(head)) {
+		return nil, fmt.Errorf("packet of type %d with length %d", head[0], length)
+	}
+	packet := make([]byte, length)
+	copy(packet, head)
+	if _, err := io.ReadFull(s.packets, packet[len(head):]); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+func resultOk(packet []byte) bool {
+	return packet[0] == client.PtResult && len(packet) >= int(types.ResultEntryMinSize) && binary.BigEndian.Uint32(packet[5:9]) == types.CmdErrOK
+}
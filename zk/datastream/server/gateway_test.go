@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/ledgerwatch/erigon/zk/datastream/client"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+	"github.com/stretchr/testify/require"
+)
+
+func freePort(t *testing.T) uint16 {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// writeTestCert writes a certificate signed by the parent, or self signed without one, and its key as PEM files
+func writeTestCert(t *testing.T, dir, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return cert, key
+}
+
+func startGatedStream(t *testing.T, cfg *GatewayConfig) string {
+	port := freePort(t)
+	cfg.InternalPort = freePort(t)
+	stream, err := NewZkEVMDataStreamServerFactory().CreateStreamServer(port, 2, 1, datastreamer.StreamType(1), filepath.Join(t.TempDir(), "data-stream"), time.Second, time.Minute, time.Minute, nil, cfg)
+	require.NoError(t, err)
+	require.NoError(t, stream.Start())
+	t.Cleanup(func() { _ = stream.(*gatedStreamServer).Stop() })
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))
+}
+
+func readHeader(server string, auth client.Auth) error {
+	c := client.NewClient(context.Background(), server, false, 2, time.Second, 0)
+	if err := c.SetAuth(auth); err != nil {
+		return err
+	}
+	if err := c.Start(); err != nil {
+		return err
+	}
+	defer c.Stop()
+	_, err := c.GetHeader()
+	return err
+}
+
+func TestGateway(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeTestCert(t, dir, "ca", true, nil, nil)
+	writeTestCert(t, dir, "server", false, ca, caKey)
+	writeTestCert(t, dir, "client", false, ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	require.NoError(t, os.WriteFile(file("tokens"), []byte("first\n\n  second  \n"), 0600))
+	require.NoError(t, os.WriteFile(file("second"), []byte("second\n"), 0600))
+	require.NoError(t, os.WriteFile(file("third"), []byte("third"), 0600))
+
+	t.Run("token", func(t *testing.T) {
+		server := startGatedStream(t, &GatewayConfig{TokensFile: file("tokens")})
+
+		require.NoError(t, readHeader(server, client.Auth{TokenFile: file("second")}))
+
+		err := readHeader(server, client.Auth{TokenFile: file("third")})
+		require.ErrorIs(t, err, types.ErrUnauthorized)
+
+		require.Error(t, readHeader(server, client.Auth{}))
+	})
+
+	t.Run("mutual tls", func(t *testing.T) {
+		server := startGatedStream(t, &GatewayConfig{
+			TLSCertFile:  file("server.crt"),
+			TLSKeyFile:   file("server.key"),
+			ClientCAFile: file("ca.crt"),
+		})
+
+		require.NoError(t, readHeader(server, client.Auth{CertFile: file("client.crt"), KeyFile: file("client.key"), CAFile: file("ca.crt")}))
+
+		// the server doesn't let a client without a certificate through
+		require.Error(t, readHeader(server, client.Auth{CAFile: file("ca.crt")}))
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		server := startGatedStream(t, &GatewayConfig{Allowlist: []string{"10.0.0.0/8", "192.168.1.1"}})
+		require.Error(t, readHeader(server, client.Auth{}))
+
+		server = startGatedStream(t, &GatewayConfig{Allowlist: []string{"10.0.0.0/8", "127.0.0.1"}})
+		require.NoError(t, readHeader(server, client.Auth{}))
+	})
+
+	t.Run("connection limit", func(t *testing.T) {
+		server := startGatedStream(t, &GatewayConfig{MaxConnectionsPerClient: 1})
+
+		first, err := net.Dial("tcp", server)
+		require.NoError(t, err)
+		// the gateway counts the connection before passing it on, an answer tells it is counted
+		command := binary.BigEndian.AppendUint64(nil, uint64(client.CmdHeader))
+		command = binary.BigEndian.AppendUint64(command, uint64(client.StSequencer))
+		_, err = first.Write(command)
+		require.NoError(t, err)
+		_, err = first.Read(make([]byte, 1))
+		require.NoError(t, err)
+
+		require.Error(t, readHeader(server, client.Auth{}))
+
+		// the slot is given back once the first client leaves
+		require.NoError(t, first.Close())
+		require.Eventually(t, func() bool {
+			return readHeader(server, client.Auth{}) == nil
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+}
+
+func TestGatewayStop(t *testing.T) {
+	port := freePort(t)
+	cfg := &GatewayConfig{InternalPort: freePort(t), MaxConnectionsPerClient: 1}
+	stream, err := NewZkEVMDataStreamServerFactory().CreateStreamServer(port, 2, 1, datastreamer.StreamType(1), filepath.Join(t.TempDir(), "data-stream"), time.Second, time.Minute, time.Minute, nil, cfg)
+	require.NoError(t, err)
+	require.NoError(t, stream.Start())
+	server := net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))
+	require.NoError(t, readHeader(server, client.Auth{}))
+
+	require.NoError(t, stream.(*gatedStreamServer).Stop())
+	require.Error(t, readHeader(server, client.Auth{}))
+
+	// the port is free again
+	ln, err := net.Listen("tcp", server)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+}
@@ -43,6 +43,7 @@ type DataStreamServer interface {
 	GetHighestClosedBatchNoCache() (uint64, error)
 	UnwindToBlock(blockNumber uint64) error
 	UnwindToBatchStart(batchNumber uint64) error
+	UnwindAfterBlock(blockNumber, batchNumber uint64) error
 	ReadBatches(start uint64, end uint64) ([][]*types.FullL2Block, error)
 	WriteWholeBatchToStream(logPrefix string, tx kv.Tx, reader DbReader, prevBatchNum, batchNum uint64) error
 	WriteBlocksToStreamConsecutively(ctx context.Context, logPrefix string, tx kv.Tx, reader DbReader, from, to uint64) error
@@ -50,9 +51,11 @@ type DataStreamServer interface {
 	UnwindIfNecessary(logPrefix string, reader DbReader, blockNum, prevBlockBatchNum, batchNum uint64) error
 	WriteBatchEnd(reader DbReader, batchNumber uint64, stateRoot *common.Hash, localExitRoot *common.Hash) (err error)
 	WriteGenesisToStream(genesis *eritypes.Block, reader *hermez_db.HermezDbReader, tx kv.Tx) error
+	CompareWithDb(tx kv.Tx, reader *hermez_db.HermezDbReader, fromBatch, toBlock uint64, checkBatchEnds bool) (*ReconcileReport, error)
+	RewriteDivergentTail(ctx context.Context, logPrefix string, tx kv.Tx, reader DbReader, report *ReconcileReport) error
 }
 
 type DataStreamServerFactory interface {
-	CreateStreamServer(port uint16, version uint8, systemID uint64, streamType datastreamer.StreamType, fileName string, writeTimeout time.Duration, inactivityTimeout time.Duration, inactivityCheckInterval time.Duration, cfg *dslog.Config) (StreamServer, error)
+	CreateStreamServer(port uint16, version uint8, systemID uint64, streamType datastreamer.StreamType, fileName string, writeTimeout time.Duration, inactivityTimeout time.Duration, inactivityCheckInterval time.Duration, cfg *dslog.Config, gatewayCfg *GatewayConfig) (StreamServer, error)
 	CreateDataStreamServer(stream StreamServer, chainId uint64) DataStreamServer
 }
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/0xPolygonHermez/zkevm-data-streamer/datastreamer"
+	"github.com/ledgerwatch/erigon/zk/datastream/types"
+)
+
+// the stream file layout of the datastreamer library: a header page holding the magic numbers and the header, then data
+// pages holding the entries, an entry not fitting in what is left of a page starts on the next one after a pad byte
+
+var streamMagicNumbers = []byte("polygonDATSTREAM")
+
+const (
+	streamHeaderOffset = 16
+	streamHeaderSize   = 38
+)
+
+// streamFileNames returns the stream file and its bookmarks db the same way the datastreamer library names them
+func streamFileNames(fileName string) (string, string) {
+	if !strings.ContainsRune(fileName, '.') {
+		fileName += ".bin"
+	}
+	return fileName, fileName[:strings.IndexRune(fileName, '.')] + ".db"
+}
+
+type streamHeader struct {
+	Version      uint8
+	SystemID     uint64
+	StreamType   datastreamer.StreamType
+	TotalLength  uint64
+	TotalEntries uint64
+}
+
+func (h *streamHeader) encode() []byte {
+	b := []byte{datastreamer.PtHeader}
+	b = binary.BigEndian.AppendUint32(b, streamHeaderSize)
+	b = append(b, h.Version)
+	b = binary.BigEndian.AppendUint64(b, h.SystemID)
+	b = binary.BigEndian.AppendUint64(b, uint64(h.StreamType))
+	b = binary.BigEndian.AppendUint64(b, h.TotalLength)
+	return binary.BigEndian.AppendUint64(b, h.TotalEntries)
+}
+
+func decodeStreamHeader(b []byte) (*streamHeader, error) {
+	if len(b) != streamHeaderSize || b[0] != datastreamer.PtHeader || binary.BigEndian.Uint32(b[1:5]) != streamHeaderSize {
+		return nil, errors.New("invalid stream header")
+	}
+	return &streamHeader{
+		Version:      b[5],
+		SystemID:     binary.BigEndian.Uint64(b[6:14]),
+		StreamType:   datastreamer.StreamType(binary.BigEndian.Uint64(b[14:22])),
+		TotalLength:  binary.BigEndian.Uint64(b[22:30]),
+		TotalEntries: binary.BigEndian.Uint64(b[30:38]),
+	}, nil
+}
+
+// pageRemaining is what is left of the data page at the offset, the library counts a full page as nothing left
+func pageRemaining(offset uint64) uint64 {
+	if (offset-datastreamer.PageHeaderSize)%datastreamer.PageDataSize == 0 {
+		return 0
+	}
+	return datastreamer.PageDataSize - (offset-datastreamer.PageHeaderSize)%datastreamer.PageDataSize
+}
+
+// streamFileReader reads the entries of a stream file in order without opening it with the library, which keeps the
+// file and its bookmarks db open for the life of the process
+type streamFileReader struct {
+	file   *os.File
+	reader *bufio.Reader
+	header *streamHeader
+	offset uint64
+	read   uint64
+}
+
+func openStreamFile(fileName string) (*streamFileReader, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	page := make([]byte, datastreamer.PageHeaderSize)
+	if _, err = io.ReadFull(file, page); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("reading the header page of %s: %w", fileName, err)
+	}
+	if !bytes.Equal(page[:streamHeaderOffset], streamMagicNumbers) {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a stream file", fileName)
+	}
+	header, err := decodeStreamHeader(page[streamHeaderOffset : streamHeaderOffset+streamHeaderSize])
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	return &streamFileReader{
+		file:   file,
+		reader: bufio.NewReaderSize(file, 1<<20),
+		header: header,
+		offset: datastreamer.PageHeaderSize,
+	}, nil
+}
+
+// next returns the next entry, or nil once all the entries in the header are read
+func (r *streamFileReader) next() (*types.FileEntry, error) {
+	if r.read >= r.header.TotalEntries {
+		return nil, nil
+	}
+
+	packetType, err := r.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if packetType == datastreamer.PtPadding {
+		skip := pageRemaining(r.offset + 1)
+		if _, err = r.reader.Discard(int(skip)); err != nil {
+			return nil, err
+		}
+		r.offset += 1 + skip
+		if packetType, err = r.reader.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+	if packetType != datastreamer.PtData {
+		return nil, fmt.Errorf("expected a data entry at offset %d, got packet type %d", r.offset, packetType)
+	}
+
+	fixed := make([]byte, datastreamer.FixedSizeFileEntry)
+	fixed[0] = packetType
+	if _, err = io.ReadFull(r.reader, fixed[1:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(fixed[1:5])
+	if length < datastreamer.FixedSizeFileEntry {
+		return nil, fmt.Errorf("invalid entry length %d at offset %d", length, r.offset)
+	}
+	encoded := make([]byte, length)
+	copy(encoded, fixed)
+	if _, err = io.ReadFull(r.reader, encoded[datastreamer.FixedSizeFileEntry:]); err != nil {
+		return nil, err
+	}
+
+	entry, err := types.DecodeFileEntry(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if entry.EntryNum != r.read {
+		return nil, fmt.Errorf("expected entry %d, got %d", r.read, entry.EntryNum)
+	}
+	r.offset += uint64(length)
+	r.read++
+
+	return entry, nil
+}
+
+func (r *streamFileReader) Close() error {
+	return r.file.Close()
+}
+
+// streamFileWriter writes a new stream file entry by entry, the header is only written on close so a file that isn't
+// closed has no entries to the library
+type streamFileWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	header streamHeader
+}
+
+func createStreamFile(fileName string, version uint8, systemID uint64, streamType datastreamer.StreamType) (*streamFileWriter, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &streamFileWriter{
+		file:   file,
+		writer: bufio.NewWriterSize(file, 1<<20),
+		header: streamHeader{
+			Version:     version,
+			SystemID:    systemID,
+			StreamType:  streamType,
+			TotalLength: datastreamer.PageHeaderSize,
+		},
+	}
+
+	page := make([]byte, datastreamer.PageHeaderSize)
+	copy(page, streamMagicNumbers)
+	copy(page[streamHeaderOffset:], w.header.encode())
+	if _, err = w.writer.Write(page); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// append writes the entry as the next one in the file and returns its number
+func (w *streamFileWriter) append(entryType types.EntryType, data []byte) (uint64, error) {
+	entry := &types.FileEntry{
+		PacketType: datastreamer.PtData,
+		Length:     uint32(datastreamer.FixedSizeFileEntry + len(data)),
+		EntryType:  entryType,
+		EntryNum:   w.header.TotalEntries,
+		Data:       data,
+	}
+
+	if remaining := pageRemaining(w.header.TotalLength); uint64(entry.Length) > remaining && remaining > 0 {
+		if _, err := w.writer.Write(make([]byte, remaining)); err != nil {
+			return 0, err
+		}
+		w.header.TotalLength += remaining
+	}
+	if _, err := w.writer.Write(entry.Encode()); err != nil {
+		return 0, err
+	}
+	w.header.TotalLength += uint64(entry.Length)
+	w.header.TotalEntries++
+
+	return entry.EntryNum, nil
+}
+
+// close fills the last data page, writes the header and syncs the file
+func (w *streamFileWriter) close() error {
+	defer w.file.Close()
+
+	pages := (w.header.TotalLength - datastreamer.PageHeaderSize + datastreamer.PageDataSize - 1) / datastreamer.PageDataSize
+	if pages == 0 {
+		pages = 1
+	}
+	size := datastreamer.PageHeaderSize + pages*datastreamer.PageDataSize
+	if _, err := w.writer.Write(make([]byte, size-w.header.TotalLength)); err != nil {
+		return err
+	}
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.file.WriteAt(w.header.encode(), streamHeaderOffset); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
@@ -27,7 +27,7 @@ func main() {
 		Outputs:     []string{"stdout"},
 	}
 
-	stream, err := dataStreamServerFactory.CreateStreamServer(uint16(6900), uint8(2), 1, datastreamer.StreamType(1), file, 50*time.Second, 600*time.Second, 300*time.Second, logConfig)
+	stream, err := dataStreamServerFactory.CreateStreamServer(uint16(6900), uint8(2), 1, datastreamer.StreamType(1), file, 50*time.Second, 600*time.Second, 300*time.Second, logConfig, nil)
 	if err != nil {
 		fmt.Println("Error creating datastream server:", err)
 		return
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/debug_tools"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/ledgerwatch/erigon/zk/types"
+)
+
+// imports the outputs of sequence-logs and sequence-calldata into an L1 archive for zkevm.l1-archive-replay
+func main() {
+	cfg, err := debug_tools.GetConf()
+	if err != nil {
+		panic(fmt.Sprintf("RPGCOnfig: %s", err))
+	}
+
+	file, err := os.Open("l1BatchInfos.json")
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	sequences := make([]types.L1BatchInfo, 0)
+
+	enc := json.NewDecoder(file)
+	if err := enc.Decode(&sequences); err != nil {
+		panic(err)
+	}
+
+	calldatas := make(map[string]string)
+	file2, err := os.Open("calldataFinal.json")
+	if err == nil {
+		defer file2.Close()
+		enc2 := json.NewDecoder(file2)
+		if err := enc2.Decode(&calldatas); err != nil {
+			panic(err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		panic(err)
+	}
+
+	calldata := make(map[common.Hash][]byte, len(calldatas))
+	for txHash, data := range calldatas {
+		decoded, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+		if err != nil {
+			panic(fmt.Sprintf("calldata of %s: %s", txHash, err))
+		}
+		calldata[common.HexToHash(txHash)] = decoded
+	}
+
+	if err := syncer.ImportL1Sequences("l1Archive.jsonl", common.HexToAddress(cfg.AddressRollup), sequences, calldata); err != nil {
+		panic(err)
+	}
+	fmt.Println("Imported", len(sequences), "sequences and", len(calldata), "transactions to l1Archive.jsonl")
+}
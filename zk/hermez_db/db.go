@@ -45,6 +45,7 @@ const BATCH_BLOCKS = "batch_blocks"                                     // batch
 const SMT_DEPTHS = "smt_depths"                                         // block number -> smt depth
 const L1_INFO_LEAVES = "l1_info_leaves"                                 // l1 info tree index -> l1 info tree leaf
 const L1_INFO_ROOTS = "l1_info_roots"                                   // root hash -> l1 info tree index
+const L1_INFO_ROOTS_BY_INDEX = "l1_info_roots_by_index"                 // l1 info tree index -> root hash
 const INVALID_BATCHES = "invalid_batches"                               // batch number -> true
 const ROllUP_TYPES_FORKS = "rollup_types_forks"                         // rollup type id -> fork id
 const FORK_HISTORY = "fork_history"                                     // index -> fork id + last verified batch
@@ -53,6 +54,9 @@ const PLAIN_STATE_VERSION = "plain_state_version"                       // batch
 const ERIGON_VERSIONS = "erigon_versions"                               // erigon version -> timestamp of startup
 const BATCH_ENDS = "batch_ends"                                         //
 const BAD_TX_HASHES = "bad_tx_hashes"                                   // tx hash -> integer counter
+const L1_BATCH_INFO_BLOCK_HASHES = "hermez_l1BatchInfoBlockHashes"      // l1blockno -> l1 block hash for l1 sequences and verifications
+const L1_INFO_TREE_BLOCK_HASHES = "l1_info_tree_block_hashes"           // l1blockno -> l1 block hash for l1 info tree updates
+const PENDING_VERIFICATIONS = "hermez_pendingVerifications"             // last l2blockno of the request -> encoded verifier request
 
 var HermezDbTables = []string{
 	L1VERIFICATIONS,
@@ -82,6 +86,7 @@ var HermezDbTables = []string{
 	SMT_DEPTHS,
 	L1_INFO_LEAVES,
 	L1_INFO_ROOTS,
+	L1_INFO_ROOTS_BY_INDEX,
 	INVALID_BATCHES,
 	ROllUP_TYPES_FORKS,
 	FORK_HISTORY,
@@ -90,6 +95,9 @@ var HermezDbTables = []string{
 	ERIGON_VERSIONS,
 	BATCH_ENDS,
 	BAD_TX_HASHES,
+	L1_BATCH_INFO_BLOCK_HASHES,
+	L1_INFO_TREE_BLOCK_HASHES,
+	PENDING_VERIFICATIONS,
 }
 
 type HermezDb struct {
@@ -673,6 +681,75 @@ func (db *HermezDb) TruncateVerifications(l2BlockNo uint64) error {
 	return nil
 }
 
+func (db *HermezDb) WriteL1BatchInfoBlockHash(l1BlockNo uint64, l1BlockHash common.Hash) error {
+	return db.tx.Put(L1_BATCH_INFO_BLOCK_HASHES, Uint64ToBytes(l1BlockNo), l1BlockHash.Bytes())
+}
+
+// GetL1BatchInfoBlockHashBelow returns the highest L1 block below l1BlockNo that holds a sequence or verification,
+// along with the hash it had when the entry was written.  A zero block number means there is no such block
+func (db *HermezDbReader) GetL1BatchInfoBlockHashBelow(l1BlockNo uint64) (uint64, common.Hash, error) {
+	return db.getL1BlockHashBelow(L1_BATCH_INFO_BLOCK_HASHES, l1BlockNo)
+}
+
+// UnwindL1BatchInfo deletes the sequences and verifications written from the given L1 block onwards
+func (db *HermezDb) UnwindL1BatchInfo(fromL1BlockNo uint64) error {
+	for _, table := range []string{L1SEQUENCES, L1VERIFICATIONS, L1_BATCH_INFO_BLOCK_HASHES} {
+		if err := db.deleteFromUintKey(table, fromL1BlockNo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *HermezDbReader) getL1BlockHashBelow(table string, l1BlockNo uint64) (uint64, common.Hash, error) {
+	c, err := db.tx.Cursor(table)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	defer c.Close()
+
+	k, _, err := c.Seek(Uint64ToBytes(l1BlockNo))
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+
+	var v []byte
+	if k == nil {
+		k, v, err = c.Last()
+	} else {
+		k, v, err = c.Prev()
+	}
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	if k == nil {
+		return 0, common.Hash{}, nil
+	}
+
+	return BytesToUint64(k), common.BytesToHash(v), nil
+}
+
+// deleteFromUintKey deletes every entry in a table keyed by a big endian number, alone or followed by more key data,
+// from the given number onwards
+func (db *HermezDb) deleteFromUintKey(table string, from uint64) error {
+	c, err := db.tx.RwCursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, _, err := c.Seek(Uint64ToBytes(from)); k != nil; k, _, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (db *HermezDb) WriteBlockBatch(l2BlockNo, batchNo uint64) error {
 	// first store the block -> batch record
 	err := db.tx.Put(BLOCKBATCHES, Uint64ToBytes(l2BlockNo), Uint64ToBytes(batchNo))
@@ -1150,6 +1227,16 @@ func (db *HermezDbReader) GetEffectiveGasPricePercentage(txHash common.Hash) (ui
 	return BytesToUint8(data), nil
 }
 
+// CheckEffectiveGasPricePercentage is GetEffectiveGasPricePercentage telling whether a percentage was stored at all
+func (db *HermezDbReader) CheckEffectiveGasPricePercentage(txHash common.Hash) (uint8, bool, error) {
+	data, err := db.tx.GetOne(TX_PRICE_PERCENTAGE, txHash.Bytes())
+	if err != nil || data == nil {
+		return 0, false, err
+	}
+
+	return BytesToUint8(data), true, nil
+}
+
 func (db *HermezDb) DeleteEffectiveGasPricePercentages(txHashes *[]common.Hash) error {
 	for _, txHash := range *txHashes {
 		err := db.tx.Delete(TX_PRICE_PERCENTAGE, txHash.Bytes())
@@ -1515,6 +1602,15 @@ func (db *HermezDbReader) GetLatestUsedGer() (uint64, common.Hash, error) {
 	return batchNo, ger, nil
 }
 
+// GetBlockLatestUsedGer returns the GER the block started using, false when it didn't start using a new one
+func (db *HermezDbReader) GetBlockLatestUsedGer(blockNo uint64) (common.Hash, bool, error) {
+	v, err := db.tx.GetOne(LATEST_USED_GER, Uint64ToBytes(blockNo))
+	if err != nil {
+		return common.Hash{}, false, err
+	}
+	return common.BytesToHash(v), len(v) > 0, nil
+}
+
 func (db *HermezDb) DeleteLatestUsedGers(fromBlockNum, toBlockNum uint64) error {
 	return db.deleteFromBucketWithUintKeysRange(LATEST_USED_GER, fromBlockNum, toBlockNum)
 }
@@ -1608,7 +1704,10 @@ func (db *HermezDbReader) GetAllL1InfoTreeLeaves() ([]common.Hash, error) {
 }
 
 func (db *HermezDb) WriteL1InfoTreeRoot(hash common.Hash, index uint64) error {
-	return db.tx.Put(L1_INFO_ROOTS, hash.Bytes(), Uint64ToBytes(index))
+	if err := db.tx.Put(L1_INFO_ROOTS, hash.Bytes(), Uint64ToBytes(index)); err != nil {
+		return err
+	}
+	return db.tx.Put(L1_INFO_ROOTS_BY_INDEX, Uint64ToBytes(index), hash.Bytes())
 }
 
 func (db *HermezDb) GetL1InfoTreeIndexByRoot(hash common.Hash) (uint64, bool, error) {
@@ -1639,6 +1738,116 @@ func (db *HermezDbReader) GetL1InfoTreeIndexToRoots() (map[uint64]common.Hash, e
 	return indexToRoot, nil
 }
 
+func (db *HermezDb) WriteL1InfoTreeBlockHash(l1BlockNo uint64, l1BlockHash common.Hash) error {
+	return db.tx.Put(L1_INFO_TREE_BLOCK_HASHES, Uint64ToBytes(l1BlockNo), l1BlockHash.Bytes())
+}
+
+// GetL1InfoTreeBlockHashBelow returns the highest L1 block below l1BlockNo that holds an info tree update, along with
+// the hash it had when the update was written.  A zero block number means there is no such block
+func (db *HermezDbReader) GetL1InfoTreeBlockHashBelow(l1BlockNo uint64) (uint64, common.Hash, error) {
+	return db.getL1BlockHashBelow(L1_INFO_TREE_BLOCK_HASHES, l1BlockNo)
+}
+
+// UnwindL1InfoTreeUpdates deletes the info tree updates, leaves and roots that came from the given L1 block onwards.
+// Updates are indexed in L1 order so this always removes a tail of the tree
+func (db *HermezDb) UnwindL1InfoTreeUpdates(fromL1BlockNo uint64) error {
+	var firstRemovedIndex *uint64
+	removed := 0
+	for {
+		latest, err := db.GetLatestL1InfoTreeUpdate()
+		if err != nil {
+			return err
+		}
+		if latest == nil || latest.BlockNumber < fromL1BlockNo {
+			break
+		}
+
+		idx := Uint64ToBytes(latest.Index)
+		if err = db.tx.Delete(L1_INFO_TREE_UPDATES, idx); err != nil {
+			return err
+		}
+		if err = db.tx.Delete(L1_INFO_LEAVES, idx); err != nil {
+			return err
+		}
+
+		// the same GER can be seen again later on so only drop the mapping if it points at this update
+		byGer, err := db.GetL1InfoTreeUpdateByGer(latest.GER)
+		if err != nil {
+			return err
+		}
+		if byGer != nil && byGer.Index == latest.Index {
+			if err = db.tx.Delete(L1_INFO_TREE_UPDATES_BY_GER, latest.GER.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		index := latest.Index
+		firstRemovedIndex = &index
+		removed++
+	}
+
+	if firstRemovedIndex != nil {
+		if err := db.deleteL1InfoTreeRootsFrom(*firstRemovedIndex, removed); err != nil {
+			return err
+		}
+	}
+
+	return db.deleteFromUintKey(L1_INFO_TREE_BLOCK_HASHES, fromL1BlockNo)
+}
+
+// deleteL1InfoTreeRootsFrom deletes the roots of the info tree from the given index onwards, expecting count of them
+func (db *HermezDb) deleteL1InfoTreeRootsFrom(index uint64, count int) error {
+	c, err := db.tx.RwCursor(L1_INFO_ROOTS_BY_INDEX)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	found := 0
+	for k, v, err := c.Seek(Uint64ToBytes(index)); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		// a root seen again later on keeps the index it was last written with
+		current, ok, err := db.GetL1InfoTreeIndexByRoot(common.BytesToHash(v))
+		if err != nil {
+			return err
+		}
+		if ok && current == BytesToUint64(k) {
+			if err = db.tx.Delete(L1_INFO_ROOTS, v); err != nil {
+				return err
+			}
+		}
+		if err = c.DeleteCurrent(); err != nil {
+			return err
+		}
+		found++
+	}
+	if found >= count {
+		return nil
+	}
+
+	// roots written before they were indexed can only be found by going through all of them
+	rc, err := db.tx.RwCursor(L1_INFO_ROOTS)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	for k, v, err := rc.First(); k != nil; k, v, err = rc.Next() {
+		if err != nil {
+			return err
+		}
+		if BytesToUint64(v) >= index {
+			if err = rc.DeleteCurrent(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func (db *HermezDbReader) GetForkIdByBlockNum(blockNum uint64) (uint64, error) {
 	blockbatch, err := db.GetBatchNoByL2Block(blockNum)
 	if err != nil {
@@ -1904,3 +2113,28 @@ func (db *HermezDbReader) GetBadTxHashCounter(txHash common.Hash) (uint64, error
 	}
 	return BytesToUint64(v), nil
 }
+
+// WritePendingVerification stores a verification request that the executor hasn't answered yet, keyed by the last
+// block it covers so that it can be resumed after a restart
+func (db *HermezDb) WritePendingVerification(lastBlockNo uint64, request []byte) error {
+	return db.tx.Put(PENDING_VERIFICATIONS, Uint64ToBytes(lastBlockNo), request)
+}
+
+// GetPendingVerifications returns the stored verification requests ordered by the last block they cover
+func (db *HermezDbReader) GetPendingVerifications() ([][]byte, error) {
+	var requests [][]byte
+	err := db.tx.ForEach(PENDING_VERIFICATIONS, nil, func(_, v []byte) error {
+		requests = append(requests, common.CopyBytes(v))
+		return nil
+	})
+	return requests, err
+}
+
+func (db *HermezDb) DeletePendingVerification(lastBlockNo uint64) error {
+	return db.tx.Delete(PENDING_VERIFICATIONS, Uint64ToBytes(lastBlockNo))
+}
+
+// DeletePendingVerificationsFrom deletes the verification requests covering blocks from the given block onwards
+func (db *HermezDb) DeletePendingVerificationsFrom(fromBlockNo uint64) error {
+	return db.deleteFromUintKey(PENDING_VERIFICATIONS, fromBlockNo)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/big"
 	"testing"
 
 	"github.com/ledgerwatch/erigon-lib/common"
@@ -11,6 +12,8 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/erigon/zk/types"
 )
 
 type IHermezDb interface {
@@ -352,6 +355,128 @@ func TestTruncateVerifications(t *testing.T) {
 	assert.Equal(t, uint64(500), batchNo)
 }
 
+func TestUnwindL1BatchInfo(t *testing.T) {
+	tx, cleanup := GetDbTx()
+	defer cleanup()
+
+	db := NewHermezDb(tx)
+
+	for i := uint64(1); i <= 10; i++ {
+		require.NoError(t, db.WriteSequence(i*10, i, common.HexToHash("0xabc"), common.HexToHash("0xabc"), common.Hash{}))
+		require.NoError(t, db.WriteVerification(i*10+1, i, common.HexToHash("0xdef"), common.HexToHash("0xdef")))
+		require.NoError(t, db.WriteL1BatchInfoBlockHash(i*10, common.BigToHash(new(big.Int).SetUint64(i*10))))
+		require.NoError(t, db.WriteL1BatchInfoBlockHash(i*10+1, common.BigToHash(new(big.Int).SetUint64(i*10+1))))
+	}
+
+	blockNo, hash, err := db.GetL1BatchInfoBlockHashBelow(math.MaxUint64)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(101), blockNo)
+	assert.Equal(t, common.BigToHash(big.NewInt(101)), hash)
+
+	blockNo, _, err = db.GetL1BatchInfoBlockHashBelow(60)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(51), blockNo)
+
+	require.NoError(t, db.UnwindL1BatchInfo(60))
+
+	seq, err := db.GetLatestSequence()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), seq.BatchNo)
+	ver, err := db.GetLatestVerification()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), ver.BatchNo)
+
+	blockNo, _, err = db.GetL1BatchInfoBlockHashBelow(math.MaxUint64)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(51), blockNo)
+
+	blockNo, _, err = db.GetL1BatchInfoBlockHashBelow(10)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), blockNo)
+}
+
+func TestUnwindL1InfoTreeUpdates(t *testing.T) {
+	tx, cleanup := GetDbTx()
+	defer cleanup()
+
+	db := NewHermezDb(tx)
+
+	for i := uint64(0); i < 5; i++ {
+		update := &types.L1InfoTreeUpdate{
+			Index:       i,
+			GER:         common.BigToHash(new(big.Int).SetUint64(i + 1)),
+			BlockNumber: 100 + i,
+		}
+		require.NoError(t, db.WriteL1InfoTreeUpdate(update))
+		require.NoError(t, db.WriteL1InfoTreeUpdateToGer(update))
+		require.NoError(t, db.WriteL1InfoTreeLeaf(i, common.BigToHash(new(big.Int).SetUint64(i+10))))
+		require.NoError(t, db.WriteL1InfoTreeRoot(common.BigToHash(new(big.Int).SetUint64(i+20)), i))
+		require.NoError(t, db.WriteL1InfoTreeBlockHash(100+i, common.BigToHash(new(big.Int).SetUint64(100+i))))
+	}
+
+	require.NoError(t, db.UnwindL1InfoTreeUpdates(103))
+
+	latest, err := db.GetLatestL1InfoTreeUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), latest.Index)
+
+	leaves, err := db.GetAllL1InfoTreeLeaves()
+	require.NoError(t, err)
+	assert.Len(t, leaves, 3)
+
+	roots, err := db.GetL1InfoTreeIndexToRoots()
+	require.NoError(t, err)
+	assert.Len(t, roots, 3)
+
+	byGer, err := db.GetL1InfoTreeUpdateByGer(common.BigToHash(big.NewInt(4)))
+	require.NoError(t, err)
+	assert.Nil(t, byGer)
+	byGer, err = db.GetL1InfoTreeUpdateByGer(common.BigToHash(big.NewInt(3)))
+	require.NoError(t, err)
+	assert.NotNil(t, byGer)
+
+	blockNo, _, err := db.GetL1InfoTreeBlockHashBelow(math.MaxUint64)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(102), blockNo)
+}
+
+func TestUnwindL1InfoTreeUpdatesUnindexedRoots(t *testing.T) {
+	tx, cleanup := GetDbTx()
+	defer cleanup()
+
+	db := NewHermezDb(tx)
+
+	for i := uint64(0); i < 5; i++ {
+		update := &types.L1InfoTreeUpdate{
+			Index:       i,
+			GER:         common.BigToHash(new(big.Int).SetUint64(i + 1)),
+			BlockNumber: 100 + i,
+		}
+		require.NoError(t, db.WriteL1InfoTreeUpdate(update))
+		require.NoError(t, db.WriteL1InfoTreeRoot(common.BigToHash(new(big.Int).SetUint64(i+20)), i))
+	}
+	// roots written before they were indexed by the info tree index
+	for i := uint64(3); i < 5; i++ {
+		require.NoError(t, tx.Delete(L1_INFO_ROOTS_BY_INDEX, Uint64ToBytes(i)))
+	}
+
+	require.NoError(t, db.UnwindL1InfoTreeUpdates(102))
+
+	roots, err := db.GetL1InfoTreeIndexToRoots()
+	require.NoError(t, err)
+	assert.Len(t, roots, 2)
+	_, ok, err := db.GetL1InfoTreeIndexByRoot(common.BigToHash(big.NewInt(24)))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	left := 0
+	require.NoError(t, tx.ForEach(L1_INFO_ROOTS_BY_INDEX, nil, func(k, v []byte) error {
+		left++
+		return nil
+	}))
+	assert.Equal(t, 2, left)
+}
+
 func TestTruncateBlockBatches(t *testing.T) {
 	tx, cleanup := GetDbTx()
 	defer cleanup()
@@ -622,3 +747,25 @@ func TestDeleteForkId(t *testing.T) {
 		})
 	}
 }
+
+func TestPendingVerifications(t *testing.T) {
+	tx, cleanup := GetDbTx()
+	defer cleanup()
+
+	db := NewHermezDb(tx)
+
+	for _, blockNo := range []uint64{12, 10, 11, 13} {
+		require.NoError(t, db.WritePendingVerification(blockNo, []byte(fmt.Sprintf("request-%d", blockNo))))
+	}
+
+	requests, err := db.GetPendingVerifications()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("request-10"), []byte("request-11"), []byte("request-12"), []byte("request-13")}, requests)
+
+	require.NoError(t, db.DeletePendingVerification(10))
+	require.NoError(t, db.DeletePendingVerificationsFrom(12))
+
+	requests, err = db.GetPendingVerifications()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("request-11")}, requests)
+}
@@ -3,44 +3,137 @@ package l1_cache
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"errors"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/metrics"
 	"github.com/ledgerwatch/log/v3"
 )
 
 const (
-	bucketName   = "Cache"
-	expiryBucket = "Expiry"
+	bucketName        = "Cache"
+	expiryBucket      = "Expiry"
+	accessBucket      = "Access"
+	unfinalizedBucket = "Unfinalized"
 )
 
 // methods we don't cache
 var methodsToIgnore = map[string]struct{}{}
 
-// methods we configure expiry for
-var methodsToExpire = map[string]time.Duration{
-	//"eth_getBlockByNumber": 1 * time.Minute, // example here but currently we don't want any methods to expire
-}
-
 // params that trigger expiration
 var paramsToExpire = map[string]struct{}{
 	"latest":    {},
 	"finalized": {},
+	"safe":      {},
+	"pending":   {},
+}
+
+// methods whose responses depend on the L1 block they refer to still being canonical
+var reorgSensitiveMethods = map[string]struct{}{
+	"eth_getLogs":          {},
+	"eth_getBlockByNumber": {},
+}
+
+var (
+	cacheSizeGauge       = metrics.GetOrCreateGauge(`l1_cache_size_bytes`)
+	cacheEvictionCounter = metrics.GetOrCreateCounter(`l1_cache_evictions`)
+	cacheReorgCounter    = metrics.GetOrCreateCounter(`l1_cache_reorgs`)
+)
+
+// the methods counted on their own in the hit and miss metrics, the method comes from the client so anything else is
+// counted as other to keep the labels valid and their number bounded
+var meteredMethods = []string{
+	"eth_blockNumber",
+	"eth_call",
+	"eth_chainId",
+	"eth_getBalance",
+	"eth_getBlockByHash",
+	"eth_getBlockByNumber",
+	"eth_getCode",
+	"eth_getLogs",
+	"eth_getStorageAt",
+	"eth_getTransactionByHash",
+	"eth_getTransactionReceipt",
+	"other",
+}
+
+var (
+	hitCounters  = methodCounters(`l1_cache_hits`)
+	missCounters = methodCounters(`l1_cache_misses`)
+)
+
+func methodCounters(name string) map[string]metrics.Counter {
+	counters := make(map[string]metrics.Counter, len(meteredMethods))
+	for _, method := range meteredMethods {
+		counters[method] = metrics.GetOrCreateCounter(fmt.Sprintf(`%s{method="%s"}`, name, method))
+	}
+	return counters
+}
+
+func methodCounter(counters map[string]metrics.Counter, method string) metrics.Counter {
+	if counter, ok := counters[method]; ok {
+		return counter
+	}
+	return counters["other"]
+}
+
+func hitCounter(method string) metrics.Counter {
+	return methodCounter(hitCounters, method)
+}
+
+func missCounter(method string) metrics.Counter {
+	return methodCounter(missCounters, method)
+}
+
+type Config struct {
+	Port uint
+	// MethodTTLs sets how long responses for a method are kept, methods not listed never expire
+	MethodTTLs map[string]time.Duration
+	// TagTTL is used for requests referring to a block tag such as latest or finalized
+	TagTTL time.Duration
+	// UnfinalizedTTL is used for reorg sensitive responses about blocks above the finalized L1 block
+	UnfinalizedTTL time.Duration
+	// MaxSize is the size the cache is trimmed to by evicting the least recently used entries, 0 means unlimited
+	MaxSize datasize.ByteSize
+	// MaintenanceInterval is how often the finalized block is checked and the eviction pass is run
+	MaintenanceInterval time.Duration
 }
 
 type L1Cache struct {
 	server *http.Server
 	db     kv.RwDB
+	cfg    Config
+
+	chainsLock sync.Mutex
+	chains     map[string]*chainState
+
+	// access times of the hits since the last maintenance pass, written with it so hits only need a read transaction
+	accessLock sync.Mutex
+	accessed   map[string]uint64
+}
+
+// chainState tracks the finality of an L1 chain as seen through one of the endpoints it was requested from
+type chainState struct {
+	endpoint   string
+	finalized  uint64
+	headNumber uint64
+	headHash   string
 }
 
-func NewL1Cache(ctx context.Context, dbPath string, port uint) (*L1Cache, error) {
+func NewL1Cache(ctx context.Context, dbPath string, cfg Config) (*L1Cache, error) {
 	db := mdbx.NewMDBX(log.New()).Path(dbPath).MustOpen()
 
 	tx, err := db.BeginRw(ctx)
@@ -49,49 +142,61 @@ func NewL1Cache(ctx context.Context, dbPath string, port uint) (*L1Cache, error)
 	}
 	defer tx.Rollback()
 
-	if err := tx.CreateBucket(bucketName); err != nil {
-		return nil, err
-	}
-	if err := tx.CreateBucket(expiryBucket); err != nil {
-		return nil, err
+	for _, bucket := range []string{bucketName, expiryBucket, accessBucket, unfinalizedBucket} {
+		if err := tx.CreateBucket(bucket); err != nil {
+			return nil, err
+		}
 	}
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	http.HandleFunc("/", handleRequest(db))
-	addr := fmt.Sprintf(":%d", port)
-	server := &http.Server{
+	if cfg.MaintenanceInterval == 0 {
+		cfg.MaintenanceInterval = time.Minute
+	}
+
+	cache := &L1Cache{
+		db:       db,
+		cfg:      cfg,
+		chains:   make(map[string]*chainState),
+		accessed: make(map[string]uint64),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", cache.handleRequest)
+	addr := fmt.Sprintf(":%d", cfg.Port)
+	cache.server = &http.Server{
 		Addr:           addr,
-		Handler:        nil,
+		Handler:        mux,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
 
 	go func() {
-		log.Info("Starting L1 Cache Server on port:", "port", port)
-		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Info("Starting L1 Cache Server on port:", "port", cfg.Port)
+		if err := cache.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 			log.Error("L1 Cache Server stopped", "error", err)
 		}
 	}()
 
+	go cache.runMaintenance(ctx)
+
 	go func() {
 		<-ctx.Done()
 		log.Info("Shutting down L1 Cache Server...")
-		if err := server.Shutdown(context.Background()); err != nil {
+		if err := cache.server.Shutdown(context.Background()); err != nil {
 			log.Error("Failed to shutdown L1 Cache Server", "error", err)
 		}
 		db.Close()
 	}()
 
-	return &L1Cache{
-		server: server,
-		db:     db,
-	}, nil
+	return cache, nil
 }
 
-func fetchFromCache(tx kv.RwTx, key string) ([]byte, bool) {
+// fetchFromCache returns the cached response, expired entries are left for the maintenance pass to evict and are
+// overwritten by the fresh response in the meantime
+func fetchFromCache(tx kv.Tx, key string) ([]byte, bool) {
 	data, err := tx.GetOne(bucketName, []byte(key))
 	if err != nil || data == nil {
 		return nil, false
@@ -101,8 +206,6 @@ func fetchFromCache(tx kv.RwTx, key string) ([]byte, bool) {
 	if err == nil && expiry != nil {
 		expiryTime, err := time.Parse(time.RFC3339, string(expiry))
 		if err == nil && time.Now().After(expiryTime) {
-			// Cache entry has expired
-			evictFromCache(tx, key)
 			return nil, false
 		}
 	}
@@ -111,8 +214,6 @@ func fetchFromCache(tx kv.RwTx, key string) ([]byte, bool) {
 	var jsonResponse map[string]interface{}
 	if err := json.Unmarshal(data, &jsonResponse); err == nil {
 		if _, hasError := jsonResponse["error"]; hasError {
-			// Cache entry is an error, evict it
-			evictFromCache(tx, key)
 			return nil, false
 		}
 	}
@@ -120,13 +221,52 @@ func fetchFromCache(tx kv.RwTx, key string) ([]byte, bool) {
 	return data, true
 }
 
-func evictFromCache(tx kv.RwTx, key string) {
-	if err := tx.Delete(bucketName, []byte(key)); err != nil {
-		log.Warn("Failed to evict from cache", "error", err)
+func touch(tx kv.RwTx, key string) error {
+	return putAccessed(tx, key, uint64(time.Now().UnixNano()))
+}
+
+func putAccessed(tx kv.RwTx, key string, accessedAt uint64) error {
+	accessed := make([]byte, 8)
+	binary.BigEndian.PutUint64(accessed, accessedAt)
+	return tx.Put(accessBucket, []byte(key), accessed)
+}
+
+// recordAccess keeps the access time of a hit until the next maintenance pass writes it
+func (c *L1Cache) recordAccess(key string) {
+	c.accessLock.Lock()
+	c.accessed[key] = uint64(time.Now().UnixNano())
+	c.accessLock.Unlock()
+}
+
+// flushAccessTimes writes the access times recorded since the last pass, skipping entries evicted in the meantime
+func (c *L1Cache) flushAccessTimes(tx kv.RwTx) error {
+	c.accessLock.Lock()
+	accessed := c.accessed
+	c.accessed = make(map[string]uint64, len(accessed))
+	c.accessLock.Unlock()
+
+	for key, accessedAt := range accessed {
+		has, err := tx.Has(bucketName, []byte(key))
+		if err != nil {
+			return err
+		}
+		if !has {
+			continue
+		}
+		if err = putAccessed(tx, key, accessedAt); err != nil {
+			return err
+		}
 	}
-	if err := tx.Delete(expiryBucket, []byte(key)); err != nil {
-		log.Warn("Failed to evict from cache", "error", err)
+	return nil
+}
+
+func evictFromCache(tx kv.RwTx, key string) {
+	for _, bucket := range []string{bucketName, expiryBucket, accessBucket, unfinalizedBucket} {
+		if err := tx.Delete(bucket, []byte(key)); err != nil {
+			log.Warn("Failed to evict from cache", "error", err)
+		}
 	}
+	cacheEvictionCounter.Inc()
 }
 
 func saveToCache(tx kv.RwTx, key string, response []byte, duration time.Duration) error {
@@ -139,8 +279,10 @@ func saveToCache(tx kv.RwTx, key string, response []byte, duration time.Duration
 		if err := tx.Put(expiryBucket, []byte(key), []byte(expiryTime)); err != nil {
 			return err
 		}
+	} else if err := tx.Delete(expiryBucket, []byte(key)); err != nil {
+		return err
 	}
-	return nil
+	return touch(tx, key)
 }
 
 func generateCacheKey(chainID string, body []byte) (string, error) {
@@ -157,113 +299,749 @@ func generateCacheKey(chainID string, body []byte) (string, error) {
 	return fmt.Sprintf("%s_%s", chainID, modifiedBody), nil
 }
 
-func handleRequest(db kv.RwDB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		endpoint := r.URL.Query().Get("endpoint")
-		chainID := r.URL.Query().Get("chainid")
-		if endpoint == "" || chainID == "" {
-			http.Error(w, "Missing endpoint or chainid parameter", http.StatusBadRequest)
+// minDuration returns the shorter of two durations where 0 means no expiry
+func minDuration(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// cachePolicy works out how long a response can be cached for and, for reorg sensitive methods, which L1
+// block it depends on.  A block of 0 means the response doesn't depend on a specific block
+func (c *L1Cache) cachePolicy(chainID, method string, params []interface{}, response []byte) (time.Duration, uint64) {
+	duration := c.cfg.MethodTTLs[method]
+
+	for _, param := range params {
+		if tag, ok := param.(string); ok {
+			if _, shouldExpire := paramsToExpire[tag]; shouldExpire {
+				return minDuration(duration, c.cfg.TagTTL), 0
+			}
+		}
+	}
+
+	if _, sensitive := reorgSensitiveMethods[method]; !sensitive {
+		return duration, 0
+	}
+
+	block, ok := referencedBlock(method, params, response)
+	if !ok {
+		// we can't tell which block this is about so treat it like a tag
+		return minDuration(duration, c.cfg.TagTTL), 0
+	}
+
+	c.chainsLock.Lock()
+	chain, known := c.chains[chainID]
+	finalized := uint64(0)
+	if known {
+		finalized = chain.finalized
+	}
+	c.chainsLock.Unlock()
+
+	if block > finalized {
+		return minDuration(duration, c.cfg.UnfinalizedTTL), block
+	}
+	return duration, 0
+}
+
+// referencedBlock finds the highest L1 block a reorg sensitive request depends on
+func referencedBlock(method string, params []interface{}, response []byte) (uint64, bool) {
+	switch method {
+	case "eth_getBlockByNumber":
+		if len(params) == 0 {
+			return 0, false
+		}
+		number, ok := params[0].(string)
+		if !ok {
+			return 0, false
+		}
+		return parseHexUint(number)
+	case "eth_getLogs":
+		if len(params) == 0 {
+			return 0, false
+		}
+		filter, ok := params[0].(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		if toBlock, ok := filter["toBlock"].(string); ok {
+			return parseHexUint(toBlock)
+		}
+		// a block hash filter, so fall back on the blocks of the logs returned
+		var logsResponse struct {
+			Result []struct {
+				BlockNumber string `json:"blockNumber"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(response, &logsResponse); err != nil || len(logsResponse.Result) == 0 {
+			return 0, false
+		}
+		var highest uint64
+		for _, l := range logsResponse.Result {
+			number, ok := parseHexUint(l.BlockNumber)
+			if !ok {
+				return 0, false
+			}
+			if number > highest {
+				highest = number
+			}
+		}
+		return highest, true
+	}
+	return 0, false
+}
+
+func parseHexUint(s string) (uint64, bool) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, false
+	}
+	number, err := strconv.ParseUint(s[2:], 16, 64)
+	return number, err == nil
+}
+
+func (c *L1Cache) trackChain(chainID, endpoint string) {
+	c.chainsLock.Lock()
+	defer c.chainsLock.Unlock()
+	if chain, ok := c.chains[chainID]; ok {
+		chain.endpoint = endpoint
+		return
+	}
+	c.chains[chainID] = &chainState{endpoint: endpoint}
+}
+
+// rpcCall is a single JSON-RPC call, either the whole request body or one element of a batch
+type rpcCall struct {
+	raw    json.RawMessage
+	id     json.RawMessage
+	method string
+	params []interface{}
+	key    string
+}
+
+func parseCall(chainID string, raw json.RawMessage) (*rpcCall, error) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return nil, err
+	}
+
+	method, ok := request["method"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid JSON-RPC method")
+	}
+	params, _ := request["params"].([]interface{})
+
+	var envelope struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, err
+	}
+
+	key, err := generateCacheKey(chainID, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpcCall{raw: raw, id: envelope.ID, method: method, params: params, key: key}, nil
+}
+
+func (c *rpcCall) cacheable() bool {
+	_, ignore := methodsToIgnore[c.method]
+	return !ignore
+}
+
+// withID replaces the id of a cached response with the id of the request it is now answering
+func withID(response []byte, id json.RawMessage) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(response, &fields); err != nil {
+		return nil, err
+	}
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	fields["id"] = id
+	return json.Marshal(fields)
+}
+
+// errorResponse answers a call of a batch the upstream response has nothing for
+func errorResponse(id json.RawMessage, message string) json.RawMessage {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	response, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   map[string]interface{}{"code": -32603, "message": message},
+	})
+	return response
+}
+
+func isBatch(body []byte) bool {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+func (c *L1Cache) handleRequest(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Query().Get("endpoint")
+	chainID := r.URL.Query().Get("chainid")
+	if endpoint == "" || chainID == "" {
+		http.Error(w, "Missing endpoint or chainid parameter", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	c.trackChain(chainID, endpoint)
+
+	if isBatch(body) {
+		c.handleBatch(r.Context(), w, endpoint, chainID, body)
+		return
+	}
+
+	call, err := parseCall(chainID, body)
+	if err != nil {
+		http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	cached, err := c.lookup(r.Context(), []*rpcCall{call})
+	if err != nil {
+		http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+		return
+	}
+	if cachedResponse, found := cached[0]; found {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache-Status", "HIT")
+		w.Write(cachedResponse)
+		return
+	}
+
+	statusCode, responseBody, err := forward(r.Context(), endpoint, body)
+	if err != nil {
+		http.Error(w, "Failed to fetch from upstream", http.StatusInternalServerError)
+		return
+	}
+
+	if statusCode == http.StatusOK {
+		if err := c.storeResponse(r.Context(), chainID, call, responseBody); err != nil {
+			http.Error(w, "Failed to save to cache", http.StatusInternalServerError)
 			return
 		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache-Status", "MISS")
+	w.Write(responseBody)
+}
+
+// handleBatch serves the cached elements of a batch locally, forwards the rest upstream as a smaller batch and
+// puts the responses back together in the order of the original request
+func (c *L1Cache) handleBatch(ctx context.Context, w http.ResponseWriter, endpoint, chainID string, body []byte) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(body, &elements); err != nil || len(elements) == 0 {
+		http.Error(w, "Invalid JSON-RPC batch request", http.StatusBadRequest)
+		return
+	}
 
-		body, err := io.ReadAll(r.Body)
+	calls := make([]*rpcCall, len(elements))
+	responses := make([]json.RawMessage, len(elements))
+	for idx, element := range elements {
+		call, err := parseCall(chainID, element)
 		if err != nil {
-			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-			return
+			responses[idx] = json.RawMessage(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}}`)
+			continue
 		}
-		defer r.Body.Close()
+		calls[idx] = call
+	}
+
+	cached, err := c.lookup(ctx, calls)
+	if err != nil {
+		http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
+		return
+	}
 
-		var request map[string]interface{}
-		if err := json.Unmarshal(body, &request); err != nil {
-			http.Error(w, "Invalid JSON-RPC request", http.StatusBadRequest)
+	// the ids come from the client and can repeat, so the calls go upstream with ids of our own to match the responses
+	// back to the right call, notifications keep having none
+	var misses []*rpcCall
+	var missesBody []json.RawMessage
+	upstreamIDs := make(map[int]string)
+	for idx, call := range calls {
+		if call == nil {
+			continue
+		}
+		if response, found := cached[idx]; found {
+			responses[idx] = response
+			continue
+		}
+		misses = append(misses, call)
+		if len(call.id) == 0 {
+			missesBody = append(missesBody, call.raw)
+			continue
+		}
+		upstreamID := json.RawMessage(strconv.Itoa(len(missesBody)))
+		raw, err := withID(call.raw, upstreamID)
+		if err != nil {
+			http.Error(w, "Failed to build upstream request", http.StatusInternalServerError)
 			return
 		}
+		upstreamIDs[idx] = string(upstreamID)
+		missesBody = append(missesBody, raw)
+	}
 
-		method, ok := request["method"].(string)
-		if !ok {
-			http.Error(w, "Invalid JSON-RPC method", http.StatusBadRequest)
-			return
+	status := "HIT"
+	if len(misses) > 0 {
+		status = "PARTIAL"
+		if len(misses) == len(elements) {
+			status = "MISS"
 		}
 
-		cacheKey, err := generateCacheKey(chainID, body)
+		upstreamBody, err := json.Marshal(missesBody)
 		if err != nil {
-			http.Error(w, "Failed to generate cache key", http.StatusInternalServerError)
+			http.Error(w, "Failed to build upstream request", http.StatusInternalServerError)
+			return
+		}
+		statusCode, responseBody, err := forward(ctx, endpoint, upstreamBody)
+		if err != nil {
+			http.Error(w, "Failed to fetch from upstream", http.StatusInternalServerError)
+			return
+		}
+		if statusCode != http.StatusOK {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(statusCode)
+			w.Write(responseBody)
 			return
 		}
 
-		if _, ignore := methodsToIgnore[method]; !ignore {
-			tx, err := db.BeginRw(r.Context())
-			if err != nil {
-				http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
-				return
+		var upstreamResponses []json.RawMessage
+		if err := json.Unmarshal(responseBody, &upstreamResponses); err != nil {
+			log.Warn("Failed to parse upstream batch response", "error", err)
+			http.Error(w, "Invalid upstream batch response", http.StatusBadGateway)
+			return
+		}
+
+		// responses to a batch can come back in any order so match them up by the ids we gave the calls
+		byID := make(map[string]json.RawMessage, len(upstreamResponses))
+		for _, response := range upstreamResponses {
+			var envelope struct {
+				ID json.RawMessage `json:"id"`
 			}
-			if cachedResponse, found := fetchFromCache(tx, cacheKey); found {
-				w.Header().Set("Content-Type", "application/json")
-				w.Header().Set("X-Cache-Status", "HIT")
-				w.Write(cachedResponse)
-				tx.Commit()
-				return
+			if err := json.Unmarshal(response, &envelope); err != nil {
+				continue
 			}
-			tx.Rollback()
+			byID[string(envelope.ID)] = response
 		}
 
-		resp, err := http.Post(endpoint, "application/json", bytes.NewBuffer(body))
-		if err != nil {
-			http.Error(w, "Failed to fetch from upstream", http.StatusInternalServerError)
+		var toStore []*rpcCall
+		var toStoreResponses [][]byte
+		for idx, call := range calls {
+			if call == nil || responses[idx] != nil {
+				continue
+			}
+			upstreamID, hasID := upstreamIDs[idx]
+			if !hasID {
+				// notifications get no response
+				continue
+			}
+			response, found := byID[upstreamID]
+			if !found {
+				log.Warn("Upstream batch response is missing a call", "method", call.method)
+				responses[idx] = errorResponse(call.id, "no response from upstream")
+				continue
+			}
+			response, err := withID(response, call.id)
+			if err != nil {
+				log.Warn("Failed to restore the id of an upstream batch response", "error", err)
+				responses[idx] = errorResponse(call.id, "invalid response from upstream")
+				continue
+			}
+			responses[idx] = response
+			toStore = append(toStore, call)
+			toStoreResponses = append(toStoreResponses, response)
+		}
+		if err := c.storeResponses(ctx, chainID, toStore, toStoreResponses); err != nil {
+			http.Error(w, "Failed to save to cache", http.StatusInternalServerError)
 			return
 		}
-		defer resp.Body.Close()
+	}
+
+	result := make([]json.RawMessage, 0, len(responses))
+	for _, response := range responses {
+		if response != nil {
+			result = append(result, response)
+		}
+	}
+	resultBody, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to build batch response", http.StatusInternalServerError)
+		return
+	}
 
-		responseBody, err := io.ReadAll(resp.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache-Status", status)
+	w.Write(resultBody)
+}
+
+// lookup returns the cached responses for the given calls keyed by their index, nil calls are skipped
+func (c *L1Cache) lookup(ctx context.Context, calls []*rpcCall) (map[int][]byte, error) {
+	tx, err := c.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	found := make(map[int][]byte)
+	for idx, call := range calls {
+		if call == nil {
+			continue
+		}
+		if !call.cacheable() {
+			missCounter(call.method).Inc()
+			continue
+		}
+		cachedResponse, hit := fetchFromCache(tx, call.key)
+		if !hit {
+			missCounter(call.method).Inc()
+			continue
+		}
+		response, err := withID(cachedResponse, call.id)
 		if err != nil {
-			http.Error(w, "Failed to read upstream response", http.StatusInternalServerError)
+			missCounter(call.method).Inc()
+			continue
+		}
+		hitCounter(call.method).Inc()
+		c.recordAccess(call.key)
+		found[idx] = response
+	}
+
+	return found, nil
+}
+
+func forward(ctx context.Context, endpoint string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, responseBody, nil
+}
+
+func (c *L1Cache) storeResponse(ctx context.Context, chainID string, call *rpcCall, response []byte) error {
+	return c.storeResponses(ctx, chainID, []*rpcCall{call}, [][]byte{response})
+}
+
+// storeResponses caches the responses to the calls in a single transaction
+func (c *L1Cache) storeResponses(ctx context.Context, chainID string, calls []*rpcCall, responses [][]byte) error {
+	var tx kv.RwTx
+	for i, call := range calls {
+		if !cacheableResponse(call, responses[i]) {
+			continue
+		}
+		if tx == nil {
+			var err error
+			if tx, err = c.db.BeginRw(ctx); err != nil {
+				return err
+			}
+			defer tx.Rollback()
+		}
+		if err := c.store(tx, chainID, call.key, call.method, call.params, responses[i]); err != nil {
+			return err
+		}
+	}
+	if tx == nil {
+		return nil
+	}
+	return tx.Commit()
+}
+
+func cacheableResponse(call *rpcCall, response []byte) bool {
+	if !call.cacheable() {
+		return false
+	}
+
+	// Check if the response contains a JSON-RPC error
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(response, &jsonResponse); err != nil {
+		log.Warn("Failed to parse upstream response, not caching", "error", err)
+		return false
+	}
+	if _, hasError := jsonResponse["error"]; hasError {
+		log.Warn("Received error response from upstream, not caching", "error", jsonResponse["error"])
+		return false
+	}
+	return true
+}
+
+func (c *L1Cache) store(tx kv.RwTx, chainID, cacheKey, method string, params []interface{}, response []byte) error {
+	cacheDuration, block := c.cachePolicy(chainID, method, params, response)
+
+	if err := saveToCache(tx, cacheKey, response, cacheDuration); err != nil {
+		return err
+	}
+	if block > 0 {
+		blockBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(blockBytes, block)
+		if err := tx.Put(unfinalizedBucket, []byte(cacheKey), blockBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *L1Cache) runMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.MaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			c.checkFinality(ctx)
+			if err := c.evict(ctx); err != nil {
+				log.Warn("L1 cache eviction pass failed", "error", err)
+			}
+		}
+	}
+}
+
+type blockHeader struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+}
+
+func getBlockHeader(ctx context.Context, endpoint, tag string) (*blockHeader, error) {
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["%s",false]}`, tag)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Result *blockHeader `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Result == nil {
+		return nil, fmt.Errorf("no %s block returned", tag)
+	}
+	return response.Result, nil
+}
+
+// checkFinality refreshes the finalized block of every chain seen so far.  Entries that are now finalized
+// lose their unfinalized status, and all unfinalized entries of a chain are dropped if its head has reorged
+func (c *L1Cache) checkFinality(ctx context.Context) {
+	c.chainsLock.Lock()
+	chains := make(map[string]chainState, len(c.chains))
+	for id, chain := range c.chains {
+		chains[id] = *chain
+	}
+	c.chainsLock.Unlock()
+
+	for chainID, chain := range chains {
+		finalized, err := getBlockHeader(ctx, chain.endpoint, "finalized")
+		if err != nil {
+			log.Debug("L1 cache failed to get the finalized block", "chainId", chainID, "error", err)
+			continue
+		}
+		head, err := getBlockHeader(ctx, chain.endpoint, "latest")
+		if err != nil {
+			log.Debug("L1 cache failed to get the latest block", "chainId", chainID, "error", err)
+			continue
+		}
+		finalizedNumber, ok := parseHexUint(finalized.Number)
+		if !ok {
+			continue
+		}
+		headNumber, ok := parseHexUint(head.Number)
+		if !ok {
+			continue
 		}
 
-		if resp.StatusCode == http.StatusOK {
-			// Check if the response contains a JSON-RPC error
-			var jsonResponse map[string]interface{}
-			if err := json.Unmarshal(responseBody, &jsonResponse); err == nil {
-				if _, hasError := jsonResponse["error"]; hasError {
-					log.Warn("Received error response from upstream, not caching", "error", jsonResponse["error"])
-				} else {
-					if _, ignore := methodsToIgnore[method]; !ignore {
-						cacheDuration := time.Duration(0)
-						if duration, found := methodsToExpire[method]; found {
-							if method == "eth_getBlockByNumber" {
-								params, ok := request["params"].([]interface{})
-								if ok && len(params) > 0 {
-									param, ok := params[0].(string)
-									if ok {
-										if _, shouldExpire := paramsToExpire[param]; shouldExpire {
-											cacheDuration = duration
-										}
-									}
-								}
-							} else {
-								cacheDuration = duration
-							}
-						}
-						tx, err := db.BeginRw(r.Context())
-						if err != nil {
-							http.Error(w, "Failed to begin transaction", http.StatusInternalServerError)
-							return
-						}
-						defer tx.Rollback()
-						if err := saveToCache(tx, cacheKey, responseBody, cacheDuration); err != nil {
-							http.Error(w, "Failed to save to cache", http.StatusInternalServerError)
-							return
-						}
-						tx.Commit()
-					}
+		// the head moving backwards, changing hash at the same height or the previous head no longer being on the
+		// chain are all signs that the unfinalized part of the chain has been reorganised.  The head has usually
+		// moved on by many blocks since the last pass so the previous head is fetched again by its number
+		reorged := false
+		if chain.headHash != "" {
+			switch {
+			case headNumber < chain.headNumber:
+				reorged = true
+			case headNumber == chain.headNumber:
+				reorged = head.Hash != chain.headHash
+			case headNumber == chain.headNumber+1:
+				reorged = head.ParentHash != chain.headHash
+			default:
+				previous, err := getBlockHeader(ctx, chain.endpoint, fmt.Sprintf("0x%x", chain.headNumber))
+				if err != nil {
+					log.Debug("L1 cache failed to get the previous head", "chainId", chainID, "block", chain.headNumber, "error", err)
+					continue
 				}
-			} else {
-				fmt.Println("Failed to parse upstream response, not caching")
+				reorged = previous.Hash != chain.headHash
 			}
 		}
+		if reorged {
+			log.Info("L1 cache detected a reorg, dropping unfinalized entries", "chainId", chainID, "head", headNumber)
+			cacheReorgCounter.Inc()
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Cache-Status", "MISS")
-		w.Write(responseBody)
+		if err := c.updateUnfinalized(ctx, chainID, finalizedNumber, reorged); err != nil {
+			log.Warn("L1 cache failed to update unfinalized entries", "chainId", chainID, "error", err)
+			continue
+		}
+
+		c.chainsLock.Lock()
+		if state, ok := c.chains[chainID]; ok {
+			state.finalized = finalizedNumber
+			state.headNumber = headNumber
+			state.headHash = head.Hash
+		}
+		c.chainsLock.Unlock()
+	}
+}
+
+func (c *L1Cache) updateUnfinalized(ctx context.Context, chainID string, finalized uint64, reorged bool) error {
+	tx, err := c.db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	prefix := []byte(chainID + "_")
+	var toEvict, toPromote [][]byte
+	if err := tx.ForPrefix(unfinalizedBucket, prefix, func(k, v []byte) error {
+		if reorged {
+			toEvict = append(toEvict, bytes.Clone(k))
+		} else if len(v) == 8 && binary.BigEndian.Uint64(v) <= finalized {
+			toPromote = append(toPromote, bytes.Clone(k))
+		}
+		return nil
+	}); err != nil {
+		return err
 	}
+
+	for _, k := range toEvict {
+		evictFromCache(tx, string(k))
+	}
+	for _, k := range toPromote {
+		if err := tx.Delete(unfinalizedBucket, k); err != nil {
+			return err
+		}
+		// the entry is safe from reorgs now so only the method TTL applies
+		if err := c.resetExpiry(tx, chainID, k); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (c *L1Cache) resetExpiry(tx kv.RwTx, chainID string, key []byte) error {
+	var request map[string]interface{}
+	if err := json.Unmarshal(key[len(chainID)+1:], &request); err != nil {
+		return nil
+	}
+	method, _ := request["method"].(string)
+	if duration := c.cfg.MethodTTLs[method]; duration > 0 {
+		return tx.Put(expiryBucket, key, []byte(time.Now().Add(duration).Format(time.RFC3339)))
+	}
+	return tx.Delete(expiryBucket, key)
+}
+
+type cacheEntry struct {
+	key      []byte
+	size     uint64
+	accessed uint64
+}
+
+// evict removes expired entries and then the least recently used entries until the cache fits in MaxSize
+func (c *L1Cache) evict(ctx context.Context) error {
+	tx, err := c.db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := c.flushAccessTimes(tx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var expired [][]byte
+	if err := tx.ForEach(expiryBucket, nil, func(k, v []byte) error {
+		expiryTime, err := time.Parse(time.RFC3339, string(v))
+		if err == nil && now.After(expiryTime) {
+			expired = append(expired, bytes.Clone(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range expired {
+		evictFromCache(tx, string(k))
+	}
+
+	var entries []cacheEntry
+	var total uint64
+	if err := tx.ForEach(bucketName, nil, func(k, v []byte) error {
+		entry := cacheEntry{key: bytes.Clone(k), size: uint64(len(k) + len(v))}
+		total += entry.size
+		entries = append(entries, entry)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if c.cfg.MaxSize > 0 && total > c.cfg.MaxSize.Bytes() {
+		for i := range entries {
+			accessed, err := tx.GetOne(accessBucket, entries[i].key)
+			if err != nil {
+				return err
+			}
+			if len(accessed) == 8 {
+				entries[i].accessed = binary.BigEndian.Uint64(accessed)
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].accessed < entries[j].accessed
+		})
+
+		evicted := 0
+		for _, entry := range entries {
+			if total <= c.cfg.MaxSize.Bytes() {
+				break
+			}
+			evictFromCache(tx, string(entry.key))
+			total -= entry.size
+			evicted++
+		}
+		log.Debug("L1 cache evicted least recently used entries", "count", evicted, "size", datasize.ByteSize(total).HR())
+	}
+
+	cacheSizeGauge.SetUint64(total)
+
+	return tx.Commit()
 }
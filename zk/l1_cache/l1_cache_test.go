@@ -0,0 +1,390 @@
+package l1_cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+)
+
+type upstream struct {
+	*httptest.Server
+	calls        atomic.Int64
+	lastBatchLen atomic.Int64
+	finalized    atomic.Uint64
+	headNumber   atomic.Uint64
+	headHash     atomic.Value
+	// hashes of the blocks below the head, by number, blocks without one are answered like any other call
+	blockHashes sync.Map
+}
+
+type upstreamRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params []interface{}   `json:"params"`
+}
+
+func newUpstream(t *testing.T) *upstream {
+	u := &upstream{}
+	u.headNumber.Store(0x100)
+	u.headHash.Store("0xaa")
+
+	respond := func(request upstreamRequest) string {
+		if request.Method == "eth_getBlockByNumber" && len(request.Params) > 0 {
+			switch request.Params[0] {
+			case "finalized":
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{"number":"0x%x","hash":"0x01","parentHash":"0x00"}}`, request.ID, u.finalized.Load())
+			case "latest":
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{"number":"0x%x","hash":"%s","parentHash":"0x00"}}`, request.ID, u.headNumber.Load(), u.headHash.Load())
+			}
+			if hash, ok := u.blockHashes.Load(request.Params[0]); ok {
+				return fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{"number":"%s","hash":"%s","parentHash":"0x00"}}`, request.ID, request.Params[0], hash)
+			}
+		}
+		if request.Method == "eth_fail" {
+			return fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32000,"message":"failed"}}`, request.ID)
+		}
+
+		n := u.calls.Add(1)
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s-%d"}`, request.ID, request.Method, n)
+	}
+
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		if isBatch(body) {
+			var requests []upstreamRequest
+			require.NoError(t, json.Unmarshal(body, &requests))
+			u.lastBatchLen.Store(int64(len(requests)))
+
+			// answer in reverse order as nothing guarantees batch responses keep the request order, and leave out
+			// the calls upstream is told to drop
+			var responses []string
+			for i := len(requests) - 1; i >= 0; i-- {
+				if requests[i].Method != "eth_drop" {
+					responses = append(responses, respond(requests[i]))
+				}
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(responses, ","))
+			return
+		}
+
+		var request upstreamRequest
+		require.NoError(t, json.Unmarshal(body, &request))
+		fmt.Fprint(w, respond(request))
+	}))
+	return u
+}
+
+func newTestCache(t *testing.T, cfg Config) *L1Cache {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// a long maintenance interval so the tests drive the maintenance passes themselves
+	cfg.MaintenanceInterval = time.Hour
+	cache, err := NewL1Cache(ctx, t.TempDir(), cfg)
+	require.NoError(t, err)
+	return cache
+}
+
+func doRequest(t *testing.T, cache *L1Cache, endpoint, body string) (string, string) {
+	target := fmt.Sprintf("/?endpoint=%s&chainid=1", url.QueryEscape(endpoint))
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	cache.handleRequest(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String(), rec.Header().Get("X-Cache-Status")
+}
+
+func TestL1Cache_MethodTTL(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+
+	cache := newTestCache(t, Config{
+		MethodTTLs: map[string]time.Duration{"eth_blockNumber": time.Second},
+	})
+
+	blockNumber := `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+	chainId := `{"jsonrpc":"2.0","id":2,"method":"eth_chainId","params":[]}`
+
+	first, status := doRequest(t, cache, u.URL, blockNumber)
+	require.Equal(t, "MISS", status)
+	cached, status := doRequest(t, cache, u.URL, blockNumber)
+	require.Equal(t, "HIT", status)
+	require.JSONEq(t, first, cached)
+
+	_, status = doRequest(t, cache, u.URL, chainId)
+	require.Equal(t, "MISS", status)
+
+	time.Sleep(2 * time.Second)
+
+	_, status = doRequest(t, cache, u.URL, blockNumber)
+	require.Equal(t, "MISS", status)
+	_, status = doRequest(t, cache, u.URL, chainId)
+	require.Equal(t, "HIT", status)
+}
+
+func TestL1Cache_ReorgInvalidatesUnfinalized(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+	u.finalized.Store(0x10)
+
+	cache := newTestCache(t, Config{})
+	ctx := context.Background()
+
+	finalizedBlock := `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x5",false]}`
+	unfinalizedBlock := `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x20",false]}`
+	unfinalizedLogs := `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[{"fromBlock":"0x1","toBlock":"0x20"}]}`
+
+	// learn the finalized block before caching anything
+	doRequest(t, cache, u.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	cache.checkFinality(ctx)
+
+	for _, body := range []string{finalizedBlock, unfinalizedBlock, unfinalizedLogs} {
+		doRequest(t, cache, u.URL, body)
+		_, status := doRequest(t, cache, u.URL, body)
+		require.Equal(t, "HIT", status)
+	}
+
+	// no reorg so everything stays cached
+	cache.checkFinality(ctx)
+	_, status := doRequest(t, cache, u.URL, unfinalizedBlock)
+	require.Equal(t, "HIT", status)
+
+	// same head height with a different hash means the unfinalized part of the chain changed
+	u.headHash.Store("0xbb")
+	cache.checkFinality(ctx)
+
+	_, status = doRequest(t, cache, u.URL, finalizedBlock)
+	require.Equal(t, "HIT", status)
+	_, status = doRequest(t, cache, u.URL, unfinalizedBlock)
+	require.Equal(t, "MISS", status)
+	_, status = doRequest(t, cache, u.URL, unfinalizedLogs)
+	require.Equal(t, "MISS", status)
+
+	// once finalized the entries are no longer dropped on reorg
+	u.finalized.Store(0x30)
+	cache.checkFinality(ctx)
+	u.headHash.Store("0xcc")
+	cache.checkFinality(ctx)
+
+	_, status = doRequest(t, cache, u.URL, unfinalizedBlock)
+	require.Equal(t, "HIT", status)
+}
+
+func TestL1Cache_ReorgBelowTheHead(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+	u.finalized.Store(0x10)
+
+	cache := newTestCache(t, Config{})
+	ctx := context.Background()
+
+	unfinalizedBlock := `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["0x20",false]}`
+	doRequest(t, cache, u.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	cache.checkFinality(ctx)
+	doRequest(t, cache, u.URL, unfinalizedBlock)
+
+	// the head moved on by many blocks and the previous head is still on the chain
+	u.blockHashes.Store("0x100", "0xaa")
+	u.headNumber.Store(0x140)
+	u.headHash.Store("0xdd")
+	cache.checkFinality(ctx)
+	_, status := doRequest(t, cache, u.URL, unfinalizedBlock)
+	require.Equal(t, "HIT", status)
+
+	// the head moved on by many blocks again but the previous head was reorged out on the way
+	u.blockHashes.Store("0x140", "0xee")
+	u.headNumber.Store(0x180)
+	u.headHash.Store("0xff")
+	cache.checkFinality(ctx)
+	_, status = doRequest(t, cache, u.URL, unfinalizedBlock)
+	require.Equal(t, "MISS", status)
+}
+
+func TestL1Cache_EvictsLeastRecentlyUsed(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+
+	cache := newTestCache(t, Config{MaxSize: 300 * datasize.B})
+	ctx := context.Background()
+
+	request := func(id int) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["0x%d"]}`, id)
+	}
+
+	for i := 0; i < 4; i++ {
+		doRequest(t, cache, u.URL, request(i))
+		time.Sleep(time.Millisecond)
+	}
+	// touch the first entry so it is the most recently used
+	_, status := doRequest(t, cache, u.URL, request(0))
+	require.Equal(t, "HIT", status)
+
+	require.NoError(t, cache.evict(ctx))
+
+	_, status = doRequest(t, cache, u.URL, request(0))
+	require.Equal(t, "HIT", status)
+	_, status = doRequest(t, cache, u.URL, request(1))
+	require.Equal(t, "MISS", status)
+}
+
+func TestL1Cache_BatchRequests(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+
+	cache := newTestCache(t, Config{})
+
+	// warm the cache with a single call using a different id
+	_, status := doRequest(t, cache, u.URL, `{"jsonrpc":"2.0","id":99,"method":"eth_getTransactionByHash","params":["0x1"]}`)
+	require.Equal(t, "MISS", status)
+
+	batch := `[
+		{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["0x2"]},
+		{"jsonrpc":"2.0","id":2,"method":"eth_getTransactionByHash","params":["0x1"]},
+		{"jsonrpc":"2.0","id":"three","method":"eth_fail","params":[]},
+		{"jsonrpc":"2.0","id":4,"method":"eth_getTransactionByHash","params":["0x3"]}
+	]`
+
+	body, status := doRequest(t, cache, u.URL, batch)
+	require.Equal(t, "PARTIAL", status)
+	require.Equal(t, int64(3), u.lastBatchLen.Load())
+
+	var responses []struct {
+		ID     json.RawMessage `json:"id"`
+		Result string          `json:"result"`
+		Error  interface{}     `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &responses))
+	require.Len(t, responses, 4)
+	require.Equal(t, `1`, string(responses[0].ID))
+	require.Equal(t, `2`, string(responses[1].ID))
+	require.Equal(t, "eth_getTransactionByHash-1", responses[1].Result)
+	require.Equal(t, `"three"`, string(responses[2].ID))
+	require.NotNil(t, responses[2].Error)
+	require.Equal(t, `4`, string(responses[3].ID))
+
+	// everything but the error is now cached so only the failing call goes upstream
+	body2, status := doRequest(t, cache, u.URL, batch)
+	require.Equal(t, "PARTIAL", status)
+	require.Equal(t, int64(1), u.lastBatchLen.Load())
+
+	var responses2 []struct {
+		ID     json.RawMessage `json:"id"`
+		Result string          `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body2), &responses2))
+	require.Len(t, responses2, 4)
+	for i := range responses {
+		require.Equal(t, string(responses[i].ID), string(responses2[i].ID))
+		require.Equal(t, responses[i].Result, responses2[i].Result)
+	}
+}
+
+func TestL1Cache_MetricsMethodLabel(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+
+	cache := newTestCache(t, Config{})
+
+	// a method the label parser would reject is counted as other rather than creating a series of its own
+	other := missCounter("other").GetValueUint64()
+	_, status := doRequest(t, cache, u.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_\"bad{method}","params":[]}`)
+	require.Equal(t, "MISS", status)
+	require.Equal(t, other+1, missCounter("other").GetValueUint64())
+	require.Equal(t, missCounter("other"), missCounter("eth_anything"))
+
+	hits := hitCounter("eth_getLogs").GetValueUint64()
+	logs := `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[{"fromBlock":"0x1","toBlock":"0x2"}]}`
+	doRequest(t, cache, u.URL, logs)
+	_, status = doRequest(t, cache, u.URL, logs)
+	require.Equal(t, "HIT", status)
+	require.Equal(t, hits+1, hitCounter("eth_getLogs").GetValueUint64())
+}
+
+func TestL1Cache_BatchMissingResponse(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+
+	cache := newTestCache(t, Config{})
+
+	// the call upstream left out still gets an answer, the others are cached
+	batch := `[
+		{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["0x1"]},
+		{"jsonrpc":"2.0","id":2,"method":"eth_drop","params":[]},
+		{"jsonrpc":"2.0","id":3,"method":"eth_getTransactionReceipt","params":["0x1"]}
+	]`
+	body, status := doRequest(t, cache, u.URL, batch)
+	require.Equal(t, "MISS", status)
+
+	var responses []struct {
+		ID     json.RawMessage `json:"id"`
+		Result string          `json:"result"`
+		Error  *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &responses))
+	require.Len(t, responses, 3)
+	require.Equal(t, `2`, string(responses[1].ID))
+	require.NotNil(t, responses[1].Error)
+	require.Equal(t, -32603, responses[1].Error.Code)
+	require.Nil(t, responses[0].Error)
+	require.Nil(t, responses[2].Error)
+
+	_, status = doRequest(t, cache, u.URL, batch)
+	require.Equal(t, "PARTIAL", status)
+	require.Equal(t, int64(1), u.lastBatchLen.Load())
+}
+
+func TestL1Cache_BatchDuplicateIDs(t *testing.T) {
+	u := newUpstream(t)
+	defer u.Close()
+
+	cache := newTestCache(t, Config{})
+
+	// both calls use the same id, each still has to get and cache its own response
+	batch := `[
+		{"jsonrpc":"2.0","id":7,"method":"eth_getTransactionByHash","params":["0x1"]},
+		{"jsonrpc":"2.0","id":7,"method":"eth_getTransactionReceipt","params":["0x1"]}
+	]`
+	body, status := doRequest(t, cache, u.URL, batch)
+	require.Equal(t, "MISS", status)
+
+	var responses []struct {
+		ID     json.RawMessage `json:"id"`
+		Result string          `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &responses))
+	require.Len(t, responses, 2)
+	require.Equal(t, `7`, string(responses[0].ID))
+	require.Equal(t, `7`, string(responses[1].ID))
+	require.True(t, strings.HasPrefix(responses[0].Result, "eth_getTransactionByHash-"))
+	require.True(t, strings.HasPrefix(responses[1].Result, "eth_getTransactionReceipt-"))
+
+	// and the cache holds each response under its own call
+	for i, single := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["0x1"]}`,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionReceipt","params":["0x1"]}`,
+	} {
+		cached, status := doRequest(t, cache, u.URL, single)
+		require.Equal(t, "HIT", status)
+		var response struct {
+			Result string `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(cached), &response))
+		require.Equal(t, responses[i].Result, response.Result)
+	}
+}
@@ -38,7 +38,7 @@ func BuildSequencesForRollup(data []byte) ([]RollupBaseEtrogBatchData, error) {
 	return sequences, err
 }
 
-func BuildSequencesForValidium(data []byte, daUrl string) ([]RollupBaseEtrogBatchData, error) {
+func BuildSequencesForValidium(data []byte, l1BlockNo uint64, daBackend da.DataAvailabilityBackend, daVerifier da.MessageVerifier, daMessage []byte) ([]RollupBaseEtrogBatchData, error) {
 	var sequences []RollupBaseEtrogBatchData
 	var validiumSequences []ValidiumBatchData
 	err := json.Unmarshal(data, &validiumSequences)
@@ -47,9 +47,16 @@ func BuildSequencesForValidium(data []byte, daUrl string) ([]RollupBaseEtrogBatc
 		return nil, err
 	}
 
+	if daVerifier != nil {
+		signedHash := AccumulatedNonForcedTransactionsHash(validiumSequences)
+		if err := daVerifier.VerifyMessage(context.Background(), l1BlockNo, signedHash, daMessage); err != nil {
+			return nil, fmt.Errorf("data availability message verification failed: %w", err)
+		}
+	}
+
 	for _, validiumSequence := range validiumSequences {
 		hash := common.BytesToHash(validiumSequence.TransactionsHash[:])
-		data, err := da.GetOffChainData(context.Background(), daUrl, hash)
+		data, err := daBackend.GetOffChainData(context.Background(), l1BlockNo, hash)
 		if err != nil {
 			return nil, err
 		}
@@ -70,7 +77,19 @@ func BuildSequencesForValidium(data []byte, daUrl string) ([]RollupBaseEtrogBatc
 	return sequences, nil
 }
 
-func DecodeL1BatchData(txData []byte, daUrl string) ([][]byte, common.Address, uint64, error) {
+// AccumulatedNonForcedTransactionsHash is the hash the data availability committee signs for a validium sequence
+func AccumulatedNonForcedTransactionsHash(validiumSequences []ValidiumBatchData) common.Hash {
+	var accumulated common.Hash
+	for _, sequence := range validiumSequences {
+		if sequence.ForcedTimestamp > 0 {
+			continue
+		}
+		accumulated = crypto.Keccak256Hash(accumulated.Bytes(), sequence.TransactionsHash[:])
+	}
+	return accumulated
+}
+
+func DecodeL1BatchData(txData []byte, l1BlockNo uint64, daBackend da.DataAvailabilityBackend, daVerifier da.MessageVerifier) ([][]byte, common.Address, uint64, error) {
 	// we need to know which version of the ABI to use here so lets find it
 	idAsString := fmt.Sprintf("%x", txData[:4])
 	abiMapped, found := contracts.SequenceBatchesMapping[idAsString]
@@ -98,6 +117,7 @@ func DecodeL1BatchData(txData []byte, daUrl string) ([][]byte, common.Address, u
 	var limitTimstamp uint64
 
 	isValidium := false
+	var daMessage []byte
 
 	switch idAsString {
 	case contracts.SequenceBatchesIdv5_0:
@@ -118,14 +138,18 @@ func DecodeL1BatchData(txData []byte, daUrl string) ([][]byte, common.Address, u
 		}
 		limitTimstamp = ts
 	case contracts.SequenceBatchesValidiumElderBerry:
-		if daUrl == "" {
-			return nil, common.Address{}, 0, fmt.Errorf("data availability url is required for validium")
+		if daBackend == nil {
+			return nil, common.Address{}, 0, fmt.Errorf("data availability backend is required for validium")
 		}
 		isValidium = true
 		cb, ok := data[3].(common.Address)
 		if !ok {
 			return nil, common.Address{}, 0, fmt.Errorf("expected position 3 in the l1 call data to be address")
 		}
+		daMessage, ok = data[4].([]byte)
+		if !ok {
+			return nil, common.Address{}, 0, fmt.Errorf("expected position 4 in the l1 call data to be the data availability message")
+		}
 		coinbase = cb
 		ts, ok := data[1].(uint64)
 		if !ok {
@@ -144,14 +168,18 @@ func DecodeL1BatchData(txData []byte, daUrl string) ([][]byte, common.Address, u
 		}
 		limitTimstamp = ts
 	case contracts.SequenceBatchesValidiumBanana:
-		if daUrl == "" {
-			return nil, common.Address{}, 0, fmt.Errorf("data availability url is required for validium")
+		if daBackend == nil {
+			return nil, common.Address{}, 0, fmt.Errorf("data availability backend is required for validium")
 		}
 		isValidium = true
 		cb, ok := data[4].(common.Address)
 		if !ok {
 			return nil, common.Address{}, 0, fmt.Errorf("expected position 4 in the l1 call data to be address")
 		}
+		daMessage, ok = data[5].([]byte)
+		if !ok {
+			return nil, common.Address{}, 0, fmt.Errorf("expected position 5 in the l1 call data to be the data availability message")
+		}
 		coinbase = cb
 		ts, ok := data[2].(uint64)
 		if !ok {
@@ -170,7 +198,7 @@ func DecodeL1BatchData(txData []byte, daUrl string) ([][]byte, common.Address, u
 	}
 
 	if isValidium {
-		sequences, err = BuildSequencesForValidium(bytedata, daUrl)
+		sequences, err = BuildSequencesForValidium(bytedata, l1BlockNo, daBackend, daVerifier, daMessage)
 	} else {
 		sequences, err = BuildSequencesForRollup(bytedata)
 	}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/zk/da"
 	zktx "github.com/ledgerwatch/erigon/zk/tx"
 	"github.com/ledgerwatch/erigon/zkevm/jsonrpc/types"
 	"github.com/stretchr/testify/require"
@@ -18,7 +19,7 @@ func Test_DecodeL1BatchData(t *testing.T) {
 	testData := "0xdef57e5400000000000000000000000000000000000000000000000000000000000000800000000000000000000000000000000000000000000000000000000065f838a100000000000000000000000000000000000000000000000000000000000000010000000000000000000000007597b12b953bffe1457d89e7e4fe3da149b45d8800000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000003cc0b00000890000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000117000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000b00000003000000000000000000000000000000000000000000000000"
 	txData := common.FromHex(testData)
 
-	transactions, _, _, err := DecodeL1BatchData(txData, "")
+	transactions, _, _, err := DecodeL1BatchData(txData, 0, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,7 +32,7 @@ func Test_DecodeL1MultiBatchDataBanana(t *testing.T) {
 	testData := "0xb910e0f900000000000000000000000000000000000000000000000000000000000000a000000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000066fae3d43c6b68527a14b86763ec2b181d3598cdc7250d1dde0887492779a8dd0d7f12d50000000000000000000000005b06837a43bdc3dd9f114558daf4b26ed49842ed000000000000000000000000000000000000000000000000000000000000000400000000000000000000000000000000000000000000000000000000000000800000000000000000000000000000000000000000000000000000000000000140000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000002c0000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000120b00000006000000000b00000006000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000120b00000006000000000b00000006000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000120b00000006000000000b00000006000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000120b00000006000000000b00000006000000000000000000000000000000000000"
 	txData := common.FromHex(testData)
 
-	transactions, _, _, err := DecodeL1BatchData(txData, "")
+	transactions, _, _, err := DecodeL1BatchData(txData, 0, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -44,7 +45,7 @@ func Test_DecodeL1BatchValidiumDataNoDAUrl(t *testing.T) {
 	testData := "0xdb5b0ed700000000000000000000000000000000000000000000000000000000000000a0000000000000000000000000000000000000000000000000000000006660bbff000000000000000000000000000000000000000000000000000000000000001b0000000000000000000000005b06837a43bdc3dd9f114558daf4b26ed49842ed00000000000000000000000000000000000000000000000000000000000002400000000000000000000000000000000000000000000000000000000000000003dd6adb9b5339c8211dc51e7a58a554ed96cf79e3ee7fc2584989fc59f9498a8500000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000082bf94a92db64c7577bee972b708e40197417a4cbff9cd222ea4a5e0dc059f3e00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000034bd4848d9132849924ed6fe5af836533213534badcfb3de4ba00654943d7c3d000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000005513b771ebf43620a7b45c4f6e7e766339c82a475187494122f1390509947a4854643ed73c45dff20dcfe99ba777e5fd8271abfab69e9b96bb5fd9dc242373bec51b5951f5b2604c9b42e478d5e2b2437f44073ef9a60000000000000000000000"
 	txData := common.FromHex(testData)
 
-	_, _, _, err := DecodeL1BatchData(txData, "")
+	_, _, _, err := DecodeL1BatchData(txData, 0, nil, nil)
 	if err == nil {
 		t.Errorf("Expect error when no DA URL is provided")
 	}
@@ -75,7 +76,7 @@ func Test_DecodeL1BatchValidiumDataBanana(t *testing.T) {
 	}))
 	defer svr.Close()
 
-	transactions, _, _, err := DecodeL1BatchData(txData, svr.URL)
+	transactions, _, _, err := DecodeL1BatchData(txData, 0, da.NewDACBackend(svr.URL), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,7 +114,7 @@ func Test_DecodeL1BatchValidiumData(t *testing.T) {
 	}))
 	defer svr.Close()
 
-	transactions, _, _, err := DecodeL1BatchData(txData, svr.URL)
+	transactions, _, _, err := DecodeL1BatchData(txData, 0, da.NewDACBackend(svr.URL), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -129,7 +130,7 @@ func Test_DecodeL1MultiBatchData(t *testing.T) {
 
 	txData := common.FromHex(testData)
 
-	transactions, _, _, err := DecodeL1BatchData(txData, "")
+	transactions, _, _, err := DecodeL1BatchData(txData, 0, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -145,7 +146,7 @@ func Test_Integration_L1DataForBatch33(t *testing.T) {
 
 	txData := common.FromHex(testData)
 
-	batches, _, _, err := DecodeL1BatchData(txData, "")
+	batches, _, _, err := DecodeL1BatchData(txData, 0, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
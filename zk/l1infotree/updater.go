@@ -9,11 +9,13 @@ import (
 	"github.com/iden3/go-iden3-crypto/keccak256"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/metrics"
 	"github.com/ledgerwatch/erigon/core/types"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/zk/contracts"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
 	zkTypes "github.com/ledgerwatch/erigon/zk/types"
 	"github.com/ledgerwatch/log/v3"
 )
@@ -24,6 +26,7 @@ type Syncer interface {
 	GetLogsChan() chan []types.Log
 	GetProgressMessageChan() chan string
 	IsDownloading() bool
+	IsReorgDetected() bool
 	GetHeader(blockNumber uint64) (*types.Header, error)
 	L1QueryHeaders(logs []types.Log) (map[uint64]*types.Header, error)
 	StopQueryBlocks()
@@ -31,6 +34,8 @@ type Syncer interface {
 	WaitQueryBlocksToFinish()
 }
 
+var l1InfoTreeReorgsCounter = metrics.GetOrCreateCounter(`l1_info_tree_reorgs`)
+
 type Updater struct {
 	cfg          *ethconfig.Zk
 	syncer       Syncer
@@ -74,6 +79,15 @@ func (u *Updater) WarmUp(tx kv.RwTx) (err error) {
 
 	u.progress = progress
 
+	// when following an L1 block that can still be reorganised check that the updates we stored are still canonical,
+	// either because the syncer has spotted a reorg or because we don't know what happened to the L1 since the last run
+	if u.syncer.IsReorgDetected() || (!u.syncer.IsSyncStarted() && u.cfg.L1HighestBlockType != "finalized") {
+		u.syncer.WaitQueryBlocksToFinish()
+		if err = u.unwindOnReorg(tx, hermezDb); err != nil {
+			return err
+		}
+	}
+
 	latestUpdate, err := hermezDb.GetLatestL1InfoTreeUpdate()
 	if err != nil {
 		return err
@@ -88,6 +102,42 @@ func (u *Updater) WarmUp(tx kv.RwTx) (err error) {
 	return nil
 }
 
+// unwindOnReorg finds the first stored L1 block that is no longer canonical and deletes the info tree updates from
+// there on so that they are fetched again from the new chain.  The progress goes back to the highest stored block that
+// is still canonical, as the blocks after it can hold updates of the new fork even where nothing was stored
+func (u *Updater) unwindOnReorg(tx kv.RwTx, hermezDb *hermez_db.HermezDb) error {
+	reorgPoint, canonicalBlock, err := syncer.FindL1ReorgPoint(u.syncer.GetHeader, hermezDb.GetL1InfoTreeBlockHashBelow)
+	if err != nil {
+		return err
+	}
+
+	if reorgPoint != 0 {
+		l1InfoTreeReorgsCounter.Inc()
+		log.Warn("L1 reorg detected, unwinding L1 info tree updates", "fromL1Block", reorgPoint, "progress", u.progress)
+
+		if err = hermezDb.UnwindL1InfoTreeUpdates(reorgPoint); err != nil {
+			return err
+		}
+	}
+
+	// the progress only moves on past blocks holding updates, so with nothing stored it's still at the start
+	if reorgPoint == 0 && canonicalBlock == 0 {
+		return nil
+	}
+	progress := canonicalBlock
+	if progress == 0 && u.cfg.L1FirstBlock > 0 {
+		progress = u.cfg.L1FirstBlock - 1
+	}
+	if u.progress <= progress {
+		return nil
+	}
+
+	log.Info("Checking the L1 again from the last canonical block holding info tree updates", "l1Block", progress, "progress", u.progress)
+	u.progress = progress
+
+	return stages.SaveStageProgress(tx, stages.L1InfoTree, u.progress)
+}
+
 func (u *Updater) CheckForInfoTreeUpdates(logPrefix string, tx kv.RwTx) (allLogs []types.Log, err error) {
 	defer func() {
 		if err != nil {
@@ -205,6 +255,9 @@ LOOP:
 				if err = hermezDb.WriteL1InfoTreeRoot(common.BytesToHash(newRoot[:]), u.latestUpdate.Index); err != nil {
 					return nil, err
 				}
+				if err = hermezDb.WriteL1InfoTreeBlockHash(l.BlockNumber, header.Hash()); err != nil {
+					return nil, err
+				}
 
 				processed++
 			default:
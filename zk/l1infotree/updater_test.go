@@ -0,0 +1,82 @@
+package l1infotree
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/commands/mocks"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	zktypes "github.com/ledgerwatch/erigon/zk/types"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestUpdaterUnwindOnReorg(t *testing.T) {
+	headers := map[uint64]*types.Header{}
+	for i := uint64(1); i <= 30; i++ {
+		headers[i] = &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0)}
+	}
+
+	tests := []struct {
+		name             string
+		forked           map[uint64]bool
+		expectedProgress uint64
+		expectedLatest   uint64
+	}{
+		// the blocks between the last canonical update and the forked one are checked again
+		{"gap below the reorg point", map[uint64]bool{12: true}, 5, 5},
+		// nothing stored was forked but the blocks after the last update can be
+		{"no stored block forked", map[uint64]bool{}, 12, 12},
+		// back to the first L1 block
+		{"every stored block forked", map[uint64]bool{5: true, 12: true}, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, db1 := context.Background(), memdb.NewTestDB(t)
+			tx := memdb.BeginRw(t, db1)
+			require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+			hDB := hermez_db.NewHermezDb(tx)
+
+			for index, l1BlockNo := range []uint64{5, 12} {
+				hash := headers[l1BlockNo].Hash()
+				if tt.forked[l1BlockNo] {
+					hash = common.HexToHash("0xf0")
+				}
+				require.NoError(t, hDB.WriteL1InfoTreeUpdate(&zktypes.L1InfoTreeUpdate{Index: uint64(index), BlockNumber: l1BlockNo, GER: common.HexToHash("0x1")}))
+				require.NoError(t, hDB.WriteL1InfoTreeBlockHash(l1BlockNo, hash))
+			}
+
+			mockCtrl := gomock.NewController(t)
+			EthermanMock := mocks.NewMockIEtherman(mockCtrl)
+			EthermanMock.EXPECT().HeaderByNumber(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, number *big.Int) (*types.Header, error) {
+				return headers[number.Uint64()], nil
+			}).AnyTimes()
+			l1Syncer := syncer.NewL1Syncer(ctx, []syncer.IEtherman{EthermanMock}, nil, nil, 10, 0, "latest")
+
+			u := NewUpdater(&ethconfig.Zk{L1FirstBlock: 3}, l1Syncer)
+			u.progress = 25
+			require.NoError(t, u.unwindOnReorg(tx, hDB))
+			require.Equal(t, tt.expectedProgress, u.progress)
+
+			saved, err := stages.GetStageProgress(tx, stages.L1InfoTree)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedProgress, saved)
+
+			latest, err := hDB.GetLatestL1InfoTreeUpdate()
+			require.NoError(t, err)
+			if tt.expectedLatest == 0 {
+				require.Nil(t, latest)
+			} else {
+				require.Equal(t, tt.expectedLatest, latest.BlockNumber)
+			}
+		})
+	}
+}
@@ -31,6 +31,11 @@ type Config struct {
 	Timeout               time.Duration
 	MaxConcurrentRequests int
 	OutputLocation        string
+
+	// BreakerFailureThreshold is how many requests in a row may fail before an executor is taken out of rotation
+	BreakerFailureThreshold int
+	// BreakerCooldown is how long a failing executor is left alone before it is sent a trial request
+	BreakerCooldown time.Duration
 }
 
 type Payload struct {
@@ -61,6 +66,7 @@ type Executor struct {
 	connCancel context.CancelFunc
 	client     executor.ExecutorServiceClient
 	semaphore  chan struct{}
+	breaker    *circuitBreaker
 
 	// if not empty then the executor will write the payload to this location before sending it to the
 	// remote executor
@@ -70,12 +76,12 @@ type Executor struct {
 func NewExecutors(cfg Config) []*Executor {
 	executors := make([]*Executor, len(cfg.GrpcUrls))
 	for i, grpcUrl := range cfg.GrpcUrls {
-		executors[i] = NewExecutor(grpcUrl, cfg.Timeout, cfg.MaxConcurrentRequests, cfg.OutputLocation)
+		executors[i] = NewExecutor(grpcUrl, cfg.Timeout, cfg.MaxConcurrentRequests, cfg.OutputLocation, cfg.BreakerFailureThreshold, cfg.BreakerCooldown)
 	}
 	return executors
 }
 
-func NewExecutor(grpcUrl string, timeout time.Duration, maxConcurrentRequests int, outputLocation string) *Executor {
+func NewExecutor(grpcUrl string, timeout time.Duration, maxConcurrentRequests int, outputLocation string, breakerFailureThreshold int, breakerCooldown time.Duration) *Executor {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -94,6 +100,7 @@ func NewExecutor(grpcUrl string, timeout time.Duration, maxConcurrentRequests in
 		connCancel:     cancel,
 		client:         client,
 		semaphore:      make(chan struct{}, maxConcurrentRequests),
+		breaker:        newCircuitBreaker(grpcUrl, breakerFailureThreshold, breakerCooldown),
 		outputLocation: outputLocation,
 	}
 
@@ -124,6 +131,20 @@ func (e *Executor) ReleaseAccess() {
 	<-e.semaphore
 }
 
+// Health reports the state of the executor's circuit breaker along with its request history
+func (e *Executor) Health() ExecutorHealth {
+	state, requests, failures, consecutiveFailures, latency := e.breaker.snapshot()
+	return ExecutorHealth{
+		GrpcUrl:             e.grpcUrl,
+		State:               state,
+		Requests:            requests,
+		Failures:            failures,
+		ConsecutiveFailures: consecutiveFailures,
+		Latency:             latency,
+		QueueLength:         e.QueueLength(),
+	}
+}
+
 func (e *Executor) CheckOnline() bool {
 	// first ensure there is a connection to work with
 	if e.conn == nil {
@@ -217,13 +238,17 @@ func (e *Executor) Verify(p *Payload, request *VerifierRequest, oldStateRoot com
 		}
 	}
 
+	start := time.Now()
 	resp, err := e.client.ProcessStatelessBatchV2(ctx, grpcRequest, grpc.MaxCallSendMsgSize(size), grpc.MaxCallRecvMsgSize(size))
+	if err == nil && resp == nil {
+		err = fmt.Errorf("nil response")
+	}
 	if err != nil {
+		e.breaker.failure(err)
 		return false, nil, nil, fmt.Errorf("failed to process stateless batch: %w", err)
 	}
-	if resp == nil {
-		return false, nil, nil, fmt.Errorf("nil response")
-	}
+	// an executor that answers, even with an error about the batch, is healthy as far as scheduling is concerned
+	e.breaker.success(time.Since(start))
 
 	counters := map[string]int{
 		"SHA": int(resp.CntSha256Hashes),
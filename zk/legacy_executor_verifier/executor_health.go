@@ -0,0 +1,191 @@
+package legacy_executor_verifier
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/metrics"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	DefaultBreakerFailureThreshold = 3
+	DefaultBreakerCooldown         = 30 * time.Second
+
+	// latencyDecay is the weight of the newest sample in the executor latency moving average
+	latencyDecay = 0.2
+)
+
+type BreakerState int
+
+const (
+	// BreakerClosed executors take work as normal
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen executors have sat out their cooldown and get a single trial request
+	BreakerHalfOpen
+	// BreakerOpen executors have failed too many times in a row and get no work until the cooldown passes
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText shows the state by its name in the admin RPC
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ExecutorHealth is a snapshot of an executor's circuit breaker and request history
+type ExecutorHealth struct {
+	GrpcUrl             string        `json:"grpcUrl"`
+	State               BreakerState  `json:"state"`
+	Requests            uint64        `json:"requests"`
+	Failures            uint64        `json:"failures"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	Latency             time.Duration `json:"latencyNs"`
+	QueueLength         int           `json:"queueLength"`
+}
+
+// circuitBreaker stops handing work to an executor that keeps failing.  Once failureThreshold requests in a row have
+// failed the breaker opens, after the cooldown a single trial request is let through and its outcome either closes
+// the breaker again or re-opens it for another cooldown
+type circuitBreaker struct {
+	mtx                 sync.Mutex
+	grpcUrl             string
+	failureThreshold    int
+	cooldown            time.Duration
+	state               BreakerState
+	openedAt            time.Time
+	trialInFlight       bool
+	trialStartedAt      time.Time
+	requests            uint64
+	failures            uint64
+	consecutiveFailures int
+	latency             time.Duration
+}
+
+func newCircuitBreaker(grpcUrl string, failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = DefaultBreakerFailureThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	b := &circuitBreaker{
+		grpcUrl:          grpcUrl,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+	}
+	b.setState(BreakerClosed)
+	return b
+}
+
+// allow reports whether the executor can take a request right now.  A half-open breaker only lets one trial request
+// through at a time so the caller must report the outcome with success or failure
+func (b *circuitBreaker) allow() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	default:
+		if b.trialPending() {
+			return false
+		}
+		b.trialInFlight = true
+		b.trialStartedAt = time.Now()
+		return true
+	}
+}
+
+// trialPending is true while a half-open trial request is out.  A trial that never reported back, say because the
+// verification was cancelled before it was sent, is given up on after a cooldown
+func (b *circuitBreaker) trialPending() bool {
+	return b.trialInFlight && time.Since(b.trialStartedAt) < b.cooldown
+}
+
+// available is allow without reserving the half-open trial, used to rank executors before picking one
+func (b *circuitBreaker) available() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerOpen:
+		return time.Since(b.openedAt) >= b.cooldown
+	default:
+		return !b.trialPending()
+	}
+}
+
+func (b *circuitBreaker) success(took time.Duration) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.requests++
+	b.consecutiveFailures = 0
+	b.trialInFlight = false
+	if b.latency == 0 {
+		b.latency = took
+	} else {
+		b.latency = time.Duration(latencyDecay*float64(took) + (1-latencyDecay)*float64(b.latency))
+	}
+	if b.state != BreakerClosed {
+		log.Info("Executor recovered, closing circuit breaker", "grpcUrl", b.grpcUrl)
+		b.setState(BreakerClosed)
+	}
+
+	metrics.GetOrCreateCounter(fmt.Sprintf(`executor_requests{url="%s"}`, b.grpcUrl)).Inc()
+	metrics.GetOrCreateGauge(fmt.Sprintf(`executor_latency_ms{url="%s"}`, b.grpcUrl)).Set(float64(b.latency.Milliseconds()))
+}
+
+func (b *circuitBreaker) failure(err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.requests++
+	b.failures++
+	b.consecutiveFailures++
+	b.trialInFlight = false
+
+	metrics.GetOrCreateCounter(fmt.Sprintf(`executor_requests{url="%s"}`, b.grpcUrl)).Inc()
+	metrics.GetOrCreateCounter(fmt.Sprintf(`executor_failures{url="%s"}`, b.grpcUrl)).Inc()
+
+	if b.state == BreakerHalfOpen || b.consecutiveFailures >= b.failureThreshold {
+		if b.state != BreakerOpen {
+			log.Warn("Executor failing, opening circuit breaker", "grpcUrl", b.grpcUrl, "consecutiveFailures", b.consecutiveFailures, "cooldown", b.cooldown, "err", err)
+		}
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+func (b *circuitBreaker) snapshot() (BreakerState, uint64, uint64, int, time.Duration) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.state, b.requests, b.failures, b.consecutiveFailures, b.latency
+}
+
+func (b *circuitBreaker) setState(state BreakerState) {
+	b.state = state
+	metrics.GetOrCreateGauge(fmt.Sprintf(`executor_circuit_state{url="%s"}`, b.grpcUrl)).Set(float64(state))
+}
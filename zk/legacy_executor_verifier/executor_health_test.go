@@ -0,0 +1,95 @@
+package legacy_executor_verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker("breaker-test", 2, 50*time.Millisecond)
+	failure := errors.New("deadline exceeded")
+
+	require.True(t, b.allow())
+	b.failure(failure)
+	require.Equal(t, BreakerClosed, b.state)
+
+	// a success in between resets the count
+	b.success(10 * time.Millisecond)
+	b.failure(failure)
+	require.Equal(t, BreakerClosed, b.state)
+	b.failure(failure)
+	require.Equal(t, BreakerOpen, b.state)
+	require.False(t, b.available())
+	require.False(t, b.allow())
+
+	// after the cooldown only a single trial is let through
+	time.Sleep(60 * time.Millisecond)
+	require.True(t, b.available())
+	require.True(t, b.allow())
+	require.Equal(t, BreakerHalfOpen, b.state)
+	require.False(t, b.allow())
+
+	// a failed trial opens the breaker straight away
+	b.failure(failure)
+	require.Equal(t, BreakerOpen, b.state)
+
+	time.Sleep(60 * time.Millisecond)
+	require.True(t, b.allow())
+	b.success(20 * time.Millisecond)
+	require.Equal(t, BreakerClosed, b.state)
+
+	state, requests, failures, consecutiveFailures, latency := b.snapshot()
+	require.Equal(t, BreakerClosed, state)
+	require.Equal(t, uint64(6), requests)
+	require.Equal(t, uint64(4), failures)
+	require.Equal(t, 0, consecutiveFailures)
+	require.Equal(t, 12*time.Millisecond, latency)
+}
+
+func TestLegacyExecutorVerifier_RankExecutors(t *testing.T) {
+	newTestExecutor := func(url string, latency time.Duration) *Executor {
+		e := &Executor{
+			grpcUrl:   url,
+			semaphore: make(chan struct{}, 4),
+			breaker:   newCircuitBreaker(url, 1, time.Minute),
+		}
+		e.breaker.latency = latency
+		return e
+	}
+
+	fast := newTestExecutor("fast", 10*time.Millisecond)
+	slow := newTestExecutor("slow", 100*time.Millisecond)
+	broken := newTestExecutor("broken", time.Millisecond)
+	broken.breaker.failure(ErrExecutorOffline)
+
+	v := &LegacyExecutorVerifier{
+		executors:    []*Executor{slow, broken, fast},
+		mtxExecutors: &sync.Mutex{},
+	}
+
+	require.Equal(t, []*Executor{fast, slow}, v.rankExecutors())
+
+	// a busy executor loses out once its queue outweighs its speed
+	for i := 0; i < 4; i++ {
+		fast.AquireAccess()
+	}
+	require.Equal(t, 10*time.Millisecond, fast.Health().Latency)
+	require.Equal(t, 4, fast.Health().QueueLength)
+	require.Equal(t, []*Executor{fast, slow}, v.rankExecutors())
+	slow.breaker.latency = 40 * time.Millisecond
+	require.Equal(t, []*Executor{slow, fast}, v.rankExecutors())
+
+	health := v.GetExecutorsHealth()
+	require.Equal(t, BreakerOpen, health[1].State)
+	require.Equal(t, uint64(1), health[1].Failures)
+
+	// the admin RPC shows the state by its name
+	encoded, err := json.Marshal(health[1])
+	require.NoError(t, err)
+	require.Contains(t, string(encoded), `"state":"open"`)
+}
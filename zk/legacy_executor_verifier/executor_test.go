@@ -68,6 +68,7 @@ func TestExecutor_Verify(t *testing.T) {
 					connCancel: nil,
 					client:     mockClient,
 					semaphore:  make(chan struct{}),
+					breaker:    newCircuitBreaker("", 0, 0),
 				}
 
 				payload := &Payload{
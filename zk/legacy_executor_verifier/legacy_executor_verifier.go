@@ -2,12 +2,14 @@ package legacy_executor_verifier
 
 import (
 	"context"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -23,7 +25,11 @@ import (
 	"github.com/ledgerwatch/log/v3"
 )
 
-var ErrNoExecutorAvailable = fmt.Errorf("no executor available")
+var (
+	ErrNoExecutorAvailable  = fmt.Errorf("no executor available")
+	ErrExecutorOffline      = fmt.Errorf("executor offline")
+	ErrVerificationNotFound = fmt.Errorf("verification not found")
+)
 
 type VerifierRequest struct {
 	BatchNumber  uint64
@@ -34,6 +40,32 @@ type VerifierRequest struct {
 	creationTime time.Time
 	timeout      time.Duration
 	retries      int
+
+	// the remaining fields are only touched while holding the verifier's promises lock
+	maxRetries        int
+	useRemoteExecutor bool
+	dropped           bool
+
+	// the stream bytes are built when the request is made and its witness is kept in the witness cache under
+	// witnessBlocks, both go with the request when it's persisted so a resumed request verifies the same payload
+	streamBytes             []byte
+	l1InfoTreeMinTimestamps map[uint64]uint64
+	witnessBlocks           []uint64
+}
+
+// persistedVerifierRequest is how a request is stored in the db while it waits on the executor
+type persistedVerifierRequest struct {
+	BatchNumber             uint64            `json:"batchNumber"`
+	BlockNumbers            []uint64          `json:"blockNumbers"`
+	ForkId                  uint64            `json:"forkId"`
+	StateRoot               common.Hash       `json:"stateRoot"`
+	Counters                map[string]int    `json:"counters"`
+	Timeout                 time.Duration     `json:"timeout"`
+	Retries                 int               `json:"retries"`
+	UseRemoteExecutor       bool              `json:"useRemoteExecutor"`
+	StreamBytes             []byte            `json:"streamBytes,omitempty"`
+	L1InfoTreeMinTimestamps map[uint64]uint64 `json:"l1InfoTreeMinTimestamps,omitempty"`
+	WitnessBlocks           []uint64          `json:"witnessBlocks,omitempty"`
 }
 
 func NewVerifierRequest(forkId, batchNumber uint64, blockNumbers []uint64, stateRoot common.Hash, counters map[string]int) *VerifierRequest {
@@ -50,9 +82,44 @@ func NewVerifierRequestWithLimits(forkId, batchNumber uint64, blockNumbers []uin
 		creationTime: time.Now(),
 		timeout:      timeout,
 		retries:      retries,
+		maxRetries:   retries,
 	}
 }
 
+// Encode serialises the request so that it can be resumed after a restart
+func (vr *VerifierRequest) Encode() ([]byte, error) {
+	return json.Marshal(persistedVerifierRequest{
+		BatchNumber:             vr.BatchNumber,
+		BlockNumbers:            vr.BlockNumbers,
+		ForkId:                  vr.ForkId,
+		StateRoot:               vr.StateRoot,
+		Counters:                vr.Counters,
+		Timeout:                 vr.timeout,
+		Retries:                 vr.maxRetries,
+		UseRemoteExecutor:       vr.useRemoteExecutor,
+		StreamBytes:             vr.streamBytes,
+		L1InfoTreeMinTimestamps: vr.l1InfoTreeMinTimestamps,
+		WitnessBlocks:           vr.witnessBlocks,
+	})
+}
+
+// DecodeVerifierRequest restores a request written by Encode, its timeout and retries start over
+func DecodeVerifierRequest(data []byte) (*VerifierRequest, error) {
+	var p persistedVerifierRequest
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if len(p.BlockNumbers) == 0 {
+		return nil, fmt.Errorf("verification request for batch %d has no blocks", p.BatchNumber)
+	}
+	request := NewVerifierRequestWithLimits(p.ForkId, p.BatchNumber, p.BlockNumbers, p.StateRoot, p.Counters, p.Timeout, p.Retries)
+	request.useRemoteExecutor = p.UseRemoteExecutor
+	request.streamBytes = p.StreamBytes
+	request.l1InfoTreeMinTimestamps = p.L1InfoTreeMinTimestamps
+	request.witnessBlocks = p.WitnessBlocks
+	return request, nil
+}
+
 func (vr *VerifierRequest) IsOverdue() bool {
 	if vr.timeout == 0 {
 		return false
@@ -114,17 +181,28 @@ type WitnessGenerator interface {
 	GetWitnessByBlockRange(tx kv.Tx, ctx context.Context, startBlock, endBlock uint64, debug, witnessFull bool) ([]byte, error)
 }
 
+// WitnessCache keeps the witnesses of pending requests so that a resumed request doesn't generate its witness again
+type WitnessCache interface {
+	GetBlocks(ctx context.Context, tx kv.Tx, fromBlock, toBlock uint64) ([]byte, error)
+	PutBlocks(ctx context.Context, tx kv.Tx, fromBlock, toBlock uint64, witness []byte) error
+	DeleteBlocks(ctx context.Context, fromBlock, toBlock uint64) error
+}
+
 type LegacyExecutorVerifier struct {
 	db                     kv.RwDB
 	cfg                    ethconfig.Zk
 	executors              []*Executor
 	executorNumber         int
+	mtxExecutors           *sync.Mutex
 	cancelAllVerifications atomic.Bool
 
 	streamServer     server.DataStreamServer
 	WitnessGenerator WitnessGenerator
+	witnessCache     WitnessCache
 
+	// requests[i] is the request behind promises[i]
 	promises    []*Promise[*VerifierBundle]
+	requests    []*VerifierRequest
 	mtxPromises *sync.Mutex
 }
 
@@ -133,6 +211,7 @@ func NewLegacyExecutorVerifier(
 	executors []*Executor,
 	db kv.RwDB,
 	witnessGenerator WitnessGenerator,
+	witnessCache WitnessCache,
 	streamServer server.DataStreamServer,
 ) *LegacyExecutorVerifier {
 	return &LegacyExecutorVerifier{
@@ -140,15 +219,21 @@ func NewLegacyExecutorVerifier(
 		cfg:                    cfg,
 		executors:              executors,
 		executorNumber:         0,
+		mtxExecutors:           &sync.Mutex{},
 		cancelAllVerifications: atomic.Bool{},
 		streamServer:           streamServer,
 		WitnessGenerator:       witnessGenerator,
+		witnessCache:           witnessCache,
 		promises:               make([]*Promise[*VerifierBundle], 0),
+		requests:               make([]*VerifierRequest, 0),
 		mtxPromises:            &sync.Mutex{},
 	}
 }
 
+// StartAsyncVerification queues the verification of the blocks, the stream bytes of the request are built from the tx
+// straight away so they can be persisted with it
 func (v *LegacyExecutorVerifier) StartAsyncVerification(
+	tx kv.Tx,
 	logPrefix string,
 	forkId uint64,
 	batchNumber uint64,
@@ -158,24 +243,46 @@ func (v *LegacyExecutorVerifier) StartAsyncVerification(
 	useRemoteExecutor bool,
 	requestTimeout time.Duration,
 	retries int,
-) {
-	var promise *Promise[*VerifierBundle]
-
+) (*VerifierRequest, error) {
 	request := NewVerifierRequestWithLimits(forkId, batchNumber, blockNumbers, stateRoot, counters, requestTimeout, retries)
+	request.useRemoteExecutor = useRemoteExecutor
 	if useRemoteExecutor {
+		request.l1InfoTreeMinTimestamps = make(map[uint64]uint64)
+		streamBytes, err := v.GetWholeBatchStreamBytes(batchNumber, tx, blockNumbers, hermez_db.NewHermezDbReader(tx), request.l1InfoTreeMinTimestamps, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.streamBytes = streamBytes
+		if v.witnessCache != nil {
+			request.witnessBlocks = []uint64{request.GetFirstBlockNumber(), request.GetLastBlockNumber()}
+		}
+	}
+	v.startVerification(logPrefix, request, "Starting verification request")
+	return request, nil
+}
+
+// ResumeVerification queues a request that was persisted before a restart
+func (v *LegacyExecutorVerifier) ResumeVerification(logPrefix string, request *VerifierRequest) {
+	v.startVerification(logPrefix, request, "Resuming verification request")
+}
+
+func (v *LegacyExecutorVerifier) startVerification(logPrefix string, request *VerifierRequest, msg string) {
+	var promise *Promise[*VerifierBundle]
+	if request.useRemoteExecutor {
 		promise = v.VerifyAsync(request)
 	} else {
 		promise = v.VerifyWithoutExecutor(request)
 	}
 
-	size := v.appendPromise(promise)
-	log.Info(fmt.Sprintf("[%s] Starting verification request", logPrefix), "batch-number", batchNumber, "blocks-range", fmt.Sprintf("[%d;%d]", request.GetFirstBlockNumber(), request.GetLastBlockNumber()), "pending-requests", size)
+	size := v.appendPromise(promise, request)
+	log.Info(fmt.Sprintf("[%s] %s", logPrefix, msg), "batch-number", request.BatchNumber, "blocks-range", fmt.Sprintf("[%d;%d]", request.GetFirstBlockNumber(), request.GetLastBlockNumber()), "pending-requests", size)
 }
 
-func (v *LegacyExecutorVerifier) appendPromise(promise *Promise[*VerifierBundle]) int {
+func (v *LegacyExecutorVerifier) appendPromise(promise *Promise[*VerifierBundle], request *VerifierRequest) int {
 	v.mtxPromises.Lock()
 	defer v.mtxPromises.Unlock()
 	v.promises = append(v.promises, promise)
+	v.requests = append(v.requests, request)
 	return len(v.promises)
 }
 
@@ -236,15 +343,18 @@ func (v *LegacyExecutorVerifier) VerifyAsync(request *VerifierRequest) *Promise[
 		}
 		defer tx.Rollback()
 
-		hermezDb := hermez_db.NewHermezDbReader(tx)
-
-		l1InfoTreeMinTimestamps := make(map[uint64]uint64)
-		streamBytes, err := v.GetWholeBatchStreamBytes(request.BatchNumber, tx, blockNumbers, hermezDb, l1InfoTreeMinTimestamps, nil)
-		if err != nil {
-			return verifierBundle, err
+		// requests persisted before their stream bytes were kept have to build them again
+		streamBytes, l1InfoTreeMinTimestamps := request.streamBytes, request.l1InfoTreeMinTimestamps
+		if streamBytes == nil {
+			hermezDb := hermez_db.NewHermezDbReader(tx)
+			l1InfoTreeMinTimestamps = make(map[uint64]uint64)
+			streamBytes, err = v.GetWholeBatchStreamBytes(request.BatchNumber, tx, blockNumbers, hermezDb, l1InfoTreeMinTimestamps, nil)
+			if err != nil {
+				return verifierBundle, err
+			}
 		}
 
-		witness, err := v.WitnessGenerator.GetWitnessByBlockRange(tx, innerCtx, blockNumbers[0], blockNumbers[len(blockNumbers)-1], false, v.cfg.WitnessFull)
+		witness, err := v.getWitness(innerCtx, tx, request)
 		if err != nil {
 			return verifierBundle, err
 		}
@@ -321,6 +431,31 @@ func (v *LegacyExecutorVerifier) VerifyAsync(request *VerifierRequest) *Promise[
 	})
 }
 
+// getWitness returns the witness of the request from the witness cache, generating and caching it when it isn't there
+func (v *LegacyExecutorVerifier) getWitness(ctx context.Context, tx kv.Tx, request *VerifierRequest) ([]byte, error) {
+	cached := v.witnessCache != nil && len(request.witnessBlocks) == 2
+	if cached {
+		witness, err := v.witnessCache.GetBlocks(ctx, tx, request.witnessBlocks[0], request.witnessBlocks[1])
+		if err != nil {
+			log.Warn("[Verifier] Failed to read the witness cache", "batch", request.BatchNumber, "err", err)
+		}
+		if witness != nil {
+			return witness, nil
+		}
+	}
+
+	witness, err := v.WitnessGenerator.GetWitnessByBlockRange(tx, ctx, request.GetFirstBlockNumber(), request.GetLastBlockNumber(), false, v.cfg.WitnessFull)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		if err = v.witnessCache.PutBlocks(ctx, tx, request.witnessBlocks[0], request.witnessBlocks[1], witness); err != nil {
+			log.Warn("[Verifier] Failed to cache the witness", "batch", request.BatchNumber, "err", err)
+		}
+	}
+	return witness, nil
+}
+
 func (v *LegacyExecutorVerifier) VerifyWithoutExecutor(request *VerifierRequest) *Promise[*VerifierBundle] {
 	promise := NewPromise[*VerifierBundle](func() (*VerifierBundle, error) {
 		response := &VerifierResponse{
@@ -353,6 +488,13 @@ func (v *LegacyExecutorVerifier) ProcessResultsSequentially(logPrefix string) ([
 
 	// not a stop signal, so we can start to process our promises now
 	for idx, promise := range v.promises {
+		// an operator gave up on this request so treat it like one that ran out of retries
+		if request := v.requests[idx]; request.dropped {
+			log.Warn(fmt.Sprintf("[%s] Verification request dropped", logPrefix), "batch-number", request.BatchNumber, "blocks-range", fmt.Sprintf("[%d;%d]", request.GetFirstBlockNumber(), request.GetLastBlockNumber()))
+			verifierBundleForUnwind = NewVerifierBundle(request, nil, true)
+			break
+		}
+
 		verifierBundle, err := promise.TryGet()
 		if verifierBundle == nil && err == nil {
 			// If code enters here this means that this promise is not yet completed
@@ -391,10 +533,17 @@ func (v *LegacyExecutorVerifier) ProcessResultsSequentially(logPrefix string) ([
 
 		log.Info(fmt.Sprintf("[%s] Finished verification request", logPrefix), "batch-number", verifierBundle.Request.BatchNumber, "blocks-range", fmt.Sprintf("[%d;%d]", verifierBundle.Request.GetFirstBlockNumber(), verifierBundle.Request.GetLastBlockNumber()), "is-valid", verifierBundle.Response.Valid, "pending-requests", len(v.promises)-1-idx)
 		verifierResponse = append(verifierResponse, verifierBundle)
+
+		if request := verifierBundle.Request; v.witnessCache != nil && len(request.witnessBlocks) == 2 {
+			if err = v.witnessCache.DeleteBlocks(context.Background(), request.witnessBlocks[0], request.witnessBlocks[1]); err != nil {
+				log.Warn("[Verifier] Failed to drop the witness from the cache", "batch", request.BatchNumber, "err", err)
+			}
+		}
 	}
 
 	// remove processed promises from the list
 	v.promises = v.promises[len(verifierResponse):]
+	v.requests = v.requests[len(verifierResponse):]
 
 	return verifierResponse, verifierBundleForUnwind
 }
@@ -426,27 +575,79 @@ func (v *LegacyExecutorVerifier) CancelAllRequests() {
 	v.cancelAllVerifications.Store(false)
 
 	v.promises = make([]*Promise[*VerifierBundle], 0)
+	v.requests = make([]*VerifierRequest, 0)
 }
 
+// GetNextOnlineAvailableExecutor picks the executor expected to answer soonest, going by its average latency and how
+// many requests it already has queued.  Executors whose circuit breaker is open are skipped until their cooldown has
+// passed, and an executor that turns out to be offline counts as a failure against its breaker
 func (v *LegacyExecutorVerifier) GetNextOnlineAvailableExecutor() *Executor {
-	var exec *Executor
+	for _, e := range v.rankExecutors() {
+		if !e.breaker.allow() {
+			continue
+		}
+		if e.CheckOnline() {
+			return e
+		}
+		e.breaker.failure(ErrExecutorOffline)
+	}
+
+	return nil
+}
 
-	// TODO: find executors with spare capacity
+// rankExecutors orders the available executors by their expected wait, ties are rotated between calls so that
+// executors with no history yet share the work
+func (v *LegacyExecutorVerifier) rankExecutors() []*Executor {
+	v.mtxExecutors.Lock()
+	defer v.mtxExecutors.Unlock()
+
+	if len(v.executors) == 0 {
+		return nil
+	}
+
+	v.executorNumber++
+	if v.executorNumber >= len(v.executors) {
+		v.executorNumber = 0
+	}
 
-	// attempt to find an executor that is online amongst them all
+	candidates := make([]*Executor, 0, len(v.executors))
+	latencies := make(map[*Executor]time.Duration, len(v.executors))
+	var fastest time.Duration
 	for i := 0; i < len(v.executors); i++ {
-		v.executorNumber++
-		if v.executorNumber >= len(v.executors) {
-			v.executorNumber = 0
+		e := v.executors[(v.executorNumber+i)%len(v.executors)]
+		if !e.breaker.available() {
+			continue
 		}
-		temp := v.executors[v.executorNumber]
-		if temp.CheckOnline() {
-			exec = temp
-			break
+		candidates = append(candidates, e)
+		_, _, _, _, latency := e.breaker.snapshot()
+		latencies[e] = latency
+		if latency > 0 && (fastest == 0 || latency < fastest) {
+			fastest = latency
+		}
+	}
+
+	// executors we haven't heard back from yet are assumed to be as quick as the fastest one
+	expectedWait := func(e *Executor) time.Duration {
+		latency := latencies[e]
+		if latency == 0 {
+			latency = max(fastest, 1)
 		}
+		return latency * time.Duration(e.QueueLength()+1)
 	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return expectedWait(candidates[i]) < expectedWait(candidates[j])
+	})
+
+	return candidates
+}
 
-	return exec
+// GetExecutorsHealth reports the circuit breaker state and request history of every executor
+func (v *LegacyExecutorVerifier) GetExecutorsHealth() []ExecutorHealth {
+	health := make([]ExecutorHealth, len(v.executors))
+	for i, e := range v.executors {
+		health[i] = e.Health()
+	}
+	return health
 }
 
 func (v *LegacyExecutorVerifier) GetWholeBatchStreamBytes(
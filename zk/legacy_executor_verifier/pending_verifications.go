@@ -0,0 +1,124 @@
+package legacy_executor_verifier
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	VerificationStatusPending  = "pending"
+	VerificationStatusFailed   = "failed"
+	VerificationStatusFinished = "finished"
+	VerificationStatusDropped  = "dropped"
+)
+
+// PendingVerification describes a verification request the sequencer hasn't yet written to the datastream
+type PendingVerification struct {
+	BatchNumber uint64        `json:"batchNumber"`
+	FirstBlock  uint64        `json:"firstBlock"`
+	LastBlock   uint64        `json:"lastBlock"`
+	ForkId      uint64        `json:"forkId"`
+	StateRoot   common.Hash   `json:"stateRoot"`
+	Age         time.Duration `json:"age"`
+	RetriesLeft int           `json:"retriesLeft"`
+	Status      string        `json:"status"`
+	Valid       *bool         `json:"valid,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// GetPendingVerifications lists the queued verification requests in the order they will be processed
+func (v *LegacyExecutorVerifier) GetPendingVerifications() []PendingVerification {
+	v.mtxPromises.Lock()
+	defer v.mtxPromises.Unlock()
+
+	result := make([]PendingVerification, len(v.promises))
+	for i, promise := range v.promises {
+		request := v.requests[i]
+		pending := PendingVerification{
+			BatchNumber: request.BatchNumber,
+			FirstBlock:  request.GetFirstBlockNumber(),
+			LastBlock:   request.GetLastBlockNumber(),
+			ForkId:      request.ForkId,
+			StateRoot:   request.StateRoot,
+			Age:         time.Since(request.creationTime),
+			RetriesLeft: request.retries,
+			Status:      VerificationStatusPending,
+		}
+
+		bundle, err := promise.TryGet()
+		switch {
+		case request.dropped:
+			pending.Status = VerificationStatusDropped
+		case err != nil:
+			pending.Status = VerificationStatusFailed
+			pending.Error = err.Error()
+		case bundle != nil:
+			pending.Status = VerificationStatusFinished
+			if bundle.Response != nil {
+				pending.Valid = &bundle.Response.Valid
+				if bundle.Response.Error != nil {
+					pending.Error = bundle.Response.Error.Error()
+				}
+			}
+		}
+		result[i] = pending
+	}
+
+	return result
+}
+
+// RetryVerification gives the request ending at the given block a fresh timeout and retry budget, and sends it to
+// an executor again straight away if its last attempt failed
+func (v *LegacyExecutorVerifier) RetryVerification(lastBlock uint64) error {
+	v.mtxPromises.Lock()
+	defer v.mtxPromises.Unlock()
+
+	idx, err := v.findRequest(lastBlock)
+	if err != nil {
+		return err
+	}
+
+	request := v.requests[idx]
+	if request.dropped {
+		return fmt.Errorf("verification for block %d has been dropped", lastBlock)
+	}
+	request.creationTime = time.Now()
+	request.retries = request.maxRetries
+
+	if _, err := v.promises[idx].TryGet(); err != nil {
+		v.promises[idx] = v.promises[idx].CloneAndRerun()
+	}
+
+	log.Info("Verification request retried", "batch-number", request.BatchNumber, "last-block", lastBlock)
+	return nil
+}
+
+// DropVerification gives up on the request ending at the given block.  As the datastream must stay sequential the
+// sequencer unwinds to the block before it once it reaches the request, and the transactions are sequenced again
+func (v *LegacyExecutorVerifier) DropVerification(lastBlock uint64) error {
+	v.mtxPromises.Lock()
+	defer v.mtxPromises.Unlock()
+
+	idx, err := v.findRequest(lastBlock)
+	if err != nil {
+		return err
+	}
+
+	request := v.requests[idx]
+	request.dropped = true
+
+	log.Warn("Verification request dropped", "batch-number", request.BatchNumber, "last-block", lastBlock)
+	return nil
+}
+
+func (v *LegacyExecutorVerifier) findRequest(lastBlock uint64) (int, error) {
+	for i, request := range v.requests {
+		if request.GetLastBlockNumber() == lastBlock {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no request ends at block %d", ErrVerificationNotFound, lastBlock)
+}
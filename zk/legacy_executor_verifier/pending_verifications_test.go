@@ -0,0 +1,151 @@
+package legacy_executor_verifier
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifierRequest_EncodeDecode(t *testing.T) {
+	request := NewVerifierRequestWithLimits(9, 5, []uint64{10, 11}, common.HexToHash("0x01"), map[string]int{"S": 100}, time.Minute, 3)
+	request.useRemoteExecutor = true
+	request.retries = 1
+	request.streamBytes = []byte{0x0b, 0x0c}
+	request.l1InfoTreeMinTimestamps = map[uint64]uint64{4: 1700000000}
+	request.witnessBlocks = []uint64{10, 11}
+
+	encoded, err := request.Encode()
+	require.NoError(t, err)
+
+	decoded, err := DecodeVerifierRequest(encoded)
+	require.NoError(t, err)
+	require.Equal(t, request.BatchNumber, decoded.BatchNumber)
+	require.Equal(t, request.BlockNumbers, decoded.BlockNumbers)
+	require.Equal(t, request.ForkId, decoded.ForkId)
+	require.Equal(t, request.StateRoot, decoded.StateRoot)
+	require.Equal(t, request.Counters, decoded.Counters)
+	require.Equal(t, time.Minute, decoded.timeout)
+	require.True(t, decoded.useRemoteExecutor)
+	require.Equal(t, request.streamBytes, decoded.streamBytes)
+	require.Equal(t, request.l1InfoTreeMinTimestamps, decoded.l1InfoTreeMinTimestamps)
+	require.Equal(t, request.witnessBlocks, decoded.witnessBlocks)
+	// the retry budget starts over on resume
+	require.Equal(t, 3, decoded.retries)
+
+	_, err = DecodeVerifierRequest([]byte(`{"batchNumber":5}`))
+	require.Error(t, err)
+}
+
+func TestLegacyExecutorVerifier_RetryAndDrop(t *testing.T) {
+	v := NewLegacyExecutorVerifier(ethconfig.Zk{}, nil, nil, nil, nil, nil)
+
+	first := NewVerifierRequestWithLimits(9, 5, []uint64{10}, common.Hash{}, nil, time.Minute, 3)
+	v.ResumeVerification("test", first)
+
+	// a request that fails on our end until it is retried
+	var attempts atomic.Int32
+	second := NewVerifierRequestWithLimits(9, 5, []uint64{10, 11}, common.Hash{}, nil, time.Minute, 3)
+	second.retries = 1
+	promise := NewPromise[*VerifierBundle](func() (*VerifierBundle, error) {
+		if attempts.Add(1) == 1 {
+			return NewVerifierBundle(second, nil, false), errors.New("witness failed")
+		}
+		return NewVerifierBundle(second, &VerifierResponse{Valid: true}, true), nil
+	})
+	promise.Wait()
+	v.appendPromise(promise, second)
+
+	third := NewVerifierRequestWithLimits(9, 5, []uint64{10, 11, 12}, common.Hash{}, nil, time.Minute, 3)
+	v.ResumeVerification("test", third)
+
+	pending := v.GetPendingVerifications()
+	require.Len(t, pending, 3)
+	require.Equal(t, VerificationStatusFinished, pending[0].Status)
+	require.Equal(t, VerificationStatusFailed, pending[1].Status)
+	require.Equal(t, "witness failed", pending[1].Error)
+	require.Equal(t, uint64(11), pending[1].LastBlock)
+
+	require.ErrorIs(t, v.RetryVerification(99), ErrVerificationNotFound)
+	require.NoError(t, v.RetryVerification(11))
+	require.Equal(t, 3, second.retries)
+	v.Wait()
+
+	require.NoError(t, v.DropVerification(12))
+	require.Equal(t, VerificationStatusDropped, v.GetPendingVerifications()[2].Status)
+
+	bundles, forUnwind := v.ProcessResultsSequentially("test")
+	require.Len(t, bundles, 2)
+	require.Equal(t, uint64(11), bundles[1].Request.GetLastBlockNumber())
+	require.NotNil(t, forUnwind)
+	require.Equal(t, uint64(12), forUnwind.Request.GetLastBlockNumber())
+}
+
+type countingWitnessGenerator struct {
+	calls int
+}
+
+func (g *countingWitnessGenerator) GetWitnessByBlockRange(_ kv.Tx, _ context.Context, startBlock, endBlock uint64, _, _ bool) ([]byte, error) {
+	g.calls++
+	return []byte{byte(startBlock), byte(endBlock)}, nil
+}
+
+type mapWitnessCache map[[2]uint64][]byte
+
+func (c mapWitnessCache) GetBlocks(_ context.Context, _ kv.Tx, fromBlock, toBlock uint64) ([]byte, error) {
+	return c[[2]uint64{fromBlock, toBlock}], nil
+}
+
+func (c mapWitnessCache) PutBlocks(_ context.Context, _ kv.Tx, fromBlock, toBlock uint64, witness []byte) error {
+	c[[2]uint64{fromBlock, toBlock}] = witness
+	return nil
+}
+
+func (c mapWitnessCache) DeleteBlocks(_ context.Context, fromBlock, toBlock uint64) error {
+	delete(c, [2]uint64{fromBlock, toBlock})
+	return nil
+}
+
+func TestLegacyExecutorVerifier_CachedWitness(t *testing.T) {
+	ctx := context.Background()
+	generator, cache := &countingWitnessGenerator{}, mapWitnessCache{}
+	v := NewLegacyExecutorVerifier(ethconfig.Zk{}, nil, nil, generator, cache, nil)
+
+	request := NewVerifierRequestWithLimits(9, 5, []uint64{10, 11}, common.Hash{}, nil, time.Minute, 3)
+	request.witnessBlocks = []uint64{10, 11}
+	witness, err := v.getWitness(ctx, nil, request)
+	require.NoError(t, err)
+	require.Equal(t, []byte{10, 11}, witness)
+
+	// a resumed request finds the witness of the original in the cache
+	encoded, err := request.Encode()
+	require.NoError(t, err)
+	resumed, err := DecodeVerifierRequest(encoded)
+	require.NoError(t, err)
+	witness, err = v.getWitness(ctx, nil, resumed)
+	require.NoError(t, err)
+	require.Equal(t, []byte{10, 11}, witness)
+	require.Equal(t, 1, generator.calls)
+
+	// the witness is dropped once the request is done with
+	promise := NewPromise[*VerifierBundle](func() (*VerifierBundle, error) {
+		return NewVerifierBundle(resumed, &VerifierResponse{Valid: true}, true), nil
+	})
+	promise.Wait()
+	v.appendPromise(promise, resumed)
+	bundles, _ := v.ProcessResultsSequentially("test")
+	require.Len(t, bundles, 1)
+	require.Empty(t, cache)
+
+	// without a cache key the witness is generated every time
+	_, err = v.getWitness(ctx, nil, NewVerifierRequestWithLimits(9, 5, []uint64{12}, common.Hash{}, nil, time.Minute, 3))
+	require.NoError(t, err)
+	require.Equal(t, 2, generator.calls)
+	require.Empty(t, cache)
+}
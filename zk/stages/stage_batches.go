@@ -653,7 +653,10 @@ func rollback(
 	tx kv.RwTx,
 	u stagedsync.Unwinder,
 ) (uint64, error) {
-	dsClient := buildNewStreamClient(ctx, cfg, latestFork)
+	dsClient, err := NewStreamClient(ctx, cfg.zkCfg, latestFork)
+	if err != nil {
+		return 0, err
+	}
 	if err := dsClient.Start(); err != nil {
 		return 0, err
 	}
@@ -819,7 +822,10 @@ func getHighestDSL2Block(ctx context.Context, batchCfg BatchesCfg, latestFork ui
 	// but we're going to open a new connection rather than use the one for syncing blocks.
 	// This is so we can keep the logic simple and just dispose of the connection when we're done
 	// greatly simplifying state juggling of the connection if it errors
-	dsClient := buildNewStreamClient(ctx, batchCfg, latestFork)
+	dsClient, err := NewStreamClient(ctx, cfg, latestFork)
+	if err != nil {
+		return 0, err
+	}
 	if err = dsClient.Start(); err != nil {
 		return 0, err
 	}
@@ -836,7 +842,16 @@ func getHighestDSL2Block(ctx context.Context, batchCfg BatchesCfg, latestFork ui
 	return fullBlock.L2BlockNumber, nil
 }
 
-func buildNewStreamClient(ctx context.Context, batchesCfg BatchesCfg, latestFork uint16) *client.StreamClient {
-	cfg := batchesCfg.zkCfg
-	return client.NewClient(ctx, cfg.L2DataStreamerUrl, cfg.L2DataStreamerUseTLS, cfg.DatastreamVersion, cfg.L2DataStreamerTimeout, latestFork)
+// NewStreamClient creates the datastream client of the config, with the credentials for servers gating the stream
+func NewStreamClient(ctx context.Context, cfg *ethconfig.Zk, latestFork uint16) (*client.StreamClient, error) {
+	c := client.NewMultiSourceClient(ctx, cfg.L2DataStreamerUrls(), cfg.L2DataStreamerUseTLS, cfg.DatastreamVersion, cfg.L2DataStreamerTimeout, latestFork)
+	if err := c.SetAuth(client.Auth{
+		CertFile:  cfg.L2DataStreamerTLSCert,
+		KeyFile:   cfg.L2DataStreamerTLSKey,
+		CAFile:    cfg.L2DataStreamerTLSCA,
+		TokenFile: cfg.L2DataStreamerTokenFile,
+	}); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
@@ -2,9 +2,11 @@ package stages
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/metrics"
 	"github.com/ledgerwatch/erigon/core/rawdb"
 	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
@@ -14,19 +16,34 @@ import (
 	"github.com/ledgerwatch/log/v3"
 )
 
+var (
+	reconcileCheckedEntriesCounter   = metrics.GetOrCreateCounter(`datastream_reconcile_checked_entries`)
+	reconcileRewrittenEntriesCounter = metrics.GetOrCreateCounter(`datastream_reconcile_rewritten_entries`)
+)
+
+func reconcileRepairsCounter(kind string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`datastream_reconcile_repairs{kind="%s"}`, kind))
+}
+
+func reconcileTableMismatchesCounter(kind string) metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`datastream_reconcile_table_mismatches{kind="%s"}`, kind))
+}
+
 type DataStreamCatchupCfg struct {
 	db               kv.RwDB
 	dataStreamServer server.DataStreamServer
 	streamVersion    int
 	hasExecutors     bool
+	reconcileBatches uint64
 }
 
-func StageDataStreamCatchupCfg(dataStreamServer server.DataStreamServer, db kv.RwDB, chainId uint64, streamVersion int, hasExecutors bool) DataStreamCatchupCfg {
+func StageDataStreamCatchupCfg(dataStreamServer server.DataStreamServer, db kv.RwDB, chainId uint64, streamVersion int, hasExecutors bool, reconcileBatches uint64) DataStreamCatchupCfg {
 	return DataStreamCatchupCfg{
 		dataStreamServer: dataStreamServer,
 		db:               db,
 		streamVersion:    streamVersion,
 		hasExecutors:     hasExecutors,
+		reconcileBatches: reconcileBatches,
 	}
 }
 
@@ -62,6 +79,12 @@ func SpawnStageDataStreamCatchup(
 		return err
 	}
 
+	if cfg.reconcileBatches > 0 {
+		if err = reconcileDatastream(ctx, logPrefix, tx, cfg.dataStreamServer, cfg.reconcileBatches, finalBlockNumber); err != nil {
+			return err
+		}
+	}
+
 	if createdTx {
 		if err := tx.Commit(); err != nil {
 			log.Error(fmt.Sprintf("[%s] error: %s", logPrefix, err))
@@ -107,6 +130,17 @@ func CatchupDatastream(ctx context.Context, logPrefix string, tx kv.RwTx, srv se
 		return 0, err
 	}
 
+	// a node relaying the synced data commits the stream before the db, so after a crash the stream can hold blocks
+	// the db doesn't have anymore.  They are synced again, so the stream is taken back to the db.
+	if !sequencer.IsSequencer() && previousProgress > finalBlockNumber {
+		if err = unwindDatastream(logPrefix, reader, srv, finalBlockNumber); err != nil {
+			return 0, err
+		}
+		if previousProgress, err = srv.GetHighestBlockNumber(); err != nil {
+			return 0, err
+		}
+	}
+
 	log.Info(fmt.Sprintf("[%s] Getting progress", logPrefix),
 		"adding up to blockNum", finalBlockNumber,
 		"previousProgress", previousProgress,
@@ -139,3 +173,114 @@ func CatchupDatastream(ctx context.Context, logPrefix string, tx kv.RwTx, srv se
 
 	return finalBlockNumber, nil
 }
+
+// reconcileDatastream compares the latest batches of the stream with the db and rewrites the stream from the first
+// entry that doesn't match, the tables disagreeing with the stream are only reported
+func reconcileDatastream(ctx context.Context, logPrefix string, tx kv.Tx, srv server.DataStreamServer, batches, toBlock uint64) error {
+	if toBlock == 0 {
+		return nil
+	}
+	reader := hermez_db.NewHermezDbReader(tx)
+
+	highestBatch, err := reader.GetBatchNoByL2Block(toBlock)
+	if err != nil && !errors.Is(err, hermez_db.ErrorNotStored) {
+		return err
+	}
+	fromBatch := uint64(1)
+	if highestBatch+1 > batches {
+		fromBatch = highestBatch + 1 - batches
+	}
+
+	// only the batches processor of a node syncing from the stream writes the batch ends
+	report, err := srv.CompareWithDb(tx, reader, fromBatch, toBlock, !sequencer.IsSequencer())
+	if err != nil {
+		return fmt.Errorf("comparing the datastream with the db: %w", err)
+	}
+	reconcileCheckedEntriesCounter.AddUint64(report.Entries)
+
+	for _, mismatch := range report.TableMismatches {
+		reconcileTableMismatchesCounter(mismatch.Kind).Inc()
+		log.Warn(fmt.Sprintf("[%s] The db table disagrees with the datastream", logPrefix),
+			"kind", mismatch.Kind, "block", mismatch.Block, "batch", mismatch.Batch, "detail", mismatch.Detail)
+	}
+
+	divergence := report.Divergence
+	if divergence == nil {
+		log.Info(fmt.Sprintf("[%s] The datastream matches the db", logPrefix),
+			"fromBlock", report.FromBlock, "toBlock", report.ToBlock, "entries", report.Entries)
+		return nil
+	}
+
+	totalEntries := srv.GetStreamServer().GetHeader().TotalEntries
+	log.Warn(fmt.Sprintf("[%s] The datastream diverges from the db, rewriting it", logPrefix),
+		"kind", divergence.Kind, "block", divergence.Block, "batch", divergence.Batch, "entry", divergence.Entry,
+		"detail", divergence.Detail, "fromEntry", report.RewriteFromEntry, "fromBlock", report.RewriteFromBlock, "toBlock", report.ToBlock)
+
+	if err = srv.RewriteDivergentTail(ctx, logPrefix, tx, reader, report); err != nil {
+		return fmt.Errorf("rewriting the datastream from block %d: %w", report.RewriteFromBlock, err)
+	}
+
+	var removedEntries uint64
+	if totalEntries > report.RewriteFromEntry {
+		removedEntries = totalEntries - report.RewriteFromEntry
+	}
+	reconcileRepairsCounter(divergence.Kind).Inc()
+	reconcileRewrittenEntriesCounter.AddUint64(removedEntries)
+	log.Info(fmt.Sprintf("[%s] Rewrote the datastream", logPrefix),
+		"fromBlock", report.RewriteFromBlock, "toBlock", report.ToBlock, "removedEntries", removedEntries)
+
+	return nil
+}
+
+func UnwindDataStreamCatchupStage(u *stagedsync.UnwindState, tx kv.RwTx, cfg DataStreamCatchupCfg, ctx context.Context) (err error) {
+	if cfg.dataStreamServer == nil {
+		return nil
+	}
+
+	useExternalTx := tx != nil
+	if !useExternalTx {
+		if tx, err = cfg.db.BeginRw(ctx); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	if err = unwindDatastream(u.LogPrefix(), hermez_db.NewHermezDbReader(tx), cfg.dataStreamServer, u.UnwindPoint); err != nil {
+		return err
+	}
+
+	if err = u.Done(tx); err != nil {
+		return err
+	}
+
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unwindDatastream removes the blocks after the given one from the stream
+func unwindDatastream(logPrefix string, reader *hermez_db.HermezDbReader, srv server.DataStreamServer, blockNum uint64) error {
+	highestBlock, err := srv.GetHighestBlockNumber()
+	if err != nil {
+		return err
+	}
+	if highestBlock <= blockNum {
+		return nil
+	}
+
+	// the stream is cut at the end of the batch of the block, without it the stream would be cut at batch 0
+	batchNum, err := reader.GetBatchNoByL2Block(blockNum)
+	if errors.Is(err, hermez_db.ErrorNotStored) || (err == nil && batchNum == 0 && blockNum > 0) {
+		return fmt.Errorf("the batch of block %d is not stored, the datastream can't be unwound to it", blockNum)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info(fmt.Sprintf("[%s] Unwinding the datastream", logPrefix), "from", highestBlock, "to", blockNum, "batch", batchNum)
+
+	return srv.UnwindAfterBlock(blockNum, batchNum)
+}
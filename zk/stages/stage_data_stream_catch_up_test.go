@@ -14,6 +14,7 @@ import (
 	"github.com/ledgerwatch/erigon/eth/stagedsync"
 	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
 	"github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/zk/datastream/server"
 	mocks "github.com/ledgerwatch/erigon/zk/datastream/mock_services"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	"github.com/stretchr/testify/require"
@@ -89,7 +90,7 @@ func TestSpawnStageDataStreamCatchup(t *testing.T) {
 
 	dataStreamServerMock.EXPECT().WriteBlocksToStreamConsecutively(ctx, s.LogPrefix(), tx1, hDBReaderMatcher, uint64(1), uint64(20)).Return(nil)
 
-	cfg := StageDataStreamCatchupCfg(dataStreamServerMock, db1, chainID, streamVersion, true)
+	cfg := StageDataStreamCatchupCfg(dataStreamServerMock, db1, chainID, streamVersion, true, 0)
 
 	// Act
 	err = SpawnStageDataStreamCatchup(s, ctx, tx1, cfg)
@@ -101,3 +102,95 @@ func TestSpawnStageDataStreamCatchup(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, uint64(20), stageProgress)
 }
+
+func TestUnwindDataStreamCatchupStage(t *testing.T) {
+	ctx, db1 := context.Background(), memdb.NewTestDB(t)
+	tx1 := memdb.BeginRw(t, db1)
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx1))
+
+	hDB := hermez_db.NewHermezDb(tx1)
+	for blockNum := uint64(1); blockNum <= 20; blockNum++ {
+		require.NoError(t, hDB.WriteBlockBatch(blockNum, 1+blockNum/5))
+	}
+	require.NoError(t, stages.SaveStageProgress(tx1, stages.DataStream, 20))
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataStreamServerMock := mocks.NewMockDataStreamServer(mockCtrl)
+	cfg := StageDataStreamCatchupCfg(dataStreamServerMock, db1, 1, 1, true, 0)
+
+	// block 9 is the last one of batch 2, the stream is taken back to its batch end
+	dataStreamServerMock.EXPECT().GetHighestBlockNumber().Return(uint64(20), nil)
+	dataStreamServerMock.EXPECT().UnwindAfterBlock(uint64(9), uint64(2)).Return(nil)
+
+	u := &stagedsync.UnwindState{ID: stages.DataStream, UnwindPoint: 9}
+	require.NoError(t, UnwindDataStreamCatchupStage(u, tx1, cfg, ctx))
+
+	stageProgress, err := stages.GetStageProgress(tx1, stages.DataStream)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), stageProgress)
+
+	// nothing to remove when the stream is not past the unwind point
+	dataStreamServerMock.EXPECT().GetHighestBlockNumber().Return(uint64(5), nil)
+	u = &stagedsync.UnwindState{ID: stages.DataStream, UnwindPoint: 7}
+	require.NoError(t, UnwindDataStreamCatchupStage(u, tx1, cfg, ctx))
+
+	// the stream is left as it is when the batch of the block to unwind to is unknown
+	dataStreamServerMock.EXPECT().GetHighestBlockNumber().Return(uint64(30), nil)
+	u = &stagedsync.UnwindState{ID: stages.DataStream, UnwindPoint: 25}
+	require.ErrorContains(t, UnwindDataStreamCatchupStage(u, tx1, cfg, ctx), "the batch of block 25 is not stored")
+
+	require.NoError(t, tx1.Delete(hermez_db.BLOCKBATCHES, hermez_db.Uint64ToBytes(3)))
+	dataStreamServerMock.EXPECT().GetHighestBlockNumber().Return(uint64(20), nil)
+	u = &stagedsync.UnwindState{ID: stages.DataStream, UnwindPoint: 3}
+	require.ErrorContains(t, UnwindDataStreamCatchupStage(u, tx1, cfg, ctx), "the batch of block 3 is not stored")
+}
+
+func TestReconcileDatastream(t *testing.T) {
+	t.Setenv("CDK_ERIGON_SEQUENCER", "")
+
+	ctx, db1 := context.Background(), memdb.NewTestDB(t)
+	tx1 := memdb.BeginRw(t, db1)
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx1))
+
+	hDB := hermez_db.NewHermezDb(tx1)
+	for blockNum := uint64(1); blockNum <= 20; blockNum++ {
+		require.NoError(t, hDB.WriteBlockBatch(blockNum, 1+blockNum/5))
+	}
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	streamServerMock := mocks.NewMockStreamServer(mockCtrl)
+	dataStreamServerMock := mocks.NewMockDataStreamServer(mockCtrl)
+	hDBReaderMatcher := gomock.AssignableToTypeOf(&hermez_db.HermezDbReader{})
+
+	// block 20 is in batch 5, the latest 2 batches are compared and the batch ends checked outside the sequencer
+	matching := &server.ReconcileReport{FromBlock: 15, ToBlock: 20, Entries: 40}
+	dataStreamServerMock.EXPECT().CompareWithDb(tx1, hDBReaderMatcher, uint64(4), uint64(20), true).Return(matching, nil)
+	require.NoError(t, reconcileDatastream(ctx, "test", tx1, dataStreamServerMock, 2, 20))
+
+	// the stream is rewritten from the block of the first entry that differs
+	diverging := &server.ReconcileReport{
+		FromBlock:        15,
+		ToBlock:          20,
+		Entries:          12,
+		Divergence:       &server.Divergence{Kind: server.DivergenceGerUpdate, Block: 17, Batch: 4, Entry: 130},
+		RewriteFromEntry: 128,
+		RewriteFromBlock: 17,
+		TableMismatches:  []server.Divergence{{Kind: server.DivergenceBatchEnds, Block: 14, Batch: 3}},
+	}
+	dataStreamServerMock.EXPECT().CompareWithDb(tx1, hDBReaderMatcher, uint64(4), uint64(20), true).Return(diverging, nil)
+	dataStreamServerMock.EXPECT().GetStreamServer().Return(streamServerMock)
+	streamServerMock.EXPECT().GetHeader().Return(datastreamer.HeaderEntry{TotalEntries: 160})
+	dataStreamServerMock.EXPECT().RewriteDivergentTail(ctx, "test", tx1, hDBReaderMatcher, diverging).Return(nil)
+
+	repairs := reconcileRepairsCounter(server.DivergenceGerUpdate).GetValueUint64()
+	rewritten := reconcileRewrittenEntriesCounter.GetValueUint64()
+	require.NoError(t, reconcileDatastream(ctx, "test", tx1, dataStreamServerMock, 2, 20))
+	assert.Equal(t, repairs+1, reconcileRepairsCounter(server.DivergenceGerUpdate).GetValueUint64())
+	assert.Equal(t, rewritten+32, reconcileRewrittenEntriesCounter.GetValueUint64())
+
+	// more batches than the chain has start at the first one
+	dataStreamServerMock.EXPECT().CompareWithDb(tx1, hDBReaderMatcher, uint64(1), uint64(20), true).Return(matching, nil)
+	require.NoError(t, reconcileDatastream(ctx, "test", tx1, dataStreamServerMock, 10, 20))
+}
@@ -141,17 +141,28 @@ func SpawnZkIntermediateHashesStage(s *stagedsync.StageState, u stagedsync.Unwin
 		log.Info(fmt.Sprintf("[%s] SMT not using mapmutation", logPrefix))
 	}
 
+	recordHistory := smtHistoryEnabled(cfg.zk)
+
 	if shouldIncrement {
 		if shouldIncrementBecauseOfAFlag {
 			log.Debug(fmt.Sprintf("[%s] IncrementTreeAlways true - incrementing tree", logPrefix), "previousRootHeight", s.BlockNumber, "calculatingRootHeight", to)
 		}
-		if root, err = zkIncrementIntermediateHashes(ctx, logPrefix, s, tx, eridb, smt, s.BlockNumber, to); err != nil {
+		if recordHistory {
+			if root, err = zkIncrementIntermediateHashesWithHistory(ctx, logPrefix, s, tx, eridb, smt, s.BlockNumber, to, cfg.zk.SmtHistoryCheckpointInterval); err != nil {
+				return trie.EmptyRoot, err
+			}
+		} else if root, err = zkIncrementIntermediateHashes(ctx, logPrefix, s, tx, eridb, smt, s.BlockNumber, to); err != nil {
 			return trie.EmptyRoot, err
 		}
 	} else {
-		if root, err = regenerateIntermediateHashes(ctx, logPrefix, tx, eridb, smt, to); err != nil {
+		if root, err = regenerateIntermediateHashes(ctx, logPrefix, tx, eridb, smt, to, cfg.zk.SmtRegenerateWorkers); err != nil {
 			return trie.EmptyRoot, err
 		}
+		if recordHistory {
+			if err = resetSmtHistory(eridb, to, root); err != nil {
+				return trie.EmptyRoot, err
+			}
+		}
 	}
 
 	log.Info(fmt.Sprintf("[%s] Trie root", logPrefix), "hash", root.Hex())
@@ -183,6 +194,12 @@ func SpawnZkIntermediateHashesStage(s *stagedsync.StageState, u stagedsync.Unwin
 		}
 	}
 
+	if recordHistory {
+		if err = finishSmtHistory(logPrefix, eridb, to, root, cfg.zk.SmtHistoryBlocks); err != nil {
+			return trie.EmptyRoot, err
+		}
+	}
+
 	if err = s.Update(tx, to); err != nil {
 		return trie.EmptyRoot, err
 	}
@@ -225,7 +242,12 @@ func UnwindZkIntermediateHashesStage(u *stagedsync.UnwindState, s *stagedsync.St
 	if err != nil {
 		return err
 	}
-	_ = root
+
+	if smtHistoryEnabled(cfg.zk) {
+		if err := unwindSmtHistory(db2.NewEriDb(tx), u.UnwindPoint, root); err != nil {
+			return err
+		}
+	}
 
 	hermezDb := hermez_db.NewHermezDb(tx)
 	if err := hermezDb.TruncateSmtDepths(u.UnwindPoint); err != nil {
@@ -243,7 +265,7 @@ func UnwindZkIntermediateHashesStage(u *stagedsync.UnwindState, s *stagedsync.St
 	return nil
 }
 
-func regenerateIntermediateHashes(ctx context.Context, logPrefix string, db kv.RwTx, eridb *db2.EriDb, smtIn *smt.SMT, toBlock uint64) (common.Hash, error) {
+func regenerateIntermediateHashes(ctx context.Context, logPrefix string, db kv.RwTx, eridb *db2.EriDb, smtIn *smt.SMT, toBlock uint64, workers int) (common.Hash, error) {
 	log.Info(fmt.Sprintf("[%s] Regeneration trie hashes started", logPrefix))
 	defer log.Info(fmt.Sprintf("[%s] Regeneration ended", logPrefix))
 
@@ -251,11 +273,6 @@ func regenerateIntermediateHashes(ctx context.Context, logPrefix string, db kv.R
 		log.Warn(fmt.Sprint("regenerate SaveStageProgress to zero error: ", err))
 	}
 
-	var a *accounts.Account
-	var addr common.Address
-	var as map[string]string
-	var inc uint64
-
 	psr := state2.NewPlainStateReader(db)
 
 	log.Info(fmt.Sprintf("[%s] Collecting account data...", logPrefix))
@@ -274,41 +291,13 @@ func regenerateIntermediateHashes(ctx context.Context, logPrefix string, db kv.R
 	progressChan, stopProgressPrinter := zk.ProgressPrinterWithoutValues(fmt.Sprintf("[%s] SMT regenerate progress", logPrefix), total*2)
 
 	progCt := uint64(0)
-	err := psr.ForEach(kv.PlainState, nil, func(k, acc []byte) error {
+	err := forEachPlainStateAccount(psr, func() {
 		progCt++
 		progressChan <- progCt
+	}, func(addr common.Address, a *accounts.Account, inc uint64, as map[string]string) error {
 		var err error
-		if len(k) == 20 {
-			if a != nil { // don't run process on first loop for first account (or it will miss collecting storage)
-				keys, err = processAccount(eridb, a, as, inc, psr, addr, keys)
-				if err != nil {
-					return err
-				}
-			}
-
-			a = &accounts.Account{}
-
-			if err := a.DecodeForStorage(acc); err != nil {
-				// TODO: not an account?
-				as = make(map[string]string)
-				return nil
-			}
-			addr = common.BytesToAddress(k)
-			inc = a.Incarnation
-			// empty storage of previous account
-			as = make(map[string]string)
-		} else { // otherwise we're reading storage
-			_, incarnation, key := dbutils.PlainParseCompositeStorageKey(k)
-			if incarnation != inc {
-				return nil
-			}
-
-			sk := fmt.Sprintf("0x%032x", key)
-			v := fmt.Sprintf("0x%032x", acc)
-
-			as[sk] = TrimHexString(v)
-		}
-		return nil
+		keys, err = processAccount(eridb, a, as, inc, psr, addr, keys)
+		return err
 	})
 
 	stopProgressPrinter()
@@ -317,17 +306,15 @@ func regenerateIntermediateHashes(ctx context.Context, logPrefix string, db kv.R
 		return trie.EmptyRoot, err
 	}
 
-	// process the final account
-	keys, err = processAccount(eridb, a, as, inc, psr, addr, keys)
-	if err != nil {
-		return trie.EmptyRoot, err
-	}
-
 	dataCollectTime := time.Since(dataCollectStartTime)
 	log.Info(fmt.Sprintf("[%s] Collecting account data finished in %v", logPrefix, dataCollectTime))
 
 	// generate tree
-	if _, err := smtIn.GenerateFromKVBulk(ctx, logPrefix, keys); err != nil {
+	if workers == 1 {
+		if _, err := smtIn.GenerateFromKVBulk(ctx, logPrefix, keys); err != nil {
+			return trie.EmptyRoot, err
+		}
+	} else if _, err := smtIn.GenerateFromKVBulkParallel(ctx, logPrefix, keys, workers); err != nil {
 		return trie.EmptyRoot, err
 	}
 
@@ -457,12 +444,30 @@ func zkIncrementIntermediateHashes(ctx context.Context, logPrefix string, s *sta
 }
 
 func unwindZkSMT(ctx context.Context, logPrefix string, from, to uint64, db kv.RwTx, checkRoot bool, expectedRootHash *common.Hash, quiet bool, quit <-chan struct{}) (common.Hash, error) {
+	return unwindZkSMTFrom(ctx, logPrefix, from, to, db, state2.NewPlainStateReader(db), false, checkRoot, expectedRootHash, quiet, quit)
+}
+
+// UnwindZkSMTFromCheckpoint unwinds the SMT of the given memory batch from the tree materialised at a checkpoint rather
+// than from the latest tree, reading the nodes the checkpoint's tree no longer shares with the latest one from the SMT
+// history.  The batch's last root must be set to the checkpoint's root beforehand
+func UnwindZkSMTFromCheckpoint(ctx context.Context, logPrefix string, checkpoint, to uint64, db kv.RwTx) (common.Hash, error) {
+	// the state at the end of the checkpoint block, plain state only holds it for the latest block
+	currentPsr := state2.NewPlainState(db, checkpoint+1, systemcontracts.SystemContractCodeLookup["Hermez"])
+	defer currentPsr.Close()
+
+	return unwindZkSMTFrom(ctx, logPrefix, checkpoint, to, db, currentPsr, true, false, nil, true, ctx.Done())
+}
+
+func unwindZkSMTFrom(ctx context.Context, logPrefix string, from, to uint64, db kv.RwTx, currentPsr state2.StateReader, useHistory, checkRoot bool, expectedRootHash *common.Hash, quiet bool, quit <-chan struct{}) (common.Hash, error) {
 	if !quiet {
 		log.Info(fmt.Sprintf("[%s] Unwind trie hashes started", logPrefix))
 		defer log.Info(fmt.Sprintf("[%s] Unwind ended", logPrefix))
 	}
 
 	eridb := db2.NewEriDb(db)
+	if useHistory {
+		eridb.UseHistory()
+	}
 	dbSmt := smt.NewSMT(eridb, false)
 
 	if !quiet {
@@ -491,8 +496,6 @@ func unwindZkSMT(ctx context.Context, logPrefix string, from, to uint64, db kv.R
 	}
 	defer sc.Close()
 
-	currentPsr := state2.NewPlainStateReader(db)
-
 	total := uint64(math.Abs(float64(from) - float64(to) + 1))
 	printerStopped := false
 	progressChan, stopPrinter := zk.ProgressPrinter(fmt.Sprintf("[%s] Progress unwinding", logPrefix), total, quiet)
@@ -647,6 +650,58 @@ func verifyLastHash(dbSmt *smt.SMT, expectedRootHash *common.Hash, checkRoot boo
 	return nil
 }
 
+// forEachPlainStateAccount calls fn with every account of the plain state along with its storage, onEntry being called
+// for every plain state entry read
+func forEachPlainStateAccount(psr *state2.PlainStateReader, onEntry func(), fn func(addr common.Address, a *accounts.Account, inc uint64, as map[string]string) error) error {
+	var a *accounts.Account
+	var addr common.Address
+	var as map[string]string
+	var inc uint64
+
+	err := psr.ForEach(kv.PlainState, nil, func(k, acc []byte) error {
+		onEntry()
+		if len(k) == 20 {
+			if a != nil { // don't run process on first loop for first account (or it will miss collecting storage)
+				if err := fn(addr, a, inc, as); err != nil {
+					return err
+				}
+			}
+
+			a = &accounts.Account{}
+
+			if err := a.DecodeForStorage(acc); err != nil {
+				// TODO: not an account?
+				as = make(map[string]string)
+				return nil
+			}
+			addr = common.BytesToAddress(k)
+			inc = a.Incarnation
+			// empty storage of previous account
+			as = make(map[string]string)
+		} else { // otherwise we're reading storage
+			_, incarnation, key := dbutils.PlainParseCompositeStorageKey(k)
+			if incarnation != inc {
+				return nil
+			}
+
+			sk := fmt.Sprintf("0x%032x", key)
+			v := fmt.Sprintf("0x%032x", acc)
+
+			as[sk] = TrimHexString(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// process the final account
+	if a == nil {
+		return nil
+	}
+	return fn(addr, a, inc, as)
+}
+
 func processAccount(db smt.DB, a *accounts.Account, as map[string]string, inc uint64, psr *state2.PlainStateReader, addr common.Address, keys []utils.NodeKey) ([]utils.NodeKey, error) {
 	// get the account balance and nonce
 	keys, err := insertAccountStateToKV(db, keys, addr.String(), a.Balance.ToBig(), new(big.Int).SetUint64(a.Nonce))
@@ -0,0 +1,223 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	state2 "github.com/ledgerwatch/erigon/core/state"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	db2 "github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/status-im/keycard-go/hexutils"
+)
+
+// CheckSmtAgainstPlainState walks the tree like smt.CheckTree and compares every leaf with the value the plain state
+// holds for its key source, reporting the leaves with a wrong value, the leaves the plain state doesn't have and the
+// plain state values missing from the tree. The tree has to be at the same block as the plain state.
+func CheckSmtAgainstPlainState(ctx context.Context, logPrefix string, tx kv.Tx, s *smt.RoSMT, trackVisited bool) (*smt.TreeCheck, error) {
+	psr := state2.NewPlainStateReader(tx)
+
+	matched := 0
+	var leafIssues []smt.NodeIssue
+	check, err := s.CheckTree(ctx, logPrefix, trackVisited, func(leaf *smt.TreeLeaf) error {
+		if leaf.KeySource == nil {
+			return nil
+		}
+		issue, err := checkLeafAgainstPlainState(psr, leaf)
+		if err != nil {
+			return err
+		}
+		if issue != nil {
+			leafIssues = append(leafIssues, *issue)
+		} else {
+			matched++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	check.Issues = append(check.Issues, leafIssues...)
+
+	expected := 0
+	if err := forEachPlainStateLeaf(psr, func(k utils.NodeKey, _ *utils.NodeValue8, _ []byte) error {
+		expected++
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("[%s] Compared the tree with the plain state", logPrefix), "matched", matched, "expected", expected)
+	if matched == expected {
+		return check, nil
+	}
+
+	// some plain state values have no leaf, look them up one by one to find where they are missing from
+	startTime := time.Now()
+	if err := forEachPlainStateLeaf(psr, func(k utils.NodeKey, v *utils.NodeValue8, _ []byte) error {
+		path, value, err := s.FindLeaf(k)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			check.Issues = append(check.Issues, smt.NodeIssue{
+				Kind:   smt.IssueMissingLeaf,
+				Path:   path,
+				Key:    k,
+				Detail: fmt.Sprintf("plain state holds %s", utils.ArrayBigToScalar(utils.BigIntArrayFromNodeValue8(v))),
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("[%s] Looked up the plain state values in %v", logPrefix, time.Since(startTime)))
+
+	return check, nil
+}
+
+// checkLeafAgainstPlainState returns the issue of a leaf whose key or value doesn't match its key source in the plain
+// state, nil if it matches
+func checkLeafAgainstPlainState(psr *state2.PlainStateReader, leaf *smt.TreeLeaf) (*smt.NodeIssue, error) {
+	issue := &smt.NodeIssue{Path: leaf.Path, Hash: leaf.Hash, Key: leaf.Key}
+
+	t, addr, storageKey, err := utils.DecodeKeySource(leaf.KeySource)
+	if err != nil {
+		issue.Kind, issue.Detail = smt.IssueMissingKeySource, err.Error()
+		return issue, nil
+	}
+
+	var key utils.NodeKey
+	switch t {
+	case utils.KEY_BALANCE:
+		key = utils.KeyEthAddrBalance(addr.String())
+	case utils.KEY_NONCE:
+		key = utils.KeyEthAddrNonce(addr.String())
+	case utils.SC_CODE:
+		key = utils.KeyContractCode(addr.String())
+	case utils.SC_LENGTH:
+		key = utils.KeyContractLength(addr.String())
+	case utils.SC_STORAGE:
+		key = utils.KeyContractStorage(utils.ScalarToArrayBig(utils.ConvertHexToBigInt(addr.String())), storageKey.String())
+	default:
+		issue.Kind, issue.Detail = smt.IssueMissingKeySource, fmt.Sprintf("unknown key source type %d", t)
+		return issue, nil
+	}
+	if key != leaf.Key {
+		issue.Kind, issue.Detail = smt.IssueMissingKeySource, fmt.Sprintf("key source of %s doesn't match the key", addr)
+		return issue, nil
+	}
+
+	expected, err := plainStateValue(psr, t, addr, storageKey)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case expected.Sign() == 0:
+		issue.Kind, issue.Detail = smt.IssueExtraLeaf, fmt.Sprintf("plain state holds no value for %s", addr)
+	case expected.Cmp(leaf.Value) != 0:
+		issue.Kind, issue.Detail = smt.IssueWrongValue, fmt.Sprintf("tree holds %s, plain state holds %s for %s", leaf.Value, expected, addr)
+	default:
+		return nil, nil
+	}
+	return issue, nil
+}
+
+// plainStateValue reads the value of the given key source type the way the regeneration of the tree computes it
+func plainStateValue(psr *state2.PlainStateReader, t int, addr common.Address, storageKey common.Hash) (*big.Int, error) {
+	a, err := psr.ReadAccountData(addr)
+	if err != nil || a == nil {
+		return new(big.Int), err
+	}
+
+	switch t {
+	case utils.KEY_BALANCE:
+		return a.Balance.ToBig(), nil
+	case utils.KEY_NONCE:
+		return new(big.Int).SetUint64(a.Nonce), nil
+	case utils.SC_CODE, utils.SC_LENGTH:
+		code, err := psr.ReadAccountCode(addr, a.Incarnation, a.CodeHash)
+		if err != nil || len(code) == 0 {
+			return new(big.Int), err
+		}
+		if t == utils.SC_LENGTH {
+			return big.NewInt(int64(len(code))), nil
+		}
+		return utils.HashContractBytecodeBigInt("0x" + hexutils.BytesToHex(code)), nil
+	default:
+		value, err := psr.ReadAccountStorage(addr, a.Incarnation, &storageKey)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(value), nil
+	}
+}
+
+// forEachPlainStateLeaf calls fn with the key, value and key source of every leaf the tree regenerated from the plain
+// state would hold
+func forEachPlainStateLeaf(psr *state2.PlainStateReader, fn func(k utils.NodeKey, v *utils.NodeValue8, keySource []byte) error) error {
+	return forEachPlainStateAccount(psr, func() {}, func(addr common.Address, a *accounts.Account, inc uint64, as map[string]string) error {
+		memDb := db2.NewMemDb()
+		keys, err := processAccount(memDb, a, as, inc, psr, addr, nil)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			v, err := memDb.GetAccountValue(k)
+			if err != nil {
+				return err
+			}
+			keySource, err := memDb.GetKeySource(k)
+			if err != nil {
+				return err
+			}
+			if err := fn(k, &v, keySource); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RepairSmt rebuilds the sub-trees holding the issues from the plain state, keeping the rest of the tree, and returns
+// the new root. The tree has to be at the same block as the plain state.
+func RepairSmt(ctx context.Context, logPrefix string, tx kv.RwTx, eridb *db2.EriDb, s *smt.SMT, issues []smt.NodeIssue) (common.Hash, error) {
+	paths := make([][]int, 0, len(issues))
+	for _, issue := range issues {
+		paths = append(paths, issue.Path)
+	}
+	subtrees := smt.NewSubtrees(paths)
+	log.Info(fmt.Sprintf("[%s] Repairing the tree", logPrefix), "issues", len(issues), "subtrees", subtrees.Len())
+
+	for _, issue := range issues {
+		if issue.Kind == smt.IssueExtraLeaf {
+			if err := eridb.DeleteKeySource(issue.Key); err != nil {
+				return common.Hash{}, err
+			}
+		}
+	}
+
+	psr := state2.NewPlainStateReader(tx)
+	leaves := 0
+	if err := forEachPlainStateLeaf(psr, func(k utils.NodeKey, v *utils.NodeValue8, keySource []byte) error {
+		if !subtrees.Add(k, *v) {
+			return nil
+		}
+		leaves++
+		return eridb.InsertKeySource(k, keySource)
+	}); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info(fmt.Sprintf("[%s] Collected the leaves of the sub-trees", logPrefix), "leaves", leaves)
+
+	root, err := s.RebuildSubtrees(ctx, logPrefix, subtrees)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BigToHash(utils.ArrayToScalar(root[:])), nil
+}
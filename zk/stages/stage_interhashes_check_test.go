@@ -0,0 +1,103 @@
+package stages
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/dbutils"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/crypto"
+	db2 "github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/stretchr/testify/require"
+)
+
+func putTestAccount(t *testing.T, tx kv.RwTx, addr common.Address, balance, nonce uint64, code []byte, storage map[common.Hash]uint64) {
+	a := accounts.NewAccount()
+	a.Balance = *uint256.NewInt(balance)
+	a.Nonce = nonce
+	if len(code) > 0 {
+		a.Incarnation = 1
+		a.CodeHash = crypto.Keccak256Hash(code)
+		require.NoError(t, tx.Put(kv.Code, a.CodeHash.Bytes(), code))
+	}
+	value := make([]byte, a.EncodingLengthForStorage())
+	a.EncodeForStorage(value)
+	require.NoError(t, tx.Put(kv.PlainState, addr.Bytes(), value))
+
+	for k, v := range storage {
+		storageKey := dbutils.PlainGenerateCompositeStorageKey(addr.Bytes(), a.Incarnation, k.Bytes())
+		if v == 0 {
+			require.NoError(t, tx.Delete(kv.PlainState, storageKey))
+			continue
+		}
+		require.NoError(t, tx.Put(kv.PlainState, storageKey, uint256.NewInt(v).Bytes()))
+	}
+}
+
+func newTestSmtTx(t *testing.T) (kv.RwTx, *db2.EriDb, *smt.SMT) {
+	_, tx := memdb.NewTestTx(t)
+	require.NoError(t, db2.CreateEriDbBuckets(tx))
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+	eridb := db2.NewEriDb(tx)
+	return tx, eridb, smt.NewSMT(eridb, false)
+}
+
+func fillTestPlainState(t *testing.T, tx kv.RwTx) {
+	for i := byte(1); i <= 50; i++ {
+		putTestAccount(t, tx, common.Address{i}, uint64(i)*1000, uint64(i), nil, nil)
+	}
+	putTestAccount(t, tx, common.Address{0xc0}, 1, 1, []byte{0x60, 0x80, 0x60, 0x40}, map[common.Hash]uint64{
+		{1}: 10,
+		{2}: 20,
+		{3}: 30,
+	})
+}
+
+func TestCheckAndRepairSmt(t *testing.T) {
+	ctx := context.Background()
+
+	tx, eridb, s := newTestSmtTx(t)
+	fillTestPlainState(t, tx)
+	_, err := regenerateIntermediateHashes(ctx, "test", tx, eridb, s, 0, 1)
+	require.NoError(t, err)
+
+	check, err := CheckSmtAgainstPlainState(ctx, "test", tx, s.RoSMT, false)
+	require.NoError(t, err)
+	require.Empty(t, check.Issues)
+	require.Equal(t, 50*2+4+3, check.Leaves)
+
+	// change the plain state under the tree: a new balance, a removed storage slot and a new account
+	putTestAccount(t, tx, common.Address{7}, 1, 7, nil, nil)
+	putTestAccount(t, tx, common.Address{0xc0}, 1, 1, []byte{0x60, 0x80, 0x60, 0x40}, map[common.Hash]uint64{{2}: 0})
+	putTestAccount(t, tx, common.Address{0xaa}, 5, 0, nil, nil)
+
+	check, err = CheckSmtAgainstPlainState(ctx, "test", tx, s.RoSMT, false)
+	require.NoError(t, err)
+	kinds := make(map[smt.IssueKind]int)
+	for _, issue := range check.Issues {
+		kinds[issue.Kind]++
+	}
+	require.Equal(t, map[smt.IssueKind]int{smt.IssueWrongValue: 1, smt.IssueExtraLeaf: 1, smt.IssueMissingLeaf: 1}, kinds)
+
+	root, err := RepairSmt(ctx, "test", tx, eridb, s, check.Issues)
+	require.NoError(t, err)
+
+	expectedTx, expectedEridb, expectedSmt := newTestSmtTx(t)
+	fillTestPlainState(t, expectedTx)
+	putTestAccount(t, expectedTx, common.Address{7}, 1, 7, nil, nil)
+	putTestAccount(t, expectedTx, common.Address{0xc0}, 1, 1, []byte{0x60, 0x80, 0x60, 0x40}, map[common.Hash]uint64{{2}: 0})
+	putTestAccount(t, expectedTx, common.Address{0xaa}, 5, 0, nil, nil)
+	expectedRoot, err := regenerateIntermediateHashes(ctx, "test", expectedTx, expectedEridb, expectedSmt, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, expectedRoot, root)
+
+	check, err = CheckSmtAgainstPlainState(ctx, "test", tx, s.RoSMT, false)
+	require.NoError(t, err)
+	require.Empty(t, check.Issues)
+}
@@ -0,0 +1,107 @@
+package stages
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/eth/ethconfig"
+	"github.com/ledgerwatch/erigon/eth/stagedsync"
+	db2 "github.com/ledgerwatch/erigon/smt/pkg/db"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+)
+
+func smtHistoryEnabled(cfg *ethconfig.Zk) bool {
+	return cfg != nil && cfg.SmtHistoryBlocks > 0
+}
+
+// startSmtHistory marks the tree the SMT currently holds as the first one historical proofs can be served for.  It
+// only does anything the first time the SMT changes with history enabled, or after the history has been reset
+func startSmtHistory(eridb *db2.EriDb, blockNo uint64) error {
+	if _, found, err := eridb.GetHistoryStart(); err != nil || found {
+		return err
+	}
+	root, err := eridb.GetLastRoot()
+	if err != nil {
+		return err
+	}
+	if err = eridb.WriteCheckpoint(blockNo, root); err != nil {
+		return err
+	}
+	return eridb.SetHistoryStart(blockNo)
+}
+
+// finishSmtHistory records the tree materialised for the block as a checkpoint and drops the history that has fallen
+// out of the retention window
+func finishSmtHistory(logPrefix string, eridb *db2.EriDb, blockNo uint64, root common.Hash, retain uint64) error {
+	if err := eridb.WriteCheckpoint(blockNo, root.Big()); err != nil {
+		return err
+	}
+	if blockNo <= retain {
+		return nil
+	}
+	pruned, err := eridb.PruneHistory(blockNo - retain)
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		log.Debug(fmt.Sprintf("[%s] Pruned SMT history", logPrefix), "nodes", pruned, "historyStart", blockNo-retain)
+	}
+	return nil
+}
+
+// resetSmtHistory starts the history again from the given block, used when the tree is rebuilt from scratch and the
+// nodes of earlier trees weren't archived
+func resetSmtHistory(eridb *db2.EriDb, blockNo uint64, root common.Hash) error {
+	if err := eridb.WriteCheckpoint(blockNo, root.Big()); err != nil {
+		return err
+	}
+	return eridb.SetHistoryStart(blockNo)
+}
+
+// unwindSmtHistory drops the checkpoints of the unwound blocks.  The tree the SMT was unwound to is materialised so it
+// becomes a checkpoint itself, and the history can be served from it on if it started later
+func unwindSmtHistory(eridb *db2.EriDb, unwindPoint uint64, root common.Hash) error {
+	start, found, err := eridb.GetHistoryStart()
+	if err != nil || !found {
+		return err
+	}
+	if err = eridb.DeleteCheckpointsFrom(unwindPoint + 1); err != nil {
+		return err
+	}
+	if err = eridb.WriteCheckpoint(unwindPoint, root.Big()); err != nil {
+		return err
+	}
+	if start > unwindPoint {
+		return eridb.SetHistoryStart(unwindPoint)
+	}
+	return nil
+}
+
+// zkIncrementIntermediateHashesWithHistory increments the tree in steps of at most interval blocks, archiving the nodes
+// each step deletes and recording the tree at the end of every step but the last as a checkpoint.  The caller records
+// the final tree once it has been checked
+func zkIncrementIntermediateHashesWithHistory(ctx context.Context, logPrefix string, s *stagedsync.StageState, db kv.RwTx, eridb *db2.EriDb, dbSmt *smt.SMT, from, to, interval uint64) (common.Hash, error) {
+	if err := startSmtHistory(eridb, from); err != nil {
+		return common.Hash{}, err
+	}
+	if interval == 0 || to < from {
+		interval = to - from
+	}
+
+	for stepFrom := from; ; {
+		stepTo := min(stepFrom+interval, to)
+		eridb.RecordHistory(stepTo)
+		root, err := zkIncrementIntermediateHashes(ctx, logPrefix, s, db, eridb, dbSmt, stepFrom, stepTo)
+		if err != nil || stepTo == to {
+			return root, err
+		}
+		if err = eridb.WriteCheckpoint(stepTo, root.Big()); err != nil {
+			return common.Hash{}, err
+		}
+		stepFrom = stepTo
+	}
+}
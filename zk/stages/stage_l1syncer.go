@@ -21,6 +21,7 @@ import (
 	"github.com/ledgerwatch/erigon/zk/contracts"
 	"github.com/ledgerwatch/erigon/zk/hermez_db"
 	"github.com/ledgerwatch/erigon/zk/sequencer"
+	"github.com/ledgerwatch/erigon/zk/syncer"
 	"github.com/ledgerwatch/erigon/zk/types"
 )
 
@@ -29,6 +30,7 @@ type IL1Syncer interface {
 	// atomic
 	IsSyncStarted() bool
 	IsDownloading() bool
+	IsReorgDetected() bool
 	GetLastCheckedL1Block() uint64
 
 	// Channels
@@ -49,6 +51,7 @@ var (
 	ErrStateRootMismatch = errors.New("state root mismatch")
 
 	lastCheckedL1BlockCounter = metrics.GetOrCreateGauge(`last_checked_l1_block`)
+	l1ReorgsCounter           = metrics.GetOrCreateCounter(`l1_syncer_reorgs`)
 )
 
 type L1SyncerCfg struct {
@@ -109,6 +112,15 @@ func SpawnStageL1Syncer(
 		return fmt.Errorf("failed to get l1 progress block, %w", err)
 	}
 
+	// when following an L1 block that can still be reorganised check that what we stored is still canonical, either
+	// because the syncer has spotted a reorg or because we don't know what happened to the L1 since the last run
+	if cfg.syncer.IsReorgDetected() || (!cfg.syncer.IsSyncStarted() && cfg.zkCfg.L1HighestBlockType != "finalized") {
+		cfg.syncer.WaitQueryBlocksToFinish()
+		if l1BlockProgress, err = unwindL1BatchInfoOnReorg(logPrefix, tx, hermezDb, cfg.syncer, l1BlockProgress); err != nil {
+			return fmt.Errorf("failed to unwind L1 reorg, %w", err)
+		}
+	}
+
 	// start syncer if not started
 	if !cfg.syncer.IsSyncStarted() {
 		if l1BlockProgress == 0 {
@@ -152,6 +164,10 @@ Loop:
 						funcErr = fmt.Errorf("failed to write batch info, %w", err)
 						return funcErr
 					}
+					if err := hermezDb.WriteL1BatchInfoBlockHash(l.BlockNumber, l.BlockHash); err != nil {
+						funcErr = fmt.Errorf("failed to write l1 block hash, %w", err)
+						return funcErr
+					}
 					if info.L1BlockNo > highestWrittenL1BlockNo {
 						highestWrittenL1BlockNo = info.L1BlockNo
 					}
@@ -161,6 +177,10 @@ Loop:
 						funcErr = fmt.Errorf("failed to write rollback sequence, %w", err)
 						return funcErr
 					}
+					if err := hermezDb.WriteL1BatchInfoBlockHash(l.BlockNumber, l.BlockHash); err != nil {
+						funcErr = fmt.Errorf("failed to write l1 block hash, %w", err)
+						return funcErr
+					}
 					if info.L1BlockNo > highestWrittenL1BlockNo {
 						highestWrittenL1BlockNo = info.L1BlockNo
 					}
@@ -178,6 +198,10 @@ Loop:
 						funcErr = fmt.Errorf("failed to write verification for block %d, %w", info.L1BlockNo, err)
 						return funcErr
 					}
+					if err := hermezDb.WriteL1BatchInfoBlockHash(l.BlockNumber, l.BlockHash); err != nil {
+						funcErr = fmt.Errorf("failed to write l1 block hash, %w", err)
+						return funcErr
+					}
 					if info.L1BlockNo > highestWrittenL1BlockNo {
 						highestWrittenL1BlockNo = info.L1BlockNo
 					}
@@ -310,6 +334,49 @@ func parseLogType(l1RollupId uint64, log *ethTypes.Log) (l1BatchInfo types.L1Bat
 	}, batchLogType
 }
 
+// unwindL1BatchInfoOnReorg finds the first stored L1 block that is no longer canonical and deletes the sequences and
+// verifications from there on, returning the L1 block the syncer should carry on from: the highest stored block that
+// is still canonical, as the blocks after it can hold logs of the new fork even where nothing was stored
+func unwindL1BatchInfoOnReorg(logPrefix string, tx kv.RwTx, hermezDb *hermez_db.HermezDb, l1Syncer IL1Syncer, l1BlockProgress uint64) (uint64, error) {
+	reorgPoint, canonicalBlock, err := syncer.FindL1ReorgPoint(l1Syncer.GetHeader, hermezDb.GetL1BatchInfoBlockHashBelow)
+	if err != nil {
+		return 0, err
+	}
+
+	if reorgPoint != 0 {
+		l1ReorgsCounter.Inc()
+		log.Warn(fmt.Sprintf("[%s] L1 reorg detected, unwinding L1 sequences and verifications", logPrefix), "fromL1Block", reorgPoint, "l1BlockProgress", l1BlockProgress)
+
+		if err = hermezDb.UnwindL1BatchInfo(reorgPoint); err != nil {
+			return 0, err
+		}
+
+		var highestVerifiedBatch uint64
+		latestVerification, err := hermezDb.GetLatestVerification()
+		if err != nil {
+			return 0, err
+		}
+		if latestVerification != nil {
+			highestVerifiedBatch = latestVerification.BatchNo
+		}
+		if err = stages.SaveStageProgress(tx, stages.L1VerificationsBatchNo, highestVerifiedBatch); err != nil {
+			return 0, err
+		}
+	}
+
+	// the progress only moves on to blocks holding sequences or verifications, so with nothing stored it's still at the start
+	if l1BlockProgress <= canonicalBlock || (reorgPoint == 0 && canonicalBlock == 0) {
+		return l1BlockProgress, nil
+	}
+
+	log.Info(fmt.Sprintf("[%s] Checking the L1 again from the last canonical block holding sequences or verifications", logPrefix), "l1Block", canonicalBlock, "l1BlockProgress", l1BlockProgress)
+	if err = stages.SaveStageProgress(tx, stages.L1Syncer, canonicalBlock); err != nil {
+		return 0, err
+	}
+
+	return canonicalBlock, nil
+}
+
 func UnwindL1SyncerStage(u *stagedsync.UnwindState, tx kv.RwTx, cfg L1SyncerCfg, ctx context.Context) (err error) {
 	// we want to keep L1 data during an unwind, as we only sync finalised data there should be
 	// no need to unwind here
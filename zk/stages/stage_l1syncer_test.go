@@ -0,0 +1,76 @@
+package stages
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/cmd/rpcdaemon/commands/mocks"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/erigon/zk/syncer"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestUnwindL1BatchInfoOnReorg(t *testing.T) {
+	headers := map[uint64]*types.Header{}
+	for i := uint64(1); i <= 30; i++ {
+		headers[i] = &types.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0)}
+	}
+
+	tests := []struct {
+		name             string
+		forked           map[uint64]bool
+		expectedProgress uint64
+		expectedStored   uint64
+	}{
+		// the blocks between the last canonical sequence and the forked one are checked again
+		{"gap below the reorg point", map[uint64]bool{12: true}, 5, 5},
+		// nothing stored was forked but the blocks after the last sequence can be
+		{"no stored block forked", map[uint64]bool{}, 12, 12},
+		{"every stored block forked", map[uint64]bool{5: true, 12: true}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, db1 := context.Background(), memdb.NewTestDB(t)
+			tx := memdb.BeginRw(t, db1)
+			require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+			hDB := hermez_db.NewHermezDb(tx)
+
+			for batchNo, l1BlockNo := range []uint64{5, 12} {
+				hash := headers[l1BlockNo].Hash()
+				if tt.forked[l1BlockNo] {
+					hash = common.HexToHash("0xf0")
+				}
+				require.NoError(t, hDB.WriteSequence(l1BlockNo, uint64(batchNo+1), common.Hash{}, common.Hash{}, common.Hash{}))
+				require.NoError(t, hDB.WriteL1BatchInfoBlockHash(l1BlockNo, hash))
+			}
+			require.NoError(t, stages.SaveStageProgress(tx, stages.L1Syncer, 25))
+
+			mockCtrl := gomock.NewController(t)
+			EthermanMock := mocks.NewMockIEtherman(mockCtrl)
+			EthermanMock.EXPECT().HeaderByNumber(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, number *big.Int) (*types.Header, error) {
+				return headers[number.Uint64()], nil
+			}).AnyTimes()
+			l1Syncer := syncer.NewL1Syncer(ctx, []syncer.IEtherman{EthermanMock}, nil, nil, 10, 0, "latest")
+
+			progress, err := unwindL1BatchInfoOnReorg("test", tx, hDB, l1Syncer, 25)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedProgress, progress)
+
+			saved, err := stages.GetStageProgress(tx, stages.L1Syncer)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedProgress, saved)
+
+			stored, _, err := hDB.GetL1BatchInfoBlockHashBelow(math.MaxUint64)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedStored, stored)
+		})
+	}
+}
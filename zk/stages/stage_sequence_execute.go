@@ -148,6 +148,12 @@ func sequencingBatchStep(
 		// if we identify any.  During normal operation this function will simply check and move on without performing
 		// any action.
 		if !batchState.isAnyRecovery() {
+			// give the verifications that were still running when the sequencer stopped a chance to finish, so that
+			// their blocks make it into the data stream rather than being unwound below
+			if err = resumePendingVerifications(batchContext, streamWriter, executionAt); err != nil {
+				return err
+			}
+
 			isUnwinding, err := alignExecutionToDatastream(batchContext, executionAt, u)
 			if err != nil {
 				// do not set shouldCheckForExecutionAndDataStreamAlighment=false because of the error
@@ -638,7 +644,13 @@ func sequencingBatchStep(
 		if err != nil {
 			return err
 		}
-		cfg.legacyVerifier.StartAsyncVerification(batchContext.s.LogPrefix(), batchState.forkId, batchState.batchNumber, block.Root(), counters.UsedAsMap(), batchState.builtBlocks, useExecutorForVerification, batchContext.cfg.zk.SequencerBatchVerificationTimeout, batchContext.cfg.zk.SequencerBatchVerificationRetries)
+		request, err := cfg.legacyVerifier.StartAsyncVerification(sdb.tx, batchContext.s.LogPrefix(), batchState.forkId, batchState.batchNumber, block.Root(), counters.UsedAsMap(), batchState.builtBlocks, useExecutorForVerification, batchContext.cfg.zk.SequencerBatchVerificationTimeout, batchContext.cfg.zk.SequencerBatchVerificationRetries)
+		if err != nil {
+			return err
+		}
+		if err = persistVerifierRequest(sdb.hermezDb, request); err != nil {
+			return err
+		}
 
 		// check for new responses from the verifier
 		needsUnwind, err := updateStreamAndCheckRollback(batchContext, batchState, streamWriter, u)
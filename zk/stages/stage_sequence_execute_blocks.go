@@ -182,10 +182,22 @@ func finaliseBlock(
 	}
 
 	// this is actually the interhashes stage
+	recordHistory := smtHistoryEnabled(batchContext.cfg.zk)
+	if recordHistory {
+		if err = startSmtHistory(batchContext.sdb.eridb, newHeader.Number.Uint64()-1); err != nil {
+			return nil, err
+		}
+		batchContext.sdb.eridb.RecordHistory(newHeader.Number.Uint64())
+	}
 	newRoot, err := zkIncrementIntermediateHashes(batchContext.ctx, batchContext.s.LogPrefix(), batchContext.s, batchContext.sdb.tx, batchContext.sdb.eridb, batchContext.sdb.smt, newHeader.Number.Uint64()-1, newHeader.Number.Uint64())
 	if err != nil {
 		return nil, err
 	}
+	if recordHistory {
+		if err = finishSmtHistory(batchContext.s.LogPrefix(), batchContext.sdb.eridb, newHeader.Number.Uint64(), newRoot, batchContext.cfg.zk.SmtHistoryBlocks); err != nil {
+			return nil, err
+		}
+	}
 
 	finalHeader := finalBlock.HeaderNoCopy()
 	finalHeader.Root = newRoot
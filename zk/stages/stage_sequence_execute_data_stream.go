@@ -93,6 +93,10 @@ func (sbc *SequencerBatchStreamWriter) writeBlockDetailsToDatastream(verifiedBun
 			if err = stages.SaveStageProgress(sbc.sdb.tx, stages.DataStream, block.NumberU64()); err != nil {
 				return checkedVerifierBundles, err
 			}
+
+			if err = sbc.sdb.hermezDb.DeletePendingVerification(request.GetLastBlockNumber()); err != nil {
+				return checkedVerifierBundles, err
+			}
 		}
 
 		checkedVerifierBundles = append(checkedVerifierBundles, bundle)
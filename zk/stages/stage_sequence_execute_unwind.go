@@ -138,6 +138,10 @@ func UnwindSequenceExecutionStageDbWrites(ctx context.Context, u *stagedsync.Unw
 	if err = hermezDb.DeleteBatchCounters(u.UnwindPoint+1, s.BlockNumber); err != nil {
 		return fmt.Errorf("truncate block batches error: %v", err)
 	}
+	// only seq
+	if err = hermezDb.DeletePendingVerificationsFrom(u.UnwindPoint + 1); err != nil {
+		return fmt.Errorf("truncate pending verifications error: %v", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,102 @@
+package stages
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/log/v3"
+
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	verifier "github.com/ledgerwatch/erigon/zk/legacy_executor_verifier"
+)
+
+// persistVerifierRequest records a request until its result is written to the data stream, so that a restart can pick
+// it up again instead of unwinding the blocks it covers
+func persistVerifierRequest(hermezDb *hermez_db.HermezDb, request *verifier.VerifierRequest) error {
+	encoded, err := request.Encode()
+	if err != nil {
+		return err
+	}
+	return hermezDb.WritePendingVerification(request.GetLastBlockNumber(), encoded)
+}
+
+// resumePendingVerifications sends the requests persisted before a restart to the executors again and writes the
+// blocks they verify to the data stream.  It stops at the first request that fails, anything still beyond the data
+// stream after that is unwound by alignExecutionToDatastream as before
+func resumePendingVerifications(batchContext *BatchContext, streamWriter *SequencerBatchStreamWriter, executionAt uint64) error {
+	logPrefix := batchContext.s.LogPrefix()
+	hermezDb := batchContext.sdb.hermezDb
+	legacyVerifier := batchContext.cfg.legacyVerifier
+
+	encodedRequests, err := hermezDb.GetPendingVerifications()
+	if err != nil {
+		return err
+	}
+	if len(encodedRequests) == 0 {
+		return nil
+	}
+
+	lastDatastreamBlock, err := batchContext.cfg.dataStreamServer.GetHighestBlockNumber()
+	if err != nil {
+		return err
+	}
+
+	resumed := 0
+	for _, encoded := range encodedRequests {
+		request, err := verifier.DecodeVerifierRequest(encoded)
+		if err != nil {
+			return fmt.Errorf("decode pending verification: %w", err)
+		}
+
+		lastBlock := request.GetLastBlockNumber()
+		// either already in the data stream or the blocks are gone, nothing to resume
+		if lastBlock <= lastDatastreamBlock || lastBlock > executionAt {
+			if err = hermezDb.DeletePendingVerification(lastBlock); err != nil {
+				return err
+			}
+			continue
+		}
+
+		legacyVerifier.ResumeVerification(logPrefix, request)
+		resumed++
+	}
+
+	if resumed == 0 {
+		return nil
+	}
+
+	log.Info(fmt.Sprintf("[%s] Waiting for resumed verifications", logPrefix), "count", resumed, "streamHeight", lastDatastreamBlock, "sequencerHeight", executionAt)
+
+	// whatever happens the verifier shouldn't carry these into normal sequencing
+	defer legacyVerifier.CancelAllRequests()
+
+	for {
+		if pending, _ := legacyVerifier.HasPendingVerifications(); !pending {
+			break
+		}
+
+		checkedVerifierBundles, verifierBundleForUnwind, err := streamWriter.CommitNewUpdates()
+		if err != nil {
+			return err
+		}
+		if verifierBundleForUnwind != nil {
+			log.Warn(fmt.Sprintf("[%s] Resumed verification gave up", logPrefix), "batch", verifierBundleForUnwind.Request.BatchNumber, "block", verifierBundleForUnwind.Request.GetLastBlockNumber())
+			return nil
+		}
+		for _, verifierBundle := range checkedVerifierBundles {
+			if !verifierBundle.Response.Valid {
+				log.Warn(fmt.Sprintf("[%s] Resumed verification found an invalid block", logPrefix), "batch", verifierBundle.Request.BatchNumber, "block", verifierBundle.Request.GetLastBlockNumber())
+				return nil
+			}
+		}
+
+		select {
+		case <-batchContext.ctx.Done():
+			return batchContext.ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	log.Info(fmt.Sprintf("[%s] Resumed verifications finished", logPrefix), "count", resumed)
+	return nil
+}
@@ -433,7 +433,7 @@ func DefaultZkStages(
 				return SpawnStageDataStreamCatchup(s, ctx, txc.Tx, dataStreamCatchupCfg)
 			},
 			Unwind: func(firstCycle bool, u *stages.UnwindState, s *stages.StageState, txc wrap.TxContainer, logger log.Logger) error {
-				return nil
+				return UnwindDataStreamCatchupStage(u, txc.Tx, dataStreamCatchupCfg, ctx)
 			},
 			Prune: func(firstCycle bool, p *stages.PruneState, tx kv.RwTx, logger log.Logger) error {
 				return nil
@@ -484,6 +484,7 @@ var ZkSequencerUnwindOrder = stages.UnwindOrder{
 }
 
 var ZkUnwindOrder = stages.UnwindOrder{
+	stages2.DataStream,
 	stages2.TxLookup,
 	stages2.LogIndex,
 	stages2.HashState,
@@ -0,0 +1,720 @@
+package syncer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	ethereum "github.com/ledgerwatch/erigon"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/hexutility"
+	"github.com/ledgerwatch/log/v3"
+
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+const (
+	tagLatest    = "latest"
+	tagSafe      = "safe"
+	tagFinalized = "finalized"
+)
+
+// L1Archive is a recording of everything the L1 syncers fetched from the L1, it can be replayed through
+// ArchiveEtherman to run the L1 sync stages without network access
+type L1Archive struct {
+	// Tags maps block tags such as latest and finalized to the block number they resolved to when recorded
+	Tags         map[string]uint64
+	Headers      map[uint64]*ethTypes.Header
+	Blocks       map[uint64]hexutility.Bytes
+	Logs         []ethTypes.Log
+	Transactions map[common.Hash]hexutility.Bytes
+	Receipts     map[common.Hash]*ethTypes.Receipt
+	Calls        map[string]hexutility.Bytes
+	Storage      map[string]hexutility.Bytes
+	// LogRanges are the log queries answered when recording, the logs of anything outside them were never fetched
+	LogRanges []LogRange
+	logIndex  map[logKey]struct{}
+}
+
+// LogRange is a log query answered when recording, either a range of blocks or a single block by hash
+type LogRange struct {
+	From      uint64           `json:"from"`
+	To        uint64           `json:"to"`
+	BlockHash *common.Hash     `json:"blockHash,omitempty"`
+	Addresses []common.Address `json:"addresses,omitempty"`
+	Topics    [][]common.Hash  `json:"topics,omitempty"`
+}
+
+// covers tells if every log the query asks for was fetched with the logs of the range
+func (r *LogRange) covers(addresses []common.Address, topics [][]common.Hash) bool {
+	if len(r.Addresses) > 0 {
+		if len(addresses) == 0 {
+			return false
+		}
+		for _, addr := range addresses {
+			if !slices.Contains(r.Addresses, addr) {
+				return false
+			}
+		}
+	}
+	for i, sub := range r.Topics {
+		if len(sub) == 0 {
+			continue
+		}
+		if i >= len(topics) || len(topics[i]) == 0 {
+			return false
+		}
+		for _, topic := range topics[i] {
+			if !slices.Contains(sub, topic) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type logKey struct {
+	block  uint64
+	txHash common.Hash
+	index  uint
+}
+
+const (
+	recordHeader      = "header"
+	recordBlock       = "block"
+	recordLogs        = "logs"
+	recordTransaction = "transaction"
+	recordReceipt     = "receipt"
+	recordCall        = "call"
+	recordStorage     = "storage"
+)
+
+// archiveRecord is a line of an archive file. Archives are only ever appended to, so a recording keeps nothing in
+// memory but the records it hasn't written yet, and a later record of the same thing replaces the earlier one
+type archiveRecord struct {
+	Kind    string            `json:"kind"`
+	Number  uint64            `json:"number,omitempty"`
+	Tag     string            `json:"tag,omitempty"`
+	Key     string            `json:"key,omitempty"`
+	Hash    *common.Hash      `json:"hash,omitempty"`
+	Header  *ethTypes.Header  `json:"header,omitempty"`
+	Receipt *ethTypes.Receipt `json:"receipt,omitempty"`
+	Logs    []ethTypes.Log    `json:"logs,omitempty"`
+	Range   *LogRange         `json:"range,omitempty"`
+	Data    hexutility.Bytes  `json:"data,omitempty"`
+}
+
+var errTruncatedArchive = errors.New("the L1 archive ends in a partly written record")
+
+func NewL1Archive() *L1Archive {
+	return &L1Archive{
+		Tags:         make(map[string]uint64),
+		Headers:      make(map[uint64]*ethTypes.Header),
+		Blocks:       make(map[uint64]hexutility.Bytes),
+		Transactions: make(map[common.Hash]hexutility.Bytes),
+		Receipts:     make(map[common.Hash]*ethTypes.Receipt),
+		Calls:        make(map[string]hexutility.Bytes),
+		Storage:      make(map[string]hexutility.Bytes),
+		logIndex:     make(map[logKey]struct{}),
+	}
+}
+
+// readArchiveRecords passes the records of the archive file to fn in order and returns the size of the file up to the
+// end of the last whole record, a record cut short by an interrupted write ends the file with errTruncatedArchive
+func readArchiveRecords(path string, fn func(record *archiveRecord) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	var size int64
+	for {
+		var record archiveRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return size, errTruncatedArchive
+		}
+		if err != nil {
+			return size, fmt.Errorf("failed to decode L1 archive %s: %w", path, err)
+		}
+		if err = fn(&record); err != nil {
+			return size, err
+		}
+		size = decoder.InputOffset()
+	}
+}
+
+func LoadL1Archive(path string) (*L1Archive, error) {
+	archive := NewL1Archive()
+	_, err := readArchiveRecords(path, archive.apply)
+	if errors.Is(err, errTruncatedArchive) {
+		log.Warn("The L1 archive ends in a partly written record, ignoring it", "path", path)
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(archive.Logs, func(i, j int) bool {
+		if archive.Logs[i].BlockNumber != archive.Logs[j].BlockNumber {
+			return archive.Logs[i].BlockNumber < archive.Logs[j].BlockNumber
+		}
+		return archive.Logs[i].Index < archive.Logs[j].Index
+	})
+
+	return archive, nil
+}
+
+func (a *L1Archive) apply(record *archiveRecord) error {
+	switch record.Kind {
+	case recordHeader:
+		if record.Header == nil || record.Header.Number == nil {
+			return errors.New("header record without a header in the L1 archive")
+		}
+		a.Headers[record.Header.Number.Uint64()] = record.Header
+		if record.Tag != "" {
+			a.Tags[record.Tag] = record.Header.Number.Uint64()
+		}
+	case recordBlock:
+		a.Blocks[record.Number] = record.Data
+		if record.Tag != "" {
+			a.Tags[record.Tag] = record.Number
+		}
+	case recordLogs:
+		a.addLogs(record.Logs)
+		if record.Range != nil {
+			a.LogRanges = append(a.LogRanges, *record.Range)
+		}
+	case recordTransaction:
+		if record.Hash == nil {
+			return errors.New("transaction record without a hash in the L1 archive")
+		}
+		a.Transactions[*record.Hash] = record.Data
+	case recordReceipt:
+		if record.Hash == nil || record.Receipt == nil {
+			return errors.New("receipt record without a hash or receipt in the L1 archive")
+		}
+		a.Receipts[*record.Hash] = record.Receipt
+	case recordCall:
+		a.Calls[record.Key] = record.Data
+	case recordStorage:
+		a.Storage[record.Key] = record.Data
+	default:
+		return fmt.Errorf("unknown record %q in the L1 archive", record.Kind)
+	}
+	return nil
+}
+
+// appendArchiveRecords writes the records to the end of the archive file, a failed write is cut back off the file so
+// the records after it still read
+func appendArchiveRecords(path string, records []archiveRecord) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	buffer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(buffer)
+	for i := range records {
+		if err = encoder.Encode(&records[i]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = buffer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Truncate(info.Size())
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (a *L1Archive) addLogs(logs []ethTypes.Log) {
+	for _, l := range logs {
+		key := logKey{l.BlockNumber, l.TxHash, l.Index}
+		if _, ok := a.logIndex[key]; ok {
+			continue
+		}
+		a.logIndex[key] = struct{}{}
+		a.Logs = append(a.Logs, l)
+	}
+}
+
+// coversLogs tells if the logs the query asks for from the blocks from to to were all recorded
+func (a *L1Archive) coversLogs(query ethereum.FilterQuery, from, to uint64) bool {
+	var ranges []LogRange
+	for _, r := range a.LogRanges {
+		if !r.covers(query.Addresses, query.Topics) {
+			continue
+		}
+		if query.BlockHash != nil {
+			if r.BlockHash != nil && *r.BlockHash == *query.BlockHash {
+				return true
+			}
+			continue
+		}
+		if r.BlockHash == nil {
+			ranges = append(ranges, r)
+		}
+	}
+	if query.BlockHash != nil || from > to {
+		return query.BlockHash == nil
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].From < ranges[j].From
+	})
+	next := from
+	for _, r := range ranges {
+		if r.From > next {
+			return false
+		}
+		if r.To >= to {
+			return true
+		}
+		if r.To >= next {
+			next = r.To + 1
+		}
+	}
+	return false
+}
+
+func (a *L1Archive) highestBlock() uint64 {
+	var highest uint64
+	for n := range a.Headers {
+		if n > highest {
+			highest = n
+		}
+	}
+	for n := range a.Blocks {
+		if n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+// blockTag returns the tag a block number argument refers to, or an empty string for a specific block
+func blockTag(blockNumber *big.Int) string {
+	if blockNumber == nil {
+		return tagLatest
+	}
+	if blockNumber.Sign() >= 0 {
+		return ""
+	}
+	switch rpc.BlockNumber(blockNumber.Int64()) {
+	case rpc.FinalizedBlockNumber:
+		return tagFinalized
+	case rpc.SafeBlockNumber:
+		return tagSafe
+	default:
+		return tagLatest
+	}
+}
+
+func callKey(to *common.Address, data []byte, blockNumber *big.Int) string {
+	var addr common.Address
+	if to != nil {
+		addr = *to
+	}
+	block := tagLatest
+	if tag := blockTag(blockNumber); tag == "" {
+		block = blockNumber.String()
+	}
+	return fmt.Sprintf("%s:%x:%s", addr.Hex(), data, block)
+}
+
+func storageKey(account common.Address, key common.Hash, blockNumber *big.Int) string {
+	block := tagLatest
+	if tag := blockTag(blockNumber); tag == "" {
+		block = blockNumber.String()
+	}
+	return fmt.Sprintf("%s:%s:%s", account.Hex(), key.Hex(), block)
+}
+
+// ArchiveEtherman is an IEtherman that serves everything from an L1Archive
+type ArchiveEtherman struct {
+	archive *L1Archive
+}
+
+func NewArchiveEtherman(archive *L1Archive) *ArchiveEtherman {
+	return &ArchiveEtherman{archive: archive}
+}
+
+func (e *ArchiveEtherman) resolve(blockNumber *big.Int) uint64 {
+	tag := blockTag(blockNumber)
+	if tag == "" {
+		return blockNumber.Uint64()
+	}
+	if n, ok := e.archive.Tags[tag]; ok {
+		return n
+	}
+	return e.archive.highestBlock()
+}
+
+func (e *ArchiveEtherman) HeaderByNumber(_ context.Context, blockNumber *big.Int) (*ethTypes.Header, error) {
+	n := e.resolve(blockNumber)
+	if header, ok := e.archive.Headers[n]; ok {
+		return header, nil
+	}
+	block, err := e.block(n)
+	if err != nil {
+		return nil, err
+	}
+	return block.Header(), nil
+}
+
+func (e *ArchiveEtherman) BlockByNumber(_ context.Context, blockNumber *big.Int) (*ethTypes.Block, error) {
+	n := e.resolve(blockNumber)
+	block, err := e.block(n)
+	if err == nil {
+		return block, nil
+	}
+	// the syncer often only needs the number of a tagged block so a header is enough
+	if header, ok := e.archive.Headers[n]; ok {
+		return ethTypes.NewBlockWithHeader(header), nil
+	}
+	return nil, err
+}
+
+func (e *ArchiveEtherman) block(n uint64) (*ethTypes.Block, error) {
+	encoded, ok := e.archive.Blocks[n]
+	if !ok {
+		return nil, fmt.Errorf("block %d not found in the L1 archive", n)
+	}
+	block := new(ethTypes.Block)
+	if err := rlp.DecodeBytes(encoded, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (e *ArchiveEtherman) FilterLogs(_ context.Context, query ethereum.FilterQuery) ([]ethTypes.Log, error) {
+	from := uint64(0)
+	if query.FromBlock != nil {
+		from = e.resolve(query.FromBlock)
+	}
+	to := e.resolve(query.ToBlock)
+	if !e.archive.coversLogs(query, from, to) {
+		if query.BlockHash != nil {
+			return nil, fmt.Errorf("logs of L1 block %s not found in the L1 archive", *query.BlockHash)
+		}
+		return nil, fmt.Errorf("logs of L1 blocks %d to %d not found in the L1 archive", from, to)
+	}
+
+	var result []ethTypes.Log
+	for _, l := range e.archive.Logs {
+		if query.BlockHash != nil {
+			if l.BlockHash != *query.BlockHash {
+				continue
+			}
+		} else if l.BlockNumber < from || l.BlockNumber > to {
+			continue
+		}
+		if matchesFilter(&l, query.Addresses, query.Topics) {
+			result = append(result, l)
+		}
+	}
+	return result, nil
+}
+
+func matchesFilter(l *ethTypes.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		found := false
+		for _, addr := range addresses {
+			if l.Address == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(topics) > len(l.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		if len(sub) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range sub {
+			if l.Topics[i] == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *ArchiveEtherman) CallContract(_ context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if result, ok := e.archive.Calls[callKey(msg.To, msg.Data, blockNumber)]; ok {
+		return result, nil
+	}
+	// fall back on the same call made against the latest block when recording
+	if result, ok := e.archive.Calls[callKey(msg.To, msg.Data, nil)]; ok {
+		return result, nil
+	}
+	return nil, fmt.Errorf("contract call not found in the L1 archive")
+}
+
+func (e *ArchiveEtherman) TransactionByHash(_ context.Context, hash common.Hash) (ethTypes.Transaction, bool, error) {
+	encoded, ok := e.archive.Transactions[hash]
+	if !ok {
+		return nil, false, fmt.Errorf("transaction %s not found in the L1 archive", hash)
+	}
+	tx, err := ethTypes.DecodeTransaction(encoded)
+	if err != nil {
+		return nil, false, err
+	}
+	return tx, false, nil
+}
+
+func (e *ArchiveEtherman) TransactionReceipt(_ context.Context, txHash common.Hash) (*ethTypes.Receipt, error) {
+	receipt, ok := e.archive.Receipts[txHash]
+	if !ok {
+		return nil, fmt.Errorf("receipt %s not found in the L1 archive", txHash)
+	}
+	return receipt, nil
+}
+
+func (e *ArchiveEtherman) StorageAt(_ context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	if result, ok := e.archive.Storage[storageKey(account, key, blockNumber)]; ok {
+		return result, nil
+	}
+	if result, ok := e.archive.Storage[storageKey(account, key, nil)]; ok {
+		return result, nil
+	}
+	return nil, fmt.Errorf("storage %s at %s not found in the L1 archive", key, account)
+}
+
+// RecordingEtherman passes every call through to a live IEtherman and records the results in an L1Archive.  Several
+// recorders can share an archive so that all the L1 clients of a node end up in the same recording
+type RecordingEtherman struct {
+	inner    IEtherman
+	recorder *L1Recorder
+}
+
+// L1Recorder appends what its RecordingEthermans fetch to the archive file
+type L1Recorder struct {
+	path    string
+	lock    sync.Mutex
+	tags    map[string]uint64
+	pending []archiveRecord
+}
+
+// NewL1Recorder starts a recording at path, continuing any recording already there
+func NewL1Recorder(path string) (*L1Recorder, error) {
+	r := &L1Recorder{path: path, tags: make(map[string]uint64)}
+	if _, err := os.Stat(path); err != nil {
+		return r, nil
+	}
+
+	// the tags are all of the recording kept around, they resolve the tagged ends of log queries
+	size, err := readArchiveRecords(path, func(record *archiveRecord) error {
+		r.tag(record)
+		return nil
+	})
+	if errors.Is(err, errTruncatedArchive) {
+		log.Warn("Cutting a partly written record off the end of the L1 recording", "path", path)
+		err = os.Truncate(path, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *L1Recorder) Wrap(inner IEtherman) *RecordingEtherman {
+	return &RecordingEtherman{inner: inner, recorder: r}
+}
+
+// Save appends what was recorded since the last save to the archive file
+func (r *L1Recorder) Save() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.pending) == 0 {
+		return nil
+	}
+	if err := appendArchiveRecords(r.path, r.pending); err != nil {
+		return err
+	}
+	r.pending = nil
+	return nil
+}
+
+// SaveOnInterval keeps saving the recording until the context is done, saving one last time on the way out
+func (r *L1Recorder) SaveOnInterval(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Save(); err != nil {
+				log.Error("Failed to save the L1 recording", "path", r.path, "err", err)
+			}
+			return
+		case <-ticker.C:
+			if err := r.Save(); err != nil {
+				log.Warn("Failed to save the L1 recording", "path", r.path, "err", err)
+			}
+		}
+	}
+}
+
+func (r *L1Recorder) record(record archiveRecord) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.tag(&record)
+	r.pending = append(r.pending, record)
+}
+
+func (r *L1Recorder) tag(record *archiveRecord) {
+	if record.Tag == "" {
+		return
+	}
+	switch record.Kind {
+	case recordHeader:
+		if record.Header != nil && record.Header.Number != nil {
+			r.tags[record.Tag] = record.Header.Number.Uint64()
+		}
+	case recordBlock:
+		r.tags[record.Tag] = record.Number
+	}
+}
+
+// logRange returns the blocks a log query covered, false when a tagged end of the query can't be resolved
+func (r *L1Recorder) logRange(query ethereum.FilterQuery) (*LogRange, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	covered := &LogRange{BlockHash: query.BlockHash, Addresses: query.Addresses, Topics: query.Topics}
+	if query.BlockHash != nil {
+		return covered, true
+	}
+	resolve := func(blockNumber *big.Int) (uint64, bool) {
+		tag := blockTag(blockNumber)
+		if tag == "" {
+			return blockNumber.Uint64(), true
+		}
+		n, ok := r.tags[tag]
+		return n, ok
+	}
+	ok := true
+	if query.FromBlock != nil {
+		covered.From, ok = resolve(query.FromBlock)
+	}
+	if ok {
+		covered.To, ok = resolve(query.ToBlock)
+	}
+	return covered, ok
+}
+
+func (e *RecordingEtherman) HeaderByNumber(ctx context.Context, blockNumber *big.Int) (*ethTypes.Header, error) {
+	header, err := e.inner.HeaderByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	e.recorder.record(archiveRecord{Kind: recordHeader, Header: header, Tag: blockTag(blockNumber)})
+	return header, nil
+}
+
+func (e *RecordingEtherman) BlockByNumber(ctx context.Context, blockNumber *big.Int) (*ethTypes.Block, error) {
+	block, err := e.inner.BlockByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := block.EncodeRLP(&buf); err != nil {
+		return nil, err
+	}
+	e.recorder.record(archiveRecord{Kind: recordBlock, Number: block.NumberU64(), Data: buf.Bytes(), Tag: blockTag(blockNumber)})
+	return block, nil
+}
+
+func (e *RecordingEtherman) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]ethTypes.Log, error) {
+	logs, err := e.inner.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	record := archiveRecord{Kind: recordLogs, Logs: logs}
+	if covered, ok := e.recorder.logRange(query); ok {
+		record.Range = covered
+	}
+	e.recorder.record(record)
+	return logs, nil
+}
+
+func (e *RecordingEtherman) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	result, err := e.inner.CallContract(ctx, msg, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	e.recorder.record(archiveRecord{Kind: recordCall, Key: callKey(msg.To, msg.Data, blockNumber), Data: result})
+	return result, nil
+}
+
+func (e *RecordingEtherman) TransactionByHash(ctx context.Context, hash common.Hash) (ethTypes.Transaction, bool, error) {
+	tx, isPending, err := e.inner.TransactionByHash(ctx, hash)
+	if err != nil {
+		return nil, false, err
+	}
+	var buf bytes.Buffer
+	if err := tx.MarshalBinary(&buf); err != nil {
+		return nil, false, err
+	}
+	e.recorder.record(archiveRecord{Kind: recordTransaction, Hash: &hash, Data: buf.Bytes()})
+	return tx, isPending, nil
+}
+
+func (e *RecordingEtherman) TransactionReceipt(ctx context.Context, txHash common.Hash) (*ethTypes.Receipt, error) {
+	receipt, err := e.inner.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	e.recorder.record(archiveRecord{Kind: recordReceipt, Hash: &txHash, Receipt: receipt})
+	return receipt, nil
+}
+
+func (e *RecordingEtherman) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	result, err := e.inner.StorageAt(ctx, account, key, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	e.recorder.record(archiveRecord{Kind: recordStorage, Key: storageKey(account, key, blockNumber), Data: result})
+	return result, nil
+}
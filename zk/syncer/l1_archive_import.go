@@ -0,0 +1,71 @@
+package syncer
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/zk/contracts"
+	"github.com/ledgerwatch/erigon/zk/types"
+)
+
+// SequenceTopics are the topics of the sequence logs the l1-sequences-downloader fetches from the rollup contract
+var SequenceTopics = [][]common.Hash{{
+	contracts.SequencedBatchTopicPreEtrog,
+	contracts.SequencedBatchTopicEtrog,
+}}
+
+// ImportL1Sequences appends what the l1-sequences-downloader found to an archive: the batch infos become the sequence
+// logs of the rollup contract from the first to the last L1 block of the infos, and the calldata of the sequence
+// transactions becomes transactions sending it to the rollup contract. The downloader only fetches the sequence logs,
+// so replaying any other log of the rollup still needs a recording
+func ImportL1Sequences(path string, rollup common.Address, infos []types.L1BatchInfo, calldata map[common.Hash][]byte) error {
+	if len(infos) == 0 {
+		return errors.New("no sequences to import")
+	}
+
+	covered := &LogRange{
+		From:      infos[0].L1BlockNo,
+		To:        infos[0].L1BlockNo,
+		Addresses: []common.Address{rollup},
+		Topics:    SequenceTopics,
+	}
+	logs := make([]ethTypes.Log, 0, len(infos))
+	indexes := make(map[uint64]uint)
+	for _, info := range infos {
+		covered.From = min(covered.From, info.L1BlockNo)
+		covered.To = max(covered.To, info.L1BlockNo)
+
+		// the downloader keeps the l1 info root of etrog sequences only
+		l := ethTypes.Log{
+			Address:     rollup,
+			Topics:      []common.Hash{contracts.SequencedBatchTopicPreEtrog, common.BigToHash(new(big.Int).SetUint64(info.BatchNo))},
+			BlockNumber: info.L1BlockNo,
+			TxHash:      info.L1TxHash,
+			Index:       indexes[info.L1BlockNo],
+		}
+		if info.L1InfoRoot != (common.Hash{}) {
+			l.Topics[0] = contracts.SequencedBatchTopicEtrog
+			l.Data = info.L1InfoRoot.Bytes()
+		}
+		indexes[info.L1BlockNo]++
+		logs = append(logs, l)
+	}
+
+	records := []archiveRecord{{Kind: recordLogs, Logs: logs, Range: covered}}
+	for hash, data := range calldata {
+		tx := ethTypes.NewTransaction(0, rollup, uint256.NewInt(0), 0, uint256.NewInt(0), data)
+		var buf bytes.Buffer
+		if err := tx.MarshalBinary(&buf); err != nil {
+			return err
+		}
+		hash := hash
+		records = append(records, archiveRecord{Kind: recordTransaction, Hash: &hash, Data: buf.Bytes()})
+	}
+
+	return appendArchiveRecords(path, records)
+}
@@ -0,0 +1,262 @@
+package syncer
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/holiman/uint256"
+	ethereum "github.com/ledgerwatch/erigon"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rpc"
+	"github.com/ledgerwatch/erigon/zk/contracts"
+	"github.com/ledgerwatch/erigon/zk/types"
+)
+
+type fakeEtherman struct {
+	lock    sync.Mutex
+	headers map[uint64]*ethTypes.Header
+	latest  uint64
+	logs    []ethTypes.Log
+	tx      ethTypes.Transaction
+}
+
+func (f *fakeEtherman) HeaderByNumber(_ context.Context, blockNumber *big.Int) (*ethTypes.Header, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if blockNumber == nil || blockNumber.Sign() < 0 {
+		return f.headers[f.latest], nil
+	}
+	return f.headers[blockNumber.Uint64()], nil
+}
+
+func (f *fakeEtherman) BlockByNumber(ctx context.Context, blockNumber *big.Int) (*ethTypes.Block, error) {
+	header, _ := f.HeaderByNumber(ctx, blockNumber)
+	return ethTypes.NewBlockWithHeader(header), nil
+}
+
+func (f *fakeEtherman) FilterLogs(_ context.Context, query ethereum.FilterQuery) ([]ethTypes.Log, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var result []ethTypes.Log
+	for _, l := range f.logs {
+		if l.BlockNumber >= query.FromBlock.Uint64() && l.BlockNumber <= query.ToBlock.Uint64() {
+			result = append(result, l)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeEtherman) CallContract(_ context.Context, msg ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	return append([]byte{0x01}, msg.Data...), nil
+}
+
+func (f *fakeEtherman) TransactionByHash(_ context.Context, _ common.Hash) (ethTypes.Transaction, bool, error) {
+	return f.tx, false, nil
+}
+
+func (f *fakeEtherman) TransactionReceipt(_ context.Context, _ common.Hash) (*ethTypes.Receipt, error) {
+	return &ethTypes.Receipt{Status: 1, CumulativeGasUsed: 21000, Logs: []*ethTypes.Log{}}, nil
+}
+
+func (f *fakeEtherman) StorageAt(_ context.Context, _ common.Address, key common.Hash, _ *big.Int) ([]byte, error) {
+	return key.Bytes(), nil
+}
+
+func TestL1Archive_RecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	contract := common.HexToAddress("0x1234")
+	topic := common.HexToHash("0xabcd")
+	other := common.HexToHash("0xef01")
+
+	live := &fakeEtherman{headers: map[uint64]*ethTypes.Header{}, latest: 20}
+	for i := uint64(0); i <= 20; i++ {
+		live.headers[i] = &ethTypes.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0)}
+	}
+	live.logs = []ethTypes.Log{
+		{Address: contract, Topics: []common.Hash{topic}, BlockNumber: 5, Index: 0, TxHash: common.HexToHash("0x05")},
+		{Address: contract, Topics: []common.Hash{other}, BlockNumber: 7, Index: 1, TxHash: common.HexToHash("0x07")},
+		{Address: contract, Topics: []common.Hash{topic}, BlockNumber: 15, Index: 0, TxHash: common.HexToHash("0x0f")},
+	}
+	live.tx = ethTypes.NewTransaction(1, contract, uint256.NewInt(0), 21000, uint256.NewInt(1), []byte{0xaa, 0xbb})
+
+	path := filepath.Join(t.TempDir(), "l1.jsonl")
+	recorder, err := NewL1Recorder(path)
+	require.NoError(t, err)
+	recording := recorder.Wrap(live)
+
+	// the same calls the L1 syncer makes while syncing in two overlapping windows
+	_, err = recording.HeaderByNumber(ctx, big.NewInt(rpc.FinalizedBlockNumber.Int64()))
+	require.NoError(t, err)
+	_, err = recording.BlockByNumber(ctx, big.NewInt(12))
+	require.NoError(t, err)
+	for _, window := range [][2]int64{{0, 10}, {8, 20}} {
+		_, err = recording.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(window[0]), ToBlock: big.NewInt(window[1])})
+		require.NoError(t, err)
+	}
+	_, err = recording.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(0), ToBlock: big.NewInt(10)})
+	require.NoError(t, err)
+	_, _, err = recording.TransactionByHash(ctx, live.tx.Hash())
+	require.NoError(t, err)
+	_, err = recording.TransactionReceipt(ctx, live.tx.Hash())
+	require.NoError(t, err)
+	_, err = recording.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: []byte{0x02}}, nil)
+	require.NoError(t, err)
+	_, err = recording.StorageAt(ctx, contract, topic, big.NewInt(12))
+	require.NoError(t, err)
+	require.NoError(t, recorder.Save())
+
+	archive, err := LoadL1Archive(path)
+	require.NoError(t, err)
+	require.Len(t, archive.Logs, 3)
+	replay := NewArchiveEtherman(archive)
+
+	header, err := replay.HeaderByNumber(ctx, big.NewInt(rpc.FinalizedBlockNumber.Int64()))
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), header.Number.Uint64())
+
+	block, err := replay.BlockByNumber(ctx, big.NewInt(12))
+	require.NoError(t, err)
+	require.Equal(t, uint64(12), block.NumberU64())
+
+	_, err = replay.BlockByNumber(ctx, big.NewInt(13))
+	require.Error(t, err)
+
+	logs, err := replay.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(0),
+		ToBlock:   big.NewInt(20),
+		Addresses: []common.Address{contract},
+		Topics:    [][]common.Hash{{topic}},
+	})
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	require.Equal(t, uint64(5), logs[0].BlockNumber)
+	require.Equal(t, uint64(15), logs[1].BlockNumber)
+
+	// blocks whose logs were never fetched can't be told apart from blocks without logs
+	_, err = replay.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(15), ToBlock: big.NewInt(21)})
+	require.ErrorContains(t, err, "logs of L1 blocks 15 to 21 not found")
+	hash := common.HexToHash("0x99")
+	_, err = replay.FilterLogs(ctx, ethereum.FilterQuery{BlockHash: &hash})
+	require.Error(t, err)
+
+	tx, _, err := replay.TransactionByHash(ctx, live.tx.Hash())
+	require.NoError(t, err)
+	require.Equal(t, live.tx.Hash(), tx.Hash())
+	require.Equal(t, []byte{0xaa, 0xbb}, tx.GetData())
+
+	receipt, err := replay.TransactionReceipt(ctx, live.tx.Hash())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), receipt.Status)
+
+	// a call recorded against latest also answers the same call at a specific block
+	result, err := replay.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: []byte{0x02}}, big.NewInt(20))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x01, 0x02}, result)
+
+	storage, err := replay.StorageAt(ctx, contract, topic, big.NewInt(12))
+	require.NoError(t, err)
+	require.Equal(t, topic.Bytes(), storage)
+}
+
+func TestL1Archive_ContinueRecording(t *testing.T) {
+	ctx := context.Background()
+	contract := common.HexToAddress("0x1234")
+	topic := common.HexToHash("0xabcd")
+
+	live := &fakeEtherman{headers: map[uint64]*ethTypes.Header{}, latest: 30}
+	for i := uint64(0); i <= 30; i++ {
+		live.headers[i] = &ethTypes.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0)}
+		live.logs = append(live.logs, ethTypes.Log{Address: contract, Topics: []common.Hash{topic}, BlockNumber: i, TxHash: common.BigToHash(new(big.Int).SetUint64(i))})
+	}
+	query := func(from, to int64) ethereum.FilterQuery {
+		return ethereum.FilterQuery{FromBlock: big.NewInt(from), ToBlock: big.NewInt(to), Addresses: []common.Address{contract}}
+	}
+
+	path := filepath.Join(t.TempDir(), "l1.jsonl")
+	recorder, err := NewL1Recorder(path)
+	require.NoError(t, err)
+	_, err = recorder.Wrap(live).FilterLogs(ctx, query(0, 9))
+	require.NoError(t, err)
+	require.NoError(t, recorder.Save())
+	_, err = recorder.Wrap(live).FilterLogs(ctx, query(10, 14))
+	require.NoError(t, err)
+	require.NoError(t, recorder.Save())
+
+	// a node stopped while saving leaves half a record behind, the next recording cuts it off and appends
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"kind":"logs","logs":[{"addr`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	recorder, err = NewL1Recorder(path)
+	require.NoError(t, err)
+	_, err = recorder.Wrap(live).FilterLogs(ctx, query(15, 20))
+	require.NoError(t, err)
+	require.NoError(t, recorder.Save())
+
+	archive, err := LoadL1Archive(path)
+	require.NoError(t, err)
+	replay := NewArchiveEtherman(archive)
+
+	logs, err := replay.FilterLogs(ctx, query(3, 20))
+	require.NoError(t, err)
+	require.Len(t, logs, 18)
+
+	// the recorded queries were filtered on the contract so they don't cover the logs of other contracts
+	_, err = replay.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(3), ToBlock: big.NewInt(20)})
+	require.Error(t, err)
+	_, err = replay.FilterLogs(ctx, query(18, 21))
+	require.Error(t, err)
+}
+
+func TestL1Archive_ImportSequences(t *testing.T) {
+	ctx := context.Background()
+	rollup := common.HexToAddress("0x5132A183E9F3CB7C848b0AAC5Ae0c4f0491B7aB2")
+	infoRoot := common.HexToHash("0x1111")
+	calldata := []byte{0xde, 0xad}
+
+	infos := []types.L1BatchInfo{
+		{BatchNo: 1, L1BlockNo: 100, L1TxHash: common.HexToHash("0x01")},
+		{BatchNo: 2, L1BlockNo: 120, L1TxHash: common.HexToHash("0x02"), L1InfoRoot: infoRoot},
+	}
+	path := filepath.Join(t.TempDir(), "l1.jsonl")
+	require.NoError(t, ImportL1Sequences(path, rollup, infos, map[common.Hash][]byte{infos[1].L1TxHash: calldata}))
+
+	archive, err := LoadL1Archive(path)
+	require.NoError(t, err)
+	replay := NewArchiveEtherman(archive)
+
+	logs, err := replay.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(100),
+		ToBlock:   big.NewInt(120),
+		Addresses: []common.Address{rollup},
+		Topics:    SequenceTopics,
+	})
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	require.Equal(t, contracts.SequencedBatchTopicPreEtrog, logs[0].Topics[0])
+	require.Equal(t, common.BigToHash(big.NewInt(1)), logs[0].Topics[1])
+	require.Equal(t, contracts.SequencedBatchTopicEtrog, logs[1].Topics[0])
+	require.Equal(t, infoRoot.Bytes(), logs[1].Data)
+
+	// the verifications weren't downloaded
+	_, err = replay.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(100),
+		ToBlock:   big.NewInt(120),
+		Addresses: []common.Address{rollup},
+		Topics:    [][]common.Hash{{contracts.SequencedBatchTopicEtrog, contracts.VerificationTopicEtrog}},
+	})
+	require.Error(t, err)
+
+	tx, _, err := replay.TransactionByHash(ctx, infos[1].L1TxHash)
+	require.NoError(t, err)
+	require.Equal(t, calldata, tx.GetData())
+}
@@ -0,0 +1,290 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	ethereum "github.com/ledgerwatch/erigon"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/metrics"
+
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/rpc"
+)
+
+const (
+	// endpointFailureThreshold is how many failures in a row eject an endpoint
+	endpointFailureThreshold = 3
+	endpointBaseBackoff      = time.Second
+	endpointMaxBackoff       = 5 * time.Minute
+
+	// endpointLatencyDecay is the weight of the newest sample in the latency moving average
+	endpointLatencyDecay = 0.2
+
+	// executionRevertedCode is the JSON-RPC error code for a reverted call, the endpoint did its job in that case
+	executionRevertedCode = 3
+)
+
+// Endpoint is an L1 RPC endpoint that keeps track of its own latency and errors.  An endpoint can be shared by several
+// syncers so that they all see the same health
+type Endpoint struct {
+	name   string
+	weight uint64
+	inner  IEtherman
+
+	mtx                 sync.Mutex
+	requests            uint64
+	errors              uint64
+	consecutiveFailures uint64
+	latency             time.Duration
+	ejectedUntil        time.Time
+	lastError           string
+
+	latencyGauge  metrics.Gauge
+	errorsCounter metrics.Counter
+}
+
+// EndpointHealth is a snapshot of an endpoint's health as shown through the admin RPC
+type EndpointHealth struct {
+	Name                string     `json:"name"`
+	Weight              uint64     `json:"weight"`
+	Requests            uint64     `json:"requests"`
+	Errors              uint64     `json:"errors"`
+	ConsecutiveFailures uint64     `json:"consecutiveFailures"`
+	LatencyMs           float64    `json:"latencyMs"`
+	Ejected             bool       `json:"ejected"`
+	EjectedUntil        *time.Time `json:"ejectedUntil,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// NewEndpoint wraps an L1 client so that its health is tracked.  A weight of zero is treated as one
+func NewEndpoint(name string, inner IEtherman, weight uint64) *Endpoint {
+	if weight == 0 {
+		weight = 1
+	}
+	return &Endpoint{
+		name:          name,
+		weight:        weight,
+		inner:         inner,
+		latencyGauge:  metrics.GetOrCreateGauge(fmt.Sprintf(`l1_endpoint_latency_ms{endpoint="%s"}`, name)),
+		errorsCounter: metrics.GetOrCreateCounter(fmt.Sprintf(`l1_endpoint_errors{endpoint="%s"}`, name)),
+	}
+}
+
+// EndpointName builds a name for an L1 RPC url that is safe to show in metrics and the RPC, dropping the path and
+// query where providers tend to put API keys
+func EndpointName(index int, rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return fmt.Sprintf("%d", index)
+	}
+	return fmt.Sprintf("%d:%s://%s", index, u.Scheme, u.Host)
+}
+
+func (e *Endpoint) Health() EndpointHealth {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	health := EndpointHealth{
+		Name:                e.name,
+		Weight:              e.weight,
+		Requests:            e.requests,
+		Errors:              e.errors,
+		ConsecutiveFailures: e.consecutiveFailures,
+		LatencyMs:           float64(e.latency.Microseconds()) / 1000,
+		LastError:           e.lastError,
+	}
+	if time.Now().Before(e.ejectedUntil) {
+		ejectedUntil := e.ejectedUntil
+		health.Ejected = true
+		health.EjectedUntil = &ejectedUntil
+	}
+	return health
+}
+
+func (e *Endpoint) state(now time.Time) (latency time.Duration, ejectedUntil time.Time, ejected bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return e.latency, e.ejectedUntil, now.Before(e.ejectedUntil)
+}
+
+func (e *Endpoint) record(start time.Time, err error) {
+	took := time.Since(start)
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.requests++
+	if isEndpointFailure(err) {
+		e.errors++
+		e.consecutiveFailures++
+		e.lastError = err.Error()
+		e.errorsCounter.Inc()
+
+		// back off exponentially for every failure past the threshold
+		if e.consecutiveFailures >= endpointFailureThreshold {
+			backoff := endpointMaxBackoff
+			if shift := e.consecutiveFailures - endpointFailureThreshold; shift < 20 {
+				backoff = min(endpointBaseBackoff<<shift, endpointMaxBackoff)
+			}
+			e.ejectedUntil = time.Now().Add(backoff)
+		}
+		return
+	}
+
+	e.consecutiveFailures = 0
+	if e.latency == 0 {
+		e.latency = took
+	} else {
+		e.latency = time.Duration(endpointLatencyDecay*float64(took) + (1-endpointLatencyDecay)*float64(e.latency))
+	}
+	e.latencyGauge.Set(float64(e.latency.Microseconds()) / 1000)
+}
+
+func isEndpointFailure(err error) bool {
+	if err == nil || errors.Is(err, ethereum.NotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == executionRevertedCode {
+		return false
+	}
+	return true
+}
+
+func (e *Endpoint) HeaderByNumber(ctx context.Context, blockNumber *big.Int) (*ethTypes.Header, error) {
+	start := time.Now()
+	header, err := e.inner.HeaderByNumber(ctx, blockNumber)
+	e.record(start, err)
+	return header, err
+}
+
+func (e *Endpoint) BlockByNumber(ctx context.Context, blockNumber *big.Int) (*ethTypes.Block, error) {
+	start := time.Now()
+	block, err := e.inner.BlockByNumber(ctx, blockNumber)
+	e.record(start, err)
+	return block, err
+}
+
+func (e *Endpoint) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]ethTypes.Log, error) {
+	start := time.Now()
+	logs, err := e.inner.FilterLogs(ctx, query)
+	e.record(start, err)
+	return logs, err
+}
+
+func (e *Endpoint) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	start := time.Now()
+	result, err := e.inner.CallContract(ctx, msg, blockNumber)
+	e.record(start, err)
+	return result, err
+}
+
+func (e *Endpoint) TransactionByHash(ctx context.Context, hash common.Hash) (ethTypes.Transaction, bool, error) {
+	start := time.Now()
+	tx, isPending, err := e.inner.TransactionByHash(ctx, hash)
+	e.record(start, err)
+	return tx, isPending, err
+}
+
+func (e *Endpoint) TransactionReceipt(ctx context.Context, txHash common.Hash) (*ethTypes.Receipt, error) {
+	start := time.Now()
+	receipt, err := e.inner.TransactionReceipt(ctx, txHash)
+	e.record(start, err)
+	return receipt, err
+}
+
+func (e *Endpoint) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	start := time.Now()
+	result, err := e.inner.StorageAt(ctx, account, key, blockNumber)
+	e.record(start, err)
+	return result, err
+}
+
+// endpointSelector picks endpoints with smooth weighted round robin.  Each endpoint's weight is scaled down by how
+// much slower it is than the fastest healthy endpoint, and ejected endpoints are skipped until their backoff ends
+type endpointSelector struct {
+	mtx       sync.Mutex
+	endpoints []*Endpoint
+	current   []float64
+}
+
+// newEndpointSelector tracks the health of any client that isn't already an Endpoint on its own
+func newEndpointSelector(etherMans []IEtherman) *endpointSelector {
+	endpoints := make([]*Endpoint, len(etherMans))
+	for i, em := range etherMans {
+		if endpoint, ok := em.(*Endpoint); ok {
+			endpoints[i] = endpoint
+		} else {
+			endpoints[i] = NewEndpoint(fmt.Sprintf("%d", i), em, 1)
+		}
+	}
+	return &endpointSelector{
+		endpoints: endpoints,
+		current:   make([]float64, len(endpoints)),
+	}
+}
+
+func (s *endpointSelector) next() *Endpoint {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+	latencies := make([]time.Duration, len(s.endpoints))
+	ejected := make([]bool, len(s.endpoints))
+
+	var fastest time.Duration
+	soonest := -1
+	var soonestUntil time.Time
+	for i, e := range s.endpoints {
+		var until time.Time
+		latencies[i], until, ejected[i] = e.state(now)
+		if ejected[i] {
+			if soonest < 0 || until.Before(soonestUntil) {
+				soonest, soonestUntil = i, until
+			}
+			continue
+		}
+		if latencies[i] > 0 && (fastest == 0 || latencies[i] < fastest) {
+			fastest = latencies[i]
+		}
+	}
+
+	var total float64
+	best := -1
+	for i, e := range s.endpoints {
+		if ejected[i] {
+			continue
+		}
+		weight := float64(e.weight)
+		if fastest > 0 && latencies[i] > 0 {
+			weight *= float64(fastest) / float64(latencies[i])
+		}
+		s.current[i] += weight
+		total += weight
+		if best < 0 || s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+
+	// everything is ejected so go with the endpoint that is due back first
+	if best < 0 {
+		return s.endpoints[soonest]
+	}
+
+	s.current[best] -= total
+	return s.endpoints[best]
+}
+
+func (s *endpointSelector) health() []EndpointHealth {
+	result := make([]EndpointHealth, len(s.endpoints))
+	for i, e := range s.endpoints {
+		result[i] = e.Health()
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	ethereum "github.com/ledgerwatch/erigon"
+	"github.com/stretchr/testify/require"
+)
+
+func pickCounts(s *endpointSelector, picks int) map[string]int {
+	counts := map[string]int{}
+	for i := 0; i < picks; i++ {
+		counts[s.next().name]++
+	}
+	return counts
+}
+
+func TestEndpointSelector_Weights(t *testing.T) {
+	a := NewEndpoint("weights-a", &fakeEtherman{}, 3)
+	b := NewEndpoint("weights-b", &fakeEtherman{}, 1)
+	s := newEndpointSelector([]IEtherman{a, b})
+
+	counts := pickCounts(s, 400)
+	require.Equal(t, 300, counts["weights-a"])
+	require.Equal(t, 100, counts["weights-b"])
+
+	// a slower endpoint is picked less often in proportion to its latency
+	a.latency = 40 * time.Millisecond
+	b.latency = 10 * time.Millisecond
+	s = newEndpointSelector([]IEtherman{a, b})
+	counts = pickCounts(s, 700)
+	require.Equal(t, 300, counts["weights-a"])
+	require.Equal(t, 400, counts["weights-b"])
+}
+
+func TestEndpoint_EjectionAndRecovery(t *testing.T) {
+	a := NewEndpoint("eject-a", &fakeEtherman{}, 1)
+	b := NewEndpoint("eject-b", &fakeEtherman{}, 1)
+	s := newEndpointSelector([]IEtherman{a, b})
+
+	failure := errors.New("connection refused")
+	for i := 0; i < endpointFailureThreshold-1; i++ {
+		a.record(time.Now(), failure)
+	}
+	require.False(t, a.Health().Ejected)
+
+	// errors that aren't the endpoint's fault don't count
+	a.record(time.Now(), ethereum.NotFound)
+	a.record(time.Now(), context.Canceled)
+	require.Equal(t, uint64(0), a.Health().ConsecutiveFailures)
+
+	for i := 0; i < endpointFailureThreshold; i++ {
+		a.record(time.Now(), failure)
+	}
+	health := a.Health()
+	require.True(t, health.Ejected)
+	require.Equal(t, uint64(endpointFailureThreshold*2-1), health.Errors)
+	require.Equal(t, failure.Error(), health.LastError)
+	require.WithinDuration(t, time.Now().Add(endpointBaseBackoff), *health.EjectedUntil, 100*time.Millisecond)
+
+	// every further failure doubles the backoff
+	a.record(time.Now(), failure)
+	require.WithinDuration(t, time.Now().Add(2*endpointBaseBackoff), *a.Health().EjectedUntil, 100*time.Millisecond)
+
+	counts := pickCounts(s, 10)
+	require.Equal(t, 10, counts["eject-b"])
+
+	// with everything ejected the endpoint due back first is used
+	for i := 0; i < endpointFailureThreshold; i++ {
+		b.record(time.Now(), failure)
+	}
+	require.Equal(t, b, s.next())
+
+	// once the backoff is over a success puts the endpoint back in rotation
+	a.ejectedUntil = time.Now()
+	_, err := a.HeaderByNumber(context.Background(), big.NewInt(1))
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), a.Health().ConsecutiveFailures)
+	require.Equal(t, a, s.next())
+}
+
+func TestEndpointName(t *testing.T) {
+	require.Equal(t, "0:https://eth.example.com", EndpointName(0, "https://eth.example.com/v2/secret-key"))
+	require.Equal(t, "1", EndpointName(1, "not a url"))
+}
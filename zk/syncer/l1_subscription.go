@@ -0,0 +1,145 @@
+package syncer
+
+import (
+	"context"
+	"time"
+
+	ethereum "github.com/ledgerwatch/erigon"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/log/v3"
+
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+)
+
+// subscriptionBufferSize is how many logs or headers can queue up from a subscription while the stages aren't
+// consuming them, beyond that the subscription is dropped and the syncer falls back to polling
+const subscriptionBufferSize = 1024
+
+// LogSubscriber is an L1 client able to push logs and new heads over a websocket, such as ethclient.Client
+type LogSubscriber interface {
+	SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- ethTypes.Log) (ethereum.Subscription, error)
+	SubscribeNewHead(ctx context.Context, ch chan<- *ethTypes.Header) (ethereum.Subscription, error)
+}
+
+// SetLogSubscriber makes the syncer follow the L1 through eth_subscribe once it has caught up with the windowed
+// eth_getLogs queries.  Logs are only streamed when following the latest L1 block as the subscription has no notion
+// of safe or finalized blocks, otherwise the syncer keeps polling
+func (s *L1Syncer) SetLogSubscriber(subscriber LogSubscriber) {
+	if subscriber != nil && s.highestBlockType != "latest" {
+		log.Warn("L1 log subscription needs the latest L1 block type, polling instead", "highestBlockType", s.highestBlockType)
+		return
+	}
+	s.logSubscriber = subscriber
+}
+
+func (s *L1Syncer) subscriptionEnabled() bool {
+	return s.logSubscriber != nil
+}
+
+// followL1Logs streams the logs of new L1 blocks to the logs channel until the subscription fails, the syncer is
+// stopped or a reorg is detected.  Every new head moves the last checked block along so that a fallback to polling
+// carries on from there, but only once the logs received before the head have been taken by the consumer
+func (s *L1Syncer) followL1Logs() (reorged bool, err error) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	defer s.isDownloading.Store(false)
+
+	logs := make(chan ethTypes.Log, subscriptionBufferSize)
+	logSub, err := s.logSubscriber.SubscribeFilterLogs(ctx, ethereum.FilterQuery{
+		Addresses: s.l1ContractAddresses,
+		Topics:    s.topics,
+	}, logs)
+	if err != nil {
+		return false, err
+	}
+	defer logSub.Unsubscribe()
+
+	heads := make(chan *ethTypes.Header, subscriptionBufferSize)
+	headSub, err := s.logSubscriber.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return false, err
+	}
+	defer headSub.Unsubscribe()
+
+	log.Info("Following the L1 via log subscription", "lastCheckedL1Block", s.lastCheckedL1Block.Load())
+
+	// blocks produced between the catch-up and the subscriptions starting aren't covered by either, so poll once more.
+	// Anything seen twice is written again with the same values
+	if _, reorged = s.pollL1(); reorged {
+		return true, nil
+	}
+
+	stopCheck := time.NewTicker(time.Second)
+	defer stopCheck.Stop()
+
+	// logs wait in pending until the consumer takes them so that heads keep being handled meanwhile. A head is only
+	// checked off once the logs received before it have been sent
+	var pending []ethTypes.Log
+	var checkpoints []headCheckpoint
+	var received, sent int
+
+	for {
+		var out chan []ethTypes.Log
+		if len(pending) > 0 {
+			out = s.logsChan
+		}
+		s.isDownloading.Store(len(pending) > 0)
+
+		select {
+		case <-s.ctx.Done():
+			return false, nil
+		case <-stopCheck.C:
+			if s.flagStop.Load() {
+				return false, nil
+			}
+		case err = <-logSub.Err():
+			return false, err
+		case err = <-headSub.Err():
+			return false, err
+		case l := <-logs:
+			// a removed log means the block it came from is no longer canonical
+			if l.Removed {
+				return true, nil
+			}
+			pending = append(pending, l)
+			received++
+		case out <- pending:
+			sent += len(pending)
+			pending = nil
+		case head := <-heads:
+			// select picks at random, the logs already received go before the head
+			for len(logs) > 0 {
+				l := <-logs
+				if l.Removed {
+					return true, nil
+				}
+				pending = append(pending, l)
+				received++
+			}
+			if reorged, err = s.checkForReorg(); err != nil || reorged {
+				return reorged, err
+			}
+			// logs for the head itself may still be on their way so only its parent is known to be complete
+			if number := head.Number.Uint64(); number > 0 {
+				checkpoints = append(checkpoints, headCheckpoint{number: number, received: received, parentHash: head.ParentHash})
+			}
+		}
+
+		for len(checkpoints) > 0 && checkpoints[0].received <= sent {
+			checkpoint := checkpoints[0]
+			checkpoints = checkpoints[1:]
+			if checkpoint.number-1 > s.lastCheckedL1Block.Load() {
+				s.latestL1Block = checkpoint.number
+				s.lastCheckedL1Block.Store(checkpoint.number - 1)
+				s.lastCheckedL1BlockHash = checkpoint.parentHash
+			}
+		}
+	}
+}
+
+// headCheckpoint is a new head waiting for the logs received before it to be sent
+type headCheckpoint struct {
+	number     uint64
+	received   int // logs received before the head
+	parentHash common.Hash
+}
@@ -0,0 +1,178 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	ethereum "github.com/ledgerwatch/erigon"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+)
+
+type fakeSubscription struct {
+	err  chan error
+	once sync.Once
+}
+
+func (f *fakeSubscription) Unsubscribe() {
+	f.once.Do(func() { close(f.err) })
+}
+
+func (f *fakeSubscription) Err() <-chan error {
+	return f.err
+}
+
+type fakeSubscriber struct {
+	lock  sync.Mutex
+	logs  chan<- ethTypes.Log
+	heads chan<- *ethTypes.Header
+	sub   *fakeSubscription
+	count int
+}
+
+func (f *fakeSubscriber) SubscribeFilterLogs(_ context.Context, _ ethereum.FilterQuery, ch chan<- ethTypes.Log) (ethereum.Subscription, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.logs = ch
+	f.sub = &fakeSubscription{err: make(chan error, 1)}
+	f.count++
+	return f.sub, nil
+}
+
+func (f *fakeSubscriber) SubscribeNewHead(_ context.Context, ch chan<- *ethTypes.Header) (ethereum.Subscription, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.heads = ch
+	return &fakeSubscription{err: make(chan error, 1)}, nil
+}
+
+func (f *fakeSubscriber) subscribed() (chan<- ethTypes.Log, chan<- *ethTypes.Header, *fakeSubscription, int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.logs, f.heads, f.sub, f.count
+}
+
+func waitForLogs(t *testing.T, s *L1Syncer) []ethTypes.Log {
+	select {
+	case logs := <-s.GetLogsChan():
+		return logs
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for logs")
+		return nil
+	}
+}
+
+func TestL1Syncer_LogSubscription(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	contract := common.HexToAddress("0x1234")
+	live := &fakeEtherman{headers: map[uint64]*ethTypes.Header{}, latest: 10}
+	for i := uint64(0); i <= 20; i++ {
+		live.headers[i] = &ethTypes.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0)}
+	}
+	live.logs = []ethTypes.Log{{Address: contract, BlockNumber: 5}}
+
+	subscriber := &fakeSubscriber{}
+	s := NewL1Syncer(ctx, []IEtherman{live}, []common.Address{contract}, nil, 100, 10, "latest")
+	s.SetLogSubscriber(subscriber)
+	s.RunQueryBlocks(0)
+	defer func() {
+		s.StopQueryBlocks()
+		s.ConsumeQueryBlocks()
+		s.WaitQueryBlocksToFinish()
+	}()
+
+	// the windowed catch-up comes first
+	logs := waitForLogs(t, s)
+	require.Equal(t, uint64(5), logs[0].BlockNumber)
+
+	var logsCh chan<- ethTypes.Log
+	var headsCh chan<- *ethTypes.Header
+	require.Eventually(t, func() bool {
+		logsCh, headsCh, _, _ = subscriber.subscribed()
+		return logsCh != nil && headsCh != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// new logs now arrive through the subscription
+	logsCh <- ethTypes.Log{Address: contract, BlockNumber: 11}
+	logs = waitForLogs(t, s)
+	require.Equal(t, uint64(11), logs[0].BlockNumber)
+
+	headsCh <- live.headers[12]
+	require.Eventually(t, func() bool {
+		return s.GetLastCheckedL1Block() == 11
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a dropped subscription falls back to polling and then subscribes again
+	live.lock.Lock()
+	live.latest = 15
+	live.logs = append(live.logs, ethTypes.Log{Address: contract, BlockNumber: 14})
+	live.lock.Unlock()
+	_, _, sub, _ := subscriber.subscribed()
+	sub.err <- errors.New("connection lost")
+
+	logs = waitForLogs(t, s)
+	require.Equal(t, uint64(14), logs[0].BlockNumber)
+	require.Eventually(t, func() bool {
+		_, _, _, count := subscriber.subscribed()
+		return count == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// removed logs mean the L1 reorganised
+	logsCh, _, _, _ = subscriber.subscribed()
+	logsCh <- ethTypes.Log{Address: contract, BlockNumber: 14, Removed: true}
+	require.Eventually(t, s.IsReorgDetected, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestL1Syncer_LogSubscriptionProgress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	contract := common.HexToAddress("0x1234")
+	live := &fakeEtherman{headers: map[uint64]*ethTypes.Header{}, latest: 10}
+	for i := uint64(0); i <= 20; i++ {
+		live.headers[i] = &ethTypes.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0)}
+	}
+
+	subscriber := &fakeSubscriber{}
+	s := NewL1Syncer(ctx, []IEtherman{live}, []common.Address{contract}, nil, 100, 10, "latest")
+	s.SetLogSubscriber(subscriber)
+	s.RunQueryBlocks(0)
+	defer func() {
+		s.StopQueryBlocks()
+		s.ConsumeQueryBlocks()
+		s.WaitQueryBlocksToFinish()
+	}()
+
+	var logsCh chan<- ethTypes.Log
+	var headsCh chan<- *ethTypes.Header
+	require.Eventually(t, func() bool {
+		logsCh, headsCh, _, _ = subscriber.subscribed()
+		return logsCh != nil && headsCh != nil && s.GetLastCheckedL1Block() == 10
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the heads are handled while the logs wait for the consumer, but the last checked block stays behind the logs
+	logsCh <- ethTypes.Log{Address: contract, BlockNumber: 11}
+	headsCh <- live.headers[12]
+	headsCh <- live.headers[13]
+	require.Eventually(t, func() bool { return len(headsCh) == 0 }, 5*time.Second, 10*time.Millisecond)
+	require.True(t, s.IsDownloading())
+	require.Never(t, func() bool { return s.GetLastCheckedL1Block() != 10 }, 200*time.Millisecond, 10*time.Millisecond)
+
+	logs := waitForLogs(t, s)
+	require.Equal(t, uint64(11), logs[0].BlockNumber)
+	require.Eventually(t, func() bool {
+		return s.GetLastCheckedL1Block() == 12 && !s.IsDownloading()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a head with nothing waiting before it is checked off straight away
+	headsCh <- live.headers[14]
+	require.Eventually(t, func() bool { return s.GetLastCheckedL1Block() == 13 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -2,7 +2,9 @@ package syncer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"sync"
 	"sync/atomic"
@@ -58,19 +60,22 @@ type jobResult struct {
 
 type L1Syncer struct {
 	ctx                 context.Context
-	etherMans           []IEtherman
-	ethermanIndex       uint8
-	ethermanMtx         *sync.Mutex
+	endpoints           *endpointSelector
 	l1ContractAddresses []common.Address
 	topics              [][]common.Hash
 	blockRange          uint64
 	queryDelay          uint64
 
-	latestL1Block uint64
+	latestL1Block     uint64
+	latestL1BlockHash common.Hash
+
+	// the hash of lastCheckedL1Block when it was checked, used to spot the L1 reorganising under us
+	lastCheckedL1BlockHash common.Hash
 
 	// atomic
 	isSyncStarted      atomic.Bool
 	isDownloading      atomic.Bool
+	isReorgDetected    atomic.Bool
 	lastCheckedL1Block atomic.Uint64
 	wgRunLoopDone      sync.WaitGroup
 	flagStop           atomic.Bool
@@ -80,14 +85,15 @@ type L1Syncer struct {
 	logsChanProgress chan string
 
 	highestBlockType string // finalized, latest, safe
+
+	// optional websocket client used to follow the L1 in real time once caught up
+	logSubscriber LogSubscriber
 }
 
 func NewL1Syncer(ctx context.Context, etherMans []IEtherman, l1ContractAddresses []common.Address, topics [][]common.Hash, blockRange, queryDelay uint64, highestBlockType string) *L1Syncer {
 	return &L1Syncer{
 		ctx:                 ctx,
-		etherMans:           etherMans,
-		ethermanIndex:       0,
-		ethermanMtx:         &sync.Mutex{},
+		endpoints:           newEndpointSelector(etherMans),
 		l1ContractAddresses: l1ContractAddresses,
 		topics:              topics,
 		blockRange:          blockRange,
@@ -99,17 +105,12 @@ func NewL1Syncer(ctx context.Context, etherMans []IEtherman, l1ContractAddresses
 }
 
 func (s *L1Syncer) getNextEtherman() IEtherman {
-	s.ethermanMtx.Lock()
-	defer s.ethermanMtx.Unlock()
-
-	if s.ethermanIndex >= uint8(len(s.etherMans)) {
-		s.ethermanIndex = 0
-	}
-
-	etherman := s.etherMans[s.ethermanIndex]
-	s.ethermanIndex++
+	return s.endpoints.next()
+}
 
-	return etherman
+// GetEndpointsHealth reports the latency, errors and ejection state of each L1 RPC endpoint
+func (s *L1Syncer) GetEndpointsHealth() []EndpointHealth {
+	return s.endpoints.health()
 }
 
 func (s *L1Syncer) IsSyncStarted() bool {
@@ -120,6 +121,12 @@ func (s *L1Syncer) IsDownloading() bool {
 	return s.isDownloading.Load()
 }
 
+// IsReorgDetected reports whether the syncer stopped because the last L1 block it checked is no longer canonical.
+// The owner of the syncer is expected to unwind whatever it stored from the L1 and run the syncer again
+func (s *L1Syncer) IsReorgDetected() bool {
+	return s.isReorgDetected.Load()
+}
+
 func (s *L1Syncer) GetLastCheckedL1Block() uint64 {
 	return s.lastCheckedL1Block.Load()
 }
@@ -165,7 +172,9 @@ func (s *L1Syncer) RunQueryBlocks(lastCheckedBlock uint64) {
 
 	// set it to true to catch the first cycle run case where the check can pass before the latest block is checked
 	s.isDownloading.Store(true)
+	s.isReorgDetected.Store(false)
 	s.lastCheckedL1Block.Store(lastCheckedBlock)
+	s.lastCheckedL1BlockHash = common.Hash{}
 
 	s.wgRunLoopDone.Add(1)
 	s.flagStop.Store(false)
@@ -183,21 +192,24 @@ func (s *L1Syncer) RunQueryBlocks(lastCheckedBlock uint64) {
 				return
 			}
 
-			latestL1Block, err := s.getLatestL1Block()
-			if err != nil {
-				log.Error("Error getting latest L1 block", "err", err)
-			} else {
-				if latestL1Block > s.lastCheckedL1Block.Load() {
-					s.isDownloading.Store(true)
-					if err := s.queryBlocks(); err != nil {
-						log.Error("Error querying blocks", "err", err)
-					} else {
-						s.lastCheckedL1Block.Store(latestL1Block)
-					}
+			caughtUp, reorged := s.pollL1()
+			if reorged {
+				s.stopOnReorg()
+				return
+			}
+
+			// once the windowed catch-up is done follow the L1 in real time until the subscription drops
+			if caughtUp && s.subscriptionEnabled() {
+				reorged, err := s.followL1Logs()
+				if reorged {
+					s.stopOnReorg()
+					return
+				}
+				if err != nil {
+					log.Warn("L1 log subscription dropped, falling back to polling", "err", err)
 				}
 			}
 
-			s.isDownloading.Store(false)
 			time.Sleep(time.Duration(s.queryDelay) * time.Millisecond)
 		}
 	}()
@@ -290,7 +302,7 @@ func (s *L1Syncer) L1QueryHeaders(logs []ethTypes.Log) (map[uint64]*ethTypes.Hea
 
 	// launch the workers - some endpoints might be faster than others so will consume more of the queue
 	// but, we really don't care about that.  We want the data as fast as possible
-	mans := s.etherMans
+	mans := s.endpoints.endpoints
 	for i := 0; i < len(mans); i++ {
 		go process(mans[i])
 	}
@@ -327,10 +339,98 @@ func (s *L1Syncer) getLatestL1Block() (uint64, error) {
 
 	latest := latestBlock.NumberU64()
 	s.latestL1Block = latest
+	s.latestL1BlockHash = latestBlock.Hash()
 
 	return latest, nil
 }
 
+// pollL1 fetches the logs between the last checked block and the highest L1 block in windows of blockRange blocks.
+// caughtUp is true when every block up to the highest L1 block has been checked
+func (s *L1Syncer) pollL1() (caughtUp bool, reorged bool) {
+	defer s.isDownloading.Store(false)
+
+	latestL1Block, err := s.getLatestL1Block()
+	if err != nil {
+		log.Error("Error getting latest L1 block", "err", err)
+		return false, false
+	}
+	if latestL1Block <= s.lastCheckedL1Block.Load() {
+		return true, false
+	}
+
+	s.isDownloading.Store(true)
+	if reorged, err = s.checkForReorg(); err != nil {
+		log.Error("Error checking for an L1 reorg", "err", err)
+		return false, false
+	}
+	if reorged {
+		return false, true
+	}
+	if err = s.queryBlocks(); err != nil {
+		log.Error("Error querying blocks", "err", err)
+		return false, false
+	}
+
+	s.lastCheckedL1Block.Store(latestL1Block)
+	s.lastCheckedL1BlockHash = s.latestL1BlockHash
+	return true, false
+}
+
+func (s *L1Syncer) stopOnReorg() {
+	log.Warn("L1 reorg detected, stopping the L1 syncer", "lastCheckedL1Block", s.lastCheckedL1Block.Load())
+	s.isReorgDetected.Store(true)
+	s.isDownloading.Store(false)
+}
+
+// checkForReorg compares the hash of the last checked L1 block with the one the L1 has now.  A finalized L1 can't
+// reorg so there is nothing to check when following it
+func (s *L1Syncer) checkForReorg() (bool, error) {
+	if s.highestBlockType == "finalized" || s.lastCheckedL1BlockHash == (common.Hash{}) {
+		return false, nil
+	}
+
+	em := s.getNextEtherman()
+	header, err := em.HeaderByNumber(s.ctx, new(big.Int).SetUint64(s.lastCheckedL1Block.Load()))
+	if err != nil {
+		if errors.Is(err, ethereum.NotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return header.Hash() != s.lastCheckedL1BlockHash, nil
+}
+
+// FindL1ReorgPoint walks back through the L1 blocks some data was stored for, comparing the hash stored with each
+// block against the L1.  It returns the lowest stored block that is no longer canonical, everything stored from that
+// block onwards needs to be unwound.  Zero means the most recent stored block is still canonical.
+// It also returns the highest stored block that is still canonical, or zero when there is none.  The L1 after it can
+// have been reorganised even where nothing was stored, so the syncer has to check the L1 again from there.
+// getBlockHashBelow returns the highest stored block below the given one and its hash, or zero when there is none
+func FindL1ReorgPoint(getHeader func(blockNo uint64) (*ethTypes.Header, error), getBlockHashBelow func(blockNo uint64) (uint64, common.Hash, error)) (reorgPoint, canonicalBlock uint64, err error) {
+	next := uint64(math.MaxUint64)
+	for {
+		blockNo, hash, err := getBlockHashBelow(next)
+		if err != nil {
+			return 0, 0, err
+		}
+		if blockNo == 0 {
+			return reorgPoint, 0, nil
+		}
+
+		header, err := getHeader(blockNo)
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return 0, 0, err
+		}
+		if err == nil && header.Hash() == hash {
+			return reorgPoint, blockNo, nil
+		}
+
+		reorgPoint = blockNo
+		next = blockNo
+	}
+}
+
 func (s *L1Syncer) queryBlocks() error {
 	// Fixed receiving duplicate log events.
 	// lastCheckedL1Block means that it has already been checked in the previous cycle.
@@ -567,6 +667,14 @@ func (s *L1Syncer) CallContract(ctx context.Context, addr *common.Address, data
 	}, nil)
 }
 
+func (s *L1Syncer) CallContractAtBlock(ctx context.Context, addr *common.Address, data []byte, blockNumber *big.Int) ([]byte, error) {
+	em := s.getNextEtherman()
+	return em.CallContract(ctx, ethereum.CallMsg{
+		To:   addr,
+		Data: data,
+	}, blockNumber)
+}
+
 func (s *L1Syncer) CheckL1BlockFinalized(blockNo uint64) (finalized bool, finalizedBn uint64, err error) {
 	em := s.getNextEtherman()
 	block, err := em.BlockByNumber(s.ctx, big.NewInt(rpc.FinalizedBlockNumber.Int64()))
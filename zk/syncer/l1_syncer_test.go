@@ -0,0 +1,114 @@
+package syncer
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	ethereum "github.com/ledgerwatch/erigon"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/stretchr/testify/require"
+
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+)
+
+func TestFindL1ReorgPoint(t *testing.T) {
+	canonical := map[uint64]*ethTypes.Header{}
+	for i := uint64(1); i <= 10; i++ {
+		canonical[i] = &ethTypes.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0), Extra: []byte("canonical")}
+	}
+	getHeader := func(blockNo uint64) (*ethTypes.Header, error) {
+		header, ok := canonical[blockNo]
+		if !ok {
+			return nil, ethereum.NotFound
+		}
+		return header, nil
+	}
+
+	// blocks 2, 5 and 8 hold data, block 12 is beyond the head of the canonical chain
+	stored := func(forked map[uint64]bool) func(uint64) (uint64, common.Hash, error) {
+		blocks := []uint64{12, 8, 5, 2}
+		return func(below uint64) (uint64, common.Hash, error) {
+			for _, b := range blocks {
+				if b < below {
+					hash := common.Hash{}
+					if header, ok := canonical[b]; ok && !forked[b] {
+						hash = header.Hash()
+					}
+					return b, hash, nil
+				}
+			}
+			return 0, common.Hash{}, nil
+		}
+	}
+
+	tests := []struct {
+		name              string
+		forked            map[uint64]bool
+		expectedReorg     uint64
+		expectedCanonical uint64
+	}{
+		{"chain shorter than stored blocks", map[uint64]bool{}, 12, 8},
+		{"reorg below stored blocks", map[uint64]bool{8: true, 5: true}, 5, 2},
+		{"everything forked", map[uint64]bool{8: true, 5: true, 2: true}, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reorgPoint, canonicalBlock, err := FindL1ReorgPoint(getHeader, stored(tt.forked))
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedReorg, reorgPoint)
+			require.Equal(t, tt.expectedCanonical, canonicalBlock)
+		})
+	}
+
+	// nothing stored on top of the canonical chain
+	reorgPoint, canonicalBlock, err := FindL1ReorgPoint(getHeader, func(below uint64) (uint64, common.Hash, error) {
+		if below > 8 {
+			return 8, canonical[8].Hash(), nil
+		}
+		return 0, common.Hash{}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), reorgPoint)
+	require.Equal(t, uint64(8), canonicalBlock)
+
+	// nothing stored at all
+	reorgPoint, canonicalBlock, err = FindL1ReorgPoint(getHeader, func(uint64) (uint64, common.Hash, error) {
+		return 0, common.Hash{}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), reorgPoint)
+	require.Equal(t, uint64(0), canonicalBlock)
+}
+
+func TestL1Syncer_CheckForReorg(t *testing.T) {
+	live := &fakeEtherman{headers: map[uint64]*ethTypes.Header{}, latest: 20}
+	for i := uint64(0); i <= 20; i++ {
+		live.headers[i] = &ethTypes.Header{Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(0)}
+	}
+
+	s := NewL1Syncer(context.Background(), []IEtherman{live}, nil, nil, 10, 0, "latest")
+	s.lastCheckedL1Block.Store(20)
+
+	// nothing checked yet
+	reorged, err := s.checkForReorg()
+	require.NoError(t, err)
+	require.False(t, reorged)
+
+	s.lastCheckedL1BlockHash = live.headers[20].Hash()
+	reorged, err = s.checkForReorg()
+	require.NoError(t, err)
+	require.False(t, reorged)
+
+	live.headers[20] = &ethTypes.Header{Number: big.NewInt(20), Difficulty: big.NewInt(0), Extra: []byte("fork")}
+	reorged, err = s.checkForReorg()
+	require.NoError(t, err)
+	require.True(t, reorged)
+
+	// a finalized block can't be reorganised so it is never checked
+	s.highestBlockType = "finalized"
+	reorged, err = s.checkForReorg()
+	require.NoError(t, err)
+	require.False(t, reorged)
+}
@@ -15,8 +15,9 @@ import (
 )
 
 const (
-	aclFolder = "acls"
-	modeKey   = "mode"
+	aclFolder       = "acls"
+	modeKey         = "mode"
+	rulesVersionKey = "rulesVersion"
 )
 
 type ACLTable string
@@ -26,6 +27,7 @@ const (
 	Allowlist          = "Allowlist"
 	BlockList          = "BlockList"
 	PolicyTransactions = "PolicyTransactions"
+	Rules              = "Rules"
 )
 
 func (t ACLTable) String() string {
@@ -42,6 +44,8 @@ func ResolveACLTable(table string) (ACLTable, error) {
 		return BlockList, nil
 	case "policytransactions":
 		return PolicyTransactions, nil
+	case "rules":
+		return Rules, nil
 	default:
 		return "", errUnknownACLTable
 	}
@@ -92,6 +96,7 @@ var (
 		Allowlist,
 		BlockList,
 		PolicyTransactions,
+		Rules,
 	}
 
 	ACLTablesCfg = kv.TableCfg{}
@@ -101,6 +106,10 @@ var (
 	errUnknownACLTable    = errors.New("unknown acl table")
 	errUnknownPolicy      = errors.New("unknown policy")
 	errWrongOperation     = errors.New("wrong operation")
+	errUnknownRuleEffect  = errors.New("unknown rule effect")
+	errInvalidRule        = errors.New("invalid rule")
+	errUnknownRule        = errors.New("unknown rule")
+	errInvalidSelector    = errors.New("invalid selector")
 )
 
 const ACLDB kv.Label = 255
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -26,6 +27,8 @@ const (
 	Remove
 	Update
 	ModeChange
+	AddRuleOp
+	RemoveRuleOp
 )
 
 func (p Operation) ToByte() byte {
@@ -47,6 +50,10 @@ func OperationFromByte(b byte) Operation {
 		return Update
 	case byte(ModeChange):
 		return ModeChange
+	case byte(AddRuleOp):
+		return AddRuleOp
+	case byte(RemoveRuleOp):
+		return RemoveRuleOp
 	default:
 		return Add // Default or error handling can be added here
 	}
@@ -63,6 +70,10 @@ func (p Operation) String() string {
 		return "update"
 	case ModeChange:
 		return "mode change"
+	case AddRuleOp:
+		return "add rule"
+	case RemoveRuleOp:
+		return "remove rule"
 	default:
 		return "unknown operation"
 	}
@@ -75,6 +86,7 @@ const (
 	AllowListTypeB ACLTypeBinary = iota
 	BlockListTypeB
 	DisabledModeB
+	RulesTypeB
 )
 
 func (p ACLTypeBinary) ToByte() byte {
@@ -107,6 +119,8 @@ func ACLTypeBinaryFromByte(b byte) ACLTypeBinary {
 		return BlockListTypeB
 	case byte(DisabledModeB):
 		return DisabledModeB
+	case byte(RulesTypeB):
+		return RulesTypeB
 	default:
 		return BlockListTypeB // Default or error handling can be added here
 	}
@@ -121,6 +135,8 @@ func (p ACLTypeBinary) String() string {
 		return "blocklist"
 	case DisabledModeB:
 		return "disabled"
+	case RulesTypeB:
+		return "rules"
 	default:
 		return "Unknown ACLTypeBinary"
 	}
@@ -325,6 +341,7 @@ type PolicyTransaction struct {
 	policy    Policy
 	operation Operation
 	timeTx    time.Time
+	rule      string // name of the rule for rule changes, appended to the encoded transaction
 }
 
 // Convert time.Time to bytes (Unix timestamp)
@@ -345,7 +362,16 @@ func InsertPolicyTransactions(ctx context.Context, aclDB kv.RwDB, pts []PolicyTr
 			addressTimestamp := append(pt.addr.Bytes(), unixBytes...)
 			value := append([]byte{pt.aclType.ToByte(), pt.operation.ToByte(), pt.policy.ToByte()}, addressTimestamp...)
 
-			if err := tx.Put(PolicyTransactions, addressTimestamp, value); err != nil {
+			// the operation and policy are part of the key so changes to the same account within a second don't
+			// collide
+			key := append(common.Copy(addressTimestamp), pt.operation.ToByte(), pt.policy.ToByte())
+			if pt.rule != "" {
+				// rules have no address, key them by name instead
+				key = append(append([]byte(pt.rule), unixBytes...), pt.operation.ToByte())
+				value = append(value, []byte(pt.rule)...)
+			}
+
+			if err := tx.Put(PolicyTransactions, key, value); err != nil {
 				return err
 			}
 		}
@@ -375,8 +401,8 @@ func LastPolicyTransactions(ctx context.Context, aclDB kv.RwDB, count int) ([]Po
 			return err
 		}
 		defer c.Close()
-		_, value, err := c.Last()
-		if err != nil {
+		key, value, err := c.Last()
+		if err != nil || key == nil {
 			return err
 		}
 
@@ -387,8 +413,8 @@ func LastPolicyTransactions(ctx context.Context, aclDB kv.RwDB, count int) ([]Po
 		pts = append(pts, pt)
 
 		for i := 1; i < count; i++ {
-			_, value, err = c.Prev()
-			if err != nil {
+			key, value, err = c.Prev()
+			if err != nil || key == nil {
 				return err
 			}
 
@@ -420,7 +446,8 @@ func byteToPolicyTransaction(value []byte) (PolicyTransaction, error) {
 	// 1 byte for policy,
 	// 20 bytes for address,
 	// 8 bytes for timestamp = 31 bytes in total
-	if len(value) != 31 {
+	// rule changes have the name of the rule after that
+	if len(value) < 31 {
 		return PolicyTransaction{}, fmt.Errorf("invalid value length %d", len(value))
 	}
 
@@ -448,6 +475,7 @@ func byteToPolicyTransaction(value []byte) (PolicyTransaction, error) {
 		policy:    policy,
 		operation: operation,
 		timeTx:    timeTx,
+		rule:      string(value[31:]),
 	}, nil
 }
 
@@ -461,6 +489,13 @@ func (pt PolicyTransaction) ToString() string {
 			pt.operation.String(),
 			pt.timeTx.Format(time.RFC3339)) // Use RFC3339 format for the
 	}
+	if pt.operation == AddRuleOp || pt.operation == RemoveRuleOp {
+		return fmt.Sprintf("ACLType: %s, Rule: %s, Operation: %s, Time: %s",
+			pt.aclType.String(),
+			pt.rule,
+			pt.operation.String(),
+			pt.timeTx.Format(time.RFC3339))
+	}
 	return fmt.Sprintf("ACLType: %s, Address: %s, Policy: %s, Operation: %s, Time: %s",
 		pt.aclType.String(),
 		hex.EncodeToString(pt.addr[:]), // Convert address to hexadecimal string representation
@@ -469,6 +504,31 @@ func (pt PolicyTransaction) ToString() string {
 		pt.timeTx.Format(time.RFC3339)) // Use RFC3339 format for the time
 }
 
+// MarshalJSON encodes the policy transaction the way ToString describes it
+func (pt PolicyTransaction) MarshalJSON() ([]byte, error) {
+	enc := struct {
+		ACLType   string          `json:"aclType"`
+		Operation string          `json:"operation"`
+		Address   *common.Address `json:"address,omitempty"`
+		Policy    string          `json:"policy,omitempty"`
+		Rule      string          `json:"rule,omitempty"`
+		Time      time.Time       `json:"time"`
+	}{
+		ACLType:   pt.aclType.String(),
+		Operation: pt.operation.String(),
+		Time:      pt.timeTx,
+	}
+	switch pt.operation {
+	case ModeChange:
+	case AddRuleOp, RemoveRuleOp:
+		enc.Rule = pt.rule
+	default:
+		enc.Address = &pt.addr
+		enc.Policy = policyName(pt.policy)
+	}
+	return json.Marshal(enc)
+}
+
 // AddPolicy adds a policy to the ACL of given address
 func AddPolicy(ctx context.Context, aclDB kv.RwDB, aclType string, addr common.Address, policy Policy) error {
 	if !IsSupportedPolicy(policy) {
@@ -567,6 +627,7 @@ func ListContentAtACL(ctx context.Context, db kv.RwDB) ([]string, error) {
 	var bufferConfig bytes.Buffer
 	var bufferBlockList bytes.Buffer
 	var bufferAllowlist bytes.Buffer
+	var bufferRules bytes.Buffer
 
 	tables := db.AllTables()
 	buffer.WriteString(" \n")
@@ -637,13 +698,33 @@ func ListContentAtACL(ctx context.Context, db kv.RwDB) ([]string, error) {
 			bufferAllowlist.WriteString("\nAllowlist is empty")
 		}
 
-		return err
+		// Rules table
+		rules, err := readRules(tx)
+		if err != nil {
+			return err
+		}
+		if len(rules) > 0 {
+			bufferRules.WriteString("\nRules\n")
+			for _, rule := range rules {
+				encoded, err := json.Marshal(rule)
+				if err != nil {
+					return err
+				}
+				bufferRules.WriteString(fmt.Sprintf("%s\n", encoded))
+			}
+		} else {
+			bufferRules.WriteString("\nRules is empty")
+		}
+		buffer.WriteString(bufferRules.String())
+
+		return nil
 	})
 
 	combinedBuffers = append(combinedBuffers, buffer.String())
 	combinedBuffers = append(combinedBuffers, bufferConfig.String())
 	combinedBuffers = append(combinedBuffers, bufferBlockList.String())
 	combinedBuffers = append(combinedBuffers, bufferAllowlist.String())
+	combinedBuffers = append(combinedBuffers, bufferRules.String())
 
 	return combinedBuffers, err
 }
@@ -710,19 +791,24 @@ func resolvePolicy(txn *types.TxSlot) Policy {
 	return SendTx
 }
 
-// isActionAllowed checks if the given action is allowed for the given address
-func (p *TxPool) isActionAllowed(ctx context.Context, addr common.Address, policy Policy) (bool, error) {
+// isActionAllowed checks if the given action is allowed for the given address.  Unless the ACL is disabled the call,
+// if given, also has to pass the ACL rules
+func (p *TxPool) isActionAllowed(ctx context.Context, addr common.Address, policy Policy, call *TxCall) (bool, error) {
 	hasPolicy, mode, err := checkIfAccountHasPolicy(ctx, p.aclDB, addr, policy)
 	if err != nil {
 		return false, err
 	}
 
-	switch mode {
-	case BlocklistMode:
+	allowed := hasPolicy
+	if mode == BlocklistMode {
 		// If the mode is blocklist, and address has a certain policy, then invert the result
 		// because, for example, if it has sendTx policy, it means it is not allowed to sendTx
-		return !hasPolicy, nil
-	default:
-		return hasPolicy, nil
+		allowed = !hasPolicy
 	}
+
+	if !allowed || mode == DisabledMode || call == nil {
+		return allowed, nil
+	}
+
+	return checkRules(ctx, p.aclDB, &p.aclRules, addr, call, time.Now())
 }
@@ -0,0 +1,337 @@
+package txpool
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/types"
+
+	"github.com/ledgerwatch/erigon/crypto"
+)
+
+// RuleEffect is what a rule does to the calls it matches
+type RuleEffect string
+
+const (
+	// RuleAllow restricts the calls it matches to the rule's senders, everyone else is refused
+	RuleAllow RuleEffect = "allow"
+	// RuleDeny refuses the calls it matches from the rule's senders
+	RuleDeny RuleEffect = "deny"
+)
+
+func ResolveRuleEffect(effect string) (RuleEffect, error) {
+	switch strings.ToLower(effect) {
+	case string(RuleAllow):
+		return RuleAllow, nil
+	case string(RuleDeny):
+		return RuleDeny, nil
+	default:
+		return "", errUnknownRuleEffect
+	}
+}
+
+// Selector is the 4-byte selector of a contract function
+type Selector [4]byte
+
+// ParseSelector accepts either the hex encoded selector or the function signature it is derived from, e.g.
+// "transfer(address,uint256)"
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "(") {
+		copy(selector[:], crypto.Keccak256([]byte(strings.ReplaceAll(s, " ", "")))[:4])
+		return selector, nil
+	}
+
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != len(selector) {
+		return selector, fmt.Errorf("%w: %q", errInvalidSelector, s)
+	}
+	copy(selector[:], b)
+	return selector, nil
+}
+
+func (s Selector) String() string {
+	return "0x" + hex.EncodeToString(s[:])
+}
+
+func (s Selector) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Selector) UnmarshalText(text []byte) error {
+	selector, err := ParseSelector(string(text))
+	if err != nil {
+		return err
+	}
+	*s = selector
+	return nil
+}
+
+// Rule is an ACL rule on the calls transactions make.  Every condition that is set has to hold for a rule to match a
+// call: an empty sender, destination or selector list matches anything.  A value cap makes an allow rule only allow
+// calls up to the cap, and a deny rule only deny calls above it.  Rules only apply within their time window
+type Rule struct {
+	Name       string           `json:"name"`
+	Effect     RuleEffect       `json:"effect"`
+	Senders    []common.Address `json:"senders,omitempty"`
+	To         []common.Address `json:"to,omitempty"`
+	Selectors  []Selector       `json:"selectors,omitempty"`
+	MaxValue   *big.Int         `json:"maxValue,omitempty"`
+	ValidFrom  *time.Time       `json:"validFrom,omitempty"`
+	ValidUntil *time.Time       `json:"validUntil,omitempty"`
+}
+
+// TxCall is what the ACL rules look at in a transaction
+type TxCall struct {
+	To          common.Address
+	Creation    bool
+	Selector    Selector
+	HasSelector bool
+	Value       *big.Int
+}
+
+func txCallFromSlot(txn *types.TxSlot) *TxCall {
+	return &TxCall{
+		To:          txn.To,
+		Creation:    txn.Creation,
+		Selector:    txn.Selector,
+		HasSelector: txn.DataLen >= 4,
+		Value:       txn.Value.ToBig(),
+	}
+}
+
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: rule has no name", errInvalidRule)
+	}
+	if _, err := ResolveRuleEffect(string(r.Effect)); err != nil {
+		return err
+	}
+	if r.MaxValue != nil && r.MaxValue.Sign() < 0 {
+		return fmt.Errorf("%w: negative value cap", errInvalidRule)
+	}
+	if r.ValidFrom != nil && r.ValidUntil != nil && !r.ValidFrom.Before(*r.ValidUntil) {
+		return fmt.Errorf("%w: time window ends before it starts", errInvalidRule)
+	}
+	return nil
+}
+
+func (r *Rule) activeAt(now time.Time) bool {
+	if r.ValidFrom != nil && now.Before(*r.ValidFrom) {
+		return false
+	}
+	if r.ValidUntil != nil && !now.Before(*r.ValidUntil) {
+		return false
+	}
+	return true
+}
+
+// matchesCall checks the destination and selector, creations never match a rule that names either
+func (r *Rule) matchesCall(call *TxCall) bool {
+	if len(r.To) > 0 {
+		if call.Creation || !containsAddress(r.To, call.To) {
+			return false
+		}
+	}
+	if len(r.Selectors) > 0 {
+		if call.Creation || !call.HasSelector {
+			return false
+		}
+		found := false
+		for _, s := range r.Selectors {
+			if s == call.Selector {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) matchesSender(addr common.Address) bool {
+	return len(r.Senders) == 0 || containsAddress(r.Senders, addr)
+}
+
+func (r *Rule) exceedsCap(value *big.Int) bool {
+	return r.MaxValue != nil && value != nil && value.Cmp(r.MaxValue) > 0
+}
+
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateRules refuses a call if a deny rule matches it, or if allow rules cover the call but none of them lets the
+// sender make it
+func evaluateRules(rules []Rule, sender common.Address, call *TxCall, now time.Time) bool {
+	restricted, allowed := false, false
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.activeAt(now) || !rule.matchesCall(call) {
+			continue
+		}
+
+		switch rule.Effect {
+		case RuleDeny:
+			if rule.matchesSender(sender) && (rule.MaxValue == nil || rule.exceedsCap(call.Value)) {
+				return false
+			}
+		case RuleAllow:
+			restricted = true
+			if rule.matchesSender(sender) && !rule.exceedsCap(call.Value) {
+				allowed = true
+			}
+		}
+	}
+
+	return !restricted || allowed
+}
+
+func readRules(tx kv.Tx) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	err := tx.ForEach(Rules, nil, func(k, v []byte) error {
+		var rule Rule
+		if err := json.Unmarshal(v, &rule); err != nil {
+			return fmt.Errorf("decode rule %s: %w", string(k), err)
+		}
+		rules = append(rules, rule)
+		return nil
+	})
+	return rules, err
+}
+
+// bumpRulesVersion marks the rules as changed so that every process using the ACL decodes them again
+func bumpRulesVersion(tx kv.RwTx) error {
+	version, err := readRulesVersion(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Put(Config, []byte(rulesVersionKey), binary.BigEndian.AppendUint64(nil, version+1))
+}
+
+func readRulesVersion(tx kv.Tx) (uint64, error) {
+	v, err := tx.GetOne(Config, []byte(rulesVersionKey))
+	if err != nil || len(v) != 8 {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// ruleCache holds the decoded ACL rules, they are only read again once the rules version in the ACL changes
+type ruleCache struct {
+	lock    sync.Mutex
+	loaded  bool
+	version uint64
+	rules   []Rule
+}
+
+func (c *ruleCache) get(ctx context.Context, aclDB kv.RwDB) ([]Rule, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	err := aclDB.View(ctx, func(tx kv.Tx) error {
+		version, err := readRulesVersion(tx)
+		if err != nil || (c.loaded && version == c.version) {
+			return err
+		}
+		rules, err := readRules(tx)
+		if err != nil {
+			return err
+		}
+		c.loaded, c.version, c.rules = true, version, rules
+		return nil
+	})
+	return c.rules, err
+}
+
+// checkRules checks the call against the ACL rules
+func checkRules(ctx context.Context, aclDB kv.RwDB, cache *ruleCache, sender common.Address, call *TxCall, now time.Time) (bool, error) {
+	rules, err := cache.get(ctx, aclDB)
+	if err != nil {
+		return false, err
+	}
+
+	return evaluateRules(rules, sender, call, now), nil
+}
+
+// ListRules returns the ACL rules ordered by name
+func ListRules(ctx context.Context, aclDB kv.RwDB) ([]Rule, error) {
+	var rules []Rule
+	err := aclDB.View(ctx, func(tx kv.Tx) (err error) {
+		rules, err = readRules(tx)
+		return err
+	})
+	return rules, err
+}
+
+// AddRule adds a rule to the ACL, replacing any rule with the same name
+func AddRule(ctx context.Context, aclDB kv.RwDB, rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	if err = aclDB.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(Rules, []byte(rule.Name), encoded); err != nil {
+			return err
+		}
+		return bumpRulesVersion(tx)
+	}); err != nil {
+		return err
+	}
+
+	return InsertPolicyTransactions(ctx, aclDB, []PolicyTransaction{{
+		aclType:   RulesTypeB,
+		operation: AddRuleOp,
+		rule:      rule.Name,
+		timeTx:    time.Now(),
+	}})
+}
+
+// RemoveRule removes the named rule from the ACL
+func RemoveRule(ctx context.Context, aclDB kv.RwDB, name string) error {
+	err := aclDB.Update(ctx, func(tx kv.RwTx) error {
+		value, err := tx.GetOne(Rules, []byte(name))
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return fmt.Errorf("%w: %s", errUnknownRule, name)
+		}
+		if err = tx.Delete(Rules, []byte(name)); err != nil {
+			return err
+		}
+		return bumpRulesVersion(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	return InsertPolicyTransactions(ctx, aclDB, []PolicyTransaction{{
+		aclType:   RulesTypeB,
+		operation: RemoveRuleOp,
+		rule:      name,
+		timeTx:    time.Now(),
+	}})
+}
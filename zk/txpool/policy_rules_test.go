@@ -0,0 +1,235 @@
+package txpool
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	fromSignature, err := ParseSelector("transfer(address, uint256)")
+	require.NoError(t, err)
+	require.Equal(t, "0xa9059cbb", fromSignature.String())
+
+	fromHex, err := ParseSelector("0xa9059cbb")
+	require.NoError(t, err)
+	require.Equal(t, fromSignature, fromHex)
+
+	_, err = ParseSelector("0xa9059c")
+	require.ErrorIs(t, err, errInvalidSelector)
+}
+
+func TestEvaluateRules(t *testing.T) {
+	admin := common.HexToAddress("0xad")
+	user := common.HexToAddress("0x05e5")
+	bridge := common.HexToAddress("0xb1d6e")
+	other := common.HexToAddress("0x07e5")
+	pause, _ := ParseSelector("pause()")
+	deposit, _ := ParseSelector("bridgeAsset(uint32,address,uint256,address,bool,bytes)")
+
+	now := time.Unix(1_700_000_000, 0)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	call := func(to common.Address, selector Selector, value int64) *TxCall {
+		return &TxCall{To: to, Selector: selector, HasSelector: true, Value: big.NewInt(value)}
+	}
+
+	tests := []struct {
+		name    string
+		rules   []Rule
+		sender  common.Address
+		call    *TxCall
+		allowed bool
+	}{
+		{
+			name:    "no rules",
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: true,
+		},
+		{
+			name:    "allow rule restricts the contract to its senders",
+			rules:   []Rule{{Name: "bridge", Effect: RuleAllow, Senders: []common.Address{admin}, To: []common.Address{bridge}}},
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: false,
+		},
+		{
+			name:    "allow rule lets its senders through",
+			rules:   []Rule{{Name: "bridge", Effect: RuleAllow, Senders: []common.Address{admin}, To: []common.Address{bridge}}},
+			sender:  admin,
+			call:    call(bridge, deposit, 1),
+			allowed: true,
+		},
+		{
+			name:    "allow rule leaves other contracts alone",
+			rules:   []Rule{{Name: "bridge", Effect: RuleAllow, Senders: []common.Address{admin}, To: []common.Address{bridge}}},
+			sender:  user,
+			call:    call(other, deposit, 1),
+			allowed: true,
+		},
+		{
+			name:    "selector scoped allow rule leaves other functions alone",
+			rules:   []Rule{{Name: "pause", Effect: RuleAllow, Senders: []common.Address{admin}, To: []common.Address{bridge}, Selectors: []Selector{pause}}},
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: true,
+		},
+		{
+			name:    "selector scoped allow rule restricts its function",
+			rules:   []Rule{{Name: "pause", Effect: RuleAllow, Senders: []common.Address{admin}, To: []common.Address{bridge}, Selectors: []Selector{pause}}},
+			sender:  user,
+			call:    call(bridge, pause, 0),
+			allowed: false,
+		},
+		{
+			name:    "allow rule value cap",
+			rules:   []Rule{{Name: "bridge", Effect: RuleAllow, To: []common.Address{bridge}, MaxValue: big.NewInt(100)}},
+			sender:  user,
+			call:    call(bridge, deposit, 101),
+			allowed: false,
+		},
+		{
+			name:    "deny rule",
+			rules:   []Rule{{Name: "deny", Effect: RuleDeny, Senders: []common.Address{user}, To: []common.Address{bridge}}},
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: false,
+		},
+		{
+			name: "deny rule wins over allow rule",
+			rules: []Rule{
+				{Name: "allow", Effect: RuleAllow, Senders: []common.Address{user}, To: []common.Address{bridge}},
+				{Name: "deny", Effect: RuleDeny, Selectors: []Selector{deposit}},
+			},
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: false,
+		},
+		{
+			name:    "deny rule value cap only denies above the cap",
+			rules:   []Rule{{Name: "deny", Effect: RuleDeny, To: []common.Address{bridge}, MaxValue: big.NewInt(100)}},
+			sender:  user,
+			call:    call(bridge, deposit, 100),
+			allowed: true,
+		},
+		{
+			name:    "expired rule",
+			rules:   []Rule{{Name: "deny", Effect: RuleDeny, Senders: []common.Address{user}, ValidUntil: &past}},
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: true,
+		},
+		{
+			name:    "rule not yet active",
+			rules:   []Rule{{Name: "deny", Effect: RuleDeny, Senders: []common.Address{user}, ValidFrom: &future}},
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: true,
+		},
+		{
+			name:    "rule within its window",
+			rules:   []Rule{{Name: "deny", Effect: RuleDeny, Senders: []common.Address{user}, ValidFrom: &past, ValidUntil: &future}},
+			sender:  user,
+			call:    call(bridge, deposit, 1),
+			allowed: false,
+		},
+		{
+			name:    "creation never matches a destination",
+			rules:   []Rule{{Name: "deny", Effect: RuleDeny, To: []common.Address{{}}}},
+			sender:  user,
+			call:    &TxCall{Creation: true, Value: big.NewInt(0)},
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.allowed, evaluateRules(tt.rules, tt.sender, tt.call, now))
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	db := newTestACLDB(t, "")
+	ctx := context.Background()
+	txPool := &TxPool{aclDB: db}
+
+	user := common.HexToAddress("0x05e5")
+	bridge := common.HexToAddress("0xb1d6e")
+	call := &TxCall{To: bridge, Value: big.NewInt(0)}
+
+	require.ErrorIs(t, AddRule(ctx, db, Rule{Name: "bad", Effect: "maybe"}), errUnknownRuleEffect)
+	require.ErrorIs(t, AddRule(ctx, db, Rule{Effect: RuleDeny}), errInvalidRule)
+
+	rule := Rule{Name: "bridge", Effect: RuleAllow, Senders: []common.Address{common.HexToAddress("0xad")}, To: []common.Address{bridge}}
+	require.NoError(t, AddRule(ctx, db, rule))
+
+	rules, err := ListRules(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{rule}, rules)
+
+	// rules don't apply while the ACL is disabled
+	require.NoError(t, SetMode(ctx, db, DisabledMode))
+	allowed, err := txPool.isActionAllowed(ctx, user, SendTx, call)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	require.NoError(t, SetMode(ctx, db, BlocklistMode))
+	allowed, err = txPool.isActionAllowed(ctx, user, SendTx, call)
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	require.NoError(t, RemoveRule(ctx, db, "bridge"))
+	require.ErrorIs(t, RemoveRule(ctx, db, "bridge"), errUnknownRule)
+
+	allowed, err = txPool.isActionAllowed(ctx, user, SendTx, call)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// rule changes are part of the policy transaction history
+	pts, err := LastPolicyTransactions(ctx, db, 3)
+	require.NoError(t, err)
+	operations := make(map[Operation]string)
+	for _, pt := range pts {
+		operations[pt.operation] = pt.rule
+	}
+	require.Equal(t, "bridge", operations[AddRuleOp])
+	require.Equal(t, "bridge", operations[RemoveRuleOp])
+}
+
+func TestRuleCache(t *testing.T) {
+	db := newTestACLDB(t, "")
+	ctx := context.Background()
+	cache := &ruleCache{}
+
+	rules, err := cache.get(ctx, db)
+	require.NoError(t, err)
+	require.Empty(t, rules)
+
+	deny := Rule{Name: "deny", Effect: RuleDeny, To: []common.Address{common.HexToAddress("0xb1d6e")}}
+	require.NoError(t, AddRule(ctx, db, deny))
+	rules, err = cache.get(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{deny}, rules)
+
+	// the rules are only decoded again once they are changed through AddRule or RemoveRule
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(Rules, []byte("broken"), []byte("{"))
+	}))
+	rules, err = cache.get(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{deny}, rules)
+
+	require.NoError(t, RemoveRule(ctx, db, "broken"))
+	require.NoError(t, RemoveRule(ctx, db, "deny"))
+	rules, err = cache.get(ctx, db)
+	require.NoError(t, err)
+	require.Empty(t, rules)
+}
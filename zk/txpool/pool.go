@@ -327,6 +327,7 @@ type TxPool struct {
 	isPostShanghai          atomic.Bool
 	ethCfg                  *ethconfig.Config
 	aclDB                   kv.RwDB
+	aclRules                ruleCache
 
 	// we cannot be in a flushing state whilst getting transactions from the pool, so we have this mutex which is
 	// exposed publicly so anything wanting to get "best" transactions can ensure a flush isn't happening and
@@ -670,6 +671,7 @@ func (p *TxPool) IsLocal(idHash []byte) bool {
 }
 func (p *TxPool) AddNewGoodPeer(peerID types.PeerID) { p.recentlyConnectedPeers.AddPeer(peerID) }
 func (p *TxPool) Started() bool                      { return p.started.Load() }
+func (p *TxPool) ACLDB() kv.RwDB                     { return p.aclDB }
 
 func (p *TxPool) ResetYieldedStatus() {
 	p.lock.Lock()
@@ -717,10 +719,9 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 		}
 	}
 
-	if p.ethCfg.Zk.TxPoolRejectSmartContractDeployments {
-		if txn.To == (common.Address{}) {
-			return SmartContractDeploymentDisabled
-		}
+	// only contract creations are rejected, calls go through whatever their destination, the zero address included
+	if p.ethCfg.Zk.TxPoolRejectSmartContractDeployments && txn.Creation {
+		return SmartContractDeploymentDisabled
 	}
 
 	isLondon := p.isLondon()
@@ -787,7 +788,7 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 	switch resolvePolicy(txn) {
 	case SendTx:
 		var allow bool
-		allow, err := p.isActionAllowed(context.TODO(), from, SendTx)
+		allow, err := p.isActionAllowed(context.TODO(), from, SendTx, txCallFromSlot(txn))
 		if err != nil {
 			panic(err)
 		}
@@ -797,7 +798,7 @@ func (p *TxPool) validateTx(txn *types.TxSlot, isLocal bool, stateCache kvcache.
 	case Deploy:
 		var allow bool
 		// check that sender may deploy contracts
-		allow, err := p.isActionAllowed(context.TODO(), from, Deploy)
+		allow, err := p.isActionAllowed(context.TODO(), from, Deploy, txCallFromSlot(txn))
 		if err != nil {
 			panic(err)
 		}
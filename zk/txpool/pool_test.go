@@ -1,9 +1,11 @@
 package txpool
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"math/big"
 	"testing"
 	"time"
 
@@ -19,6 +21,8 @@ import (
 	"github.com/ledgerwatch/erigon-lib/kv/temporal/temporaltest"
 	"github.com/ledgerwatch/erigon-lib/txpool/txpoolcfg"
 	"github.com/ledgerwatch/erigon-lib/types"
+	ethTypes "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/crypto"
 	"github.com/ledgerwatch/erigon/eth/ethconfig"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -244,3 +248,82 @@ func TestOnNewBlock(t *testing.T) {
 	assert.ErrorIs(t, io.EOF, err)
 	assert.Equal(t, 3, len(minedTxs.Txs))
 }
+
+func TestRejectSmartContractDeployments(t *testing.T) {
+	ch := make(chan types.Announcements, 100)
+	_, coreDB, _ := temporaltest.NewTestDB(t, datadir.New(t.TempDir()))
+	defer coreDB.Close()
+
+	db := memdb.NewTestPoolDB(t)
+	aclsDB := newTestACLDB(t, "")
+	defer aclsDB.Close()
+
+	ethCfg := ethconfig.Defaults
+	ethCfg.Zk = &ethconfig.Zk{TxPoolRejectSmartContractDeployments: true}
+	pool, err := New(ch, coreDB, txpoolcfg.DefaultConfig, &ethCfg, kvcache.New(kvcache.DefaultCoherentConfig), *u256.N1, nil, nil, aclsDB)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	balance := make([]byte, types.EncodeSenderLengthForStorage(0, *uint256.NewInt(common.Ether)))
+	types.EncodeSender(0, *uint256.NewInt(common.Ether), balance)
+	change := &remote.StateChangeBatch{
+		PendingBlockBaseFee: 200000,
+		BlockGasLimit:       1000000,
+		ChangeBatch: []*remote.StateChange{{
+			BlockHeight: 0,
+			BlockHash:   gointerfaces.ConvertHashToH256([32]byte{}),
+			Changes: []*remote.AccountChange{{
+				Action:  remote.Action_UPSERT,
+				Address: gointerfaces.ConvertAddressToH160(sender),
+				Data:    balance,
+			}},
+		}},
+	}
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, pool.OnNewBlock(ctx, change, types.TxSlots{}, types.TxSlots{}, tx))
+
+	// the slots come from the parser as they would from the network, it fills in the destination of every call
+	parseCtx := types.NewTxParseContext(*u256.N1)
+	parseCtx.WithSender(false)
+	signer := ethTypes.LatestSignerForChainID(big.NewInt(1))
+	slot := func(nonce uint64, to *common.Address) *types.TxSlot {
+		var txn ethTypes.Transaction
+		if to == nil {
+			txn = ethTypes.NewContractCreation(nonce, uint256.NewInt(0), 100000, uint256.NewInt(300000), []byte{0x60, 0x00})
+		} else {
+			txn = ethTypes.NewTransaction(nonce, *to, uint256.NewInt(0), 100000, uint256.NewInt(300000), []byte{0xa9, 0x05, 0x9c, 0xbb})
+		}
+		signed, err := ethTypes.SignTx(txn, *signer, key)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, signed.MarshalBinary(&buf))
+
+		slot := &types.TxSlot{}
+		_, err = parseCtx.ParseTransaction(buf.Bytes(), 0, slot, nil, false, false, nil)
+		require.NoError(t, err)
+		return slot
+	}
+
+	contract := common.HexToAddress("0xb1d6e")
+	tests := []struct {
+		name   string
+		to     *common.Address
+		reason DiscardReason
+	}{
+		{name: "call", to: &contract, reason: Success},
+		{name: "call to the zero address", to: &common.Address{}, reason: Success},
+		{name: "deployment", reason: SmartContractDeploymentDisabled},
+	}
+	for i, tt := range tests {
+		var slots types.TxSlots
+		slots.Append(slot(uint64(i), tt.to), sender[:], true)
+		reasons, err := pool.AddLocalTxs(ctx, slots, tx)
+		require.NoError(t, err)
+		require.Equal(t, []DiscardReason{tt.reason}, reasons, tt.name)
+	}
+}
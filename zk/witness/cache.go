@@ -0,0 +1,296 @@
+package witness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	mdbx2 "github.com/erigontech/mdbx-go/mdbx"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/length"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/metrics"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const (
+	cacheFolder = "witness-cache"
+	sizeKey     = "size"
+
+	// CacheDB labels the witness cache database
+	CacheDB kv.Label = 254
+
+	// Witnesses maps a batch number to the hash of the batch's last block followed by the witness
+	Witnesses = "Witnesses"
+	// BlockWitnesses maps the last and first block of a range to the hash of the last block followed by the witness
+	BlockWitnesses = "BlockWitnesses"
+	// CacheMeta holds the total size of the cached witnesses
+	CacheMeta = "CacheMeta"
+)
+
+var (
+	CacheTables    = []string{Witnesses, BlockWitnesses, CacheMeta}
+	CacheTablesCfg = kv.TableCfg{}
+
+	errWitnessTooLarge = errors.New("witness is larger than the cache")
+
+	cacheHits      = metrics.GetOrCreateCounter(`witness_cache_total{result="hit"}`)
+	cacheMisses    = metrics.GetOrCreateCounter(`witness_cache_total{result="miss"}`)
+	cacheEvictions = metrics.GetOrCreateCounter(`witness_cache_evictions`)
+	cacheSize      = metrics.GetOrCreateGauge(`witness_cache_size`)
+)
+
+func init() {
+	for _, name := range CacheTables {
+		if _, ok := CacheTablesCfg[name]; !ok {
+			CacheTablesCfg[name] = kv.TableCfgItem{}
+		}
+	}
+}
+
+// Cache is a size bounded store of batch witnesses generated in the node's default witness mode.  Every witness is
+// stored with the hash of its batch's last block so a witness left behind by an unwind is never served, and the
+// lowest batches are evicted once the witnesses outgrow the cache.  The sequencer keeps the witnesses of the block
+// ranges it has pending verifications for in the cache as well
+type Cache struct {
+	db      kv.RwDB
+	maxSize uint64
+}
+
+// OpenCache opens the witness cache in the given data directory
+func OpenCache(ctx context.Context, dataDir string, maxSize datasize.ByteSize) (*Cache, error) {
+	db, err := mdbx.NewMDBX(log.New()).Label(CacheDB).Path(filepath.Join(dataDir, cacheFolder)).
+		WithTableCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg { return CacheTablesCfg }).
+		Flags(func(f uint) uint { return f ^ mdbx2.Durable | mdbx2.SafeNoSync }).
+		GrowthStep(16 * datasize.MB).
+		SyncPeriod(30 * time.Second).
+		Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{db: db, maxSize: maxSize.Bytes()}
+	if err = db.View(ctx, func(tx kv.Tx) error {
+		size, err := readSize(tx)
+		cacheSize.SetUint64(size)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Cache) Close() {
+	c.db.Close()
+}
+
+// lastBlockHash returns the hash of the batch's last block in chaindata, the batch isn't cacheable if it has no blocks
+func lastBlockHash(tx kv.Tx, batchNo uint64) (libcommon.Hash, bool, error) {
+	blockNo, found, err := hermez_db.NewHermezDbReader(tx).GetHighestBlockInBatch(batchNo)
+	if err != nil || !found {
+		return libcommon.Hash{}, false, err
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNo)
+	if err != nil || hash == (libcommon.Hash{}) {
+		return libcommon.Hash{}, false, err
+	}
+	return hash, true, nil
+}
+
+// Get returns the cached witness of the batch if it was generated for the blocks the batch holds in chaindata
+func (c *Cache) Get(ctx context.Context, tx kv.Tx, batchNo uint64) ([]byte, error) {
+	witness, err := c.get(ctx, tx, batchNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if witness == nil {
+		cacheMisses.Inc()
+	} else {
+		cacheHits.Inc()
+	}
+	return witness, nil
+}
+
+func (c *Cache) get(ctx context.Context, tx kv.Tx, batchNo uint64) ([]byte, error) {
+	hash, ok, err := lastBlockHash(tx, batchNo)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return c.read(ctx, Witnesses, hermez_db.Uint64ToBytes(batchNo), hash)
+}
+
+// read returns the witness under the key if it was stored with the hash
+func (c *Cache) read(ctx context.Context, table string, key []byte, hash libcommon.Hash) ([]byte, error) {
+	var witness []byte
+	if err := c.db.View(ctx, func(cacheTx kv.Tx) error {
+		v, err := cacheTx.GetOne(table, key)
+		if err != nil || len(v) < length.Hash || libcommon.BytesToHash(v[:length.Hash]) != hash {
+			return err
+		}
+		witness = libcommon.Copy(v[length.Hash:])
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return witness, nil
+}
+
+// Put caches the witness of the batch, evicting the lowest batches if the cache grows too large
+func (c *Cache) Put(ctx context.Context, tx kv.Tx, batchNo uint64, witness []byte) error {
+	hash, ok, err := lastBlockHash(tx, batchNo)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no blocks found for batch %d", batchNo)
+	}
+
+	value := append(hash.Bytes(), witness...)
+	if uint64(len(value)) > c.maxSize {
+		return fmt.Errorf("%w: batch %d, %d bytes", errWitnessTooLarge, batchNo, len(witness))
+	}
+	return c.write(ctx, Witnesses, hermez_db.Uint64ToBytes(batchNo), value)
+}
+
+func blocksKey(fromBlock, toBlock uint64) []byte {
+	return append(hermez_db.Uint64ToBytes(toBlock), hermez_db.Uint64ToBytes(fromBlock)...)
+}
+
+// GetBlocks returns the cached witness of the blocks from fromBlock to toBlock if it was generated for the blocks
+// chaindata holds
+func (c *Cache) GetBlocks(ctx context.Context, tx kv.Tx, fromBlock, toBlock uint64) ([]byte, error) {
+	hash, err := rawdb.ReadCanonicalHash(tx, toBlock)
+	if err != nil || hash == (libcommon.Hash{}) {
+		return nil, err
+	}
+
+	witness, err := c.read(ctx, BlockWitnesses, blocksKey(fromBlock, toBlock), hash)
+	if err != nil {
+		return nil, err
+	}
+	if witness == nil {
+		cacheMisses.Inc()
+	} else {
+		cacheHits.Inc()
+	}
+	return witness, nil
+}
+
+// PutBlocks caches the witness of the blocks from fromBlock to toBlock, block ranges are evicted before batches
+func (c *Cache) PutBlocks(ctx context.Context, tx kv.Tx, fromBlock, toBlock uint64, witness []byte) error {
+	hash, err := rawdb.ReadCanonicalHash(tx, toBlock)
+	if err != nil {
+		return err
+	}
+	if hash == (libcommon.Hash{}) {
+		return fmt.Errorf("block %d not found", toBlock)
+	}
+
+	value := append(hash.Bytes(), witness...)
+	if uint64(len(value)) > c.maxSize {
+		return fmt.Errorf("%w: blocks %d to %d, %d bytes", errWitnessTooLarge, fromBlock, toBlock, len(witness))
+	}
+	return c.write(ctx, BlockWitnesses, blocksKey(fromBlock, toBlock), value)
+}
+
+// DeleteBlocks drops the witness of the blocks from fromBlock to toBlock
+func (c *Cache) DeleteBlocks(ctx context.Context, fromBlock, toBlock uint64) error {
+	return c.write(ctx, BlockWitnesses, blocksKey(fromBlock, toBlock), nil)
+}
+
+// write stores the value under the key, or deletes the key for a nil value, and evicts what no longer fits
+func (c *Cache) write(ctx context.Context, table string, key, value []byte) error {
+	return c.db.Update(ctx, func(cacheTx kv.RwTx) error {
+		size, err := readSize(cacheTx)
+		if err != nil {
+			return err
+		}
+
+		old, err := cacheTx.GetOne(table, key)
+		if err != nil {
+			return err
+		}
+		size = size - uint64(len(old)) + uint64(len(value))
+		if value == nil {
+			err = cacheTx.Delete(table, key)
+		} else {
+			err = cacheTx.Put(table, key, value)
+		}
+		if err != nil {
+			return err
+		}
+
+		if size, err = evict(cacheTx, size, c.maxSize); err != nil {
+			return err
+		}
+		if err = cacheTx.Put(CacheMeta, []byte(sizeKey), hermez_db.Uint64ToBytes(size)); err != nil {
+			return err
+		}
+		cacheSize.SetUint64(size)
+		return nil
+	})
+}
+
+// Highest returns the highest batch with a cached witness
+func (c *Cache) Highest(ctx context.Context) (batchNo uint64, found bool, err error) {
+	err = c.db.View(ctx, func(tx kv.Tx) error {
+		cursor, err := tx.Cursor(Witnesses)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close()
+		k, _, err := cursor.Last()
+		if err != nil || k == nil {
+			return err
+		}
+		batchNo, found = hermez_db.BytesToUint64(k), true
+		return nil
+	})
+	return batchNo, found, err
+}
+
+// evict deletes the lowest block ranges and then the lowest batches until the witnesses fit in the cache and returns
+// the size left
+func evict(tx kv.RwTx, size, maxSize uint64) (uint64, error) {
+	for _, table := range []string{BlockWitnesses, Witnesses} {
+		if size <= maxSize {
+			return size, nil
+		}
+
+		cursor, err := tx.RwCursor(table)
+		if err != nil {
+			return 0, err
+		}
+		for k, v, err := cursor.First(); k != nil && size > maxSize; k, v, err = cursor.Next() {
+			if err != nil {
+				cursor.Close()
+				return 0, err
+			}
+			if err = cursor.DeleteCurrent(); err != nil {
+				cursor.Close()
+				return 0, err
+			}
+			size -= uint64(len(v))
+			cacheEvictions.Inc()
+		}
+		cursor.Close()
+	}
+	return size, nil
+}
+
+func readSize(tx kv.Tx) (uint64, error) {
+	v, err := tx.GetOne(CacheMeta, []byte(sizeKey))
+	if err != nil {
+		return 0, err
+	}
+	return hermez_db.BytesToUint64(v), nil
+}
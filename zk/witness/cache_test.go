@@ -0,0 +1,110 @@
+package witness
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	ctx, dir := context.Background(), t.TempDir()
+	tx := memdb.BeginRw(t, memdb.NewTestDB(t))
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+
+	hermezDb := hermez_db.NewHermezDb(tx)
+	for blockNo := uint64(1); blockNo <= 3; blockNo++ {
+		require.NoError(t, hermezDb.WriteBlockBatch(blockNo, blockNo))
+		require.NoError(t, rawdb.WriteCanonicalHash(tx, libcommon.BytesToHash([]byte{byte(blockNo)}), blockNo))
+	}
+
+	// a witness takes its size plus the 32 byte block hash, so the cache holds one 30 byte witness but not two
+	cache, err := OpenCache(ctx, dir, 100*datasize.B)
+	require.NoError(t, err)
+
+	witness1 := bytes.Repeat([]byte{1}, 30)
+	require.NoError(t, cache.Put(ctx, tx, 1, witness1))
+	cached, err := cache.Get(ctx, tx, 1)
+	require.NoError(t, err)
+	require.Equal(t, witness1, cached)
+
+	witness2 := bytes.Repeat([]byte{2}, 30)
+	require.NoError(t, cache.Put(ctx, tx, 2, witness2))
+	cached, err = cache.Get(ctx, tx, 1)
+	require.NoError(t, err)
+	require.Nil(t, cached, "the lowest batch should have been evicted")
+	cached, err = cache.Get(ctx, tx, 2)
+	require.NoError(t, err)
+	require.Equal(t, witness2, cached)
+
+	require.ErrorIs(t, cache.Put(ctx, tx, 3, bytes.Repeat([]byte{3}, 80)), errWitnessTooLarge)
+	require.Error(t, cache.Put(ctx, tx, 4, witness1), "batch without blocks")
+
+	// the cache and its size survive a restart
+	cache.Close()
+	cache, err = OpenCache(ctx, dir, 100*datasize.B)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	highest, found, err := cache.Highest(ctx)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(2), highest)
+
+	// replacing a witness accounts for the size of the old one
+	require.NoError(t, cache.Put(ctx, tx, 2, witness1))
+	cached, err = cache.Get(ctx, tx, 2)
+	require.NoError(t, err)
+	require.Equal(t, witness1, cached)
+
+	// a witness for blocks that were unwound isn't served
+	require.NoError(t, rawdb.WriteCanonicalHash(tx, libcommon.BytesToHash([]byte{0xff}), 2))
+	cached, err = cache.Get(ctx, tx, 2)
+	require.NoError(t, err)
+	require.Nil(t, cached)
+}
+
+func TestCacheBlocks(t *testing.T) {
+	ctx := context.Background()
+	tx := memdb.BeginRw(t, memdb.NewTestDB(t))
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+	for blockNo := uint64(1); blockNo <= 3; blockNo++ {
+		require.NoError(t, hermez_db.NewHermezDb(tx).WriteBlockBatch(blockNo, 1))
+		require.NoError(t, rawdb.WriteCanonicalHash(tx, libcommon.BytesToHash([]byte{byte(blockNo)}), blockNo))
+	}
+
+	cache, err := OpenCache(ctx, t.TempDir(), 100*datasize.B)
+	require.NoError(t, err)
+	defer cache.Close()
+
+	witness := bytes.Repeat([]byte{1}, 30)
+	require.NoError(t, cache.PutBlocks(ctx, tx, 1, 2, witness))
+	cached, err := cache.GetBlocks(ctx, tx, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, witness, cached)
+	cached, err = cache.GetBlocks(ctx, tx, 1, 3)
+	require.NoError(t, err)
+	require.Nil(t, cached)
+
+	// block ranges go before the batches when the cache is full
+	require.NoError(t, cache.Put(ctx, tx, 1, witness))
+	cached, err = cache.GetBlocks(ctx, tx, 1, 2)
+	require.NoError(t, err)
+	require.Nil(t, cached)
+	cached, err = cache.Get(ctx, tx, 1)
+	require.NoError(t, err)
+	require.Equal(t, witness, cached)
+
+	require.NoError(t, cache.PutBlocks(ctx, tx, 3, 3, witness[:10]))
+	require.NoError(t, cache.DeleteBlocks(ctx, 3, 3))
+	cached, err = cache.GetBlocks(ctx, tx, 3, 3)
+	require.NoError(t, err)
+	require.Nil(t, cached)
+	require.Error(t, cache.PutBlocks(ctx, tx, 4, 4, witness), "block not in chaindata")
+}
@@ -0,0 +1,153 @@
+package witness
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/metrics"
+	"github.com/ledgerwatch/erigon/eth/stagedsync/stages"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var pregeneratedWitnesses = metrics.GetOrCreateCounter(`witness_cache_pregenerated`)
+
+// Pregenerator fills the witness cache in the background with the witnesses of the batches the node has closed, so
+// RPC requests for recent batches don't have to wait for the witness to be generated
+type Pregenerator struct {
+	db          kv.RoDB
+	cache       *Cache
+	generator   *Generator
+	witnessFull bool
+	interval    time.Duration
+
+	// next is the next batch to generate the witness of, 0 until the first pass has picked a starting point
+	next uint64
+}
+
+func NewPregenerator(db kv.RoDB, cache *Cache, generator *Generator, witnessFull bool, interval time.Duration) *Pregenerator {
+	return &Pregenerator{
+		db:          db,
+		cache:       cache,
+		generator:   generator,
+		witnessFull: witnessFull,
+		interval:    interval,
+	}
+}
+
+// Run generates the witnesses of newly closed batches every interval until the context is cancelled
+func (p *Pregenerator) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.generateClosedBatches(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Warn("[Witness cache] Failed to pre-generate witnesses", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// generateClosedBatches generates the witnesses of the closed batches that haven't been cached since the last pass.
+// On the first pass it carries on after the highest cached batch, or starts with the latest closed batch on an empty
+// cache rather than going through the whole chain
+func (p *Pregenerator) generateClosedBatches(ctx context.Context) error {
+	highest, found, err := p.highestClosedBatch(ctx)
+	if err != nil || !found {
+		return err
+	}
+
+	if p.next == 0 {
+		p.next = highest
+		cached, found, err := p.cache.Highest(ctx)
+		if err != nil {
+			return err
+		}
+		if found && cached < highest {
+			p.next = cached + 1
+		}
+	}
+	if p.next > highest+1 {
+		// the node unwound, the batches closed again from here on need new witnesses
+		p.next = highest
+	}
+
+	for ; p.next <= highest; p.next++ {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = p.generate(ctx, p.next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pregenerator) generate(ctx context.Context, batchNo uint64) error {
+	tx, err := p.db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// invalid batches have no blocks in chaindata, the RPC forwards them to the sequencer
+	if _, ok, err := lastBlockHash(tx, batchNo); err != nil || !ok {
+		return err
+	}
+
+	cached, err := p.cache.get(ctx, tx, batchNo)
+	if err != nil || cached != nil {
+		return err
+	}
+
+	start := time.Now()
+	witness, err := p.generator.GetWitnessByBatch(tx, ctx, batchNo, false, p.witnessFull)
+	if err != nil {
+		return err
+	}
+	if err = p.cache.Put(ctx, tx, batchNo, witness); err != nil {
+		if errors.Is(err, errWitnessTooLarge) {
+			log.Warn("[Witness cache] Witness doesn't fit in the cache", "batch", batchNo, "size", len(witness))
+			return nil
+		}
+		return err
+	}
+
+	pregeneratedWitnesses.Inc()
+	log.Debug("[Witness cache] Pre-generated witness", "batch", batchNo, "size", len(witness), "took", time.Since(start))
+	return nil
+}
+
+// highestClosedBatch returns the batch before the one holding the last block the node has finished syncing, which may
+// still be open
+func (p *Pregenerator) highestClosedBatch(ctx context.Context) (uint64, bool, error) {
+	tx, err := p.db.BeginRo(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	blockNo, err := stages.GetStageProgress(tx, stages.Finish)
+	if err != nil {
+		return 0, false, err
+	}
+	batchNo, err := hermez_db.NewHermezDbReader(tx).GetBatchNoByL2Block(blockNo)
+	if err != nil {
+		if errors.Is(err, hermez_db.ErrorNotStored) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if batchNo < 2 {
+		// batch 0 is the genesis and batch 1 is the first one that can be open
+		return 0, false, nil
+	}
+	return batchNo - 1, true, nil
+}
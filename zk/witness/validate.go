@@ -0,0 +1,200 @@
+package witness
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+)
+
+// NodeKind is the kind of state a witness node holds
+type NodeKind string
+
+const (
+	AccountNode NodeKind = "account"
+	StorageNode NodeKind = "storage"
+	CodeNode    NodeKind = "code"
+)
+
+var leafTypeNames = map[int]string{
+	utils.KEY_BALANCE: "balance",
+	utils.KEY_NONCE:   "nonce",
+	utils.SC_CODE:     "codeHash",
+	utils.SC_LENGTH:   "codeLength",
+	utils.SC_STORAGE:  "storage",
+}
+
+// WitnessNode is an account, storage or code node of a witness, the hash nodes standing in for the subtrees a witness
+// leaves out aren't state and are never reported
+type WitnessNode struct {
+	Kind NodeKind
+	// LeafType is the SMT leaf type of account and storage nodes: balance, nonce, code hash, code length or storage
+	LeafType   int
+	Address    libcommon.Address
+	StorageKey libcommon.Hash
+	// CodeHash is the hash the SMT keeps for the code of code nodes
+	CodeHash libcommon.Hash
+	Value    []byte
+}
+
+func (n WitnessNode) key() string {
+	switch n.Kind {
+	case CodeNode:
+		return string(n.Kind) + n.CodeHash.Hex()
+	case StorageNode:
+		return string(n.Kind) + n.Address.Hex() + n.StorageKey.Hex()
+	default:
+		return fmt.Sprintf("%s%s%d", n.Kind, n.Address.Hex(), n.LeafType)
+	}
+}
+
+func (n WitnessNode) String() string {
+	switch n.Kind {
+	case CodeNode:
+		return fmt.Sprintf("code %s (%d bytes)", n.CodeHash.Hex(), len(n.Value))
+	case StorageNode:
+		return fmt.Sprintf("storage %s %s = 0x%x", n.Address.Hex(), n.StorageKey.Hex(), n.Value)
+	default:
+		return fmt.Sprintf("account %s %s = 0x%x", n.Address.Hex(), leafTypeNames[n.LeafType], n.Value)
+	}
+}
+
+// NodeMismatch is a node both witnesses hold with different values
+type NodeMismatch struct {
+	Node      WitnessNode
+	Reference []byte
+}
+
+// Diff lists the nodes a witness is missing or has on top of a reference witness, and the nodes they disagree on
+type Diff struct {
+	Missing    []WitnessNode
+	Extra      []WitnessNode
+	Mismatched []NodeMismatch
+}
+
+func (d *Diff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Mismatched) == 0
+}
+
+// ParseWitness decodes a witness as returned by the generator
+func ParseWitness(data []byte) (*trie.Witness, error) {
+	return trie.NewWitnessFromReader(bytes.NewReader(data), false)
+}
+
+// WitnessRoot re-derives the root of the state tree from the SMT nodes of the witness
+func WitnessRoot(w *trie.Witness) (libcommon.Hash, error) {
+	tree, err := smt.BuildSMTfromWitness(w)
+	if err != nil {
+		return libcommon.Hash{}, err
+	}
+	root, err := tree.Db.GetLastRoot()
+	if err != nil {
+		return libcommon.Hash{}, err
+	}
+	return libcommon.BigToHash(root), nil
+}
+
+// PreBatchStateRoot returns the state root the witness of the batch must have, the root hermez_stateRoots holds for the
+// last block of the previous batch or the root of its header when the table has none, along with that block
+func PreBatchStateRoot(tx kv.Tx, batchNo uint64) (libcommon.Hash, uint64, error) {
+	if batchNo == 0 {
+		return libcommon.Hash{}, 0, fmt.Errorf("batch 0 has no previous batch")
+	}
+	hermezDb := hermez_db.NewHermezDbReader(tx)
+	blockNo, found, err := hermezDb.GetHighestBlockInBatch(batchNo - 1)
+	if err != nil {
+		return libcommon.Hash{}, 0, err
+	}
+	if !found {
+		return libcommon.Hash{}, 0, fmt.Errorf("no blocks found for batch %d", batchNo-1)
+	}
+
+	root, err := hermezDb.GetStateRoot(blockNo)
+	if err != nil {
+		return libcommon.Hash{}, 0, err
+	}
+	if root != (libcommon.Hash{}) {
+		return root, blockNo, nil
+	}
+
+	header := rawdb.ReadHeaderByNumber(tx, blockNo)
+	if header == nil {
+		return libcommon.Hash{}, 0, fmt.Errorf("no header found for block %d", blockNo)
+	}
+	return header.Root, blockNo, nil
+}
+
+// WitnessNodes returns the account, storage and code nodes of the witness
+func WitnessNodes(w *trie.Witness) []WitnessNode {
+	nodes := make([]WitnessNode, 0, len(w.Operators))
+	for _, operator := range w.Operators {
+		switch op := operator.(type) {
+		case *trie.OperatorSMTLeafValue:
+			node := WitnessNode{
+				Kind:     AccountNode,
+				LeafType: int(op.NodeType),
+				Address:  libcommon.BytesToAddress(op.Address),
+				Value:    op.Value,
+			}
+			if node.LeafType == utils.SC_STORAGE {
+				node.Kind = StorageNode
+				node.StorageKey = libcommon.BytesToHash(op.StorageKey)
+			}
+			nodes = append(nodes, node)
+		case *trie.OperatorCode:
+			nodes = append(nodes, WitnessNode{
+				Kind:     CodeNode,
+				CodeHash: libcommon.HexToHash(utils.HashContractBytecode(hex.EncodeToString(op.Code))),
+				Value:    op.Code,
+			})
+		}
+	}
+	return nodes
+}
+
+// DiffWitnesses compares the state nodes of the witness with those of the reference witness, e.g. a full witness of
+// the same batch or the witness another node generated for it
+func DiffWitnesses(w, reference *trie.Witness) *Diff {
+	ours := make(map[string]WitnessNode)
+	for _, node := range WitnessNodes(w) {
+		ours[node.key()] = node
+	}
+	theirs := make(map[string]WitnessNode)
+	for _, node := range WitnessNodes(reference) {
+		theirs[node.key()] = node
+	}
+
+	diff := &Diff{}
+	for key, node := range theirs {
+		if _, ok := ours[key]; !ok {
+			diff.Missing = append(diff.Missing, node)
+		}
+	}
+	for key, node := range ours {
+		ref, ok := theirs[key]
+		if !ok {
+			diff.Extra = append(diff.Extra, node)
+			continue
+		}
+		if !bytes.Equal(node.Value, ref.Value) {
+			diff.Mismatched = append(diff.Mismatched, NodeMismatch{Node: node, Reference: ref.Value})
+		}
+	}
+
+	sortNodes(diff.Missing)
+	sortNodes(diff.Extra)
+	sort.Slice(diff.Mismatched, func(i, j int) bool { return diff.Mismatched[i].Node.key() < diff.Mismatched[j].Node.key() })
+	return diff
+}
+
+func sortNodes(nodes []WitnessNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].key() < nodes[j].key() })
+}
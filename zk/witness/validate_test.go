@@ -0,0 +1,114 @@
+package witness
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	libcommon "github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon/core/rawdb"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/smt/pkg/smt"
+	"github.com/ledgerwatch/erigon/smt/pkg/utils"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+	"github.com/ledgerwatch/erigon/zk/hermez_db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateWitness(t *testing.T) {
+	contract := libcommon.HexToAddress("0x71dd1027069078091B3ca48093B00E4735B20624")
+	code := []byte{0x60, 0x01, 0x60, 0x02}
+
+	s := smt.NewSMT(nil, false)
+	_, err := s.SetAccountState(contract.String(), big.NewInt(1000), big.NewInt(1))
+	require.NoError(t, err)
+	require.NoError(t, s.SetContractBytecode(contract.String(), hex.EncodeToString(code)))
+	require.NoError(t, s.Db.AddCode(code))
+	_, err = s.SetContractStorage(contract.String(), map[string]string{
+		libcommon.HexToHash("0x1").String(): "0x2a",
+		libcommon.HexToHash("0x2").String(): "0x2b",
+	}, nil)
+	require.NoError(t, err)
+
+	full, err := smt.BuildWitness(s, nil, context.Background())
+	require.NoError(t, err)
+
+	data, err := getWitnessBytes(full, false)
+	require.NoError(t, err)
+	w, err := ParseWitness(data)
+	require.NoError(t, err)
+
+	expectedRoot, err := s.Db.GetLastRoot()
+	require.NoError(t, err)
+	root, err := WitnessRoot(w)
+	require.NoError(t, err)
+	require.Equal(t, libcommon.BigToHash(expectedRoot), root)
+
+	require.True(t, DiffWitnesses(w, full).Empty())
+
+	// drop a storage slot and the code, change the balance and add a node the full witness doesn't have
+	var operators []trie.WitnessOperator
+	for _, operator := range w.Operators {
+		switch op := operator.(type) {
+		case *trie.OperatorCode:
+			continue
+		case *trie.OperatorSMTLeafValue:
+			if op.NodeType == utils.SC_STORAGE && libcommon.BytesToHash(op.StorageKey) == libcommon.HexToHash("0x1") {
+				continue
+			}
+			if op.NodeType == utils.KEY_BALANCE {
+				operator = &trie.OperatorSMTLeafValue{NodeType: op.NodeType, Address: op.Address, StorageKey: op.StorageKey, Value: []byte{0x01}}
+			}
+		}
+		operators = append(operators, operator)
+	}
+	extra := libcommon.HexToAddress("0x01")
+	operators = append(operators, &trie.OperatorSMTLeafValue{NodeType: utils.KEY_NONCE, Address: extra.Bytes(), StorageKey: libcommon.Hash{}.Bytes(), Value: []byte{0x05}})
+
+	diff := DiffWitnesses(trie.NewWitness(operators), full)
+	require.False(t, diff.Empty())
+
+	require.Len(t, diff.Missing, 2)
+	require.Equal(t, CodeNode, diff.Missing[0].Kind)
+	require.Equal(t, code, diff.Missing[0].Value)
+	require.Equal(t, StorageNode, diff.Missing[1].Kind)
+	require.Equal(t, libcommon.HexToHash("0x1"), diff.Missing[1].StorageKey)
+
+	require.Len(t, diff.Extra, 1)
+	require.Equal(t, WitnessNode{Kind: AccountNode, LeafType: utils.KEY_NONCE, Address: extra, Value: []byte{0x05}}, diff.Extra[0])
+
+	require.Len(t, diff.Mismatched, 1)
+	require.Equal(t, utils.KEY_BALANCE, diff.Mismatched[0].Node.LeafType)
+	require.Equal(t, []byte{0x01}, diff.Mismatched[0].Node.Value)
+	require.Equal(t, big.NewInt(1000).Bytes(), diff.Mismatched[0].Reference)
+}
+
+func TestPreBatchStateRoot(t *testing.T) {
+	tx := memdb.BeginRw(t, memdb.NewTestDB(t))
+	require.NoError(t, hermez_db.CreateHermezBuckets(tx))
+
+	hermezDb := hermez_db.NewHermezDb(tx)
+	require.NoError(t, hermezDb.WriteBlockBatch(1, 1))
+	require.NoError(t, hermezDb.WriteBlockBatch(2, 1))
+	require.NoError(t, hermezDb.WriteBlockBatch(3, 2))
+
+	_, _, err := PreBatchStateRoot(tx, 4)
+	require.Error(t, err, "previous batch without blocks")
+
+	// without a root in hermez_stateRoots the header root is used
+	header := &types.Header{Number: big.NewInt(2), Root: libcommon.HexToHash("0xaa")}
+	rawdb.WriteHeader(tx, header)
+	require.NoError(t, rawdb.WriteCanonicalHash(tx, header.Hash(), 2))
+
+	root, blockNo, err := PreBatchStateRoot(tx, 2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), blockNo)
+	require.Equal(t, header.Root, root)
+
+	require.NoError(t, hermezDb.WriteStateRoot(2, libcommon.HexToHash("0xbb")))
+	root, _, err = PreBatchStateRoot(tx, 2)
+	require.NoError(t, err)
+	require.Equal(t, libcommon.HexToHash("0xbb"), root)
+}